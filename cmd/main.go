@@ -12,13 +12,26 @@ import (
 	"time"
 
 	"github.com/CoolE88/data-aggregation-service/internal/aggregator"
+	"github.com/CoolE88/data-aggregation-service/internal/alert"
+	"github.com/CoolE88/data-aggregation-service/internal/anomaly"
+	"github.com/CoolE88/data-aggregation-service/internal/archive"
 	"github.com/CoolE88/data-aggregation-service/internal/config"
+	"github.com/CoolE88/data-aggregation-service/internal/dedup"
+	"github.com/CoolE88/data-aggregation-service/internal/derived"
 	"github.com/CoolE88/data-aggregation-service/internal/domain"
 	appgrpc "github.com/CoolE88/data-aggregation-service/internal/grpc"
 	apphttp "github.com/CoolE88/data-aggregation-service/internal/http"
 	applogger "github.com/CoolE88/data-aggregation-service/internal/logger"
+	"github.com/CoolE88/data-aggregation-service/internal/partition"
+	"github.com/CoolE88/data-aggregation-service/internal/recompute"
 	"github.com/CoolE88/data-aggregation-service/internal/repository/postgres"
+	"github.com/CoolE88/data-aggregation-service/internal/schema"
 	"github.com/CoolE88/data-aggregation-service/internal/service"
+	"github.com/CoolE88/data-aggregation-service/internal/signing"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+	"github.com/CoolE88/data-aggregation-service/internal/timepolicy"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
+	"github.com/CoolE88/data-aggregation-service/internal/window"
 	"github.com/CoolE88/data-aggregation-service/pkg/utils"
 
 	"go.uber.org/zap"
@@ -59,8 +72,259 @@ func main() {
 	// Инициализация сервиса
 	dataService := service.NewDataService(repo, logger)
 
+	// Валидация пакетов перед обработкой
+	validator, err := validation.NewValidator(validation.Rules{
+		EmptyPayload:     validation.EmptyPayloadPolicy(cfg.Validation.EmptyPayloadPolicy),
+		MinPayloadLength: cfg.Validation.MinPayloadLength,
+		MaxPayloadLength: cfg.Validation.MaxPayloadLength,
+		MinValue:         cfg.Validation.MinValue,
+		MaxValue:         cfg.Validation.MaxValue,
+		RejectZeroUUID:   cfg.Validation.RejectZeroUUID,
+	})
+	if err != nil {
+		logger.Error("Invalid validation configuration", zap.Error(err))
+		return
+	}
+
+	// Фоновые задачи, которые нужно дождаться до закрытия репозитория
+	var jobs sync.WaitGroup
+
+	// Месячные партиции processed_packets создаются до приёма первых пакетов
+	partitionManager := partition.NewManager(repo, partition.Config{
+		MonthsAhead:       cfg.Partition.MonthsAhead,
+		MinRunway:         cfg.Partition.MinRunway,
+		MaintenancePeriod: cfg.Partition.MaintenanceInterval,
+		RetentionMonths:   cfg.Partition.RetentionMonths,
+		RetentionDryRun:   cfg.Partition.RetentionDryRun,
+		ExportDir:         cfg.Partition.ExportDir,
+		DetachLockTimeout: cfg.Partition.DetachLockTimeout,
+	}, logger)
+	if err := partitionManager.EnsurePartitions(ctx); err != nil {
+		logger.Error("Failed to prepare processed_packets partitions", zap.Error(err))
+		return
+	}
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		partitionManager.Run(ctx)
+	}()
+
+	// Дедупликация повторно присланных пакетов
+	deduplicator := dedup.NewDeduplicator(repo, dedup.Config{
+		TTL:             cfg.Dedup.TTL,
+		CacheSize:       cfg.Dedup.CacheSize,
+		CleanupInterval: cfg.Dedup.CleanupInterval,
+	}, logger)
+	dataService.SetDedupFilter(deduplicator)
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		deduplicator.Run(ctx)
+	}()
+
+	// Окна событийного времени
+	if cfg.Window.Enabled {
+		windowManager, err := window.NewManager("max_per_window", window.Config{
+			Size:               cfg.Window.Size,
+			Slide:              cfg.Window.Slide,
+			WatermarkDelay:     cfg.Window.WatermarkDelay,
+			AllowedLateness:    cfg.Window.AllowedLateness,
+			CheckpointInterval: cfg.Window.CheckpointInterval,
+		}, repo, repo, logger)
+		if err != nil {
+			logger.Error("Invalid window configuration", zap.Error(err))
+			return
+		}
+		if err := windowManager.Restore(ctx); err != nil {
+			logger.Error("Failed to restore window state", zap.Error(err))
+			return
+		}
+		dataService.AddObserver(windowManager)
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			windowManager.Run(ctx)
+		}()
+		logger.Info("Event-time windowing enabled", zap.Duration("size", cfg.Window.Size))
+	}
+
+	// Архив сырых пейлоадов
+	if cfg.RawArchive.Enabled {
+		archiver := archive.NewArchiver(repo, archive.Config{
+			Retention:       cfg.RawArchive.Retention,
+			PartitionsAhead: cfg.RawArchive.PartitionsAhead,
+		}, logger)
+		if err := archiver.Maintain(ctx); err != nil {
+			logger.Error("Failed to prepare raw archive partitions", zap.Error(err))
+			return
+		}
+		dataService.AddObserver(archiver)
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			archiver.Run(ctx)
+		}()
+		logger.Info("Raw payload archival enabled", zap.Duration("retention", cfg.RawArchive.Retention))
+	}
+
+	// Пороговые алерты
+	notifier := alert.NewWebhookNotifier(alert.WebhookConfig{
+		DefaultURLs:  cfg.Alert.WebhookURLs,
+		Timeout:      cfg.Alert.WebhookTimeout,
+		MaxRetries:   cfg.Alert.WebhookMaxRetries,
+		RetryBackoff: cfg.Alert.WebhookRetryBackoff,
+		Workers:      cfg.Alert.WebhookWorkers,
+	}, logger)
+	alertEngine := alert.NewEngine(repo, notifier, logger)
+	alertEngine.SetAllowedWebhookHosts(cfg.Alert.WebhookAllowedHosts)
+	if err := alertEngine.Load(ctx); err != nil {
+		logger.Error("Failed to load alert rules", zap.Error(err))
+		return
+	}
+	dataService.AddObserver(alertEngine)
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		notifier.Run(ctx)
+	}()
+
+	// Производные метрики по источникам
+	derivedDefinitions, err := derived.ParseDefinitions(cfg.Derived.Metrics)
+	if err != nil {
+		logger.Error("Invalid derived metrics configuration", zap.Error(err))
+		return
+	}
+	derivedEngine, err := derived.NewEngine(repo, derivedDefinitions, logger)
+	if err != nil {
+		logger.Error("Invalid derived metrics configuration", zap.Error(err))
+		return
+	}
+	if err := derivedEngine.Load(ctx); err != nil {
+		logger.Error("Failed to load derived metrics", zap.Error(err))
+		return
+	}
+	dataService.AddEnricher(derivedEngine)
+
+	// Детектор аномалий по источникам
+	var anomalyDetector *anomaly.Detector
+	if cfg.Anomaly.Enabled {
+		anomalyDetector, err = anomaly.NewDetector(repo, notifier, domain.AnomalyParams{
+			Method:     domain.AnomalyMethod(cfg.Anomaly.Method),
+			Alpha:      cfg.Anomaly.Alpha,
+			Threshold:  cfg.Anomaly.Threshold,
+			WarmUp:     cfg.Anomaly.WarmUp,
+			WindowSize: cfg.Anomaly.WindowSize,
+			Notify:     cfg.Anomaly.Notify,
+		}, logger)
+		if err != nil {
+			logger.Error("Invalid anomaly detector configuration", zap.Error(err))
+			return
+		}
+		if err := anomalyDetector.Restore(ctx); err != nil {
+			logger.Error("Failed to restore anomaly detector state", zap.Error(err))
+			return
+		}
+		dataService.AddEnricher(anomalyDetector)
+		dataService.AddObserver(anomalyDetector)
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			anomalyDetector.Run(ctx, cfg.Anomaly.CheckpointInterval)
+		}()
+		logger.Info("Anomaly detection enabled", zap.String("method", cfg.Anomaly.Method))
+	}
+
+	// Арендаторы: аутентификация по API-ключам и квоты приёма
+	apiKeys, err := tenant.ParseAPIKeys(cfg.Tenant.APIKeys)
+	if err != nil {
+		logger.Error("Invalid tenant API keys", zap.Error(err))
+		return
+	}
+	tenantQuotas, err := tenant.ParseQuotas(cfg.Tenant.Quotas)
+	if err != nil {
+		logger.Error("Invalid tenant quotas", zap.Error(err))
+		return
+	}
+	authenticator := tenant.NewAuthenticator(apiKeys, cfg.Tenant.AdminTenant, cfg.Tenant.AuthDisabled)
+	switch {
+	case authenticator.Enabled() && cfg.Tenant.AuthDisabled:
+		logger.Error("AUTH_DISABLED cannot be combined with TENANT_API_KEYS")
+		return
+	case cfg.Tenant.AuthDisabled:
+		logger.Warn("AUTH_DISABLED is set, all requests use the default tenant and admin routes are open")
+	case !authenticator.Enabled():
+		logger.Warn("TENANT_API_KEYS is empty, all requests use the default tenant and admin routes are closed")
+	}
+	quotaEnforcer := tenant.NewQuotaEnforcer(dataService, repo, tenant.QuotaConfig{
+		Default:         tenant.Quota{IngestRate: cfg.Tenant.IngestRate, MaxRows: cfg.Tenant.MaxRows},
+		Tenants:         tenantQuotas,
+		RefreshInterval: cfg.Tenant.RowsRefreshInterval,
+	}, logger)
+	if err := quotaEnforcer.Refresh(ctx); err != nil {
+		logger.Error("Failed to count tenant rows", zap.Error(err))
+		return
+	}
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		quotaEnforcer.Run(ctx)
+	}()
+
+	// Реестр версионированных схем пакетов по источникам
+	schemaRegistry := schema.NewRegistry(repo, logger)
+	if err := schemaRegistry.Load(ctx); err != nil {
+		logger.Error("Failed to load packet schemas", zap.Error(err))
+		return
+	}
+
+	// Проверка времени устройства относительно времени приёма
+	timePolicy, err := timepolicy.NewProcessor(quotaEnforcer, repo, timepolicy.Config{
+		Policy:    timepolicy.Policy(cfg.Timestamp.Policy),
+		MaxPast:   cfg.Timestamp.MaxPast,
+		MaxFuture: cfg.Timestamp.MaxFuture,
+	}, logger)
+	if err != nil {
+		logger.Error("Invalid timestamp policy configuration", zap.Error(err))
+		return
+	}
+
+	// Ключи проверки подписей пакетов по источникам
+	signingRegistry := signing.NewRegistry(repo, cfg.Signing.Required, logger)
+	if err := signingRegistry.Load(ctx); err != nil {
+		logger.Error("Failed to load signing keys", zap.Error(err))
+		return
+	}
+
+	// Пакеты проверяются по схеме источника, затем проходят валидацию, проверку времени и квоты арендатора
+	verifiedProcessor := schema.NewProcessor(
+		validation.NewValidatingProcessor(timePolicy, validator, logger),
+		schemaRegistry, cfg.Schema.Required, logger)
+	// Подпись клиентских пакетов проверяется до любых изменений пакета
+	processor := signing.NewProcessor(verifiedProcessor, signingRegistry, logger)
+
 	// Запуск HTTP сервера
 	httpServer := apphttp.NewHTTPServer(cfg.RESTPort, dataService, logger)
+	httpServer.SetAuthenticator(authenticator)
+	httpServer.RegisterIngestRoutes(processor)
+	httpServer.RegisterQuarantineRoutes(timePolicy)
+
+	// Пересчёт результатов по архиву сырых пейлоадов
+	recomputeManager := recompute.NewManager(repo, logger)
+	if err := recomputeManager.Restore(ctx); err != nil {
+		logger.Error("Failed to restore recompute jobs", zap.Error(err))
+		return
+	}
+	httpServer.RegisterRecomputeRoutes(recomputeManager)
+	httpServer.RegisterAlertRoutes(alertEngine)
+	httpServer.RegisterDerivedRoutes(derivedEngine)
+	httpServer.RegisterSchemaRoutes(schemaRegistry)
+	httpServer.RegisterSigningRoutes(signingRegistry)
+	httpServer.RegisterPartitionRoutes(partitionManager)
+	httpServer.AddHealthReporter(partitionManager)
+	if anomalyDetector != nil {
+		httpServer.RegisterAnomalyRoutes(anomalyDetector)
+	}
+
 	go func() {
 		if err := httpServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.Error("HTTP server failed", zap.Error(err))
@@ -70,6 +334,8 @@ func main() {
 
 	// Запуск GRPC сервера
 	grpcServer := appgrpc.NewGRPCServer(dataService, logger)
+	grpcServer.SetAuthenticator(authenticator)
+	grpcServer.SetAlertService(alertEngine)
 	go func() {
 		if err := grpcServer.Start(cfg.GRPCPort); err != nil {
 			logger.Error("gRPC server failed", zap.Error(err))
@@ -77,9 +343,9 @@ func main() {
 		}
 	}()
 
-	// Инициализация агрегатора
+	// Инициализация агрегатора. Подпись проверяется до постановки пакета в очередь.
 	packets := make(chan *domain.DataPacket, 1000)
-	aggregator := aggregator.NewAggregator(dataService, cfg.WorkerCount, logger)
+	aggregator := aggregator.NewAggregator(verifiedProcessor, cfg.WorkerCount, logger)
 
 	// Запускаем агрегатор
 	go func() {
@@ -116,9 +382,14 @@ func main() {
 				}
 				packet := &domain.DataPacket{
 					ID:        utils.NewUUID(),
+					TenantID:  domain.DefaultTenantID,
 					Timestamp: timeGenerator.Generate(),
 					Payload:   utils.GenerateRandomPayload(10),
 				}
+				if err := signingRegistry.Verify(packet); err != nil {
+					logger.Warn("Generated packet rejected by signature verification", zap.Error(err))
+					continue
+				}
 
 				select {
 				case packets <- packet:
@@ -152,6 +423,8 @@ func main() {
 	aggregator.Stop()
 	aggregator.Wait() // Дождаться завершения воркеров
 	wg.Wait()         // Дождаться генератора
+	jobs.Wait()       // Дождаться фоновых задач
+	recomputeManager.Stop()
 
 	// Graceful shutdown
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
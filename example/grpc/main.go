@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"time"
 
@@ -41,6 +42,10 @@ func main() {
 	// Тест 3: Ошибки валидации
 	fmt.Println("\n=== Test 3: Validation Errors ===")
 	testValidationErrors(ctx, client)
+
+	// Тест 4: StreamMaxValuesByPeriod
+	fmt.Println("\n=== Test 4: StreamMaxValuesByPeriod ===")
+	testStreamMaxValuesByPeriod(ctx, client)
 }
 
 func testGetMaxValuesByPeriod(ctx context.Context, client pb.DataAggregationServiceClient) {
@@ -50,22 +55,65 @@ func testGetMaxValuesByPeriod(ctx context.Context, client pb.DataAggregationServ
 	req := &pb.TimePeriod{
 		StartTime: startTime,
 		EndTime:   endTime,
+		PageSize:  100,
 	}
 
-	resp, err := client.GetMaxValuesByPeriod(ctx, req)
-	if err != nil {
-		if st, ok := status.FromError(err); ok {
-			log.Printf("gRPC error: %s (code: %s)", st.Message(), st.Code())
-		} else {
-			log.Printf("Error: %v", err)
+	// Страницы запрашиваются, пока сервер возвращает токен следующей. Без page_size сервер отдаёт
+	// не больше 1000 строк, а токен принимается только с теми же периодом и фильтрами.
+	found := 0
+	for {
+		resp, err := client.GetMaxValuesByPeriod(ctx, req)
+		if err != nil {
+			if st, ok := status.FromError(err); ok {
+				log.Printf("gRPC error: %s (code: %s)", st.Message(), st.Code())
+			} else {
+				log.Printf("Error: %v", err)
+			}
+			return
+		}
+
+		for _, val := range resp.MaxValues {
+			found++
+			fmt.Printf("%d. ID: %s, MaxValue: %d\n", found, val.Id, val.MaxValueInt64)
+		}
+		if resp.NextPageToken == "" {
+			break
 		}
+		req.PageToken = resp.NextPageToken
+	}
+
+	fmt.Printf("Found %d max values\n", found)
+}
+
+func testStreamMaxValuesByPeriod(ctx context.Context, client pb.DataAggregationServiceClient) {
+	stream, err := client.StreamMaxValuesByPeriod(ctx, &pb.TimePeriod{
+		StartTime: time.Now().Add(-24 * time.Hour).Format(time.RFC3339),
+		EndTime:   time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("Error: %v", err)
 		return
 	}
 
-	fmt.Printf("Found %d max values:\n", len(resp.MaxValues))
-	for i, val := range resp.MaxValues {
-		fmt.Printf("%d. ID: %s, MaxValue: %d\n", i+1, val.Id, val.MaxValue)
+	// Результаты приходят по мере чтения из базы, без загрузки всей выборки в память
+	received := 0
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if st, ok := status.FromError(err); ok {
+				log.Printf("gRPC error: %s (code: %s)", st.Message(), st.Code())
+			} else {
+				log.Printf("Error: %v", err)
+			}
+			return
+		}
+		received++
 	}
+
+	fmt.Printf("Streamed %d max values\n", received)
 }
 
 func testGetMaxValueByID(ctx context.Context, client pb.DataAggregationServiceClient) {
@@ -87,7 +135,7 @@ func testGetMaxValueByID(ctx context.Context, client pb.DataAggregationServiceCl
 		return
 	}
 
-	fmt.Printf("Found packet: ID=%s, MaxValue=%d\n", resp.Id, resp.MaxValue)
+	fmt.Printf("Found packet: ID=%s, MaxValue=%d\n", resp.Id, resp.MaxValueInt64)
 }
 
 func testValidationErrors(ctx context.Context, client pb.DataAggregationServiceClient) {
@@ -2,6 +2,7 @@ package aggregator
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
@@ -87,10 +88,14 @@ func (a *Aggregator) worker(ctx context.Context, packets chan *domain.DataPacket
 			duration := time.Since(start).Seconds()
 			metrics.AggregatorPacketProcessingTime.Observe(duration)
 
-			if err != nil {
+			switch {
+			case errors.Is(err, domain.ErrPacketQuarantined):
+				// Пакет сохранён в карантин и не считается ошибкой обработки
+				a.logger.Debug("Packet quarantined", zap.String("packet_id", packet.ID.String()), zap.Int("worker_id", id))
+			case err != nil:
 				metrics.AggregatorPacketsFailed.Inc()
 				a.logger.Error("Failed to process packet", zap.Error(err), zap.Int("worker_id", id))
-			} else {
+			default:
 				metrics.AggregatorPacketsProcessed.Inc()
 				a.logger.Debug("Packet processed", zap.Duration("duration", time.Duration(duration*float64(time.Second))), zap.Int("worker_id", id))
 			}
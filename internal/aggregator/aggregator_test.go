@@ -33,12 +33,12 @@ func TestAggregator_Start(t *testing.T) {
 	packet1 := &domain.DataPacket{
 		ID:        uuid.New(),
 		Timestamp: time.Now(),
-		Payload:   []int{1, 2, 3},
+		Payload:   []int64{1, 2, 3},
 	}
 	packet2 := &domain.DataPacket{
 		ID:        uuid.New(),
 		Timestamp: time.Now(),
-		Payload:   []int{4, 5, 6},
+		Payload:   []int64{4, 5, 6},
 	}
 
 	mockService.On("ProcessPacket", mock.Anything, packet1).Return(nil)
@@ -0,0 +1,444 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	maxForPackets    = 100000
+	maxWindowSeconds = 7 * 24 * 60 * 60
+)
+
+var (
+	// ErrInvalidRule возвращается для некорректного правила
+	ErrInvalidRule = errors.New("invalid alert rule")
+	// ErrRuleNotFound возвращается, если правила нет
+	ErrRuleNotFound = errors.New("alert rule not found")
+)
+
+// Store хранилище правил и истории срабатываний
+type Store interface {
+	// ListAlertRules возвращает правила всех арендаторов для загрузки движка
+	ListAlertRules(ctx context.Context) ([]*domain.AlertRule, error)
+	SaveAlertRule(ctx context.Context, rule *domain.AlertRule) error
+	DeleteAlertRule(ctx context.Context, tenantID string, id uuid.UUID) (bool, error)
+	SaveAlertEvent(ctx context.Context, event *domain.AlertEvent) error
+	// GetLastAlertEvents возвращает последнее событие по каждой серии источника каждого правила
+	GetLastAlertEvents(ctx context.Context) ([]*domain.AlertEvent, error)
+}
+
+// Notifier доставляет события алертов
+type Notifier interface {
+	Notify(event *domain.AlertEvent, webhooks []string)
+}
+
+// streamKey серия источника, по которой правило вычисляется отдельно
+type streamKey struct {
+	sourceID string
+	series   string
+}
+
+// streamState состояние вычисления правила по одной серии источника
+type streamState struct {
+	consecutive int         // нарушений подряд, для правил без окна
+	breaches    []time.Time // время нарушений в окне, для правил с окном
+	incidentID  uuid.UUID   // не нулевой, пока правило по серии в состоянии firing
+}
+
+// ruleState правило и его состояние вычисления по сериям источников.
+// Значения разных серий не смешиваются: у каждой свои счётчики нарушений и свой инцидент.
+type ruleState struct {
+	rule    *domain.AlertRule
+	streams map[streamKey]*streamState
+}
+
+func newRuleState(rule *domain.AlertRule) *ruleState {
+	return &ruleState{rule: rule, streams: make(map[streamKey]*streamState)}
+}
+
+// Engine вычисляет правила на каждом обработанном пакете и рассылает уведомления при смене состояния.
+// Правило принадлежит арендатору: оно видно и изменяемо только им и вычисляется только на его пакетах.
+type Engine struct {
+	store    Store
+	notifier Notifier
+	logger   *zap.Logger
+
+	allowedWebhookHosts []string // хосты, разрешённые для вебхуков правил; пусто — любые внешние
+
+	mu    sync.Mutex
+	rules map[uuid.UUID]*ruleState
+}
+
+func NewEngine(store Store, notifier Notifier, logger *zap.Logger) *Engine {
+	return &Engine{
+		store:    store,
+		notifier: notifier,
+		logger:   logger,
+		rules:    make(map[uuid.UUID]*ruleState),
+	}
+}
+
+// SetAllowedWebhookHosts ограничивает вебхуки правил перечисленными хостами.
+// Элемент ".example.com" разрешает поддомены example.com.
+func (e *Engine) SetAllowedWebhookHosts(hosts []string) {
+	e.allowedWebhookHosts = hosts
+}
+
+// Load загружает правила и восстанавливает состояние firing по последним событиям,
+// чтобы после перезапуска не отправлять повторное уведомление по тому же инциденту
+func (e *Engine) Load(ctx context.Context) error {
+	rules, err := e.store.ListAlertRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load alert rules: %w", err)
+	}
+
+	events, err := e.store.GetLastAlertEvents(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load alert events: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = make(map[uuid.UUID]*ruleState, len(rules))
+	for _, rule := range rules {
+		e.rules[rule.ID] = newRuleState(rule)
+	}
+	for _, event := range events {
+		if state, ok := e.rules[event.RuleID]; ok && event.Status == domain.AlertStatusFiring {
+			state.stream(streamKey{sourceID: event.SourceID, series: event.Series}).incidentID = event.IncidentID
+		}
+	}
+	e.updateFiringGauge()
+
+	e.logger.Info("[Alert] Rules loaded", zap.Int("rules", len(rules)))
+	return nil
+}
+
+// CreateRule проверяет и сохраняет новое правило арендатора запроса
+func (e *Engine) CreateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.validateRule(&rule); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	rule.ID = uuid.New()
+	rule.TenantID = tenantID
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+
+	if err := e.store.SaveAlertRule(ctx, &rule); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.rules[rule.ID] = newRuleState(&rule)
+	e.mu.Unlock()
+
+	return copyRule(&rule), nil
+}
+
+// UpdateRule заменяет правило и сбрасывает его состояние. Активные инциденты серий, которые
+// правило по-прежнему отбирает, сохраняются, чтобы resolved пришёл по тому же ключу дедупликации.
+func (e *Engine) UpdateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.validateRule(&rule); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	current, ok := e.rules[rule.ID]
+	e.mu.Unlock()
+	if !ok || current.rule.TenantID != tenantID {
+		return nil, ErrRuleNotFound
+	}
+
+	rule.TenantID = tenantID
+	rule.CreatedAt = current.rule.CreatedAt
+	rule.UpdatedAt = time.Now().UTC()
+
+	if err := e.store.SaveAlertRule(ctx, &rule); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	if state, ok := e.rules[rule.ID]; ok {
+		updated := newRuleState(&rule)
+		for key, stream := range state.streams {
+			if stream.incidentID != uuid.Nil && rule.Matches(key.sourceID, key.series) {
+				updated.streams[key] = &streamState{incidentID: stream.incidentID}
+			}
+		}
+		e.rules[rule.ID] = updated
+		e.updateFiringGauge()
+	}
+	e.mu.Unlock()
+
+	return copyRule(&rule), nil
+}
+
+// DeleteRule удаляет правило арендатора запроса
+func (e *Engine) DeleteRule(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	found, err := e.store.DeleteAlertRule(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	state, loaded := e.rules[id]
+	loaded = loaded && state.rule.TenantID == tenantID
+	if loaded {
+		delete(e.rules, id)
+		e.updateFiringGauge()
+	}
+	e.mu.Unlock()
+
+	if !found && !loaded {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// GetRule возвращает копию правила арендатора запроса
+func (e *Engine) GetRule(ctx context.Context, id uuid.UUID) (*domain.AlertRule, bool) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, ok := e.rules[id]
+	if !ok || state.rule.TenantID != tenantID {
+		return nil, false
+	}
+	return copyRule(state.rule), true
+}
+
+// ListRules возвращает копии правил арендатора запроса, упорядоченные по времени создания
+func (e *Engine) ListRules(ctx context.Context) []*domain.AlertRule {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return []*domain.AlertRule{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules := make([]*domain.AlertRule, 0, len(e.rules))
+	for _, state := range e.rules {
+		if state.rule.TenantID == tenantID {
+			rules = append(rules, copyRule(state.rule))
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+	})
+	return rules
+}
+
+// OnProcessed вычисляет правила арендатора пакета, отбирающие его источник и серию
+func (e *Engine) OnProcessed(ctx context.Context, _ *domain.DataPacket, data *domain.ProcessedData) {
+	if data.EmptyPayload {
+		return
+	}
+
+	value, err := data.ExactValue()
+	if err != nil {
+		e.logger.Warn("[Alert] Skipping packet with unparsable value",
+			zap.String("packet_id", data.PacketID.String()),
+			zap.Error(err))
+		return
+	}
+
+	type notification struct {
+		event    *domain.AlertEvent
+		webhooks []string
+	}
+
+	e.mu.Lock()
+	var notifications []notification
+	for _, state := range e.rules {
+		if state.rule.TenantID != data.TenantID || !state.rule.Matches(data.SourceID, data.Series) {
+			continue
+		}
+		if event := state.evaluate(value, data); event != nil {
+			notifications = append(notifications, notification{event: event, webhooks: state.rule.Webhooks})
+		}
+	}
+	if len(notifications) > 0 {
+		e.updateFiringGauge()
+	}
+	e.mu.Unlock()
+
+	for _, n := range notifications {
+		metrics.AlertEvents.WithLabelValues(string(n.event.Status)).Inc()
+		e.logger.Info("[Alert] Rule state changed",
+			zap.String("rule", n.event.RuleName),
+			zap.String("status", string(n.event.Status)),
+			zap.Float64("value", n.event.Value),
+			zap.String("packet_id", n.event.PacketID.String()))
+
+		if err := e.store.SaveAlertEvent(ctx, n.event); err != nil {
+			e.logger.Error("[Alert] Failed to save alert event",
+				zap.String("rule_id", n.event.RuleID.String()),
+				zap.Error(err))
+		}
+		e.notifier.Notify(n.event, n.webhooks)
+	}
+}
+
+// stream возвращает состояние правила по серии источника, создавая его при первом обращении
+func (s *ruleState) stream(key streamKey) *streamState {
+	stream, ok := s.streams[key]
+	if !ok {
+		stream = &streamState{}
+		s.streams[key] = stream
+	}
+	return stream
+}
+
+// evaluate обновляет состояние правила по серии пакета и возвращает событие при смене firing/resolved
+func (s *ruleState) evaluate(value float64, data *domain.ProcessedData) *domain.AlertEvent {
+	if s.rule.Disabled {
+		return nil
+	}
+
+	stream := s.stream(streamKey{sourceID: data.SourceID, series: data.Series})
+
+	breached := s.rule.Condition == domain.AlertConditionAbove && value > s.rule.Threshold ||
+		s.rule.Condition == domain.AlertConditionBelow && value < s.rule.Threshold
+
+	var active bool
+	if s.rule.WindowSeconds > 0 {
+		active = stream.evaluateWindow(breached, data.CreatedAt, s.rule)
+	} else {
+		if breached {
+			stream.consecutive++
+		} else {
+			stream.consecutive = 0
+		}
+		active = stream.consecutive >= s.rule.ForPackets
+	}
+
+	firing := stream.incidentID != uuid.Nil
+	switch {
+	case active && !firing:
+		stream.incidentID = uuid.New()
+		return s.event(stream, domain.AlertStatusFiring, value, data)
+	case !active && firing && !breached:
+		event := s.event(stream, domain.AlertStatusResolved, value, data)
+		stream.incidentID = uuid.Nil
+		return event
+	default:
+		return nil
+	}
+}
+
+// evaluateWindow считает нарушения серии за последние WindowSeconds по времени обработки
+func (s *streamState) evaluateWindow(breached bool, at time.Time, rule *domain.AlertRule) bool {
+	cutoff := at.Add(-time.Duration(rule.WindowSeconds) * time.Second)
+
+	kept := s.breaches[:0]
+	for _, t := range s.breaches {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.breaches = kept
+
+	if breached {
+		s.breaches = append(s.breaches, at)
+	}
+	return len(s.breaches) >= rule.ForPackets
+}
+
+func (s *ruleState) event(stream *streamState, status domain.AlertStatus, value float64, data *domain.ProcessedData) *domain.AlertEvent {
+	return &domain.AlertEvent{
+		ID:         uuid.New(),
+		IncidentID: stream.incidentID,
+		TenantID:   s.rule.TenantID,
+		RuleID:     s.rule.ID,
+		RuleName:   s.rule.Name,
+		SourceID:   data.SourceID,
+		Series:     data.Series,
+		Status:     status,
+		Condition:  s.rule.Condition,
+		Threshold:  s.rule.Threshold,
+		Value:      value,
+		PacketID:   data.PacketID,
+		CreatedAt:  time.Now().UTC(),
+	}
+}
+
+func (e *Engine) updateFiringGauge() {
+	firing := 0
+	for _, state := range e.rules {
+		for _, stream := range state.streams {
+			if stream.incidentID != uuid.Nil {
+				firing++
+			}
+		}
+	}
+	metrics.AlertsFiring.Set(float64(firing))
+}
+
+func (e *Engine) validateRule(rule *domain.AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRule)
+	}
+	if rule.Condition != domain.AlertConditionAbove && rule.Condition != domain.AlertConditionBelow {
+		return fmt.Errorf("%w: condition must be %q or %q", ErrInvalidRule, domain.AlertConditionAbove, domain.AlertConditionBelow)
+	}
+	if math.IsNaN(rule.Threshold) || math.IsInf(rule.Threshold, 0) {
+		return fmt.Errorf("%w: threshold must be finite", ErrInvalidRule)
+	}
+	if rule.ForPackets < 0 || rule.ForPackets > maxForPackets {
+		return fmt.Errorf("%w: for_packets must be in [0, %d]", ErrInvalidRule, maxForPackets)
+	}
+	if rule.WindowSeconds < 0 || rule.WindowSeconds > maxWindowSeconds {
+		return fmt.Errorf("%w: window_seconds must be in [0, %d]", ErrInvalidRule, maxWindowSeconds)
+	}
+	if rule.ForPackets == 0 {
+		rule.ForPackets = 1
+	}
+	for _, webhook := range rule.Webhooks {
+		if err := validateWebhookURL(webhook, e.allowedWebhookHosts); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	}
+	return nil
+}
+
+func copyRule(rule *domain.AlertRule) *domain.AlertRule {
+	copied := *rule
+	copied.Webhooks = append([]string(nil), rule.Webhooks...)
+	copied.Series = append([]string(nil), rule.Series...)
+	return &copied
+}
@@ -0,0 +1,439 @@
+package alert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) ListAlertRules(ctx context.Context) ([]*domain.AlertRule, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.AlertRule), args.Error(1)
+}
+
+func (m *MockStore) SaveAlertRule(ctx context.Context, rule *domain.AlertRule) error {
+	args := m.Called(ctx, rule)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteAlertRule(ctx context.Context, tenantID string, id uuid.UUID) (bool, error) {
+	args := m.Called(ctx, tenantID, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) SaveAlertEvent(ctx context.Context, event *domain.AlertEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetLastAlertEvents(ctx context.Context) ([]*domain.AlertEvent, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.AlertEvent), args.Error(1)
+}
+
+type recordingNotifier struct {
+	events []*domain.AlertEvent
+}
+
+func (n *recordingNotifier) Notify(event *domain.AlertEvent, _ []string) {
+	n.events = append(n.events, event)
+}
+
+const testTenant = "team-a"
+
+func tenantCtx(tenantID string) context.Context {
+	return tenant.WithID(context.Background(), tenantID)
+}
+
+func newTestEngine(t *testing.T, rule domain.AlertRule) (*Engine, *recordingNotifier) {
+	t.Helper()
+
+	store := new(MockStore)
+	store.On("SaveAlertRule", mock.Anything, mock.Anything).Return(nil)
+	store.On("SaveAlertEvent", mock.Anything, mock.Anything).Return(nil)
+
+	notifier := &recordingNotifier{}
+	logger, _ := zap.NewDevelopment()
+	engine := NewEngine(store, notifier, logger)
+
+	_, err := engine.CreateRule(tenantCtx(testTenant), rule)
+	require.NoError(t, err)
+
+	return engine, notifier
+}
+
+func process(engine *Engine, value int64, at time.Time) {
+	engine.OnProcessed(context.Background(), &domain.DataPacket{}, &domain.ProcessedData{
+		PacketID:  uuid.New(),
+		TenantID:  testTenant,
+		MaxValue:  value,
+		CreatedAt: at,
+	})
+}
+
+func TestEngine_ConsecutivePackets(t *testing.T) {
+	engine, notifier := newTestEngine(t, domain.AlertRule{
+		Name: "high", Condition: domain.AlertConditionAbove, Threshold: 100, ForPackets: 2,
+	})
+	now := time.Now()
+
+	process(engine, 150, now)
+	assert.Empty(t, notifier.events, "one breach is not enough")
+
+	process(engine, 50, now)
+	process(engine, 150, now)
+	assert.Empty(t, notifier.events, "breaches are not consecutive")
+
+	process(engine, 200, now)
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, domain.AlertStatusFiring, notifier.events[0].Status)
+	assert.Equal(t, float64(200), notifier.events[0].Value)
+
+	// Повторные нарушения не дублируют уведомление
+	process(engine, 300, now)
+	assert.Len(t, notifier.events, 1)
+
+	process(engine, 10, now)
+	require.Len(t, notifier.events, 2)
+	assert.Equal(t, domain.AlertStatusResolved, notifier.events[1].Status)
+	assert.Equal(t, notifier.events[0].IncidentID, notifier.events[1].IncidentID)
+}
+
+func TestEngine_Window(t *testing.T) {
+	engine, notifier := newTestEngine(t, domain.AlertRule{
+		Name: "low", Condition: domain.AlertConditionBelow, Threshold: 0, ForPackets: 2, WindowSeconds: 60,
+	})
+	now := time.Now()
+
+	process(engine, -1, now)
+	process(engine, 5, now.Add(10*time.Second))
+	process(engine, -1, now.Add(90*time.Second))
+	assert.Empty(t, notifier.events, "first breach left the window")
+
+	process(engine, -5, now.Add(100*time.Second))
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, domain.AlertStatusFiring, notifier.events[0].Status)
+
+	process(engine, 5, now.Add(200*time.Second))
+	require.Len(t, notifier.events, 2)
+	assert.Equal(t, domain.AlertStatusResolved, notifier.events[1].Status)
+}
+
+func TestEngine_LoadRestoresFiringState(t *testing.T) {
+	rule := &domain.AlertRule{ID: uuid.New(), TenantID: testTenant, Name: "high", Condition: domain.AlertConditionAbove, Threshold: 10, ForPackets: 1}
+	incident := uuid.New()
+
+	store := new(MockStore)
+	store.On("ListAlertRules", mock.Anything).Return([]*domain.AlertRule{rule}, nil)
+	store.On("GetLastAlertEvents", mock.Anything).
+		Return([]*domain.AlertEvent{{RuleID: rule.ID, IncidentID: incident, Status: domain.AlertStatusFiring}}, nil)
+	store.On("SaveAlertEvent", mock.Anything, mock.Anything).Return(nil)
+
+	notifier := &recordingNotifier{}
+	logger, _ := zap.NewDevelopment()
+	engine := NewEngine(store, notifier, logger)
+	require.NoError(t, engine.Load(context.Background()))
+
+	process(engine, 50, time.Now())
+	assert.Empty(t, notifier.events, "incident is already firing")
+
+	process(engine, 1, time.Now())
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, incident, notifier.events[0].IncidentID)
+}
+
+func TestEngine_InvalidRule(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	engine := NewEngine(new(MockStore), &recordingNotifier{}, logger)
+
+	_, err := engine.CreateRule(tenantCtx(testTenant), domain.AlertRule{Name: "x", Condition: "equals"})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+
+	_, err = engine.CreateRule(tenantCtx(testTenant), domain.AlertRule{
+		Name: "x", Condition: domain.AlertConditionAbove, Webhooks: []string{"ftp://example.com"},
+	})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+
+	_, err = engine.UpdateRule(tenantCtx(testTenant), domain.AlertRule{ID: uuid.New(), Name: "x", Condition: domain.AlertConditionAbove})
+	assert.ErrorIs(t, err, ErrRuleNotFound)
+
+	_, err = engine.CreateRule(context.Background(), domain.AlertRule{Name: "x", Condition: domain.AlertConditionAbove})
+	assert.ErrorIs(t, err, tenant.ErrUnauthenticated)
+}
+
+func TestEngine_WebhookTargets(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	engine := NewEngine(new(MockStore), &recordingNotifier{}, logger)
+
+	for _, webhook := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://metadata.google.internal/computeMetadata/v1/",
+		"http://0.0.0.0/hook",
+	} {
+		_, err := engine.CreateRule(tenantCtx(testTenant), domain.AlertRule{
+			Name: "x", Condition: domain.AlertConditionAbove, Webhooks: []string{webhook},
+		})
+		assert.ErrorIs(t, err, ErrInvalidRule, webhook)
+	}
+
+	engine.SetAllowedWebhookHosts([]string{"hooks.example.com", ".partner.io"})
+	assert.NoError(t, engine.validateRule(&domain.AlertRule{
+		Name: "x", Condition: domain.AlertConditionAbove,
+		Webhooks: []string{"https://hooks.example.com/a", "https://alerts.partner.io/b"},
+	}))
+	assert.ErrorIs(t, engine.validateRule(&domain.AlertRule{
+		Name: "x", Condition: domain.AlertConditionAbove, Webhooks: []string{"https://evil.example.org/a"},
+	}), ErrInvalidRule)
+}
+
+func TestWebhookNotifier_RuleWebhookCannotReachLoopback(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	logger, _ := zap.NewDevelopment()
+	notifier := NewWebhookNotifier(WebhookConfig{MaxRetries: 3, RetryBackoff: time.Millisecond}, logger)
+
+	notifier.deliver(context.Background(), delivery{event: &domain.AlertEvent{ID: uuid.New()}, url: server.URL, fromRule: true})
+	assert.Equal(t, int32(0), calls.Load())
+	assert.Empty(t, notifier.queue, "forbidden targets are not retried")
+}
+
+func TestEngine_TenantIsolation(t *testing.T) {
+	engine, notifier := newTestEngine(t, domain.AlertRule{
+		Name: "high", Condition: domain.AlertConditionAbove, Threshold: 100,
+	})
+	rule := engine.ListRules(tenantCtx(testTenant))[0]
+
+	// Другой арендатор не видит, не меняет и не удаляет правило
+	other := tenantCtx("team-b")
+	assert.Empty(t, engine.ListRules(other))
+	_, found := engine.GetRule(other, rule.ID)
+	assert.False(t, found)
+
+	_, err := engine.UpdateRule(other, domain.AlertRule{ID: rule.ID, Name: "stolen", Condition: domain.AlertConditionBelow})
+	assert.ErrorIs(t, err, ErrRuleNotFound)
+
+	engine.store.(*MockStore).On("DeleteAlertRule", mock.Anything, "team-b", rule.ID).Return(false, nil)
+	assert.ErrorIs(t, engine.DeleteRule(other, rule.ID), ErrRuleNotFound)
+	_, found = engine.GetRule(tenantCtx(testTenant), rule.ID)
+	assert.True(t, found)
+
+	// Пакеты другого арендатора правило не вычисляют
+	engine.OnProcessed(context.Background(), &domain.DataPacket{}, &domain.ProcessedData{
+		PacketID: uuid.New(), TenantID: "team-b", MaxValue: 500, CreatedAt: time.Now(),
+	})
+	assert.Empty(t, notifier.events)
+
+	process(engine, 500, time.Now())
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, testTenant, notifier.events[0].TenantID)
+}
+
+func processSeries(engine *Engine, sourceID, series string, value int64, at time.Time) {
+	engine.OnProcessed(context.Background(), &domain.DataPacket{}, &domain.ProcessedData{
+		PacketID:  uuid.New(),
+		TenantID:  testTenant,
+		SourceID:  sourceID,
+		Series:    series,
+		MaxValue:  value,
+		CreatedAt: at,
+	})
+}
+
+func TestEngine_SelectorsAndPerSeriesState(t *testing.T) {
+	engine, notifier := newTestEngine(t, domain.AlertRule{
+		Name: "hot", Condition: domain.AlertConditionAbove, Threshold: 30, ForPackets: 2,
+		SourceID: "sensor-1", Series: []string{"temperature", "humidity"},
+	})
+	now := time.Now()
+
+	// Другой источник и неотобранная серия правило не вычисляют
+	processSeries(engine, "sensor-2", "temperature", 100, now)
+	processSeries(engine, "sensor-2", "temperature", 100, now)
+	processSeries(engine, "sensor-1", "voltage", 100, now)
+	processSeries(engine, "sensor-1", "voltage", 100, now)
+	assert.Empty(t, notifier.events)
+
+	// Нарушения разных серий не складываются и не сбрасывают друг друга
+	processSeries(engine, "sensor-1", "temperature", 40, now)
+	processSeries(engine, "sensor-1", "humidity", 40, now)
+	processSeries(engine, "sensor-1", "humidity", 10, now)
+	assert.Empty(t, notifier.events)
+
+	processSeries(engine, "sensor-1", "temperature", 50, now)
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, domain.AlertStatusFiring, notifier.events[0].Status)
+	assert.Equal(t, "sensor-1", notifier.events[0].SourceID)
+	assert.Equal(t, "temperature", notifier.events[0].Series)
+
+	// Норма в другой серии не закрывает инцидент серии temperature
+	processSeries(engine, "sensor-1", "humidity", 10, now)
+	assert.Len(t, notifier.events, 1)
+
+	processSeries(engine, "sensor-1", "temperature", 20, now)
+	require.Len(t, notifier.events, 2)
+	assert.Equal(t, domain.AlertStatusResolved, notifier.events[1].Status)
+	assert.Equal(t, notifier.events[0].IncidentID, notifier.events[1].IncidentID)
+}
+
+func TestEngine_WindowPerSeries(t *testing.T) {
+	engine, notifier := newTestEngine(t, domain.AlertRule{
+		Name: "low", Condition: domain.AlertConditionBelow, Threshold: 0, ForPackets: 2, WindowSeconds: 60,
+	})
+	now := time.Now()
+
+	processSeries(engine, "", "a", -1, now)
+	processSeries(engine, "", "b", -1, now.Add(time.Second))
+	assert.Empty(t, notifier.events, "breaches of different series are counted separately")
+
+	processSeries(engine, "", "b", -1, now.Add(2*time.Second))
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, "b", notifier.events[0].Series)
+}
+
+func TestWebhookNotifier_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	delivered := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered <- r
+	}))
+	defer server.Close()
+
+	logger, _ := zap.NewDevelopment()
+	notifier := NewWebhookNotifier(WebhookConfig{
+		DefaultURLs:  []string{server.URL},
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+	}, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	event := &domain.AlertEvent{ID: uuid.New(), IncidentID: uuid.New(), Status: domain.AlertStatusFiring}
+	notifier.Notify(event, nil)
+
+	select {
+	case r := <-delivered:
+		assert.Equal(t, event.ID.String(), r.Header.Get("X-Alert-Event-ID"))
+		assert.Equal(t, event.IncidentID.String(), r.Header.Get("X-Alert-Incident-ID"))
+	case <-time.After(2 * time.Second):
+		t.Fatal("notification was not delivered")
+	}
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWebhookNotifier_DoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	logger, _ := zap.NewDevelopment()
+	notifier := NewWebhookNotifier(WebhookConfig{MaxRetries: 3, RetryBackoff: time.Millisecond}, logger)
+
+	notifier.deliver(context.Background(), delivery{event: &domain.AlertEvent{ID: uuid.New()}, url: server.URL, backoff: time.Millisecond})
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Empty(t, notifier.queue, "client errors are not retried")
+}
+
+func TestWebhookNotifier_SlowWebhookDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	delivered := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer fast.Close()
+
+	logger, _ := zap.NewDevelopment()
+	notifier := NewWebhookNotifier(WebhookConfig{Workers: 2, Timeout: 10 * time.Second}, logger)
+	notifier.ruleClient = notifier.client // тестовые серверы слушают loopback
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	notifier.Notify(&domain.AlertEvent{ID: uuid.New()}, []string{slow.URL})
+	notifier.Notify(&domain.AlertEvent{ID: uuid.New()}, []string{fast.URL})
+
+	select {
+	case <-delivered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("delivery to the fast webhook waited for the slow one")
+	}
+}
+
+func TestWebhookNotifier_RetryDoesNotHoldWorker(t *testing.T) {
+	var failing atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		failing.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	delivered := make(chan struct{}, 1)
+	up := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer up.Close()
+
+	logger, _ := zap.NewDevelopment()
+	// Один воркер и длинная пауза: повтор не должен занимать воркер на время ожидания
+	notifier := NewWebhookNotifier(WebhookConfig{Workers: 1, MaxRetries: 3, RetryBackoff: time.Minute}, logger)
+	notifier.ruleClient = notifier.client // тестовые серверы слушают loopback
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	notifier.Notify(&domain.AlertEvent{ID: uuid.New()}, []string{down.URL})
+	notifier.Notify(&domain.AlertEvent{ID: uuid.New()}, []string{up.URL})
+
+	select {
+	case <-delivered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("retry backoff blocked the delivery queue")
+	}
+	assert.Equal(t, int32(1), failing.Load())
+}
@@ -0,0 +1,274 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+// WebhookConfig настройки доставки уведомлений
+type WebhookConfig struct {
+	DefaultURLs  []string // используются, если у правила нет своих вебхуков
+	Timeout      time.Duration
+	MaxRetries   int
+	RetryBackoff time.Duration // пауза перед первым повтором, далее удваивается
+	QueueSize    int
+	Workers      int // число параллельных доставок
+}
+
+type delivery struct {
+	event    *domain.AlertEvent
+	url      string
+	fromRule bool          // вебхук задан правилом арендатора, а не конфигурацией
+	attempt  int           // номер попытки, начиная с 0
+	backoff  time.Duration // пауза перед следующим повтором
+}
+
+// errForbiddenTarget возвращается при попытке доставки на запрещённый адрес
+var errForbiddenTarget = errors.New("webhook target address is not allowed")
+
+// metadataHosts имена сервисов метаданных облачных провайдеров
+var metadataHosts = map[string]struct{}{
+	"metadata":                 {},
+	"metadata.google.internal": {},
+	"metadata.azure.internal":  {},
+}
+
+// metadataIPs адреса сервисов метаданных вне link-local диапазонов
+var metadataIPs = []net.IP{
+	net.ParseIP("100.100.100.200"), // Alibaba Cloud
+	net.ParseIP("fd00:ec2::254"),   // AWS IMDS по IPv6
+}
+
+// forbiddenIP сообщает, что адрес локальный для сервиса: loopback, link-local (в том числе
+// 169.254.169.254), неопределённый или адрес сервиса метаданных
+func forbiddenIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, metadata := range metadataIPs {
+		if ip.Equal(metadata) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostAllowed сообщает, входит ли хост в список разрешённых. Элемент ".example.com"
+// разрешает поддомены example.com, пустой список разрешает любой хост.
+func hostAllowed(host string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, item := range allowed {
+		item = strings.ToLower(item)
+		if host == item || strings.HasPrefix(item, ".") && strings.HasSuffix(host, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWebhookURL проверяет вебхук правила: схему http(s), хост из allowed и отсутствие
+// локальных адресов и адресов сервисов метаданных. Имена хостов дополнительно проверяются
+// при подключении, после разрешения DNS.
+func validateWebhookURL(raw string, allowed []string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url %q", raw)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("webhook url %q points to a local address", raw)
+	}
+	if _, ok := metadataHosts[host]; ok {
+		return fmt.Errorf("webhook url %q points to a metadata service", raw)
+	}
+	if ip := net.ParseIP(host); ip != nil && forbiddenIP(ip) {
+		return fmt.Errorf("webhook url %q points to a local address", raw)
+	}
+	if !hostAllowed(host, allowed) {
+		return fmt.Errorf("webhook host %q is not in the allowed list", host)
+	}
+	return nil
+}
+
+// guardedDialControl запрещает подключение к локальным адресам после разрешения DNS,
+// чтобы имя хоста из правила нельзя было перенаправить на внутренний адрес
+func guardedDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+		return fmt.Errorf("%w: %s", errForbiddenTarget, host)
+	}
+	return nil
+}
+
+// WebhookNotifier отправляет события POST-запросом с JSON телом в фоне.
+// Доставки выполняет пул воркеров, каждая попытка — отдельная задача очереди: повтор
+// ставится в очередь по таймеру, поэтому медленный или недоступный вебхук не задерживает остальные.
+// Вебхуки правил отправляются клиентом, который не подключается к локальным адресам;
+// вебхуки по умолчанию задаёт оператор, и на них ограничение не действует.
+// Заголовок X-Alert-Event-ID позволяет получателю отбросить повторы после ретраев,
+// X-Alert-Incident-ID связывает firing и resolved одного инцидента.
+type WebhookNotifier struct {
+	cfg        WebhookConfig
+	client     *http.Client
+	ruleClient *http.Client
+	logger     *zap.Logger
+	queue      chan delivery
+}
+
+func NewWebhookNotifier(cfg WebhookConfig, logger *zap.Logger) *WebhookNotifier {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // прокси подключался бы вместо хоста правила в обход проверки адреса
+	transport.DialContext = (&net.Dialer{Timeout: cfg.Timeout, Control: guardedDialControl}).DialContext
+
+	return &WebhookNotifier{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		ruleClient: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		logger:     logger,
+		queue:      make(chan delivery, cfg.QueueSize),
+	}
+}
+
+// Notify ставит событие в очередь доставки на каждый вебхук, не блокируя обработку пакетов
+func (n *WebhookNotifier) Notify(event *domain.AlertEvent, webhooks []string) {
+	fromRule := len(webhooks) > 0
+	if !fromRule {
+		webhooks = n.cfg.DefaultURLs
+	}
+
+	for _, url := range webhooks {
+		n.enqueue(delivery{event: event, url: url, fromRule: fromRule, backoff: n.cfg.RetryBackoff})
+	}
+}
+
+// enqueue ставит попытку доставки в очередь; при переполненной очереди уведомление отбрасывается
+func (n *WebhookNotifier) enqueue(d delivery) {
+	select {
+	case n.queue <- d:
+	default:
+		metrics.AlertNotifications.WithLabelValues("dropped").Inc()
+		n.logger.Warn("[Alert] Notification queue full, dropping notification",
+			zap.String("event_id", d.event.ID.String()),
+			zap.String("url", d.url),
+			zap.Int("attempt", d.attempt))
+	}
+}
+
+// Run запускает воркеры доставки и ждёт их завершения после отмены ctx
+func (n *WebhookNotifier) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < n.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-n.queue:
+					n.deliver(ctx, d)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver выполняет одну попытку доставки и при временной ошибке планирует повтор через d.backoff
+func (n *WebhookNotifier) deliver(ctx context.Context, d delivery) {
+	body, err := json.Marshal(d.event)
+	if err != nil {
+		n.logger.Error("[Alert] Failed to encode notification", zap.Error(err))
+		return
+	}
+
+	retryable, err := n.send(ctx, d, body)
+	if err == nil {
+		metrics.AlertNotifications.WithLabelValues("delivered").Inc()
+		return
+	}
+
+	if !retryable || d.attempt >= n.cfg.MaxRetries {
+		metrics.AlertNotifications.WithLabelValues("failed").Inc()
+		n.logger.Error("[Alert] Failed to deliver notification",
+			zap.String("event_id", d.event.ID.String()),
+			zap.String("url", d.url),
+			zap.Int("attempts", d.attempt+1),
+			zap.Error(err))
+		return
+	}
+
+	metrics.AlertNotificationRetries.Inc()
+	next := delivery{event: d.event, url: d.url, fromRule: d.fromRule, attempt: d.attempt + 1, backoff: d.backoff * 2}
+	time.AfterFunc(d.backoff, func() {
+		if ctx.Err() != nil {
+			return
+		}
+		n.enqueue(next)
+	})
+}
+
+// send выполняет одну попытку доставки. Ответы 4xx, кроме 429, не повторяются.
+func (n *WebhookNotifier) send(ctx context.Context, d delivery, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Alert-Event-ID", d.event.ID.String())
+	req.Header.Set("X-Alert-Incident-ID", d.event.IncidentID.String())
+
+	client := n.client
+	if d.fromRule {
+		client = n.ruleClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return !errors.Is(err, errForbiddenTarget), err
+	}
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,463 @@
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultSource ключ состояния для пакетов без source_id
+	DefaultSource = domain.DefaultSourceID
+
+	maxWindowSize = 10000
+	// minDeviation не даёт делить на ноль, пока значения источника не менялись
+	minDeviation = 1e-9
+	// madScale приводит MAD к стандартному отклонению нормального распределения
+	madScale = 0.6745
+)
+
+// ErrInvalidParams возвращается для некорректных параметров детектора
+var ErrInvalidParams = errors.New("invalid anomaly params")
+
+// Store хранилище параметров источников и снапшотов состояния детектора
+type Store interface {
+	ListAnomalyParams(ctx context.Context) ([]*domain.AnomalyParams, error)
+	SaveAnomalyParams(ctx context.Context, params *domain.AnomalyParams) error
+	DeleteAnomalyParams(ctx context.Context, tenantID, sourceID string) (bool, error)
+	LoadAnomalyStates(ctx context.Context) (map[string][]byte, error)
+	SaveAnomalyStates(ctx context.Context, states map[string][]byte) error
+}
+
+// Notifier доставляет уведомления об аномалиях
+type Notifier interface {
+	Notify(event *domain.AlertEvent, webhooks []string)
+}
+
+// paramsKey источник арендатора, для которого заданы параметры
+type paramsKey struct {
+	tenantID string
+	sourceID string
+}
+
+// sourceState статистика значений источника, сериализуется в снапшот.
+// EWMA и окно для MAD ведутся всегда, чтобы смена метода не требовала прогрева.
+type sourceState struct {
+	Count    int64     `json:"count"`
+	Mean     float64   `json:"mean"`
+	Variance float64   `json:"variance"`
+	Window   []float64 `json:"window,omitempty"`
+}
+
+// Detector оценивает каждое обработанное значение относительно истории его источника.
+// Enrich проставляет оценку до сохранения результата, OnProcessed после сохранения
+// добавляет значение в историю и отправляет уведомление.
+type Detector struct {
+	store    Store
+	notifier Notifier
+	defaults domain.AnomalyParams
+	logger   *zap.Logger
+
+	mu     sync.Mutex
+	params map[paramsKey]*domain.AnomalyParams
+	states map[string]*sourceState
+	dirty  map[string]struct{}
+}
+
+func NewDetector(store Store, notifier Notifier, defaults domain.AnomalyParams, logger *zap.Logger) (*Detector, error) {
+	if err := validateParams(&defaults, defaults); err != nil {
+		return nil, err
+	}
+
+	return &Detector{
+		store:    store,
+		notifier: notifier,
+		defaults: defaults,
+		logger:   logger,
+		params:   make(map[paramsKey]*domain.AnomalyParams),
+		states:   make(map[string]*sourceState),
+		dirty:    make(map[string]struct{}),
+	}, nil
+}
+
+// Restore загружает параметры источников и последнее сохранённое состояние
+func (d *Detector) Restore(ctx context.Context) error {
+	params, err := d.store.ListAnomalyParams(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load anomaly params: %w", err)
+	}
+
+	states, err := d.store.LoadAnomalyStates(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load anomaly states: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.params = make(map[paramsKey]*domain.AnomalyParams, len(params))
+	for _, p := range params {
+		d.params[paramsKey{p.TenantID, p.SourceID}] = p
+	}
+
+	d.states = make(map[string]*sourceState, len(states))
+	for source, data := range states {
+		var state sourceState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("failed to decode anomaly state of %q: %w", source, err)
+		}
+		d.states[source] = &state
+	}
+	metrics.AnomalySources.Set(float64(len(d.states)))
+
+	d.logger.Info("[Anomaly] State restored",
+		zap.Int("sources", len(d.states)),
+		zap.Int("configured_sources", len(d.params)))
+
+	return nil
+}
+
+// Checkpoint сохраняет состояние источников, изменившихся с прошлого снапшота
+func (d *Detector) Checkpoint(ctx context.Context) error {
+	d.mu.Lock()
+	states := make(map[string][]byte, len(d.dirty))
+	for source := range d.dirty {
+		data, err := json.Marshal(d.states[source])
+		if err != nil {
+			d.mu.Unlock()
+			return fmt.Errorf("failed to encode anomaly state of %q: %w", source, err)
+		}
+		states[source] = data
+	}
+	d.dirty = make(map[string]struct{})
+	d.mu.Unlock()
+
+	if len(states) == 0 {
+		return nil
+	}
+
+	if err := d.store.SaveAnomalyStates(ctx, states); err != nil {
+		// Не сохранённые источники попадут в следующий снапшот
+		d.mu.Lock()
+		for source := range states {
+			d.dirty[source] = struct{}{}
+		}
+		d.mu.Unlock()
+		return fmt.Errorf("failed to save anomaly states: %w", err)
+	}
+
+	return nil
+}
+
+// Run периодически сохраняет состояние и делает финальный снапшот при отмене ctx
+func (d *Detector) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := d.Checkpoint(saveCtx); err != nil {
+				d.logger.Error("[Anomaly] Final checkpoint failed", zap.Error(err))
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := d.Checkpoint(ctx); err != nil {
+				d.logger.Error("[Anomaly] Checkpoint failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Enrich оценивает значение пакета по статистике его источника, не изменяя её.
+// Статистика обновляется в OnProcessed, чтобы несохранённые и повторные пакеты её не искажали.
+func (d *Detector) Enrich(_ context.Context, packet *domain.DataPacket, data *domain.ProcessedData) {
+	if data.EmptyPayload {
+		return
+	}
+
+	value, err := data.ExactValue()
+	if err != nil {
+		d.logger.Warn("[Anomaly] Skipping packet with unparsable value",
+			zap.String("packet_id", data.PacketID.String()),
+			zap.Error(err))
+		return
+	}
+
+	source := sourceKey(packet)
+	key := stateKey(packet, data.Series)
+
+	d.mu.Lock()
+	params := d.paramsFor(packet.Tenant(), source)
+	var score *float64
+	if state, ok := d.states[key]; ok && state.Count >= int64(params.WarmUp) && state.Count > 0 {
+		s := state.score(value, params.Method)
+		score = &s
+	}
+	d.mu.Unlock()
+
+	if score == nil {
+		metrics.AnomalyEvaluations.WithLabelValues("warming_up").Inc()
+		return
+	}
+
+	data.AnomalyScore = score
+	data.Anomalous = math.Abs(*score) >= params.Threshold
+	metrics.AnomalyScore.Observe(math.Abs(*score))
+	if data.Anomalous {
+		metrics.AnomalyEvaluations.WithLabelValues("anomalous").Inc()
+	} else {
+		metrics.AnomalyEvaluations.WithLabelValues("normal").Inc()
+	}
+}
+
+// OnProcessed добавляет сохранённое значение в статистику источника и отправляет уведомление
+// об аномальном результате, если оно включено для источника
+func (d *Detector) OnProcessed(_ context.Context, packet *domain.DataPacket, data *domain.ProcessedData) {
+	if data.EmptyPayload {
+		return
+	}
+
+	value, err := data.ExactValue()
+	if err != nil {
+		return // уже записано в лог в Enrich
+	}
+
+	source := sourceKey(packet)
+	key := stateKey(packet, data.Series)
+
+	d.mu.Lock()
+	params := d.paramsFor(packet.Tenant(), source)
+	state, ok := d.states[key]
+	if !ok {
+		state = &sourceState{}
+		d.states[key] = state
+		metrics.AnomalySources.Set(float64(len(d.states)))
+	}
+	state.update(value, params)
+	d.dirty[key] = struct{}{}
+	d.mu.Unlock()
+
+	if !data.Anomalous || data.AnomalyScore == nil || d.notifier == nil || !params.Notify {
+		return
+	}
+
+	eventID := uuid.New()
+	d.logger.Info("[Anomaly] Anomalous value detected",
+		zap.String("source_id", source),
+		zap.String("packet_id", data.PacketID.String()),
+		zap.Float64("value", value),
+		zap.Float64("score", *data.AnomalyScore))
+
+	d.notifier.Notify(&domain.AlertEvent{
+		ID:         eventID,
+		IncidentID: eventID,
+		TenantID:   data.TenantID,
+		RuleName:   "anomaly:" + source,
+		Status:     domain.AlertStatusFiring,
+		Condition:  domain.AlertConditionAnomaly,
+		Threshold:  params.Threshold,
+		Value:      value,
+		Score:      data.AnomalyScore,
+		PacketID:   data.PacketID,
+		CreatedAt:  time.Now().UTC(),
+	}, nil)
+}
+
+// SetParams проверяет и сохраняет параметры источника арендатора. Нулевые поля берутся
+// из параметров по умолчанию, без арендатора параметры задаются арендатору по умолчанию.
+func (d *Detector) SetParams(ctx context.Context, params domain.AnomalyParams) (*domain.AnomalyParams, error) {
+	if params.TenantID == "" {
+		params.TenantID = domain.DefaultTenantID
+	}
+	if params.SourceID == "" {
+		return nil, fmt.Errorf("%w: source_id is required", ErrInvalidParams)
+	}
+	if err := validateParams(&params, d.defaults); err != nil {
+		return nil, err
+	}
+
+	if err := d.store.SaveAnomalyParams(ctx, &params); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.params[paramsKey{params.TenantID, params.SourceID}] = &params
+	d.mu.Unlock()
+
+	copied := params
+	return &copied, nil
+}
+
+// GetParams возвращает действующие параметры источника арендатора и признак, что они заданы явно
+func (d *Detector) GetParams(tenantID, sourceID string) (*domain.AnomalyParams, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, configured := d.params[paramsKey{tenantID, sourceID}]
+	params := d.paramsFor(tenantID, sourceID)
+	return &params, configured
+}
+
+// ListParams возвращает явно заданные параметры источников арендатора
+func (d *Detector) ListParams(tenantID string) []*domain.AnomalyParams {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	list := make([]*domain.AnomalyParams, 0, len(d.params))
+	for key, p := range d.params {
+		if key.tenantID != tenantID {
+			continue
+		}
+		copied := *p
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].SourceID < list[j].SourceID
+	})
+	return list
+}
+
+// DeleteParams возвращает источник арендатора к параметрам по умолчанию
+func (d *Detector) DeleteParams(ctx context.Context, tenantID, sourceID string) (bool, error) {
+	found, err := d.store.DeleteAnomalyParams(ctx, tenantID, sourceID)
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	delete(d.params, paramsKey{tenantID, sourceID})
+	d.mu.Unlock()
+
+	return found, nil
+}
+
+// paramsFor возвращает параметры источника арендатора, вызывается под d.mu
+func (d *Detector) paramsFor(tenantID, source string) domain.AnomalyParams {
+	if p, ok := d.params[paramsKey{tenantID, source}]; ok {
+		return *p
+	}
+	params := d.defaults
+	params.TenantID = tenantID
+	params.SourceID = source
+	return params
+}
+
+// score возвращает оценку value относительно накопленной статистики
+func (s *sourceState) score(value float64, method domain.AnomalyMethod) float64 {
+	if method == domain.AnomalyMethodMAD && len(s.Window) > 0 {
+		median := medianOf(s.Window)
+		deviations := make([]float64, len(s.Window))
+		for i, v := range s.Window {
+			deviations[i] = math.Abs(v - median)
+		}
+		mad := math.Max(medianOf(deviations), minDeviation)
+		return madScale * (value - median) / mad
+	}
+
+	std := math.Max(math.Sqrt(s.Variance), minDeviation)
+	return (value - s.Mean) / std
+}
+
+// update добавляет значение в EWMA и окно последних значений
+func (s *sourceState) update(value float64, params domain.AnomalyParams) {
+	if s.Count == 0 {
+		s.Mean = value
+		s.Variance = 0
+	} else {
+		diff := value - s.Mean
+		incr := params.Alpha * diff
+		s.Mean += incr
+		s.Variance = (1 - params.Alpha) * (s.Variance + diff*incr)
+	}
+	s.Count++
+
+	s.Window = append(s.Window, value)
+	if extra := len(s.Window) - params.WindowSize; extra > 0 {
+		s.Window = append(s.Window[:0], s.Window[extra:]...)
+	}
+}
+
+func medianOf(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func sourceKey(packet *domain.DataPacket) string {
+	if packet.SourceID == "" {
+		return DefaultSource
+	}
+	return packet.SourceID
+}
+
+// stateKey ключ статистики серии источника. Одноимённые источники разных арендаторов ведутся раздельно;
+// для арендатора по умолчанию и безымянной серии ключ совпадает с источником, как в снапшотах
+// до появления арендаторов и серий.
+func stateKey(packet *domain.DataPacket, series string) string {
+	key := sourceKey(packet)
+	if tenantID := packet.Tenant(); tenantID != domain.DefaultTenantID {
+		key = tenantID + "/" + key
+	}
+	if series != domain.DefaultSeries {
+		key += "#" + series
+	}
+	return key
+}
+
+// validateParams заполняет нулевые поля из defaults и проверяет диапазоны
+func validateParams(params *domain.AnomalyParams, defaults domain.AnomalyParams) error {
+	if params.Method == "" {
+		params.Method = defaults.Method
+	}
+	if params.Alpha == 0 {
+		params.Alpha = defaults.Alpha
+	}
+	if params.Threshold == 0 {
+		params.Threshold = defaults.Threshold
+	}
+	if params.WarmUp == 0 {
+		params.WarmUp = defaults.WarmUp
+	}
+	if params.WindowSize == 0 {
+		params.WindowSize = defaults.WindowSize
+	}
+
+	if params.Method != domain.AnomalyMethodEWMA && params.Method != domain.AnomalyMethodMAD {
+		return fmt.Errorf("%w: method must be %q or %q", ErrInvalidParams, domain.AnomalyMethodEWMA, domain.AnomalyMethodMAD)
+	}
+	if !(params.Alpha > 0 && params.Alpha <= 1) {
+		return fmt.Errorf("%w: alpha must be in (0, 1]", ErrInvalidParams)
+	}
+	if !(params.Threshold > 0) || math.IsInf(params.Threshold, 0) {
+		return fmt.Errorf("%w: threshold must be positive", ErrInvalidParams)
+	}
+	if params.WarmUp < 0 {
+		return fmt.Errorf("%w: warm_up must not be negative", ErrInvalidParams)
+	}
+	if params.WindowSize < 3 || params.WindowSize > maxWindowSize {
+		return fmt.Errorf("%w: window_size must be in [3, %d]", ErrInvalidParams, maxWindowSize)
+	}
+	return nil
+}
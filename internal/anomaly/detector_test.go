@@ -0,0 +1,195 @@
+package anomaly
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) ListAnomalyParams(ctx context.Context) ([]*domain.AnomalyParams, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.AnomalyParams), args.Error(1)
+}
+
+func (m *MockStore) SaveAnomalyParams(ctx context.Context, params *domain.AnomalyParams) error {
+	args := m.Called(ctx, params)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteAnomalyParams(ctx context.Context, tenantID, sourceID string) (bool, error) {
+	args := m.Called(ctx, tenantID, sourceID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) LoadAnomalyStates(ctx context.Context) (map[string][]byte, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string][]byte), args.Error(1)
+}
+
+func (m *MockStore) SaveAnomalyStates(ctx context.Context, states map[string][]byte) error {
+	args := m.Called(ctx, states)
+	return args.Error(0)
+}
+
+type recordingNotifier struct {
+	events []*domain.AlertEvent
+}
+
+func (n *recordingNotifier) Notify(event *domain.AlertEvent, _ []string) {
+	n.events = append(n.events, event)
+}
+
+var testDefaults = domain.AnomalyParams{
+	Method:     domain.AnomalyMethodEWMA,
+	Alpha:      0.2,
+	Threshold:  3,
+	WarmUp:     5,
+	WindowSize: 20,
+}
+
+func evaluate(d *Detector, source string, value int64) *domain.ProcessedData {
+	packet := &domain.DataPacket{ID: uuid.New(), SourceID: source}
+	data := &domain.ProcessedData{PacketID: packet.ID, MaxValue: value}
+	d.Enrich(context.Background(), packet, data)
+	d.OnProcessed(context.Background(), packet, data)
+	return data
+}
+
+func TestDetector_EWMA(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	d, err := NewDetector(new(MockStore), nil, testDefaults, logger)
+	require.NoError(t, err)
+
+	values := []int64{100, 102, 98, 101, 99}
+	for _, v := range values {
+		data := evaluate(d, "sensor-1", v)
+		assert.Nil(t, data.AnomalyScore, "detector is warming up")
+	}
+
+	data := evaluate(d, "sensor-1", 101)
+	require.NotNil(t, data.AnomalyScore)
+	assert.False(t, data.Anomalous)
+
+	data = evaluate(d, "sensor-1", 500)
+	require.NotNil(t, data.AnomalyScore)
+	assert.True(t, data.Anomalous)
+	assert.Greater(t, *data.AnomalyScore, 3.0)
+
+	// Другой источник имеет собственную статистику
+	data = evaluate(d, "sensor-2", 500)
+	assert.Nil(t, data.AnomalyScore)
+
+	// Одноимённый источник другого арендатора тоже
+	packet := &domain.DataPacket{ID: uuid.New(), TenantID: "team-b", SourceID: "sensor-1"}
+	data = &domain.ProcessedData{PacketID: packet.ID, TenantID: "team-b", MaxValue: 500}
+	d.Enrich(context.Background(), packet, data)
+	assert.Nil(t, data.AnomalyScore)
+}
+
+func TestDetector_MADPerSourceParams(t *testing.T) {
+	store := new(MockStore)
+	store.On("SaveAnomalyParams", mock.Anything, mock.Anything).Return(nil)
+
+	logger, _ := zap.NewDevelopment()
+	d, err := NewDetector(store, nil, testDefaults, logger)
+	require.NoError(t, err)
+
+	params, err := d.SetParams(context.Background(), domain.AnomalyParams{SourceID: "sensor-1", Method: domain.AnomalyMethodMAD, WarmUp: 3})
+	require.NoError(t, err)
+	assert.Equal(t, testDefaults.Threshold, params.Threshold, "zero fields fall back to defaults")
+	assert.Equal(t, domain.DefaultTenantID, params.TenantID)
+
+	// Параметры одноимённого источника другого арендатора не меняются
+	other, configured := d.GetParams("team-b", "sensor-1")
+	assert.False(t, configured)
+	assert.Equal(t, testDefaults.Method, other.Method)
+	assert.Empty(t, d.ListParams("team-b"))
+	assert.Len(t, d.ListParams(domain.DefaultTenantID), 1)
+
+	for _, v := range []int64{10, 12, 11, 13} {
+		evaluate(d, "sensor-1", v)
+	}
+
+	data := evaluate(d, "sensor-1", 11)
+	require.NotNil(t, data.AnomalyScore)
+	assert.False(t, data.Anomalous)
+
+	data = evaluate(d, "sensor-1", -40)
+	assert.True(t, data.Anomalous)
+	assert.Less(t, *data.AnomalyScore, -3.0)
+
+	_, err = d.SetParams(context.Background(), domain.AnomalyParams{SourceID: "sensor-1", Alpha: 2})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+}
+
+func TestDetector_CheckpointRestore(t *testing.T) {
+	store := new(MockStore)
+	var saved map[string][]byte
+	store.On("SaveAnomalyStates", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(map[string][]byte)
+	})
+
+	logger, _ := zap.NewDevelopment()
+	d, err := NewDetector(store, nil, testDefaults, logger)
+	require.NoError(t, err)
+
+	for _, v := range []int64{100, 102, 98, 101, 99, 100} {
+		evaluate(d, "", v)
+	}
+	require.NoError(t, d.Checkpoint(context.Background()))
+	require.Contains(t, saved, DefaultSource)
+
+	restoredStore := new(MockStore)
+	restoredStore.On("ListAnomalyParams", mock.Anything).Return([]*domain.AnomalyParams{}, nil)
+	restoredStore.On("LoadAnomalyStates", mock.Anything).Return(saved, nil)
+
+	restored, err := NewDetector(restoredStore, nil, testDefaults, logger)
+	require.NoError(t, err)
+	require.NoError(t, restored.Restore(context.Background()))
+
+	data := evaluate(restored, "", 500)
+	require.NotNil(t, data.AnomalyScore, "restored state is already warmed up")
+	assert.True(t, data.Anomalous)
+
+	// Без изменений снапшот не пишется повторно
+	require.NoError(t, d.Checkpoint(context.Background()))
+	store.AssertNumberOfCalls(t, "SaveAnomalyStates", 1)
+}
+
+func TestDetector_Notify(t *testing.T) {
+	notifier := &recordingNotifier{}
+	logger, _ := zap.NewDevelopment()
+
+	defaults := testDefaults
+	defaults.Notify = true
+	d, err := NewDetector(new(MockStore), notifier, defaults, logger)
+	require.NoError(t, err)
+
+	for _, v := range []int64{100, 102, 98, 101, 99, 100} {
+		evaluate(d, "sensor-1", v)
+	}
+	assert.Empty(t, notifier.events)
+
+	data := evaluate(d, "sensor-1", 500)
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, domain.AlertConditionAnomaly, notifier.events[0].Condition)
+	assert.Equal(t, "anomaly:sensor-1", notifier.events[0].RuleName)
+	assert.Equal(t, data.AnomalyScore, notifier.events[0].Score)
+}
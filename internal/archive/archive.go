@@ -0,0 +1,114 @@
+package archive
+
+import (
+	"context"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+// Store хранилище сырых пейлоадов с суточными партициями
+type Store interface {
+	SaveRawPacket(ctx context.Context, packet *domain.RawPacket) error
+	// EnsureRawPartitions создаёт суточные партиции raw_packets для дней из [from, to]
+	EnsureRawPartitions(ctx context.Context, from, to time.Time) error
+	// DropRawPartitionsBefore удаляет партиции, целиком лежащие раньше before, и возвращает их имена
+	DropRawPartitionsBefore(ctx context.Context, before time.Time) ([]string, error)
+}
+
+type Config struct {
+	Retention         time.Duration
+	PartitionsAhead   int // сколько суточных партиций создавать заранее
+	MaintenancePeriod time.Duration
+}
+
+// Archiver сохраняет исходный пейлоад каждого обработанного пакета и
+// поддерживает партиции raw_packets в пределах собственного срока хранения
+type Archiver struct {
+	store  Store
+	cfg    Config
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+func NewArchiver(store Store, cfg Config, logger *zap.Logger) *Archiver {
+	if cfg.PartitionsAhead <= 0 {
+		cfg.PartitionsAhead = 3
+	}
+	if cfg.MaintenancePeriod <= 0 {
+		cfg.MaintenancePeriod = time.Hour
+	}
+
+	return &Archiver{
+		store:  store,
+		cfg:    cfg,
+		logger: logger,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// OnProcessed архивирует пейлоад пакета после успешной обработки.
+// Пакет с несколькими сериями архивируется целиком один раз — по результату первой серии.
+func (a *Archiver) OnProcessed(ctx context.Context, packet *domain.DataPacket, data *domain.ProcessedData) {
+	if data.Series != packet.SeriesNames()[0] {
+		return
+	}
+
+	raw := domain.NewRawPacket(packet, a.now())
+
+	if err := a.store.SaveRawPacket(ctx, raw); err != nil {
+		metrics.RawArchivePackets.WithLabelValues("failed").Inc()
+		a.logger.Error("[Archive] Failed to archive raw packet",
+			zap.String("packet_id", packet.ID.String()),
+			zap.Error(err))
+		return
+	}
+
+	metrics.RawArchivePackets.WithLabelValues("saved").Inc()
+}
+
+// Maintain создаёт партиции на ближайшие дни и удаляет партиции старше срока хранения
+func (a *Archiver) Maintain(ctx context.Context) error {
+	today := a.now().Truncate(24 * time.Hour)
+
+	if err := a.store.EnsureRawPartitions(ctx, today, today.AddDate(0, 0, a.cfg.PartitionsAhead)); err != nil {
+		return err
+	}
+
+	if a.cfg.Retention <= 0 {
+		return nil
+	}
+
+	dropped, err := a.store.DropRawPartitionsBefore(ctx, today.Add(-a.cfg.Retention))
+	if err != nil {
+		return err
+	}
+
+	if len(dropped) > 0 {
+		metrics.RawArchivePartitionsDropped.Add(float64(len(dropped)))
+		a.logger.Info("[Archive] Expired raw partitions dropped", zap.Strings("partitions", dropped))
+	}
+
+	return nil
+}
+
+// Run выполняет обслуживание партиций сразу и далее с периодом MaintenancePeriod
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.MaintenancePeriod)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Maintain(ctx); err != nil && ctx.Err() == nil {
+			a.logger.Error("[Archive] Partition maintenance failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
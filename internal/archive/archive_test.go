@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) SaveRawPacket(ctx context.Context, packet *domain.RawPacket) error {
+	args := m.Called(ctx, packet)
+	return args.Error(0)
+}
+
+func (m *MockStore) EnsureRawPartitions(ctx context.Context, from, to time.Time) error {
+	args := m.Called(ctx, from, to)
+	return args.Error(0)
+}
+
+func (m *MockStore) DropRawPartitionsBefore(ctx context.Context, before time.Time) ([]string, error) {
+	args := m.Called(ctx, before)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func TestArchiver_OnProcessed(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	archiver := NewArchiver(store, Config{}, logger)
+
+	packet := &domain.DataPacket{ID: uuid.New(), Timestamp: time.Now(), DecimalPayload: []string{"1.25", "3.50"}}
+
+	store.On("SaveRawPacket", mock.Anything, mock.AnythingOfType("*domain.RawPacket")).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			raw := args.Get(1).(*domain.RawPacket)
+			assert.Equal(t, packet.ID, raw.PacketID)
+			assert.Equal(t, domain.PayloadKindDecimal, raw.PayloadKind)
+			assert.Equal(t, packet.DecimalPayload, raw.DecimalPayload)
+		})
+
+	archiver.OnProcessed(context.Background(), packet, &domain.ProcessedData{PacketID: packet.ID})
+	store.AssertExpectations(t)
+}
+
+func TestArchiver_Maintain(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	archiver := NewArchiver(store, Config{Retention: 7 * 24 * time.Hour, PartitionsAhead: 2}, logger)
+	archiver.now = func() time.Time { return time.Date(2025, 9, 10, 15, 30, 0, 0, time.UTC) }
+
+	today := time.Date(2025, 9, 10, 0, 0, 0, 0, time.UTC)
+	store.On("EnsureRawPartitions", mock.Anything, today, today.AddDate(0, 0, 2)).Return(nil)
+	store.On("DropRawPartitionsBefore", mock.Anything, today.AddDate(0, 0, -7)).Return([]string{"raw_packets_20250902"}, nil)
+
+	assert.NoError(t, archiver.Maintain(context.Background()))
+	store.AssertExpectations(t)
+}
+
+func TestArchiver_Maintain_EnsureFails(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	archiver := NewArchiver(store, Config{Retention: 24 * time.Hour}, logger)
+
+	store.On("EnsureRawPartitions", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("db down"))
+
+	assert.Error(t, archiver.Maintain(context.Background()))
+	store.AssertNotCalled(t, "DropRawPartitionsBefore", mock.Anything, mock.Anything)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,6 +14,18 @@ type Config struct {
 	WorkerCount  int
 	DataInterval int // in milliseconds
 	LogLevel     string
+	Window       WindowConfig
+	Validation   ValidationConfig
+	RawArchive   RawArchiveConfig
+	Partition    PartitionConfig
+	Alert        AlertConfig
+	Anomaly      AnomalyConfig
+	Derived      DerivedConfig
+	Dedup        DedupConfig
+	Tenant       TenantConfig
+	Schema       SchemaConfig
+	Timestamp    TimestampConfig
+	Signing      SigningConfig
 }
 
 type DBConfig struct {
@@ -24,6 +37,108 @@ type DBConfig struct {
 	MaxConnIdleTime  time.Duration
 }
 
+// WindowConfig настройки окон событийного времени, длительности в секундах
+type WindowConfig struct {
+	Enabled            bool
+	Size               time.Duration
+	Slide              time.Duration // 0 — tumbling окна
+	WatermarkDelay     time.Duration
+	AllowedLateness    time.Duration
+	CheckpointInterval time.Duration
+}
+
+// ValidationConfig правила валидации входящих пакетов.
+// Нулевые длины и nil границы означают отсутствие ограничения.
+type ValidationConfig struct {
+	EmptyPayloadPolicy string // reject или store_null
+	MinPayloadLength   int
+	MaxPayloadLength   int
+	MinValue           *float64
+	MaxValue           *float64
+	RejectZeroUUID     bool
+}
+
+// RawArchiveConfig настройки архива сырых пейлоадов
+type RawArchiveConfig struct {
+	Enabled         bool
+	Retention       time.Duration
+	PartitionsAhead int
+}
+
+// PartitionConfig настройки обслуживания месячных партиций processed_packets
+type PartitionConfig struct {
+	MonthsAhead         int
+	MinRunway           time.Duration
+	MaintenanceInterval time.Duration
+	RetentionMonths     int           // 0 — партиции не удаляются
+	RetentionDryRun     bool          // только записывать в журнал партиции, которые были бы удалены
+	ExportDir           string        // каталог для выгрузки партиций перед удалением, пусто — без выгрузки
+	DetachLockTimeout   time.Duration // сколько ждать блокировку processed_packets при отсоединении партиции
+}
+
+// AlertConfig настройки доставки уведомлений алертов
+type AlertConfig struct {
+	WebhookURLs         []string // вебхуки по умолчанию для правил без своих вебхуков
+	WebhookAllowedHosts []string // хосты, разрешённые для вебхуков правил; пусто — любые внешние
+	WebhookTimeout      time.Duration
+	WebhookMaxRetries   int
+	WebhookRetryBackoff time.Duration
+	WebhookWorkers      int
+}
+
+// AnomalyConfig параметры детектора аномалий по умолчанию
+type AnomalyConfig struct {
+	Enabled            bool
+	Method             string // ewma или mad
+	Alpha              float64
+	Threshold          float64
+	WarmUp             int
+	WindowSize         int
+	Notify             bool
+	CheckpointInterval time.Duration
+}
+
+// DerivedConfig производные метрики, заданные конфигурацией
+type DerivedConfig struct {
+	Metrics string // определения "[source:]name=expression" через ";"
+}
+
+// DedupConfig настройки дедупликации пакетов по идентификатору
+type DedupConfig struct {
+	TTL             time.Duration
+	CacheSize       int
+	CleanupInterval time.Duration
+}
+
+// TenantConfig аутентификация клиентов и квоты арендаторов. Без API-ключей аутентификация
+// выключена и все запросы выполняются от арендатора по умолчанию.
+type TenantConfig struct {
+	APIKeys             string  // пары "key=tenant" через ";"
+	AdminTenant         string  // арендатор, которому доступны /api/v1/admin/*
+	AuthDisabled        bool    // без API-ключей открыть /api/v1/admin/* всем клиентам, только для разработки
+	IngestRate          float64 // пакетов в секунду на арендатора, 0 — без ограничения
+	MaxRows             int64   // строк результатов на арендатора, 0 — без ограничения
+	Quotas              string  // переопределения "tenant=rate:rows" через ";"
+	RowsRefreshInterval time.Duration
+}
+
+// SchemaConfig настройки реестра схем пакетов
+type SchemaConfig struct {
+	Required bool // отклонять пакеты источников без зарегистрированной схемы
+}
+
+// TimestampConfig допуск времени устройства относительно времени сервера и действие для пакетов вне допуска
+type TimestampConfig struct {
+	Policy    string        // accept, clamp, reject или quarantine
+	MaxPast   time.Duration // 0 — без ограничения
+	MaxFuture time.Duration // 0 — без ограничения
+}
+
+// SigningConfig проверка подписей пакетов
+type SigningConfig struct {
+	Required bool // отклонять пакеты источников без ключей подписи
+}
+
 func LoadConfig() *Config {
 	return &Config{
 		DBConfig: DBConfig{
@@ -40,6 +155,82 @@ func LoadConfig() *Config {
 		WorkerCount:  getEnvAsInt("WORKER_COUNT", 5),
 		DataInterval: getEnvAsInt("DATA_INTERVAL", 100),
 		LogLevel:     getEnv("LOG_LEVEL", "info"),
+		Window: WindowConfig{
+			Enabled:            getEnvAsBool("WINDOW_ENABLED", false),
+			Size:               time.Duration(getEnvAsInt("WINDOW_SIZE", 60)) * time.Second,
+			Slide:              time.Duration(getEnvAsInt("WINDOW_SLIDE", 0)) * time.Second,
+			WatermarkDelay:     time.Duration(getEnvAsInt("WINDOW_WATERMARK_DELAY", 5)) * time.Second,
+			AllowedLateness:    time.Duration(getEnvAsInt("WINDOW_ALLOWED_LATENESS", 60)) * time.Second,
+			CheckpointInterval: time.Duration(getEnvAsInt("WINDOW_CHECKPOINT_INTERVAL", 10)) * time.Second,
+		},
+		Validation: ValidationConfig{
+			EmptyPayloadPolicy: getEnv("VALIDATION_EMPTY_PAYLOAD", "reject"),
+			MinPayloadLength:   getEnvAsInt("VALIDATION_MIN_PAYLOAD_LENGTH", 0),
+			MaxPayloadLength:   getEnvAsInt("VALIDATION_MAX_PAYLOAD_LENGTH", 0),
+			MinValue:           getEnvAsFloatPtr("VALIDATION_MIN_VALUE"),
+			MaxValue:           getEnvAsFloatPtr("VALIDATION_MAX_VALUE"),
+			RejectZeroUUID:     getEnvAsBool("VALIDATION_REJECT_ZERO_UUID", true),
+		},
+		RawArchive: RawArchiveConfig{
+			Enabled:         getEnvAsBool("RAW_ARCHIVE_ENABLED", false),
+			Retention:       time.Duration(getEnvAsInt("RAW_ARCHIVE_RETENTION_DAYS", 30)) * 24 * time.Hour,
+			PartitionsAhead: getEnvAsInt("RAW_ARCHIVE_PARTITIONS_AHEAD", 3),
+		},
+		Partition: PartitionConfig{
+			MonthsAhead:         getEnvAsInt("PARTITION_MONTHS_AHEAD", 3),
+			MinRunway:           time.Duration(getEnvAsInt("PARTITION_MIN_RUNWAY_DAYS", 45)) * 24 * time.Hour,
+			MaintenanceInterval: time.Duration(getEnvAsInt("PARTITION_MAINTENANCE_INTERVAL", 3600)) * time.Second,
+			RetentionMonths:     getEnvAsInt("PARTITION_RETENTION_MONTHS", 0),
+			RetentionDryRun:     getEnvAsBool("PARTITION_RETENTION_DRY_RUN", false),
+			ExportDir:           getEnv("PARTITION_EXPORT_DIR", ""),
+			DetachLockTimeout:   time.Duration(getEnvAsInt("PARTITION_DETACH_LOCK_TIMEOUT", 5)) * time.Second,
+		},
+		Alert: AlertConfig{
+			WebhookURLs:         getEnvAsList("ALERT_WEBHOOK_URLS"),
+			WebhookAllowedHosts: getEnvAsList("ALERT_WEBHOOK_ALLOWED_HOSTS"),
+			WebhookTimeout:      time.Duration(getEnvAsInt("ALERT_WEBHOOK_TIMEOUT", 5)) * time.Second,
+			WebhookMaxRetries:   getEnvAsInt("ALERT_WEBHOOK_MAX_RETRIES", 5),
+			WebhookRetryBackoff: time.Duration(getEnvAsInt("ALERT_WEBHOOK_RETRY_BACKOFF_MS", 1000)) * time.Millisecond,
+			WebhookWorkers:      getEnvAsInt("ALERT_WEBHOOK_WORKERS", 4),
+		},
+		Anomaly: AnomalyConfig{
+			Enabled:            getEnvAsBool("ANOMALY_ENABLED", false),
+			Method:             getEnv("ANOMALY_METHOD", "ewma"),
+			Alpha:              getEnvAsFloat("ANOMALY_ALPHA", 0.1),
+			Threshold:          getEnvAsFloat("ANOMALY_THRESHOLD", 3),
+			WarmUp:             getEnvAsInt("ANOMALY_WARM_UP", 30),
+			WindowSize:         getEnvAsInt("ANOMALY_WINDOW_SIZE", 100),
+			Notify:             getEnvAsBool("ANOMALY_NOTIFY", false),
+			CheckpointInterval: time.Duration(getEnvAsInt("ANOMALY_CHECKPOINT_INTERVAL", 10)) * time.Second,
+		},
+		Derived: DerivedConfig{
+			Metrics: getEnv("DERIVED_METRICS", ""),
+		},
+		Dedup: DedupConfig{
+			TTL:             time.Duration(getEnvAsInt("DEDUP_TTL_HOURS", 24)) * time.Hour,
+			CacheSize:       getEnvAsInt("DEDUP_CACHE_SIZE", 100000),
+			CleanupInterval: time.Duration(getEnvAsInt("DEDUP_CLEANUP_INTERVAL", 300)) * time.Second,
+		},
+		Tenant: TenantConfig{
+			APIKeys:             getEnv("TENANT_API_KEYS", ""),
+			AdminTenant:         getEnv("TENANT_ADMIN_ID", "default"),
+			AuthDisabled:        getEnvAsBool("AUTH_DISABLED", false),
+			IngestRate:          getEnvAsFloat("TENANT_INGEST_RATE", 0),
+			MaxRows:             int64(getEnvAsInt("TENANT_MAX_ROWS", 0)),
+			Quotas:              getEnv("TENANT_QUOTAS", ""),
+			RowsRefreshInterval: time.Duration(getEnvAsInt("TENANT_ROWS_REFRESH_INTERVAL", 300)) * time.Second,
+		},
+		Schema: SchemaConfig{
+			Required: getEnvAsBool("SCHEMA_REQUIRED", false),
+		},
+		Timestamp: TimestampConfig{
+			Policy:    getEnv("TIMESTAMP_POLICY", "accept"),
+			MaxPast:   time.Duration(getEnvAsInt("TIMESTAMP_MAX_PAST", 30*24*3600)) * time.Second,
+			MaxFuture: time.Duration(getEnvAsInt("TIMESTAMP_MAX_FUTURE", 300)) * time.Second,
+		},
+		Signing: SigningConfig{
+			Required: getEnvAsBool("SIGNING_REQUIRED", false),
+		},
 	}
 }
 
@@ -59,3 +250,42 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getEnvAsBool(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+func getEnvAsFloat(key string, fallback float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// getEnvAsFloatPtr возвращает nil, если переменная не задана или некорректна
+func getEnvAsFloatPtr(key string) *float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
+
+// getEnvAsList разбирает список через запятую, пустые элементы отбрасываются
+func getEnvAsList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
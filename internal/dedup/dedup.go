@@ -0,0 +1,160 @@
+// Package dedup отсекает повторно присланные пакеты по идентификатору.
+// Быстрая проверка выполняется по фильтру в памяти, окончательная — по уникальному
+// ключу в таблице packet_dedup в транзакции сохранения результата.
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Store хранилище идентификаторов обработанных пакетов
+type Store interface {
+	// DeleteDedupEntriesBefore удаляет записи, впервые увиденные раньше before, и возвращает их количество
+	DeleteDedupEntriesBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Config struct {
+	TTL             time.Duration // сколько помнить идентификатор пакета
+	CacheSize       int           // сколько идентификаторов держать в памяти
+	CleanupInterval time.Duration
+}
+
+// key идентификатор пакета уникален в пределах арендатора
+type key struct {
+	tenantID string
+	packetID uuid.UUID
+}
+
+type entry struct {
+	key    key
+	seenAt time.Time
+}
+
+// Deduplicator помнит идентификаторы пакетов в течение TTL. Фильтр в памяти ограничен CacheSize:
+// вытесненные идентификаторы продолжают отсекаться таблицей до истечения TTL.
+type Deduplicator struct {
+	store  Store
+	cfg    Config
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu    sync.Mutex
+	seen  map[key]*list.Element
+	order *list.List // записи в порядке добавления, то есть по возрастанию seenAt
+}
+
+func NewDeduplicator(store Store, cfg Config, logger *zap.Logger) *Deduplicator {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = 100000
+	}
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = 5 * time.Minute
+	}
+
+	return &Deduplicator{
+		store:  store,
+		cfg:    cfg,
+		logger: logger,
+		now:    func() time.Time { return time.Now().UTC() },
+		seen:   make(map[key]*list.Element),
+		order:  list.New(),
+	}
+}
+
+// Reserve отмечает пакет как принятый в обработку. Возвращает false, если пакет
+// арендатора с таким идентификатором уже принимался в пределах TTL, в том числе если он ещё обрабатывается.
+func (d *Deduplicator) Reserve(tenantID string, packetID uuid.UUID) bool {
+	now := d.now()
+	k := key{tenantID: tenantID, packetID: packetID}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(now)
+	if _, ok := d.seen[k]; ok {
+		return false
+	}
+
+	if d.order.Len() >= d.cfg.CacheSize {
+		oldest := d.order.Front()
+		delete(d.seen, oldest.Value.(entry).key)
+		d.order.Remove(oldest)
+	}
+	d.seen[k] = d.order.PushBack(entry{key: k, seenAt: now})
+	metrics.DedupCacheSize.Set(float64(d.order.Len()))
+	return true
+}
+
+// Forget снимает отметку, если пакет не удалось сохранить, чтобы повторная отправка была обработана
+func (d *Deduplicator) Forget(tenantID string, packetID uuid.UUID) {
+	k := key{tenantID: tenantID, packetID: packetID}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if element, ok := d.seen[k]; ok {
+		d.order.Remove(element)
+		delete(d.seen, k)
+		metrics.DedupCacheSize.Set(float64(d.order.Len()))
+	}
+}
+
+// Cleanup удаляет из памяти и из таблицы идентификаторы старше TTL
+func (d *Deduplicator) Cleanup(ctx context.Context) error {
+	now := d.now()
+
+	d.mu.Lock()
+	d.expire(now)
+	d.mu.Unlock()
+
+	deleted, err := d.store.DeleteDedupEntriesBefore(ctx, now.Add(-d.cfg.TTL))
+	if err != nil {
+		return err
+	}
+
+	if deleted > 0 {
+		d.logger.Debug("[Dedup] Expired entries deleted", zap.Int64("deleted", deleted))
+	}
+	return nil
+}
+
+// Run выполняет очистку с периодом CleanupInterval до отмены ctx
+func (d *Deduplicator) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				d.logger.Error("[Dedup] Cleanup failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// expire удаляет из памяти записи старше TTL. Вызывается под d.mu.
+func (d *Deduplicator) expire(now time.Time) {
+	cutoff := now.Add(-d.cfg.TTL)
+	for element := d.order.Front(); element != nil; element = d.order.Front() {
+		if element.Value.(entry).seenAt.After(cutoff) {
+			break
+		}
+		delete(d.seen, element.Value.(entry).key)
+		d.order.Remove(element)
+	}
+	metrics.DedupCacheSize.Set(float64(d.order.Len()))
+}
@@ -0,0 +1,110 @@
+package dedup
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) DeleteDedupEntriesBefore(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func newTestDeduplicator(store Store, cfg Config, now *time.Time) *Deduplicator {
+	logger, _ := zap.NewDevelopment()
+	d := NewDeduplicator(store, cfg, logger)
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+const tenantA = "team-a"
+
+func TestDeduplicator_ReserveWithinTTL(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	d := newTestDeduplicator(new(MockStore), Config{TTL: time.Hour}, &now)
+
+	id := uuid.New()
+	assert.True(t, d.Reserve(tenantA, id))
+	assert.False(t, d.Reserve(tenantA, id))
+
+	now = now.Add(time.Hour)
+	assert.True(t, d.Reserve(tenantA, id), "identifier expires after TTL")
+}
+
+func TestDeduplicator_Forget(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	d := newTestDeduplicator(new(MockStore), Config{}, &now)
+
+	id := uuid.New()
+	require.True(t, d.Reserve(tenantA, id))
+	d.Forget(tenantA, id)
+	assert.True(t, d.Reserve(tenantA, id))
+}
+
+func TestDeduplicator_SameIDAcrossTenants(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	d := newTestDeduplicator(new(MockStore), Config{}, &now)
+
+	id := uuid.New()
+	require.True(t, d.Reserve(tenantA, id))
+	assert.True(t, d.Reserve("team-b", id), "another tenant's packet with the same id is not a duplicate")
+	assert.False(t, d.Reserve("team-b", id))
+}
+
+func TestDeduplicator_EvictsOldestWhenFull(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	d := newTestDeduplicator(new(MockStore), Config{CacheSize: 2}, &now)
+
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	require.True(t, d.Reserve(tenantA, first))
+	require.True(t, d.Reserve(tenantA, second))
+	require.True(t, d.Reserve(tenantA, third))
+
+	assert.False(t, d.Reserve(tenantA, third))
+	assert.True(t, d.Reserve(tenantA, first), "evicted identifier is left to the durable check")
+}
+
+func TestDeduplicator_ConcurrentResends(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	d := newTestDeduplicator(new(MockStore), Config{}, &now)
+
+	id := uuid.New()
+	var accepted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if d.Reserve(tenantA, id) {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), accepted.Load())
+}
+
+func TestDeduplicator_Cleanup(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	store := new(MockStore)
+	d := newTestDeduplicator(store, Config{TTL: 24 * time.Hour}, &now)
+
+	store.On("DeleteDedupEntriesBefore", mock.Anything, now.Add(-24*time.Hour)).Return(int64(3), nil)
+
+	require.NoError(t, d.Cleanup(context.Background()))
+	store.AssertExpectations(t)
+}
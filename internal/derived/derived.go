@@ -0,0 +1,440 @@
+// Package derived вычисляет производные метрики — выражения над статистиками пейлоада,
+// заданные по источникам в конфигурации (для всех арендаторов) или через admin API (для арендатора).
+package derived
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// AllSources источник, выражения которого применяются к пакетам всех источников
+	AllSources = "*"
+
+	maxMetricsPerSource = 50
+	maxSourceLength     = 128
+)
+
+var (
+	// ErrInvalidMetric возвращается для некорректного имени, источника или выражения
+	ErrInvalidMetric = errors.New("invalid derived metric")
+
+	namePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,63}$`)
+)
+
+// Store хранилище метрик, заданных через API
+type Store interface {
+	ListDerivedMetrics(ctx context.Context) ([]*domain.DerivedMetric, error)
+	SaveDerivedMetric(ctx context.Context, metric *domain.DerivedMetric) error
+	DeleteDerivedMetric(ctx context.Context, tenantID, sourceID, name string) (bool, error)
+}
+
+// metricKey метрика источника арендатора; у метрик из конфигурации арендатор пуст
+type metricKey struct {
+	tenant string
+	source string
+	name   string
+}
+
+// sourceMetric метрика источника без арендатора, ключ действующего набора арендатора
+type sourceMetric struct {
+	source string
+	name   string
+}
+
+type compiledMetric struct {
+	metric  *domain.DerivedMetric
+	program *Program
+}
+
+// Engine вычисляет производные метрики пакета до сохранения результата.
+// Метрики арендатора из API переопределяют метрики из конфигурации с тем же источником и именем,
+// метрики источника — одноимённые метрики для всех источников.
+type Engine struct {
+	store  Store
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	static   map[metricKey]*compiledMetric
+	stored   map[metricKey]*compiledMetric
+	shared   map[string][]*compiledMetric            // метрики из конфигурации по источникам
+	byTenant map[string]map[string][]*compiledMetric // действующие метрики арендаторов с метриками из API
+}
+
+// NewEngine компилирует метрики из конфигурации; ошибка в любом выражении не даёт запустить сервис
+func NewEngine(store Store, defaults []domain.DerivedMetric, logger *zap.Logger) (*Engine, error) {
+	e := &Engine{
+		store:  store,
+		logger: logger,
+		static: make(map[metricKey]*compiledMetric, len(defaults)),
+		stored: make(map[metricKey]*compiledMetric),
+	}
+
+	for _, metric := range defaults {
+		metric.FromConfig = true
+		compiled, err := compile(&metric)
+		if err != nil {
+			return nil, err
+		}
+		e.static[metricKey{"", metric.SourceID, metric.Name}] = compiled
+	}
+	if err := checkLimits(e.static, nil); err != nil {
+		return nil, err
+	}
+	e.rebuild()
+
+	return e, nil
+}
+
+// Load загружает метрики, сохранённые через API. Выражения, которые больше не компилируются,
+// пропускаются с ошибкой в логе, чтобы не блокировать запуск.
+func (e *Engine) Load(ctx context.Context) error {
+	list, err := e.store.ListDerivedMetrics(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load derived metrics: %w", err)
+	}
+
+	stored := make(map[metricKey]*compiledMetric, len(list))
+	for _, metric := range list {
+		compiled, err := compile(metric)
+		if err != nil {
+			e.logger.Error("[Derived] Skipping stored metric",
+				zap.String("source_id", metric.SourceID),
+				zap.String("name", metric.Name),
+				zap.Error(err))
+			continue
+		}
+		stored[metricKey{metric.TenantID, metric.SourceID, metric.Name}] = compiled
+	}
+
+	e.mu.Lock()
+	e.stored = stored
+	e.rebuild()
+	e.mu.Unlock()
+
+	e.logger.Info("[Derived] Metrics loaded",
+		zap.Int("config", len(e.static)),
+		zap.Int("stored", len(stored)))
+	return nil
+}
+
+// SetMetric компилирует выражение и сохраняет метрику арендатора; без арендатора метрика
+// задаётся арендатору по умолчанию
+func (e *Engine) SetMetric(ctx context.Context, metric domain.DerivedMetric) (*domain.DerivedMetric, error) {
+	if metric.TenantID == "" {
+		metric.TenantID = domain.DefaultTenantID
+	}
+	metric.FromConfig = false
+	metric.UpdatedAt = time.Now().UTC()
+	compiled, err := compile(&metric)
+	if err != nil {
+		return nil, err
+	}
+
+	key := metricKey{metric.TenantID, metric.SourceID, metric.Name}
+
+	e.mu.Lock()
+	stored := make(map[metricKey]*compiledMetric, len(e.stored)+1)
+	for k, v := range e.stored {
+		stored[k] = v
+	}
+	stored[key] = compiled
+	err = checkLimits(e.static, stored)
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.store.SaveDerivedMetric(ctx, &metric); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.stored[key] = compiled
+	e.rebuild()
+	e.mu.Unlock()
+
+	saved := metric
+	return &saved, nil
+}
+
+// DeleteMetric удаляет метрику арендатора, заданную через API. Одноимённая метрика из конфигурации
+// снова начинает действовать.
+func (e *Engine) DeleteMetric(ctx context.Context, tenantID, sourceID, name string) (bool, error) {
+	found, err := e.store.DeleteDerivedMetric(ctx, tenantID, sourceID, name)
+	if err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	key := metricKey{tenantID, sourceID, name}
+	_, loaded := e.stored[key]
+	delete(e.stored, key)
+	e.rebuild()
+	e.mu.Unlock()
+
+	return found || loaded, nil
+}
+
+// ListMetrics возвращает действующие метрики арендатора, упорядоченные по источнику и имени
+func (e *Engine) ListMetrics(tenantID string) []*domain.DerivedMetric {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	effective := effectiveMetrics(e.static, e.stored, tenantID)
+	list := make([]*domain.DerivedMetric, 0, len(effective))
+	for _, compiled := range effective {
+		list = append(list, copyMetric(compiled.metric))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].SourceID != list[j].SourceID {
+			return list[i].SourceID < list[j].SourceID
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Enrich вычисляет метрики источника пакета и сохраняет результаты в data.Derived.
+// Метрика, выражение которой не дало конечного числа (например, деление на ноль), пропускается.
+func (e *Engine) Enrich(_ context.Context, packet *domain.DataPacket, data *domain.ProcessedData) {
+	if data.EmptyPayload {
+		return
+	}
+
+	source := packet.SourceID
+	if source == "" {
+		source = domain.DefaultSourceID
+	}
+
+	e.mu.RLock()
+	bySource, ok := e.byTenant[packet.Tenant()]
+	if !ok {
+		bySource = e.shared
+	}
+	list, ok := bySource[source]
+	if !ok {
+		list = bySource[AllSources]
+	}
+	e.mu.RUnlock()
+
+	if len(list) == 0 {
+		return
+	}
+
+	stats, ok := payloadStats(packet.SeriesValues(data.Series))
+	if !ok {
+		return
+	}
+
+	derived := make(map[string]float64, len(list))
+	for _, compiled := range list {
+		value, err := compiled.program.Eval(stats)
+		if err != nil {
+			metrics.DerivedEvaluations.WithLabelValues("error").Inc()
+			e.logger.Debug("[Derived] Metric not evaluated",
+				zap.String("packet_id", data.PacketID.String()),
+				zap.String("name", compiled.metric.Name),
+				zap.Error(err))
+			continue
+		}
+		metrics.DerivedEvaluations.WithLabelValues("ok").Inc()
+		derived[compiled.metric.Name] = value
+	}
+
+	if len(derived) > 0 {
+		data.Derived = derived
+	}
+}
+
+// rebuild пересобирает действующие метрики по источникам арендаторов. Вызывается под e.mu.
+func (e *Engine) rebuild() {
+	e.shared = groupBySource(effectiveMetrics(e.static, nil, ""))
+
+	byTenant := make(map[string]map[string][]*compiledMetric)
+	for key := range e.stored {
+		if _, ok := byTenant[key.tenant]; !ok {
+			byTenant[key.tenant] = groupBySource(effectiveMetrics(e.static, e.stored, key.tenant))
+		}
+	}
+	e.byTenant = byTenant
+}
+
+// effectiveMetrics возвращает метрики из конфигурации с переопределениями арендатора из API
+func effectiveMetrics(static, stored map[metricKey]*compiledMetric, tenantID string) map[sourceMetric]*compiledMetric {
+	effective := make(map[sourceMetric]*compiledMetric, len(static))
+	for key, compiled := range static {
+		effective[sourceMetric{key.source, key.name}] = compiled
+	}
+	for key, compiled := range stored {
+		if key.tenant == tenantID {
+			effective[sourceMetric{key.source, key.name}] = compiled
+		}
+	}
+	return effective
+}
+
+// groupBySource раскладывает действующие метрики по источникам
+func groupBySource(effective map[sourceMetric]*compiledMetric) map[string][]*compiledMetric {
+	// Метрики для всех источников, затем переопределения конкретных источников
+	shared := make(map[string]*compiledMetric)
+	perSource := make(map[string]map[string]*compiledMetric)
+	for key, compiled := range effective {
+		if key.source == AllSources {
+			shared[key.name] = compiled
+			continue
+		}
+		if perSource[key.source] == nil {
+			perSource[key.source] = make(map[string]*compiledMetric)
+		}
+		perSource[key.source][key.name] = compiled
+	}
+
+	bySource := make(map[string][]*compiledMetric, len(perSource)+1)
+	bySource[AllSources] = sortedMetrics(shared)
+	for source, own := range perSource {
+		merged := make(map[string]*compiledMetric, len(shared)+len(own))
+		for name, compiled := range shared {
+			merged[name] = compiled
+		}
+		for name, compiled := range own {
+			merged[name] = compiled
+		}
+		bySource[source] = sortedMetrics(merged)
+	}
+	return bySource
+}
+
+// checkLimits проверяет число метрик на источник каждого арендатора с учётом переопределений
+func checkLimits(static, stored map[metricKey]*compiledMetric) error {
+	tenants := map[string]struct{}{"": {}}
+	for key := range stored {
+		tenants[key.tenant] = struct{}{}
+	}
+
+	for tenantID := range tenants {
+		counts := make(map[string]int)
+		for key := range effectiveMetrics(static, stored, tenantID) {
+			counts[key.source]++
+		}
+		for source, count := range counts {
+			if count > maxMetricsPerSource {
+				return fmt.Errorf("%w: source %q has more than %d metrics", ErrInvalidMetric, source, maxMetricsPerSource)
+			}
+		}
+	}
+	return nil
+}
+
+func sortedMetrics(set map[string]*compiledMetric) []*compiledMetric {
+	list := make([]*compiledMetric, 0, len(set))
+	for _, compiled := range set {
+		list = append(list, compiled)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].metric.Name < list[j].metric.Name })
+	return list
+}
+
+func compile(metric *domain.DerivedMetric) (*compiledMetric, error) {
+	if metric.SourceID == "" || len(metric.SourceID) > maxSourceLength {
+		return nil, fmt.Errorf("%w: source_id must be 1 to %d characters", ErrInvalidMetric, maxSourceLength)
+	}
+	if !namePattern.MatchString(metric.Name) {
+		return nil, fmt.Errorf("%w: name must match %s", ErrInvalidMetric, namePattern)
+	}
+
+	program, err := Compile(metric.Expression)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidMetric, metric.Name, err)
+	}
+	return &compiledMetric{metric: copyMetric(metric), program: program}, nil
+}
+
+// payloadStats считает статистики пейлоада серии любого типа. Десятичные значения приводятся к float64.
+func payloadStats(payload domain.SeriesPayload) (*Stats, bool) {
+	var values []float64
+	switch payload.Kind() {
+	case domain.PayloadKindFloat:
+		values = payload.FloatPayload
+	case domain.PayloadKindDecimal:
+		values = make([]float64, 0, len(payload.DecimalPayload))
+		for _, text := range payload.DecimalPayload {
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, false
+			}
+			values = append(values, value)
+		}
+	default:
+		values = make([]float64, len(payload.Payload))
+		for i, value := range payload.Payload {
+			values[i] = float64(value)
+		}
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	stats := &Stats{
+		Max:   values[0],
+		Min:   values[0],
+		Count: float64(len(values)),
+		First: values[0],
+		Last:  values[len(values)-1],
+	}
+	for _, value := range values {
+		stats.Sum += value
+		if value > stats.Max {
+			stats.Max = value
+		}
+		if value < stats.Min {
+			stats.Min = value
+		}
+	}
+	stats.Mean = stats.Sum / stats.Count
+	return stats, true
+}
+
+// ParseDefinitions разбирает DERIVED_METRICS: определения "[source:]name=expression" через ";".
+// Определения без источника применяются ко всем источникам.
+func ParseDefinitions(spec string) ([]domain.DerivedMetric, error) {
+	var list []domain.DerivedMetric
+	for _, definition := range strings.Split(spec, ";") {
+		definition = strings.TrimSpace(definition)
+		if definition == "" {
+			continue
+		}
+
+		target, expression, ok := strings.Cut(definition, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q, expected [source:]name=expression", ErrInvalidMetric, definition)
+		}
+
+		metric := domain.DerivedMetric{SourceID: AllSources, Expression: strings.TrimSpace(expression)}
+		target = strings.TrimSpace(target)
+		if i := strings.LastIndex(target, ":"); i >= 0 {
+			metric.SourceID = strings.TrimSpace(target[:i])
+			target = strings.TrimSpace(target[i+1:])
+		}
+		metric.Name = target
+		list = append(list, metric)
+	}
+	return list, nil
+}
+
+func copyMetric(metric *domain.DerivedMetric) *domain.DerivedMetric {
+	copied := *metric
+	return &copied
+}
@@ -0,0 +1,182 @@
+package derived
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) ListDerivedMetrics(ctx context.Context) ([]*domain.DerivedMetric, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.DerivedMetric), args.Error(1)
+}
+
+func (m *MockStore) SaveDerivedMetric(ctx context.Context, metric *domain.DerivedMetric) error {
+	args := m.Called(ctx, metric)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteDerivedMetric(ctx context.Context, tenantID, sourceID, name string) (bool, error) {
+	args := m.Called(ctx, tenantID, sourceID, name)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestCompile(t *testing.T) {
+	stats := &Stats{Max: 10, Min: 2, Sum: 24, Count: 4, Mean: 6, First: 2, Last: 10}
+
+	for expression, want := range map[string]float64{
+		"max - min":             8,
+		"sum / count":           6,
+		"(mean - 32) * 5 / 9":   (6 - 32) * 5.0 / 9,
+		"-first + last":         8,
+		"max(first, 3) + 0.5":   3.5,
+		"pow(2, 3) + sqrt(min)": 8 + 1.4142135623730951,
+		"round(abs(min - max))": 8,
+	} {
+		program, err := Compile(expression)
+		require.NoError(t, err, expression)
+		got, err := program.Eval(stats)
+		require.NoError(t, err, expression)
+		assert.InDelta(t, want, got, 1e-9, expression)
+	}
+
+	for _, expression := range []string{
+		"",
+		"max -",
+		"avg",
+		"median(max)",
+		"pow(max)",
+		"max > min",
+		"max % 2",
+		`"text"`,
+		"os.Exit(1)",
+		"stats.max",
+	} {
+		_, err := Compile(expression)
+		assert.ErrorIs(t, err, ErrInvalidExpression, expression)
+	}
+}
+
+func TestProgram_EvalNonFinite(t *testing.T) {
+	program, err := Compile("sum / (max - min)")
+	require.NoError(t, err)
+
+	_, err = program.Eval(&Stats{Max: 5, Min: 5, Sum: 10})
+	assert.Error(t, err)
+}
+
+func TestParseDefinitions(t *testing.T) {
+	list, err := ParseDefinitions("range=max - min; sensor-1:celsius = (mean - 32) * 5 / 9 ;")
+	require.NoError(t, err)
+	assert.Equal(t, []domain.DerivedMetric{
+		{SourceID: AllSources, Name: "range", Expression: "max - min"},
+		{SourceID: "sensor-1", Name: "celsius", Expression: "(mean - 32) * 5 / 9"},
+	}, list)
+
+	_, err = ParseDefinitions("range")
+	assert.ErrorIs(t, err, ErrInvalidMetric)
+}
+
+func TestNewEngine_RejectsInvalidConfig(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	_, err := NewEngine(new(MockStore), []domain.DerivedMetric{{SourceID: AllSources, Name: "bad", Expression: "max +"}}, logger)
+	assert.ErrorIs(t, err, ErrInvalidMetric)
+
+	_, err = NewEngine(new(MockStore), []domain.DerivedMetric{{SourceID: AllSources, Name: "1st", Expression: "max"}}, logger)
+	assert.ErrorIs(t, err, ErrInvalidMetric)
+}
+
+func TestEngine_EnrichPerSource(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := new(MockStore)
+	engine, err := NewEngine(store, []domain.DerivedMetric{
+		{SourceID: AllSources, Name: "range", Expression: "max - min"},
+		{SourceID: AllSources, Name: "ratio", Expression: "max / min"},
+	}, logger)
+	require.NoError(t, err)
+
+	store.On("ListDerivedMetrics", mock.Anything).Return([]*domain.DerivedMetric{
+		{TenantID: domain.DefaultTenantID, SourceID: "thermo", Name: "range", Expression: "(max - min) * 1.8"},
+	}, nil)
+	require.NoError(t, engine.Load(context.Background()))
+
+	enrich := func(packet *domain.DataPacket) *domain.ProcessedData {
+		data := &domain.ProcessedData{PacketID: packet.ID}
+		engine.Enrich(context.Background(), packet, data)
+		return data
+	}
+
+	data := enrich(&domain.DataPacket{ID: uuid.New(), Payload: []int64{4, 10, 2}})
+	assert.Equal(t, map[string]float64{"range": 8, "ratio": 5}, data.Derived)
+
+	data = enrich(&domain.DataPacket{ID: uuid.New(), SourceID: "thermo", FloatPayload: []float64{1.5, 11.5}})
+	assert.InDelta(t, 18.0, data.Derived["range"], 1e-9)
+	assert.InDelta(t, 11.5/1.5, data.Derived["ratio"], 1e-9)
+
+	// Деление на ноль пропускает только эту метрику
+	data = enrich(&domain.DataPacket{ID: uuid.New(), DecimalPayload: []string{"0", "3.5"}})
+	assert.Equal(t, map[string]float64{"range": 3.5}, data.Derived)
+}
+
+func TestEngine_SetAndDeleteMetric(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	store := new(MockStore)
+	engine, err := NewEngine(store, []domain.DerivedMetric{
+		{SourceID: AllSources, Name: "range", Expression: "max - min"},
+	}, logger)
+	require.NoError(t, err)
+
+	_, err = engine.SetMetric(context.Background(), domain.DerivedMetric{SourceID: AllSources, Name: "range", Expression: "max -"})
+	assert.ErrorIs(t, err, ErrInvalidMetric)
+	store.AssertNotCalled(t, "SaveDerivedMetric", mock.Anything, mock.Anything)
+
+	store.On("SaveDerivedMetric", mock.Anything, mock.AnythingOfType("*domain.DerivedMetric")).Return(nil).Once()
+	saved, err := engine.SetMetric(context.Background(), domain.DerivedMetric{SourceID: AllSources, Name: "range", Expression: "max - min + 1"})
+	require.NoError(t, err)
+	assert.False(t, saved.FromConfig)
+
+	list := engine.ListMetrics(domain.DefaultTenantID)
+	require.Len(t, list, 1)
+	assert.Equal(t, "max - min + 1", list[0].Expression)
+	assert.Equal(t, domain.DefaultTenantID, list[0].TenantID)
+
+	// Метрика арендатора не действует для других арендаторов
+	list = engine.ListMetrics("team-b")
+	require.Len(t, list, 1)
+	assert.Equal(t, "max - min", list[0].Expression)
+	data := &domain.ProcessedData{}
+	engine.Enrich(context.Background(), &domain.DataPacket{TenantID: "team-b", Payload: []int64{4, 10}}, data)
+	assert.Equal(t, map[string]float64{"range": 6}, data.Derived)
+
+	// После удаления снова действует метрика из конфигурации
+	store.On("DeleteDerivedMetric", mock.Anything, domain.DefaultTenantID, AllSources, "range").Return(true, nil)
+	found, err := engine.DeleteMetric(context.Background(), domain.DefaultTenantID, AllSources, "range")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	list = engine.ListMetrics(domain.DefaultTenantID)
+	require.Len(t, list, 1)
+	assert.True(t, list[0].FromConfig)
+	assert.Equal(t, "max - min", list[0].Expression)
+
+	store.On("SaveDerivedMetric", mock.Anything, mock.Anything).Return(errors.New("db down"))
+	_, err = engine.SetMetric(context.Background(), domain.DerivedMetric{SourceID: "s1", Name: "mean", Expression: "mean"})
+	assert.Error(t, err)
+	assert.Len(t, engine.ListMetrics(domain.DefaultTenantID), 1)
+}
@@ -0,0 +1,196 @@
+package derived
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxExpressionLength = 1024
+
+// ErrInvalidExpression возвращается, если выражение не компилируется
+var ErrInvalidExpression = errors.New("invalid expression")
+
+// Stats статистики пейлоада пакета, доступные в выражениях как переменные
+type Stats struct {
+	Max   float64
+	Min   float64
+	Sum   float64
+	Count float64
+	Mean  float64
+	First float64
+	Last  float64
+}
+
+var variables = map[string]func(*Stats) float64{
+	"max":   func(s *Stats) float64 { return s.Max },
+	"min":   func(s *Stats) float64 { return s.Min },
+	"sum":   func(s *Stats) float64 { return s.Sum },
+	"count": func(s *Stats) float64 { return s.Count },
+	"mean":  func(s *Stats) float64 { return s.Mean },
+	"first": func(s *Stats) float64 { return s.First },
+	"last":  func(s *Stats) float64 { return s.Last },
+}
+
+type function struct {
+	arity int
+	call  func(args []float64) float64
+}
+
+// functions встроенные функции. Имена min и max в позиции вызова означают функцию, а не переменную.
+var functions = map[string]function{
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"floor": {1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ceil":  {1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"round": {1, func(a []float64) float64 { return math.Round(a[0]) }},
+	"log":   {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log10": {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"exp":   {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"pow":   {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"min":   {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":   {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+}
+
+// Program скомпилированное арифметическое выражение
+type Program struct {
+	eval func(*Stats) float64
+}
+
+// Compile разбирает выражение и проверяет, что в нём только числа, переменные статистик,
+// операторы + - * / и встроенные функции. Ошибки в выражении обнаруживаются здесь, а не при обработке пакетов.
+func Compile(expression string) (*Program, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, fmt.Errorf("%w: expression is empty", ErrInvalidExpression)
+	}
+	if len(expression) > maxExpressionLength {
+		return nil, fmt.Errorf("%w: expression is longer than %d characters", ErrInvalidExpression, maxExpressionLength)
+	}
+
+	node, err := parser.ParseExpr(expression)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+
+	eval, err := compileNode(node)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+	return &Program{eval: eval}, nil
+}
+
+// Eval вычисляет выражение. Деление на ноль и другие нечисловые результаты возвращают ошибку.
+func (p *Program) Eval(stats *Stats) (float64, error) {
+	value := p.eval(stats)
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("expression result is not finite")
+	}
+	return value, nil
+}
+
+// Variables возвращает имена переменных, доступных в выражениях
+func Variables() []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func compileNode(node ast.Expr) (func(*Stats) float64, error) {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		if n.Kind != token.INT && n.Kind != token.FLOAT {
+			return nil, fmt.Errorf("unsupported literal %s", n.Value)
+		}
+		value, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", n.Value)
+		}
+		return func(*Stats) float64 { return value }, nil
+
+	case *ast.Ident:
+		variable, ok := variables[n.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown variable %q, available: %s", n.Name, strings.Join(Variables(), ", "))
+		}
+		return variable, nil
+
+	case *ast.ParenExpr:
+		return compileNode(n.X)
+
+	case *ast.UnaryExpr:
+		x, err := compileNode(n.X)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case token.ADD:
+			return x, nil
+		case token.SUB:
+			return func(s *Stats) float64 { return -x(s) }, nil
+		default:
+			return nil, fmt.Errorf("unsupported operator %s", n.Op)
+		}
+
+	case *ast.BinaryExpr:
+		x, err := compileNode(n.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := compileNode(n.Y)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case token.ADD:
+			return func(s *Stats) float64 { return x(s) + y(s) }, nil
+		case token.SUB:
+			return func(s *Stats) float64 { return x(s) - y(s) }, nil
+		case token.MUL:
+			return func(s *Stats) float64 { return x(s) * y(s) }, nil
+		case token.QUO:
+			return func(s *Stats) float64 { return x(s) / y(s) }, nil
+		default:
+			return nil, fmt.Errorf("unsupported operator %s", n.Op)
+		}
+
+	case *ast.CallExpr:
+		ident, ok := n.Fun.(*ast.Ident)
+		if !ok || n.Ellipsis.IsValid() {
+			return nil, fmt.Errorf("unsupported call")
+		}
+		fn, ok := functions[ident.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q", ident.Name)
+		}
+		if len(n.Args) != fn.arity {
+			return nil, fmt.Errorf("function %s expects %d arguments, got %d", ident.Name, fn.arity, len(n.Args))
+		}
+		args := make([]func(*Stats) float64, len(n.Args))
+		for i, arg := range n.Args {
+			compiled, err := compileNode(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = compiled
+		}
+		return func(s *Stats) float64 {
+			values := make([]float64, len(args))
+			for i, arg := range args {
+				values[i] = arg(s)
+			}
+			return fn.call(values)
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported syntax")
+	}
+}
@@ -1,22 +1,852 @@
 package domain
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// DataPacket представляет входящий пакет данных
+var (
+	// ErrValueOutOfRange возвращается, если значение не вмещается в int64
+	ErrValueOutOfRange = errors.New("value out of int64 range")
+	// ErrDuplicatePacket возвращается при сохранении пакета, идентификатор которого уже обработан
+	ErrDuplicatePacket = errors.New("duplicate packet")
+	// ErrPacketQuarantined возвращается для пакета, отложенного в карантин до ручного разбора
+	ErrPacketQuarantined = errors.New("packet quarantined")
+	// ErrInvalidCursor возвращается для курсора страницы, который не удалось разобрать или выдан для другой оси времени
+	ErrInvalidCursor = errors.New("invalid page cursor")
+	// ErrInvalidQuery возвращается для некорректных параметров выборки, например пустого интервала
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// PayloadKind тип значений в пейлоаде пакета
+type PayloadKind string
+
+const (
+	PayloadKindInt     PayloadKind = "int"
+	PayloadKindFloat   PayloadKind = "float"
+	PayloadKindDecimal PayloadKind = "decimal"
+)
+
+// DataPacket представляет входящий пакет данных.
+// Заполняется ровно один из пейлоадов: целые, дробные или десятичные фиксированной точности,
+// либо именованные серии (каналы устройства), каждая со своим пейлоадом.
 type DataPacket struct {
-	ID        uuid.UUID `json:"id"`
-	Timestamp time.Time `json:"timestamp"`
-	Payload   []int     `json:"payload"`
+	ID             uuid.UUID                `json:"id"`
+	TenantID       string                   `json:"-"`                   // арендатор, определяется по аутентифицированному клиенту, а не по телу пакета
+	SourceID       string                   `json:"source_id,omitempty"` // источник (устройство), пусто — источник по умолчанию
+	Labels         map[string]string        `json:"labels,omitempty"`
+	Timestamp      time.Time                `json:"timestamp"`
+	Payload        []int64                  `json:"payload"`
+	FloatPayload   []float64                `json:"float_payload,omitempty"`
+	DecimalPayload []string                 `json:"decimal_payload,omitempty"` // значения в виде строк, например "12.340"
+	Series         map[string]SeriesPayload `json:"series,omitempty"`          // именованные серии, например "temperature"
+	SchemaVersion  int                      `json:"schema_version,omitempty"`  // версия схемы источника, 0 — текущая
+	Signature      *PacketSignature         `json:"signature,omitempty"`       // подпись канонического представления пакета ключом источника
+	ReceivedAt     time.Time                `json:"-"`                         // время приёма пакета сервером
+	ClampedFrom    time.Time                `json:"-"`                         // исходное время устройства, если Timestamp прижат к границе допуска
+}
+
+// DefaultSeries имя безымянной серии: пейлоада пакета без именованных серий
+const DefaultSeries = ""
+
+// SeriesPayload значения одной серии пакета. Заполняется ровно один из пейлоадов.
+// В JSON серия задаётся массивом чисел, как "payload" пакета, или объектом с полями пейлоада.
+type SeriesPayload struct {
+	Payload        []int64   `json:"payload,omitempty"`
+	FloatPayload   []float64 `json:"float_payload,omitempty"`
+	DecimalPayload []string  `json:"decimal_payload,omitempty"`
+}
+
+// Len возвращает количество значений серии
+func (s SeriesPayload) Len() int {
+	return len(s.Payload) + len(s.FloatPayload) + len(s.DecimalPayload)
+}
+
+// Kind возвращает тип пейлоада серии
+func (s SeriesPayload) Kind() PayloadKind {
+	switch {
+	case len(s.DecimalPayload) > 0:
+		return PayloadKindDecimal
+	case len(s.FloatPayload) > 0:
+		return PayloadKindFloat
+	default:
+		return PayloadKindInt
+	}
+}
+
+// UnmarshalJSON принимает массив чисел или объект с полями пейлоада
+func (s *SeriesPayload) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var numbers []json.Number
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.UseNumber()
+		if err := decoder.Decode(&numbers); err != nil {
+			return err
+		}
+		*s = SeriesPayload{}
+		var err error
+		s.Payload, s.FloatPayload, err = splitNumbers(numbers)
+		return err
+	}
+
+	type plain SeriesPayload
+	var raw struct {
+		plain
+		Payload []json.Number `json:"payload"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	*s = SeriesPayload(raw.plain)
+	ints, floats, err := splitNumbers(raw.Payload)
+	if err != nil {
+		return err
+	}
+	s.Payload = ints
+	s.FloatPayload = append(floats, s.FloatPayload...)
+	return nil
+}
+
+// SeriesNames возвращает имена серий пакета по алфавиту. У пакета без именованных серий
+// одна безымянная серия DefaultSeries.
+func (p *DataPacket) SeriesNames() []string {
+	if len(p.Series) == 0 {
+		return []string{DefaultSeries}
+	}
+
+	names := make([]string, 0, len(p.Series))
+	for name := range p.Series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SeriesValues возвращает пейлоад серии; для DefaultSeries — собственный пейлоад пакета
+func (p *DataPacket) SeriesValues(name string) SeriesPayload {
+	if name == DefaultSeries {
+		return SeriesPayload{
+			Payload:        p.Payload,
+			FloatPayload:   p.FloatPayload,
+			DecimalPayload: p.DecimalPayload,
+		}
+	}
+	return p.Series[name]
 }
 
-// ProcessedData представляет обработанные данные
+// Tenant возвращает арендатора пакета; пакеты без арендатора относятся к арендатору по умолчанию
+func (p *DataPacket) Tenant() string {
+	if p.TenantID == "" {
+		return DefaultTenantID
+	}
+	return p.TenantID
+}
+
+// PayloadLen возвращает количество значений в пейлоаде пакета без учёта именованных серий
+func (p *DataPacket) PayloadLen() int {
+	return p.SeriesValues(DefaultSeries).Len()
+}
+
+// PayloadKind возвращает тип пейлоада пакета без учёта именованных серий
+func (p *DataPacket) PayloadKind() PayloadKind {
+	return p.SeriesValues(DefaultSeries).Kind()
+}
+
+// UnmarshalJSON раскладывает числа из "payload" по типу: если все значения целые,
+// пейлоад остаётся целочисленным, иначе значения попадают в FloatPayload.
+func (p *DataPacket) UnmarshalJSON(data []byte) error {
+	type plain DataPacket
+	var raw struct {
+		plain
+		Payload []json.Number `json:"payload"`
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	*p = DataPacket(raw.plain)
+	ints, floats, err := splitNumbers(raw.Payload)
+	if err != nil {
+		return err
+	}
+	p.Payload = ints
+	p.FloatPayload = append(floats, p.FloatPayload...)
+
+	return nil
+}
+
+// splitNumbers возвращает целые значения, если все числа целые, иначе дробные
+func splitNumbers(numbers []json.Number) ([]int64, []float64, error) {
+	ints := make([]int64, 0, len(numbers))
+	for _, number := range numbers {
+		value, err := strconv.ParseInt(number.String(), 10, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrValueOutOfRange, number)
+		}
+		if err != nil {
+			ints = nil
+			break
+		}
+		ints = append(ints, value)
+	}
+	if ints != nil {
+		return ints, nil, nil
+	}
+
+	floats := make([]float64, 0, len(numbers))
+	for _, number := range numbers {
+		value, err := number.Float64()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid payload value %q: %w", number, err)
+		}
+		floats = append(floats, value)
+	}
+	return nil, floats, nil
+}
+
+// ProcessedData представляет обработанные данные.
+// Для дробных и десятичных пейлоадов точный максимум лежит в MaxValueFloat / MaxValueDecimal,
+// а MaxValue — его округление до целого, ограниченное диапазоном int64, для совместимости.
+// Для пустого пейлоада EmptyPayload == true, а max_value хранится как NULL.
 type ProcessedData struct {
+	PacketID        uuid.UUID          `json:"packet_id" db:"packet_id"`
+	TenantID        string             `json:"tenant_id,omitempty" db:"tenant_id"`
+	SourceID        string             `json:"source_id,omitempty" db:"source_id"`
+	Series          string             `json:"series,omitempty" db:"series"`             // пусто — безымянная серия
+	PacketCreatedAt time.Time          `json:"packet_created_at" db:"packet_created_at"` // время устройства
+	ReceivedAt      time.Time          `json:"received_at" db:"received_at"`             // время приёма пакета сервером
+	ClampedFrom     *time.Time         `json:"clamped_from,omitempty" db:"clamped_from"` // исходное время устройства, если оно вышло за допуск и было прижато
+	CreatedAt       time.Time          `json:"created_at" db:"created_at"`
+	MaxValue        int64              `json:"max_value" db:"max_value"`
+	ValueKind       PayloadKind        `json:"value_kind,omitempty" db:"value_kind"`
+	MaxValueFloat   *float64           `json:"max_value_float,omitempty" db:"max_value_float"`
+	MaxValueDecimal string             `json:"max_value_decimal,omitempty" db:"max_value_decimal"`
+	EmptyPayload    bool               `json:"empty_payload,omitempty" db:"empty_payload"`
+	AnomalyScore    *float64           `json:"anomaly_score,omitempty" db:"anomaly_score"` // nil, пока детектор не накопил статистику
+	Anomalous       bool               `json:"anomalous,omitempty" db:"anomalous"`
+	Labels          map[string]string  `json:"labels,omitempty" db:"labels"`
+	Derived         map[string]float64 `json:"derived,omitempty" db:"derived"` // значения производных метрик источника
+}
+
+// ExactValue возвращает точный максимум как float64: дробный или десятичный, если есть, иначе целый
+func (d *ProcessedData) ExactValue() (float64, error) {
+	switch {
+	case d.MaxValueFloat != nil:
+		return *d.MaxValueFloat, nil
+	case d.MaxValueDecimal != "":
+		return strconv.ParseFloat(d.MaxValueDecimal, 64)
+	default:
+		return float64(d.MaxValue), nil
+	}
+}
+
+// ExactDecimal возвращает точный максимум в десятичной записи: дробный или десятичный, если есть, иначе целый
+func (d *ProcessedData) ExactDecimal() string {
+	switch {
+	case d.MaxValueFloat != nil:
+		return strconv.FormatFloat(*d.MaxValueFloat, 'f', -1, 64)
+	case d.MaxValueDecimal != "":
+		return d.MaxValueDecimal
+	default:
+		return strconv.FormatInt(d.MaxValue, 10)
+	}
+}
+
+// DecimalToInt64 округляет десятичную запись до ближайшего целого (половину — от нуля)
+// и ограничивает результат диапазоном int64; overflow сообщает, что значение пришлось ограничить
+func DecimalToInt64(text string) (value int64, overflow bool, err error) {
+	rat, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return 0, false, fmt.Errorf("invalid decimal value %q", text)
+	}
+	value, overflow = RatToInt64(rat)
+	return value, overflow, nil
+}
+
+// RatToInt64 округляет число до ближайшего целого (половину — от нуля)
+// и ограничивает результат диапазоном int64
+func RatToInt64(rat *big.Rat) (value int64, overflow bool) {
+	quo, rem := new(big.Int).QuoRem(rat.Num(), rat.Denom(), new(big.Int))
+	if new(big.Int).Lsh(rem.Abs(rem), 1).Cmp(rat.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(rat.Sign())))
+	}
+
+	switch {
+	case quo.IsInt64():
+		return quo.Int64(), false
+	case quo.Sign() < 0:
+		return math.MinInt64, true
+	default:
+		return math.MaxInt64, true
+	}
+}
+
+// PacketFilter отбор результатов по источнику и лейблам. Пустые поля не ограничивают выборку.
+type PacketFilter struct {
+	SourceID string
+	Labels   map[string]string // результат должен содержать все указанные лейблы
+	Series   []string          // имена серий, пусто — все серии
+	TimeAxis TimeAxis          // ось, по которой отбирается интервал запроса, пусто — время обработки
+}
+
+// TimeAxis ось времени интервала запроса
+type TimeAxis string
+
+const (
+	// TimeAxisProcessing время обработки пакета сервисом (created_at), ось по умолчанию
+	TimeAxisProcessing TimeAxis = "processing"
+	// TimeAxisEvent время устройства из пакета (packet_created_at); старые данные,
+	// загруженные задним числом, попадают в интервал своего времени устройства
+	TimeAxisEvent TimeAxis = "event"
+)
+
+// Valid сообщает, что ось известна; пустая ось означает время обработки
+func (a TimeAxis) Valid() bool {
+	return a == "" || a == TimeAxisProcessing || a == TimeAxisEvent
+}
+
+func (a TimeAxis) orDefault() TimeAxis {
+	if a == "" {
+		return TimeAxisProcessing
+	}
+	return a
+}
+
+// Размер страницы выборки результатов за период
+const (
+	DefaultPageSize = 1000
+	MaxPageSize     = 10000
+)
+
+// PageRequest запрос страницы: Limit строк после позиции Cursor, пустой курсор — первая страница
+type PageRequest struct {
+	Limit  int
+	Cursor string
+}
+
+// MaxValuesPage страница результатов за период; NextCursor пуст на последней странице
+type MaxValuesPage struct {
+	MaxValues  []*ProcessedData `json:"max_values"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// PageCursor позиция последней строки страницы в порядке (время на оси, packet_id, серия).
+// Серия различает строки одного пакета с несколькими сериями. Query — отпечаток параметров
+// запроса, для которого выдан курсор: с другим интервалом или фильтрами курсор не принимается.
+type PageCursor struct {
+	TimeAxis TimeAxis  `json:"a,omitempty"`
+	Time     time.Time `json:"t"`
+	PacketID uuid.UUID `json:"id"`
+	Series   string    `json:"s,omitempty"`
+	Query    string    `json:"q"`
+}
+
+// PageQueryHash возвращает отпечаток интервала и фильтра запроса страницы.
+// Порядок серий и лейблов в запросе на отпечаток не влияет.
+func PageQueryHash(start, end time.Time, filter PacketFilter) string {
+	series := append([]string(nil), filter.Series...)
+	sort.Strings(series)
+
+	// Ключи map кодируются в json по алфавиту
+	data, _ := json.Marshal(struct {
+		Start    time.Time         `json:"start"`
+		End      time.Time         `json:"end"`
+		TimeAxis TimeAxis          `json:"axis"`
+		SourceID string            `json:"source"`
+		Labels   map[string]string `json:"labels"`
+		Series   []string          `json:"series"`
+	}{start.UTC(), end.UTC(), filter.TimeAxis.orDefault(), filter.SourceID, filter.Labels, series})
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// CursorAfter возвращает курсор, указывающий на строку data на оси axis, для запроса с отпечатком query
+func CursorAfter(data *ProcessedData, axis TimeAxis, query string) *PageCursor {
+	cursor := &PageCursor{TimeAxis: axis.orDefault(), Time: data.CreatedAt, PacketID: data.PacketID, Series: data.Series, Query: query}
+	if axis == TimeAxisEvent {
+		cursor.Time = data.PacketCreatedAt
+	}
+	return cursor
+}
+
+// Encode возвращает непрозрачное строковое представление курсора
+func (c *PageCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodePageCursor разбирает курсор, выданный для оси axis и запроса с отпечатком query
+func DecodePageCursor(value string, axis TimeAxis, query string) (*PageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor PageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Time.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.TimeAxis != axis.orDefault() {
+		return nil, fmt.Errorf("%w: cursor was issued for another time_axis", ErrInvalidCursor)
+	}
+	if cursor.Query != query {
+		return nil, fmt.Errorf("%w: cursor was issued for another period or filter", ErrInvalidCursor)
+	}
+	return &cursor, nil
+}
+
+// DefaultTenantID арендатор пакетов встроенного генератора и всех клиентов, пока аутентификация выключена
+const DefaultTenantID = "default"
+
+// DefaultSourceID источник пакетов без source_id
+const DefaultSourceID = "default"
+
+// DerivedMetric производная метрика: выражение над статистиками пейлоада,
+// результат которого сохраняется в ProcessedData.Derived под именем Name
+type DerivedMetric struct {
+	TenantID   string    `json:"tenant_id,omitempty"` // пусто у метрик из конфигурации: они действуют для всех арендаторов
+	SourceID   string    `json:"source_id"`           // "*" — для всех источников
+	Name       string    `json:"name"`
+	Expression string    `json:"expression"`
+	FromConfig bool      `json:"from_config,omitempty"` // задана в DERIVED_METRICS, а не через API
+	UpdatedAt  time.Time `json:"updated_at,omitempty"`
+}
+
+// QuarantinedPacket пакет, время устройства которого вышло за допуск относительно времени сервера.
+// Хранится до ручного разбора: выпуска в обработку или удаления.
+type QuarantinedPacket struct {
+	PacketID   uuid.UUID   `json:"packet_id"`
+	TenantID   string      `json:"-"`
+	SourceID   string      `json:"source_id,omitempty"`
+	Reason     string      `json:"reason"`    // too_old или too_new
+	Timestamp  time.Time   `json:"timestamp"` // время устройства
+	ReceivedAt time.Time   `json:"received_at"`
+	Packet     *DataPacket `json:"packet"`
+}
+
+// PacketSignature подпись пакета ключом KeyID источника, значение в base64
+type PacketSignature struct {
+	KeyID string `json:"key_id"`
+	Value string `json:"value"`
+}
+
+// SigningAlgorithm алгоритм подписи пакетов
+type SigningAlgorithm string
+
+const (
+	SigningAlgorithmHMACSHA256 SigningAlgorithm = "hmac-sha256"
+	SigningAlgorithmEd25519    SigningAlgorithm = "ed25519"
+)
+
+// SigningKey ключ проверки подписей источника арендатора: общий секрет HMAC или открытый ключ Ed25519.
+// У источника может быть несколько действующих ключей, чтобы ротация не прерывала приём.
+type SigningKey struct {
+	TenantID  string           `json:"tenant_id"`
+	SourceID  string           `json:"source_id"`
+	KeyID     string           `json:"key_id"`
+	Algorithm SigningAlgorithm `json:"algorithm"`
+	Key       []byte           `json:"-"` // не возвращается через API
+	CreatedAt time.Time        `json:"created_at"`
+	ExpiresAt *time.Time       `json:"expires_at,omitempty"` // nil — бессрочный
+}
+
+// Active сообщает, действует ли ключ в момент now
+func (k *SigningKey) Active(now time.Time) bool {
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// PacketSchema версия схемы пакетов источника арендатора. Версии источника нумеруются подряд с 1,
+// последняя версия считается текущей моделью пакета.
+type PacketSchema struct {
+	TenantID       string             `json:"tenant_id"`
+	SourceID       string             `json:"source_id"`
+	Version        int                `json:"version"`
+	Fields         []SchemaField      `json:"fields,omitempty"`       // именованные серии; пусто — пакет с безымянным пейлоадом
+	PayloadType    PayloadKind        `json:"payload_type,omitempty"` // тип безымянного пейлоада, пусто — любой
+	RequiredLabels []string           `json:"required_labels,omitempty"`
+	Constraints    PayloadConstraints `json:"constraints"`      // применяются к каждой серии
+	Upcast         *SchemaUpcast      `json:"upcast,omitempty"` // перевод пакета предыдущей версии в эту
+	CreatedAt      time.Time          `json:"created_at,omitempty"`
+}
+
+// SchemaField серия пакета в схеме
+type SchemaField struct {
+	Name     string      `json:"name"`
+	Type     PayloadKind `json:"type"` // целые значения допускаются и для float и decimal
+	Required bool        `json:"required,omitempty"`
+}
+
+// PayloadConstraints ограничения значений серии. Нулевые длины и nil границы не ограничивают.
+type PayloadConstraints struct {
+	MinLength int      `json:"min_length,omitempty"`
+	MaxLength int      `json:"max_length,omitempty"`
+	MinValue  *float64 `json:"min_value,omitempty"`
+	MaxValue  *float64 `json:"max_value,omitempty"`
+}
+
+// SchemaUpcast декларативный перевод пакета предыдущей версии схемы в текущую.
+// Шаги применяются в порядке полей.
+type SchemaUpcast struct {
+	PayloadToSeries string            `json:"payload_to_series,omitempty"` // безымянный пейлоад становится серией
+	RenameSeries    map[string]string `json:"rename_series,omitempty"`     // старое имя -> новое
+	DropSeries      []string          `json:"drop_series,omitempty"`
+	RenameLabels    map[string]string `json:"rename_labels,omitempty"`  // старый ключ -> новый
+	DefaultLabels   map[string]string `json:"default_labels,omitempty"` // добавляются, если лейбла нет
+}
+
+// TopKOrder направление выборки top-K
+type TopKOrder string
+
+const (
+	TopKOrderTop    TopKOrder = "top"    // наибольшие максимумы
+	TopKOrderBottom TopKOrder = "bottom" // наименьшие максимумы
+)
+
+// MaxTopK ограничивает размер выборки top-K
+const MaxTopK = 1000
+
+// RollupResolution задаёт гранулярность бакета роллапа
+type RollupResolution string
+
+const (
+	RollupResolutionMinute RollupResolution = "1m"
+	RollupResolutionHour   RollupResolution = "1h"
+	RollupResolutionDay    RollupResolution = "1d"
+)
+
+// RollupResolutions перечисляет доступные разрешения от самого грубого к самому мелкому
+var RollupResolutions = []RollupResolution{
+	RollupResolutionDay,
+	RollupResolutionHour,
+	RollupResolutionMinute,
+}
+
+// Duration возвращает длительность бакета для разрешения
+func (r RollupResolution) Duration() time.Duration {
+	switch r {
+	case RollupResolutionMinute:
+		return time.Minute
+	case RollupResolutionHour:
+		return time.Hour
+	case RollupResolutionDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// RollupBucket представляет агрегат обработанных значений за временной бакет
+type RollupBucket struct {
+	BucketStart time.Time        `json:"bucket_start" db:"bucket_start"`
+	Resolution  RollupResolution `json:"resolution" db:"-"`
+	MaxValue    int64            `json:"max_value" db:"max_value"` // округлены до целого и ограничены диапазоном int64,
+	MinValue    int64            `json:"min_value" db:"min_value"` // точные значения — в полях *Decimal
+	Count       int64            `json:"count" db:"count"`
+	Sum         int64            `json:"sum" db:"sum"`
+
+	// Точные максимум, минимум и сумма точных максимумов пакетов в десятичной записи
+	MaxValueDecimal string `json:"max_value_decimal" db:"max_value_decimal"`
+	MinValueDecimal string `json:"min_value_decimal" db:"min_value_decimal"`
+	SumDecimal      string `json:"sum_decimal" db:"sum_decimal"`
+}
+
+// RollupSketch счётчики DDSketch точных максимумов за бакет роллапа
+type RollupSketch struct {
+	BucketStart time.Time        `json:"bucket_start" db:"bucket_start"`
+	Buckets     map[string]int64 `json:"buckets" db:"sketch"`
+}
+
+// QuantileValue оценка квантиля
+type QuantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// MaxQuantiles ограничивает число квантилей в одном запросе
+const MaxQuantiles = 20
+
+// QuantileBucket квантили максимумов за интервал, построенные объединением скетчей роллапов
+type QuantileBucket struct {
+	BucketStart time.Time        `json:"bucket_start"`
+	Resolution  RollupResolution `json:"resolution"`
+	Count       int64            `json:"count"`
+	Quantiles   []QuantileValue  `json:"quantiles"`
+}
+
+// WindowResult представляет максимум по окну событийного времени
+type WindowResult struct {
+	TenantID        string    `json:"-" db:"tenant_id"`
+	SourceID        string    `json:"source_id,omitempty" db:"source_id"`
+	Series          string    `json:"series,omitempty" db:"series"` // пусто — безымянная серия
+	WindowStart     time.Time `json:"window_start" db:"window_start"`
+	WindowEnd       time.Time `json:"window_end" db:"window_end"`
+	MaxValue        int64     `json:"max_value" db:"max_value"`                 // округлён до целого и ограничен диапазоном int64
+	MaxValueDecimal string    `json:"max_value_decimal" db:"max_value_decimal"` // точный максимум в десятичной записи
+	Count           int64     `json:"count" db:"count"`
+	Late            bool      `json:"late" db:"late"` // результат обновлён опоздавшим пакетом
+	EmittedAt       time.Time `json:"emitted_at" db:"emitted_at"`
+}
+
+// LatePacket представляет пакет, пришедший позже допустимого опоздания
+type LatePacket struct {
 	PacketID        uuid.UUID `json:"packet_id" db:"packet_id"`
+	TenantID        string    `json:"-" db:"tenant_id"`
+	SourceID        string    `json:"source_id,omitempty" db:"source_id"`
+	Series          string    `json:"series,omitempty" db:"series"` // пусто — безымянная серия
 	PacketCreatedAt time.Time `json:"packet_created_at" db:"packet_created_at"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
-	MaxValue        int       `json:"max_value" db:"max_value"`
+	MaxValue        int64     `json:"max_value" db:"max_value"`
+	MaxValueDecimal string    `json:"max_value_decimal" db:"max_value_decimal"` // точный максимум в десятичной записи
+	Watermark       time.Time `json:"watermark" db:"watermark"`
+	ReceivedAt      time.Time `json:"received_at" db:"received_at"`
+}
+
+// RawPacket исходный пейлоад пакета, сохранённый в архиве
+type RawPacket struct {
+	PacketID        uuid.UUID                `json:"packet_id" db:"packet_id"`
+	TenantID        string                   `json:"-" db:"tenant_id"`
+	PacketCreatedAt time.Time                `json:"packet_created_at" db:"packet_created_at"`
+	ArchivedAt      time.Time                `json:"archived_at" db:"archived_at"`
+	PayloadKind     PayloadKind              `json:"payload_kind" db:"payload_kind"`
+	Payload         []int64                  `json:"payload,omitempty" db:"-"`
+	FloatPayload    []float64                `json:"float_payload,omitempty" db:"-"`
+	DecimalPayload  []string                 `json:"decimal_payload,omitempty" db:"-"`
+	Series          map[string]SeriesPayload `json:"series,omitempty" db:"-"`
+}
+
+// NewRawPacket копирует пейлоад пакета для архивации
+func NewRawPacket(packet *DataPacket, archivedAt time.Time) *RawPacket {
+	return &RawPacket{
+		PacketID:        packet.ID,
+		TenantID:        packet.Tenant(),
+		PacketCreatedAt: packet.Timestamp,
+		ArchivedAt:      archivedAt,
+		PayloadKind:     packet.PayloadKind(),
+		Payload:         packet.Payload,
+		FloatPayload:    packet.FloatPayload,
+		DecimalPayload:  packet.DecimalPayload,
+		Series:          packet.Series,
+	}
+}
+
+// DataPacket восстанавливает пакет из архива
+func (r *RawPacket) DataPacket() *DataPacket {
+	return &DataPacket{
+		ID:             r.PacketID,
+		TenantID:       r.TenantID,
+		Timestamp:      r.PacketCreatedAt,
+		Payload:        r.Payload,
+		FloatPayload:   r.FloatPayload,
+		DecimalPayload: r.DecimalPayload,
+		Series:         r.Series,
+	}
+}
+
+// RecomputeStatus состояние задачи пересчёта
+type RecomputeStatus string
+
+const (
+	RecomputeStatusRunning   RecomputeStatus = "running"
+	RecomputeStatusCompleted RecomputeStatus = "completed"
+	RecomputeStatusFailed    RecomputeStatus = "failed"
+	RecomputeStatusCancelled RecomputeStatus = "cancelled"
+)
+
+// RecomputeRequest параметры пересчёта результатов по архиву сырых пейлоадов.
+// Интервал задаётся по времени архивации (обработки) пакета.
+type RecomputeRequest struct {
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Functions     []string  `json:"functions"`
+	DryRun        bool      `json:"dry_run"`
+	RatePerSecond int       `json:"rate_per_second,omitempty"` // 0 — без ограничения
+}
+
+// RecomputeDiff расхождение пересчитанного значения с текущим
+type RecomputeDiff struct {
+	TenantID string    `json:"tenant_id"`
+	PacketID uuid.UUID `json:"packet_id"`
+	Series   string    `json:"series,omitempty"` // пусто — безымянная серия
+	Function string    `json:"function"`
+	OldValue string    `json:"old_value,omitempty"`
+	NewValue string    `json:"new_value"`
+}
+
+// RecomputeJob состояние и отчёт задачи пересчёта
+type RecomputeJob struct {
+	ID         uuid.UUID        `json:"id"`
+	Request    RecomputeRequest `json:"request"`
+	Status     RecomputeStatus  `json:"status"`
+	Total      int64            `json:"total"`
+	Processed  int64            `json:"processed"`
+	Written    int64            `json:"written"`
+	Changed    int64            `json:"changed"`
+	Diffs      []RecomputeDiff  `json:"diffs,omitempty"` // первые расхождения, ограничено по количеству
+	Error      string           `json:"error,omitempty"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
+
+// TenantPacketKey идентифицирует пакет арендатора: packet_id уникален только в пределах арендатора
+type TenantPacketKey struct {
+	TenantID string
+	PacketID uuid.UUID
+}
+
+// PacketSeriesKey идентифицирует серию пакета арендатора
+type PacketSeriesKey struct {
+	TenantID string
+	PacketID uuid.UUID
+	Series   string
+}
+
+// PacketResult версионированный результат функции агрегации для пакета
+type PacketResult struct {
+	TenantID   string    `json:"-" db:"tenant_id"`
+	PacketID   uuid.UUID `json:"packet_id" db:"packet_id"`
+	Series     string    `json:"series,omitempty" db:"series"` // пусто — безымянная серия
+	Function   string    `json:"function" db:"function"`
+	Version    int       `json:"version" db:"version"`
+	Value      string    `json:"value" db:"value"` // десятичная запись без потери точности
+	ComputedAt time.Time `json:"computed_at" db:"computed_at"`
+	JobID      uuid.UUID `json:"job_id" db:"job_id"`
+}
+
+// AlertCondition условие срабатывания правила
+type AlertCondition string
+
+const (
+	AlertConditionAbove AlertCondition = "above"
+	AlertConditionBelow AlertCondition = "below"
+	// AlertConditionAnomaly используется в уведомлениях детектора аномалий
+	AlertConditionAnomaly AlertCondition = "anomaly"
+)
+
+// AlertRule правило порогового алерта по обработанным значениям.
+// Без окна правило срабатывает после ForPackets нарушений подряд, с окном —
+// после ForPackets нарушений за последние WindowSeconds секунд.
+// Нарушения считаются и инциденты открываются отдельно по каждой серии источника.
+type AlertRule struct {
+	ID            uuid.UUID      `json:"id" db:"id"`
+	TenantID      string         `json:"-" db:"tenant_id"` // владелец правила, задаётся по аутентифицированному клиенту
+	Name          string         `json:"name" db:"name"`
+	SourceID      string         `json:"source_id,omitempty" db:"source_id"` // пусто — все источники
+	Series        []string       `json:"series,omitempty" db:"series"`       // имена серий, пусто — все серии, "" — безымянная
+	Condition     AlertCondition `json:"condition" db:"condition"`
+	Threshold     float64        `json:"threshold" db:"threshold"`
+	ForPackets    int            `json:"for_packets,omitempty" db:"for_packets"`
+	WindowSeconds int            `json:"window_seconds,omitempty" db:"window_seconds"`
+	Webhooks      []string       `json:"webhooks,omitempty" db:"webhooks"` // пусто — вебхуки по умолчанию
+	Disabled      bool           `json:"disabled,omitempty" db:"disabled"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// Matches сообщает, отбирает ли правило серию series источника sourceID
+func (r *AlertRule) Matches(sourceID, series string) bool {
+	if r.SourceID != "" && r.SourceID != sourceID {
+		return false
+	}
+	if len(r.Series) == 0 {
+		return true
+	}
+	for _, name := range r.Series {
+		if name == series {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertStatus состояние алерта в уведомлении
+type AlertStatus string
+
+const (
+	AlertStatusFiring   AlertStatus = "firing"
+	AlertStatusResolved AlertStatus = "resolved"
+)
+
+// AlertEvent переход правила в состояние firing или resolved.
+// IncidentID совпадает у firing и следующего за ним resolved и служит ключом дедупликации.
+type AlertEvent struct {
+	ID         uuid.UUID      `json:"id" db:"id"`
+	IncidentID uuid.UUID      `json:"incident_id" db:"incident_id"`
+	TenantID   string         `json:"tenant_id,omitempty" db:"tenant_id"`
+	RuleID     uuid.UUID      `json:"rule_id" db:"rule_id"`
+	RuleName   string         `json:"rule_name" db:"rule_name"`
+	SourceID   string         `json:"source_id,omitempty" db:"source_id"`
+	Series     string         `json:"series,omitempty" db:"series"` // пусто — безымянная серия
+	Status     AlertStatus    `json:"status" db:"status"`
+	Condition  AlertCondition `json:"condition" db:"condition"`
+	Threshold  float64        `json:"threshold" db:"threshold"`
+	Value      float64        `json:"value" db:"value"`
+	Score      *float64       `json:"score,omitempty" db:"-"` // оценка аномальности для уведомлений детектора
+	PacketID   uuid.UUID      `json:"packet_id" db:"packet_id"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+}
+
+// AnomalyMethod метод оценки аномальности значения
+type AnomalyMethod string
+
+const (
+	AnomalyMethodEWMA AnomalyMethod = "ewma" // z-score относительно экспоненциально сглаженных среднего и дисперсии
+	AnomalyMethodMAD  AnomalyMethod = "mad"  // модифицированный z-score по медиане и MAD последних значений
+)
+
+// AnomalyParams параметры детектора аномалий для источника арендатора
+type AnomalyParams struct {
+	TenantID   string        `json:"tenant_id" db:"tenant_id"`
+	SourceID   string        `json:"source_id" db:"source_id"`
+	Method     AnomalyMethod `json:"method" db:"method"`
+	Alpha      float64       `json:"alpha,omitempty" db:"alpha"`             // коэффициент сглаживания EWMA
+	Threshold  float64       `json:"threshold" db:"threshold"`               // порог |score| для аномалии
+	WarmUp     int           `json:"warm_up,omitempty" db:"warm_up"`         // сколько значений накопить до оценки
+	WindowSize int           `json:"window_size,omitempty" db:"window_size"` // число значений для MAD
+	Notify     bool          `json:"notify,omitempty" db:"notify"`
+}
+
+// Partition партиция таблицы с диапазоном значений ключа [From, To)
+type Partition struct {
+	Name string    `json:"name"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Статусы записей журнала срока хранения партиций
+const (
+	RetentionStatusPlanned = "planned" // пробный прогон: партиция была бы удалена
+	RetentionStatusDropped = "dropped"
+	RetentionStatusFailed  = "failed"
+)
+
+// RetentionAuditEntry запись журнала применения срока хранения к партиции
+type RetentionAuditEntry struct {
+	ID         int64     `json:"id" db:"id"`
+	Partition  string    `json:"partition" db:"partition_name"`
+	RangeFrom  time.Time `json:"range_from" db:"range_from"`
+	RangeTo    time.Time `json:"range_to" db:"range_to"`
+	Status     string    `json:"status" db:"status"`
+	DryRun     bool      `json:"dry_run" db:"dry_run"`
+	Bytes      int64     `json:"bytes" db:"bytes"` // размер партиции с индексами перед удалением
+	ExportPath string    `json:"export_path,omitempty" db:"export_path"`
+	Error      string    `json:"error,omitempty" db:"error"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 }
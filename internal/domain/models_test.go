@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataPacket_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		kind     PayloadKind
+		ints     []int64
+		floats   []float64
+		decimals []string
+	}{
+		{
+			name: "integer payload",
+			body: `{"id":"123e4567-e89b-12d3-a456-426614174000","timestamp":"2025-09-01T00:00:00Z","payload":[1,5,3]}`,
+			kind: PayloadKindInt,
+			ints: []int64{1, 5, 3},
+		},
+		{
+			name:   "fractional payload",
+			body:   `{"id":"123e4567-e89b-12d3-a456-426614174000","timestamp":"2025-09-01T00:00:00Z","payload":[1,2.5,-0.25]}`,
+			kind:   PayloadKindFloat,
+			floats: []float64{1, 2.5, -0.25},
+		},
+		{
+			name:     "decimal payload",
+			body:     `{"id":"123e4567-e89b-12d3-a456-426614174000","timestamp":"2025-09-01T00:00:00Z","decimal_payload":["1.10","2.005"]}`,
+			kind:     PayloadKindDecimal,
+			decimals: []string{"1.10", "2.005"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var packet DataPacket
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &packet))
+			assert.Equal(t, tt.kind, packet.PayloadKind())
+			assert.Equal(t, "123e4567-e89b-12d3-a456-426614174000", packet.ID.String())
+			if tt.ints != nil {
+				assert.Equal(t, tt.ints, packet.Payload)
+			}
+			assert.Equal(t, tt.floats, packet.FloatPayload)
+			assert.Equal(t, tt.decimals, packet.DecimalPayload)
+		})
+	}
+}
+
+func TestDataPacket_UnmarshalJSON_Int64Range(t *testing.T) {
+	var packet DataPacket
+	require.NoError(t, json.Unmarshal([]byte(`{"payload":[9223372036854775807,-9223372036854775808]}`), &packet))
+	assert.Equal(t, []int64{9223372036854775807, -9223372036854775808}, packet.Payload)
+
+	err := json.Unmarshal([]byte(`{"payload":[9223372036854775808]}`), &packet)
+	assert.ErrorIs(t, err, ErrValueOutOfRange)
+}
+
+func TestDataPacket_UnmarshalJSON_Series(t *testing.T) {
+	var packet DataPacket
+	body := `{"timestamp":"2025-09-01T00:00:00Z","series":{"temp":[20.5,21],"rpm":[900,1200],"volts":{"decimal_payload":["3.30"]}}}`
+	require.NoError(t, json.Unmarshal([]byte(body), &packet))
+
+	assert.Equal(t, []string{"rpm", "temp", "volts"}, packet.SeriesNames())
+	assert.Equal(t, SeriesPayload{Payload: []int64{900, 1200}}, packet.SeriesValues("rpm"))
+	assert.Equal(t, PayloadKindFloat, packet.SeriesValues("temp").Kind())
+	assert.Equal(t, []float64{20.5, 21}, packet.SeriesValues("temp").FloatPayload)
+	assert.Equal(t, PayloadKindDecimal, packet.SeriesValues("volts").Kind())
+	assert.Equal(t, 0, packet.PayloadLen())
+
+	// Пакет без серий состоит из одной безымянной серии
+	var plain DataPacket
+	require.NoError(t, json.Unmarshal([]byte(`{"payload":[1,2]}`), &plain))
+	assert.Equal(t, []string{DefaultSeries}, plain.SeriesNames())
+	assert.Equal(t, 2, plain.SeriesValues(DefaultSeries).Len())
+
+	err := json.Unmarshal([]byte(`{"series":{"big":[9223372036854775808]}}`), &packet)
+	assert.ErrorIs(t, err, ErrValueOutOfRange)
+}
+
+func TestPageCursor_EncodeDecode(t *testing.T) {
+	data := &ProcessedData{
+		PacketID:        uuid.New(),
+		Series:          "temp",
+		PacketCreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		CreatedAt:       time.Date(2025, 9, 1, 12, 0, 0, 123456000, time.UTC),
+	}
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	query := PageQueryHash(start, end, PacketFilter{SourceID: "pump", Series: []string{"temp", "rpm"}})
+
+	cursor, err := DecodePageCursor(CursorAfter(data, "", query).Encode(), TimeAxisProcessing, query)
+	require.NoError(t, err)
+	assert.True(t, cursor.Time.Equal(data.CreatedAt))
+	assert.Equal(t, data.PacketID, cursor.PacketID)
+	assert.Equal(t, "temp", cursor.Series)
+
+	eventQuery := PageQueryHash(start, end, PacketFilter{TimeAxis: TimeAxisEvent})
+	cursor, err = DecodePageCursor(CursorAfter(data, TimeAxisEvent, eventQuery).Encode(), TimeAxisEvent, eventQuery)
+	require.NoError(t, err)
+	assert.True(t, cursor.Time.Equal(data.PacketCreatedAt))
+
+	_, err = DecodePageCursor(CursorAfter(data, TimeAxisEvent, eventQuery).Encode(), "", query)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = DecodePageCursor("%%%", "", query)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = DecodePageCursor("e30", "", query)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// Курсор не принимается с другим интервалом или фильтром
+	encoded := CursorAfter(data, "", query).Encode()
+	for _, other := range []string{
+		PageQueryHash(start, end.Add(time.Hour), PacketFilter{SourceID: "pump", Series: []string{"temp", "rpm"}}),
+		PageQueryHash(start, end, PacketFilter{SourceID: "fan", Series: []string{"temp", "rpm"}}),
+		PageQueryHash(start, end, PacketFilter{SourceID: "pump", Series: []string{"temp"}}),
+		PageQueryHash(start, end, PacketFilter{SourceID: "pump", Series: []string{"temp", "rpm"}, Labels: map[string]string{"site": "a"}}),
+	} {
+		_, err = DecodePageCursor(encoded, "", other)
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	}
+
+	// Порядок серий и часовой пояс границ не меняют отпечаток
+	same := PageQueryHash(start.In(time.FixedZone("MSK", 3*3600)), end, PacketFilter{SourceID: "pump", Series: []string{"rpm", "temp"}})
+	_, err = DecodePageCursor(encoded, "", same)
+	assert.NoError(t, err)
+}
+
+func TestDecimalToInt64(t *testing.T) {
+	// Сумма двух значений около math.MaxInt64 не помещается в int64 и ограничивается его границей
+	sum := new(big.Int).Add(big.NewInt(math.MaxInt64-1), big.NewInt(math.MaxInt64-2))
+	value, overflow, err := DecimalToInt64(sum.String())
+	require.NoError(t, err)
+	assert.True(t, overflow)
+	assert.Equal(t, int64(math.MaxInt64), value)
+
+	value, overflow, err = DecimalToInt64("-" + sum.String())
+	require.NoError(t, err)
+	assert.True(t, overflow)
+	assert.Equal(t, int64(math.MinInt64), value)
+
+	value, overflow, err = DecimalToInt64("9223372036854775807")
+	require.NoError(t, err)
+	assert.False(t, overflow)
+	assert.Equal(t, int64(math.MaxInt64), value)
+
+	for text, expected := range map[string]int64{"2.5": 3, "-2.5": -3, "2.49": 2, "-0.4": 0, "12.340": 12} {
+		value, _, err := DecimalToInt64(text)
+		require.NoError(t, err)
+		assert.Equal(t, expected, value, text)
+	}
+
+	_, _, err = DecimalToInt64("abc")
+	assert.Error(t, err)
+}
+
+func TestProcessedData_ExactDecimal(t *testing.T) {
+	huge := 1e19
+	assert.Equal(t, "10000000000000000000", (&ProcessedData{MaxValue: math.MaxInt64, MaxValueFloat: &huge}).ExactDecimal())
+	assert.Equal(t, "-12.340", (&ProcessedData{MaxValue: -12, MaxValueDecimal: "-12.340"}).ExactDecimal())
+	assert.Equal(t, "42", (&ProcessedData{MaxValue: 42}).ExactDecimal())
+}
@@ -0,0 +1,158 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pb "github.com/CoolE88/data-aggregation-service/gen/go/aggregator/v1"
+	"github.com/CoolE88/data-aggregation-service/internal/alert"
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AlertService управляет правилами алертов
+type AlertService interface {
+	CreateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error)
+	UpdateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error)
+	DeleteRule(ctx context.Context, id uuid.UUID) error
+	GetRule(ctx context.Context, id uuid.UUID) (*domain.AlertRule, bool)
+	ListRules(ctx context.Context) []*domain.AlertRule
+}
+
+// SetAlertService подключает управление правилами алертов, вызывается до Start
+func (s *GRPCServer) SetAlertService(svc AlertService) {
+	s.alerts = svc
+}
+
+func (s *GRPCServer) CreateAlertRule(ctx context.Context, req *pb.AlertRule) (*pb.AlertRule, error) {
+	if s.alerts == nil {
+		return nil, status.Error(codes.Unimplemented, "alert rules are not enabled")
+	}
+
+	rule, err := s.alerts.CreateRule(ctx, alertRuleFromProto(req))
+	if err != nil {
+		return nil, s.alertError(err)
+	}
+
+	return alertRuleToProto(rule), nil
+}
+
+func (s *GRPCServer) GetAlertRule(ctx context.Context, req *pb.AlertRuleID) (*pb.AlertRule, error) {
+	if s.alerts == nil {
+		return nil, status.Error(codes.Unimplemented, "alert rules are not enabled")
+	}
+
+	id, err := uuid.Parse(req.Id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid rule id")
+	}
+
+	rule, ok := s.alerts.GetRule(ctx, id)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "alert rule not found")
+	}
+
+	return alertRuleToProto(rule), nil
+}
+
+func (s *GRPCServer) ListAlertRules(ctx context.Context, _ *pb.ListAlertRulesRequest) (*pb.ListAlertRulesResponse, error) {
+	if s.alerts == nil {
+		return nil, status.Error(codes.Unimplemented, "alert rules are not enabled")
+	}
+
+	rules := s.alerts.ListRules(ctx)
+	response := &pb.ListAlertRulesResponse{
+		Rules: make([]*pb.AlertRule, len(rules)),
+	}
+	for i, rule := range rules {
+		response.Rules[i] = alertRuleToProto(rule)
+	}
+
+	return response, nil
+}
+
+func (s *GRPCServer) UpdateAlertRule(ctx context.Context, req *pb.AlertRule) (*pb.AlertRule, error) {
+	if s.alerts == nil {
+		return nil, status.Error(codes.Unimplemented, "alert rules are not enabled")
+	}
+
+	id, err := uuid.Parse(req.Id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid rule id")
+	}
+
+	update := alertRuleFromProto(req)
+	update.ID = id
+
+	rule, err := s.alerts.UpdateRule(ctx, update)
+	if err != nil {
+		return nil, s.alertError(err)
+	}
+
+	return alertRuleToProto(rule), nil
+}
+
+func (s *GRPCServer) DeleteAlertRule(ctx context.Context, req *pb.AlertRuleID) (*pb.DeleteAlertRuleResponse, error) {
+	if s.alerts == nil {
+		return nil, status.Error(codes.Unimplemented, "alert rules are not enabled")
+	}
+
+	id, err := uuid.Parse(req.Id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid rule id")
+	}
+
+	if err := s.alerts.DeleteRule(ctx, id); err != nil {
+		return nil, s.alertError(err)
+	}
+
+	return &pb.DeleteAlertRuleResponse{}, nil
+}
+
+func (s *GRPCServer) alertError(err error) error {
+	switch {
+	case errors.Is(err, alert.ErrInvalidRule):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, alert.ErrRuleNotFound):
+		return status.Error(codes.NotFound, "alert rule not found")
+	default:
+		s.logger.Error("Alert rule operation failed", zap.Error(err))
+		return status.Error(codes.Internal, "alert rule operation failed")
+	}
+}
+
+func alertRuleFromProto(req *pb.AlertRule) domain.AlertRule {
+	return domain.AlertRule{
+		Name:          req.Name,
+		SourceID:      req.SourceId,
+		Series:        req.Series,
+		Condition:     domain.AlertCondition(req.Condition),
+		Threshold:     req.Threshold,
+		ForPackets:    int(req.ForPackets),
+		WindowSeconds: int(req.WindowSeconds),
+		Webhooks:      req.Webhooks,
+		Disabled:      req.Disabled,
+	}
+}
+
+func alertRuleToProto(rule *domain.AlertRule) *pb.AlertRule {
+	return &pb.AlertRule{
+		Id:            rule.ID.String(),
+		Name:          rule.Name,
+		SourceId:      rule.SourceID,
+		Series:        rule.Series,
+		Condition:     string(rule.Condition),
+		Threshold:     rule.Threshold,
+		ForPackets:    int32(rule.ForPackets),    //nolint:gosec // ограничено при валидации правила
+		WindowSeconds: int32(rule.WindowSeconds), //nolint:gosec // ограничено при валидации правила
+		Webhooks:      rule.Webhooks,
+		Disabled:      rule.Disabled,
+		CreatedAt:     rule.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:     rule.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
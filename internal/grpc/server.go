@@ -2,34 +2,52 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"math"
 	"net"
+	"strings"
 	"time"
 
 	pb "github.com/CoolE88/data-aggregation-service/gen/go/aggregator/v1"
 	"github.com/CoolE88/data-aggregation-service/internal/domain"
 	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
 
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
 
 // DataService описывает бизнес-логику для получения данных
 type DataService interface {
-	GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time) ([]*domain.ProcessedData, error)
-	GetMaxValueByPacketID(ctx context.Context, packetID string) (*domain.ProcessedData, error)
+	GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, page domain.PageRequest) (*domain.MaxValuesPage, error)
+	StreamMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, fn func(*domain.ProcessedData) error) error
+	GetMaxValueByPacketID(ctx context.Context, packetID, series string) (*domain.ProcessedData, error)
+	GetTopK(ctx context.Context, start, end time.Time, k int, order domain.TopKOrder, filter domain.PacketFilter) ([]*domain.ProcessedData, error)
+	GetRollups(ctx context.Context, start, end time.Time, step time.Duration, series string) ([]*domain.RollupBucket, error)
+	GetQuantiles(ctx context.Context, start, end time.Time, step time.Duration, quantiles []float64, series string) ([]*domain.QuantileBucket, error)
+	GetRawPacket(ctx context.Context, packetID string) (*domain.RawPacket, error)
 	CheckDBConnection(ctx context.Context) error
 }
 
+// Authenticator определяет арендатора по API-ключу клиента
+type Authenticator interface {
+	Authenticate(key string) (string, error)
+}
+
 // GRPCServer реализует gRPC сервер с метриками и логированием
 type GRPCServer struct {
 	pb.UnimplementedDataAggregationServiceServer
 	server  *grpc.Server
 	service DataService
+	alerts  AlertService
+	auth    Authenticator
 	logger  *zap.Logger
 }
 
@@ -38,17 +56,24 @@ func NewGRPCServer(service DataService, logger *zap.Logger) *GRPCServer {
 	metricsInterceptor := grpc_prometheus.UnaryServerInterceptor
 	customMetricsInterceptor := unaryMetricsInterceptor()
 
+	s := &GRPCServer{
+		service: service,
+		logger:  logger,
+	}
+
 	chain := grpc.ChainUnaryInterceptor(
 		loggingInterceptor,
 		metricsInterceptor,
+		s.authInterceptor,
 		customMetricsInterceptor,
 	)
-
-	s := &GRPCServer{
-		server:  grpc.NewServer(chain),
-		service: service,
-		logger:  logger,
-	}
+	streamChain := grpc.ChainStreamInterceptor(
+		logging.StreamServerInterceptor(interceptorLogger(logger)),
+		grpc_prometheus.StreamServerInterceptor,
+		s.streamAuthInterceptor,
+		streamMetricsInterceptor(),
+	)
+	s.server = grpc.NewServer(chain, streamChain)
 
 	pb.RegisterDataAggregationServiceServer(s.server, s)
 	reflection.Register(s.server)
@@ -59,6 +84,12 @@ func NewGRPCServer(service DataService, logger *zap.Logger) *GRPCServer {
 	return s
 }
 
+// SetAuthenticator включает аутентификацию по API-ключу. Без него все вызовы
+// выполняются от арендатора по умолчанию. Вызывать до Start.
+func (s *GRPCServer) SetAuthenticator(auth Authenticator) {
+	s.auth = auth
+}
+
 func (s *GRPCServer) Start(addr string) error {
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
@@ -87,6 +118,65 @@ func (s *GRPCServer) Shutdown(ctx context.Context) error {
 	}
 }
 
+// authInterceptor определяет арендатора по ключу из метаданных x-api-key или authorization: Bearer
+func (s *GRPCServer) authInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	tenantID := domain.DefaultTenantID
+	if s.auth != nil {
+		id, err := s.auth.Authenticate(apiKey(ctx))
+		if err != nil {
+			metrics.GRPCRequests.WithLabelValues(info.FullMethod, codes.Unauthenticated.String(), "").Inc()
+			return nil, status.Error(codes.Unauthenticated, "invalid or missing api key")
+		}
+		tenantID = id
+	}
+
+	return handler(tenant.WithID(ctx, tenantID), req)
+}
+
+// streamAuthInterceptor определяет арендатора потокового вызова так же, как authInterceptor
+func (s *GRPCServer) streamAuthInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	tenantID := domain.DefaultTenantID
+	if s.auth != nil {
+		id, err := s.auth.Authenticate(apiKey(stream.Context()))
+		if err != nil {
+			metrics.GRPCRequests.WithLabelValues(info.FullMethod, codes.Unauthenticated.String(), "").Inc()
+			return status.Error(codes.Unauthenticated, "invalid or missing api key")
+		}
+		tenantID = id
+	}
+
+	wrapped := grpc_middleware.WrapServerStream(stream)
+	wrapped.WrappedContext = tenant.WithID(stream.Context(), tenantID)
+	return handler(srv, wrapped)
+}
+
+// apiKey возвращает ключ клиента из метаданных вызова
+func apiKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get("x-api-key"); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		if token, ok := strings.CutPrefix(values[0], "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
+
 // Custom metrics interceptor для детального отслеживания статусов и длительности с статусом
 func unaryMetricsInterceptor() grpc.UnaryServerInterceptor {
 	return func(
@@ -111,14 +201,37 @@ func unaryMetricsInterceptor() grpc.UnaryServerInterceptor {
 		}
 
 		duration := time.Since(start).Seconds()
+		tenantID, _ := tenant.FromContext(ctx)
 
-		metrics.GRPCRequests.WithLabelValues(info.FullMethod, statusCode).Inc()
+		metrics.GRPCRequests.WithLabelValues(info.FullMethod, statusCode, tenantID).Inc()
 		metrics.GRPCRequestDuration.WithLabelValues(info.FullMethod, statusCode).Observe(duration)
 
 		return resp, err
 	}
 }
 
+// streamMetricsInterceptor учитывает потоковые вызовы в тех же метриках, что и unaryMetricsInterceptor
+func streamMetricsInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+
+		err := handler(srv, stream)
+
+		statusCode := status.Code(err).String()
+		tenantID, _ := tenant.FromContext(stream.Context())
+
+		metrics.GRPCRequests.WithLabelValues(info.FullMethod, statusCode, tenantID).Inc()
+		metrics.GRPCRequestDuration.WithLabelValues(info.FullMethod, statusCode).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
 // Logger adapter для grpc middleware
 func interceptorLogger(l *zap.Logger) logging.Logger {
 	return logging.LoggerFunc(func(_ context.Context, lvl logging.Level, msg string, fields ...any) {
@@ -145,7 +258,122 @@ func interceptorLogger(l *zap.Logger) logging.Logger {
 	})
 }
 
+// narrowToInt32 заполняет устаревшее int32 поле. Значение вне диапазона не усекается:
+// поле остаётся нулевым, а клиент получает флаг переполнения.
+func narrowToInt32(value int64) (int32, bool) {
+	if value < math.MinInt32 || value > math.MaxInt32 {
+		metrics.GRPCLegacyValueOverflow.Inc()
+		return 0, true
+	}
+	return int32(value), false
+}
+
 func (s *GRPCServer) GetMaxValuesByPeriod(ctx context.Context, req *pb.TimePeriod) (*pb.MaxValuesResponse, error) {
+	startTime, endTime, filter, err := periodFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+
+	page := domain.PageRequest{Limit: int(req.PageSize), Cursor: req.PageToken}
+	data, err := s.service.GetMaxValuesByTimeRange(ctx, startTime, endTime, filter, page)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCursor) || errors.Is(err, domain.ErrInvalidQuery) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		s.logger.Error("Failed to get max values by period", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to retrieve data")
+	}
+
+	response := &pb.MaxValuesResponse{
+		MaxValues:     make([]*pb.MaxValue, len(data.MaxValues)),
+		NextPageToken: data.NextCursor,
+	}
+
+	for i, item := range data.MaxValues {
+		response.MaxValues[i] = maxValueToProto(item)
+	}
+
+	return response, nil
+}
+
+// StreamMaxValuesByPeriod отправляет все результаты за период по мере чтения из базы.
+// Отмена вызова клиентом отменяет контекст потока и останавливает запрос.
+func (s *GRPCServer) StreamMaxValuesByPeriod(req *pb.TimePeriod, stream grpc.ServerStreamingServer[pb.MaxValue]) error {
+	startTime, endTime, filter, err := periodFilter(req)
+	if err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	err = s.service.StreamMaxValuesByTimeRange(ctx, startTime, endTime, filter, func(item *domain.ProcessedData) error {
+		return stream.Send(maxValueToProto(item))
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		if _, ok := status.FromError(err); ok {
+			// Ошибка Send уже содержит код gRPC
+			return err
+		}
+		if errors.Is(err, domain.ErrInvalidQuery) {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		s.logger.Error("Failed to stream max values by period", zap.Error(err))
+		return status.Error(codes.Internal, "failed to retrieve data")
+	}
+	return nil
+}
+
+// periodFilter разбирает период и фильтр запроса результатов за период
+func periodFilter(req *pb.TimePeriod) (time.Time, time.Time, domain.PacketFilter, error) {
+	if req.StartTime == "" || req.EndTime == "" {
+		return time.Time{}, time.Time{}, domain.PacketFilter{}, status.Error(codes.InvalidArgument, "start_time and end_time are required")
+	}
+
+	startTime, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, domain.PacketFilter{}, status.Error(codes.InvalidArgument, "invalid start_time format, expected RFC3339")
+	}
+
+	endTime, err := time.Parse(time.RFC3339, req.EndTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, domain.PacketFilter{}, status.Error(codes.InvalidArgument, "invalid end_time format, expected RFC3339")
+	}
+
+	timeAxis := domain.TimeAxis(req.TimeAxis)
+	if !timeAxis.Valid() {
+		return time.Time{}, time.Time{}, domain.PacketFilter{}, status.Error(codes.InvalidArgument, "time_axis must be event or processing")
+	}
+
+	filter := domain.PacketFilter{SourceID: req.SourceId, Labels: req.Labels, Series: req.Series, TimeAxis: timeAxis}
+	return startTime, endTime, filter, nil
+}
+
+func maxValueToProto(item *domain.ProcessedData) *pb.MaxValue {
+	legacyValue, overflow := narrowToInt32(item.MaxValue)
+	return &pb.MaxValue{
+		Id:               item.PacketID.String(),
+		MaxValue:         legacyValue,
+		ValueKind:        string(item.ValueKind),
+		MaxValueFloat:    item.MaxValueFloat,
+		MaxValueDecimal:  item.MaxValueDecimal,
+		MaxValueInt64:    item.MaxValue,
+		MaxValueOverflow: overflow,
+		AnomalyScore:     item.AnomalyScore,
+		Anomalous:        item.Anomalous,
+		Derived:          item.Derived,
+		SourceId:         item.SourceID,
+		Labels:           item.Labels,
+		Series:           item.Series,
+	}
+}
+
+func (s *GRPCServer) GetTopK(ctx context.Context, req *pb.TopKRequest) (*pb.MaxValuesResponse, error) {
 	if req.StartTime == "" || req.EndTime == "" {
 		return nil, status.Error(codes.InvalidArgument, "start_time and end_time are required")
 	}
@@ -160,9 +388,34 @@ func (s *GRPCServer) GetMaxValuesByPeriod(ctx context.Context, req *pb.TimePerio
 		return nil, status.Error(codes.InvalidArgument, "invalid end_time format, expected RFC3339")
 	}
 
-	data, err := s.service.GetMaxValuesByTimeRange(ctx, startTime, endTime)
+	k := int(req.K)
+	if k == 0 {
+		k = 10
+	}
+	if k < 1 || k > domain.MaxTopK {
+		return nil, status.Errorf(codes.InvalidArgument, "k must be in [1, %d]", domain.MaxTopK)
+	}
+
+	order := domain.TopKOrder(req.Order)
+	if order == "" {
+		order = domain.TopKOrderTop
+	}
+	if order != domain.TopKOrderTop && order != domain.TopKOrderBottom {
+		return nil, status.Error(codes.InvalidArgument, "order must be top or bottom")
+	}
+
+	timeAxis := domain.TimeAxis(req.TimeAxis)
+	if !timeAxis.Valid() {
+		return nil, status.Error(codes.InvalidArgument, "time_axis must be event or processing")
+	}
+
+	filter := domain.PacketFilter{SourceID: req.SourceId, Labels: req.Labels, Series: req.Series, TimeAxis: timeAxis}
+	data, err := s.service.GetTopK(ctx, startTime, endTime, k, order, filter)
 	if err != nil {
-		s.logger.Error("Failed to get max values by period", zap.Error(err))
+		if errors.Is(err, domain.ErrInvalidQuery) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		s.logger.Error("Failed to get top-k", zap.Error(err))
 		return nil, status.Error(codes.Internal, "failed to retrieve data")
 	}
 
@@ -171,10 +424,7 @@ func (s *GRPCServer) GetMaxValuesByPeriod(ctx context.Context, req *pb.TimePerio
 	}
 
 	for i, item := range data {
-		response.MaxValues[i] = &pb.MaxValue{
-			Id:       item.PacketID.String(),
-			MaxValue: int32(item.MaxValue),
-		}
+		response.MaxValues[i] = maxValueToProto(item)
 	}
 
 	return response, nil
@@ -185,7 +435,7 @@ func (s *GRPCServer) GetMaxValueByID(ctx context.Context, req *pb.PackageID) (*p
 		return nil, status.Error(codes.InvalidArgument, "id is required")
 	}
 
-	data, err := s.service.GetMaxValueByPacketID(ctx, req.Id)
+	data, err := s.service.GetMaxValueByPacketID(ctx, req.Id, req.Series)
 	if err != nil {
 		s.logger.Error("Failed to get max value by ID", zap.Error(err))
 		return nil, status.Error(codes.Internal, "failed to retrieve packet")
@@ -195,10 +445,176 @@ func (s *GRPCServer) GetMaxValueByID(ctx context.Context, req *pb.PackageID) (*p
 		return nil, status.Error(codes.NotFound, "packet not found")
 	}
 
+	legacyValue, overflow := narrowToInt32(data.MaxValue)
 	response := &pb.MaxValueResponse{
-		Id:       data.PacketID.String(),
-		MaxValue: int32(data.MaxValue),
+		Id:               data.PacketID.String(),
+		MaxValue:         legacyValue,
+		ValueKind:        string(data.ValueKind),
+		MaxValueFloat:    data.MaxValueFloat,
+		MaxValueDecimal:  data.MaxValueDecimal,
+		MaxValueInt64:    data.MaxValue,
+		MaxValueOverflow: overflow,
+		AnomalyScore:     data.AnomalyScore,
+		Anomalous:        data.Anomalous,
+		Derived:          data.Derived,
+		SourceId:         data.SourceID,
+		Labels:           data.Labels,
+		Series:           data.Series,
+	}
+
+	return response, nil
+}
+
+func (s *GRPCServer) GetRollups(ctx context.Context, req *pb.RollupRequest) (*pb.RollupResponse, error) {
+	if req.StartTime == "" || req.EndTime == "" || req.Step == "" {
+		return nil, status.Error(codes.InvalidArgument, "start_time, end_time and step are required")
+	}
+
+	startTime, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid start_time format, expected RFC3339")
+	}
+
+	endTime, err := time.Parse(time.RFC3339, req.EndTime)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid end_time format, expected RFC3339")
+	}
+
+	step, err := time.ParseDuration(req.Step)
+	if err != nil || step <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid step format, expected duration like 1m or 24h")
+	}
+
+	data, err := s.service.GetRollups(ctx, startTime, endTime, step, req.Series)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidQuery) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		s.logger.Error("Failed to get rollups", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to retrieve rollups")
+	}
+
+	response := &pb.RollupResponse{
+		Buckets: make([]*pb.RollupBucket, len(data)),
+	}
+
+	for i, item := range data {
+		response.Resolution = string(item.Resolution)
+		response.Buckets[i] = &pb.RollupBucket{
+			BucketStart:     item.BucketStart.UTC().Format(time.RFC3339),
+			MaxValue:        item.MaxValue,
+			MinValue:        item.MinValue,
+			Count:           item.Count,
+			Sum:             item.Sum,
+			SumDecimal:      item.SumDecimal,
+			MaxValueDecimal: item.MaxValueDecimal,
+			MinValueDecimal: item.MinValueDecimal,
+		}
+	}
+
+	return response, nil
+}
+
+func (s *GRPCServer) GetQuantiles(ctx context.Context, req *pb.QuantileRequest) (*pb.QuantileResponse, error) {
+	if req.StartTime == "" || req.EndTime == "" || len(req.Quantiles) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "start_time, end_time and quantiles are required")
+	}
+
+	startTime, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid start_time format, expected RFC3339")
+	}
+
+	endTime, err := time.Parse(time.RFC3339, req.EndTime)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid end_time format, expected RFC3339")
+	}
+
+	if len(req.Quantiles) > domain.MaxQuantiles {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d quantiles are allowed", domain.MaxQuantiles)
+	}
+	for _, q := range req.Quantiles {
+		if q < 0 || q > 1 || math.IsNaN(q) {
+			return nil, status.Error(codes.InvalidArgument, "quantiles must be in [0, 1]")
+		}
+	}
+
+	var step time.Duration
+	if req.Step != "" {
+		step, err = time.ParseDuration(req.Step)
+		if err != nil || step <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid step format, expected duration like 1m or 24h")
+		}
+	}
+
+	data, err := s.service.GetQuantiles(ctx, startTime, endTime, step, req.Quantiles, req.Series)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidQuery) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		s.logger.Error("Failed to get quantiles", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to retrieve quantiles")
+	}
+
+	response := &pb.QuantileResponse{
+		Buckets: make([]*pb.QuantileBucket, len(data)),
+	}
+
+	for i, item := range data {
+		response.Resolution = string(item.Resolution)
+		bucket := &pb.QuantileBucket{
+			BucketStart: item.BucketStart.UTC().Format(time.RFC3339),
+			Count:       item.Count,
+			Quantiles:   make([]*pb.QuantileValue, len(item.Quantiles)),
+		}
+		for j, q := range item.Quantiles {
+			bucket.Quantiles[j] = &pb.QuantileValue{Quantile: q.Quantile, Value: q.Value}
+		}
+		response.Buckets[i] = bucket
 	}
 
 	return response, nil
 }
+
+func (s *GRPCServer) GetRawPacket(ctx context.Context, req *pb.PackageID) (*pb.RawPacketResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	data, err := s.service.GetRawPacket(ctx, req.Id)
+	if err != nil {
+		s.logger.Error("Failed to get raw packet", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to retrieve raw packet")
+	}
+
+	if data == nil {
+		return nil, status.Error(codes.NotFound, "raw packet not found")
+	}
+
+	return &pb.RawPacketResponse{
+		Id:              data.PacketID.String(),
+		PacketCreatedAt: data.PacketCreatedAt.UTC().Format(time.RFC3339Nano),
+		ArchivedAt:      data.ArchivedAt.UTC().Format(time.RFC3339Nano),
+		PayloadKind:     string(data.PayloadKind),
+		Payload:         data.Payload,
+		FloatPayload:    data.FloatPayload,
+		DecimalPayload:  data.DecimalPayload,
+		Series:          seriesToProto(data.Series),
+	}, nil
+}
+
+func seriesToProto(series map[string]domain.SeriesPayload) map[string]*pb.SeriesValues {
+	if len(series) == 0 {
+		return nil
+	}
+
+	result := make(map[string]*pb.SeriesValues, len(series))
+	for name, values := range series {
+		result[name] = &pb.SeriesValues{
+			Payload:        values.Payload,
+			FloatPayload:   values.FloatPayload,
+			DecimalPayload: values.DecimalPayload,
+		}
+	}
+	return result
+}
@@ -2,17 +2,23 @@ package grpc
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"testing"
 	"time"
 
 	pb "github.com/CoolE88/data-aggregation-service/gen/go/aggregator/v1"
+	"github.com/CoolE88/data-aggregation-service/internal/alert"
 	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -20,22 +26,67 @@ type MockService struct {
 	mock.Mock
 }
 
-func (m *MockService) GetMaxValueByPacketID(ctx context.Context, packetID string) (*domain.ProcessedData, error) {
-	args := m.Called(ctx, packetID)
+func (m *MockService) GetMaxValueByPacketID(ctx context.Context, packetID, series string) (*domain.ProcessedData, error) {
+	args := m.Called(ctx, packetID, series)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*domain.ProcessedData), args.Error(1)
 }
 
-func (m *MockService) GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time) ([]*domain.ProcessedData, error) {
-	args := m.Called(ctx, start, end)
+func (m *MockService) GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, page domain.PageRequest) (*domain.MaxValuesPage, error) {
+	args := m.Called(ctx, start, end, filter, page)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.MaxValuesPage), args.Error(1)
+}
+
+// StreamMaxValuesByTimeRange передаёт fn строки, заданные первым значением Return, и возвращает второе
+func (m *MockService) StreamMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, fn func(*domain.ProcessedData) error) error {
+	args := m.Called(ctx, start, end, filter)
+	if rows, ok := args.Get(0).([]*domain.ProcessedData); ok {
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockService) GetTopK(ctx context.Context, start, end time.Time, k int, order domain.TopKOrder, filter domain.PacketFilter) ([]*domain.ProcessedData, error) {
+	args := m.Called(ctx, start, end, k, order, filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]*domain.ProcessedData), args.Error(1)
 }
 
+func (m *MockService) GetRollups(ctx context.Context, start, end time.Time, step time.Duration, series string) ([]*domain.RollupBucket, error) {
+	args := m.Called(ctx, start, end, step, series)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RollupBucket), args.Error(1)
+}
+
+func (m *MockService) GetQuantiles(ctx context.Context, start, end time.Time, step time.Duration, quantiles []float64, series string) ([]*domain.QuantileBucket, error) {
+	args := m.Called(ctx, start, end, step, quantiles, series)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.QuantileBucket), args.Error(1)
+}
+
+func (m *MockService) GetRawPacket(ctx context.Context, packetID string) (*domain.RawPacket, error) {
+	args := m.Called(ctx, packetID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RawPacket), args.Error(1)
+}
+
 func (m *MockService) CheckDBConnection(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
@@ -57,7 +108,9 @@ func TestGRPCServer_GetMaxValuesByPeriod(t *testing.T) {
 		mock.Anything,
 		start,
 		end,
-	).Return(expectedData, nil)
+		domain.PacketFilter{},
+		domain.PageRequest{},
+	).Return(&domain.MaxValuesPage{MaxValues: expectedData}, nil)
 
 	req := &pb.TimePeriod{
 		StartTime: start.Format(time.RFC3339),
@@ -100,15 +153,17 @@ func TestGRPCServer_GetMaxValueByID(t *testing.T) {
 		PacketID:        packetID,
 		PacketCreatedAt: time.Now(),
 		MaxValue:        42,
+		Series:          "cpu",
 	}
 
-	mockService.On("GetMaxValueByPacketID", mock.Anything, packetID.String()).
+	mockService.On("GetMaxValueByPacketID", mock.Anything, packetID.String(), "cpu").
 		Return(expectedData, nil)
 
-	req := &pb.PackageID{Id: packetID.String()}
+	req := &pb.PackageID{Id: packetID.String(), Series: "cpu"}
 	response, err := server.GetMaxValueByID(context.Background(), req)
 	assert.NoError(t, err)
 	assert.Equal(t, int32(42), response.MaxValue)
+	assert.Equal(t, "cpu", response.Series)
 	assert.Equal(t, packetID.String(), response.Id)
 	mockService.AssertExpectations(t)
 }
@@ -119,7 +174,7 @@ func TestGRPCServer_GetMaxValueByID_NotFound(t *testing.T) {
 	server := &GRPCServer{service: mockService, logger: logger}
 
 	packetID := uuid.New()
-	mockService.On("GetMaxValueByPacketID", mock.Anything, packetID.String()).
+	mockService.On("GetMaxValueByPacketID", mock.Anything, packetID.String(), "").
 		Return((*domain.ProcessedData)(nil), nil)
 
 	req := &pb.PackageID{Id: packetID.String()}
@@ -128,3 +183,454 @@ func TestGRPCServer_GetMaxValueByID_NotFound(t *testing.T) {
 	assert.Nil(t, response)
 	assert.Equal(t, codes.NotFound, status.Code(err))
 }
+
+func TestGRPCServer_GetTopK(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewGRPCServer(mockService, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	packetID := uuid.New()
+	labels := map[string]string{"region": "eu"}
+	filter := domain.PacketFilter{Labels: labels, Series: []string{"cpu"}}
+
+	mockService.On("GetTopK", mock.Anything, start, end, 10, domain.TopKOrderTop, filter).
+		Return([]*domain.ProcessedData{{PacketID: packetID, MaxValue: 42}}, nil)
+
+	resp, err := server.GetTopK(context.Background(), &pb.TopKRequest{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		Labels:    labels,
+		Series:    []string{"cpu"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resp.MaxValues, 1)
+	assert.Equal(t, packetID.String(), resp.MaxValues[0].Id)
+	assert.Equal(t, int64(42), resp.MaxValues[0].MaxValueInt64)
+
+	_, err = server.GetTopK(context.Background(), &pb.TopKRequest{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		Order:     "middle",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	eventFilter := domain.PacketFilter{TimeAxis: domain.TimeAxisEvent}
+	mockService.On("GetTopK", mock.Anything, start, end, 10, domain.TopKOrderTop, eventFilter).
+		Return([]*domain.ProcessedData{{PacketID: packetID, MaxValue: 7}}, nil)
+	resp, err = server.GetTopK(context.Background(), &pb.TopKRequest{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		TimeAxis:  "event",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), resp.MaxValues[0].MaxValueInt64)
+
+	_, err = server.GetTopK(context.Background(), &pb.TopKRequest{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		TimeAxis:  "ingest",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	mockService.AssertExpectations(t)
+}
+
+func TestGRPCServer_GetRollups(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockService := new(MockService)
+	server := &GRPCServer{service: mockService, logger: logger}
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	expectedData := []*domain.RollupBucket{
+		{BucketStart: start, Resolution: domain.RollupResolutionHour, MaxValue: 70, MinValue: 5, Count: 3, Sum: 100},
+		{BucketStart: start.Add(time.Hour), Resolution: domain.RollupResolutionHour, MaxValue: 80, MinValue: 2, Count: 2, Sum: 82},
+		{BucketStart: start.Add(2 * time.Hour), Resolution: domain.RollupResolutionHour, MaxValue: math.MaxInt64, MinValue: math.MaxInt64 - 1, Count: 2,
+			Sum: math.MaxInt64, SumDecimal: "18446744073709551613", MaxValueDecimal: "10000000000000000000", MinValueDecimal: "8446744073709551613"},
+	}
+
+	mockService.On("GetRollups", mock.Anything, start, end, time.Hour, "").Return(expectedData, nil)
+
+	req := &pb.RollupRequest{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		Step:      "1h",
+	}
+	response, err := server.GetRollups(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "1h", response.Resolution)
+	assert.Len(t, response.Buckets, 3)
+	assert.Equal(t, int64(80), response.Buckets[1].MaxValue)
+	// Сумма вне int64 ограничена в sum и передаётся точно в sum_decimal
+	assert.Equal(t, int64(math.MaxInt64), response.Buckets[2].Sum)
+	assert.Equal(t, "18446744073709551613", response.Buckets[2].SumDecimal)
+	assert.Equal(t, "10000000000000000000", response.Buckets[2].MaxValueDecimal)
+	assert.Equal(t, "8446744073709551613", response.Buckets[2].MinValueDecimal)
+	mockService.AssertExpectations(t)
+}
+
+func TestGRPCServer_GetQuantiles(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockService := new(MockService)
+	server := &GRPCServer{service: mockService, logger: logger}
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 2)
+	expectedData := []*domain.QuantileBucket{
+		{BucketStart: start, Resolution: domain.RollupResolutionDay, Count: 40, Quantiles: []domain.QuantileValue{{Quantile: 0.99, Value: 95.5}}},
+		{BucketStart: start.AddDate(0, 0, 1), Resolution: domain.RollupResolutionDay, Count: 60, Quantiles: []domain.QuantileValue{{Quantile: 0.99, Value: 88.1}}},
+	}
+
+	mockService.On("GetQuantiles", mock.Anything, start, end, 24*time.Hour, []float64{0.99}, "cpu").Return(expectedData, nil)
+
+	response, err := server.GetQuantiles(context.Background(), &pb.QuantileRequest{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		Quantiles: []float64{0.99},
+		Step:      "24h",
+		Series:    "cpu",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1d", response.Resolution)
+	assert.Len(t, response.Buckets, 2)
+	assert.Equal(t, int64(60), response.Buckets[1].Count)
+	assert.Equal(t, 88.1, response.Buckets[1].Quantiles[0].Value)
+
+	_, err = server.GetQuantiles(context.Background(), &pb.QuantileRequest{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		Quantiles: []float64{99},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockService.AssertExpectations(t)
+}
+
+func TestGRPCServer_GetMaxValueByID_FloatValue(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockService := new(MockService)
+	server := &GRPCServer{service: mockService, logger: logger}
+
+	packetID := uuid.New()
+	maxValue := 21.75
+	mockService.On("GetMaxValueByPacketID", mock.Anything, packetID.String(), "").
+		Return(&domain.ProcessedData{
+			PacketID:      packetID,
+			MaxValue:      22,
+			ValueKind:     domain.PayloadKindFloat,
+			MaxValueFloat: &maxValue,
+		}, nil)
+
+	response, err := server.GetMaxValueByID(context.Background(), &pb.PackageID{Id: packetID.String()})
+	assert.NoError(t, err)
+	assert.Equal(t, "float", response.ValueKind)
+	assert.Equal(t, 21.75, response.GetMaxValueFloat())
+	mockService.AssertExpectations(t)
+}
+
+func TestGRPCServer_GetMaxValuesByPeriod_Int64Values(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockService := new(MockService)
+	server := &GRPCServer{service: mockService, logger: logger}
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	expectedData := []*domain.ProcessedData{
+		{PacketID: uuid.New(), MaxValue: 1 << 40},
+		{PacketID: uuid.New(), MaxValue: -5},
+	}
+
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{}, domain.PageRequest{}).
+		Return(&domain.MaxValuesPage{MaxValues: expectedData}, nil)
+
+	resp, err := server.GetMaxValuesByPeriod(context.Background(), &pb.TimePeriod{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resp.MaxValues, 2)
+
+	// Значение вне int32 не усекается: устаревшее поле пустое, выставлен флаг переполнения
+	assert.Equal(t, int64(1<<40), resp.MaxValues[0].MaxValueInt64)
+	assert.Equal(t, int32(0), resp.MaxValues[0].MaxValue)
+	assert.True(t, resp.MaxValues[0].MaxValueOverflow)
+
+	assert.Equal(t, int64(-5), resp.MaxValues[1].MaxValueInt64)
+	assert.Equal(t, int32(-5), resp.MaxValues[1].MaxValue)
+	assert.False(t, resp.MaxValues[1].MaxValueOverflow)
+}
+
+func TestGRPCServer_GetMaxValuesByPeriod_Filter(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockService := new(MockService)
+	server := &GRPCServer{service: mockService, logger: logger}
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	filter := domain.PacketFilter{SourceID: "sensor-1", Labels: map[string]string{"site": "a"}}
+	expectedData := []*domain.ProcessedData{
+		{PacketID: uuid.New(), SourceID: "sensor-1", Labels: map[string]string{"site": "a", "rack": "7"}, MaxValue: 3},
+	}
+
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, start, end, filter, domain.PageRequest{}).
+		Return(&domain.MaxValuesPage{MaxValues: expectedData}, nil)
+
+	resp, err := server.GetMaxValuesByPeriod(context.Background(), &pb.TimePeriod{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		SourceId:  "sensor-1",
+		Labels:    map[string]string{"site": "a"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resp.MaxValues, 1)
+	assert.Equal(t, "sensor-1", resp.MaxValues[0].SourceId)
+	assert.Equal(t, map[string]string{"site": "a", "rack": "7"}, resp.MaxValues[0].Labels)
+	mockService.AssertExpectations(t)
+}
+
+func TestGRPCServer_GetMaxValuesByPeriod_Page(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockService := new(MockService)
+	server := &GRPCServer{service: mockService, logger: logger}
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{}, domain.PageRequest{Limit: 2, Cursor: "abc"}).
+		Return(&domain.MaxValuesPage{MaxValues: []*domain.ProcessedData{{PacketID: uuid.New(), MaxValue: 3}}, NextCursor: "def"}, nil)
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{}, domain.PageRequest{Cursor: "bad"}).
+		Return(nil, domain.ErrInvalidCursor)
+
+	resp, err := server.GetMaxValuesByPeriod(context.Background(), &pb.TimePeriod{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		PageSize:  2,
+		PageToken: "abc",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resp.MaxValues, 1)
+	assert.Equal(t, "def", resp.NextPageToken)
+
+	_, err = server.GetMaxValuesByPeriod(context.Background(), &pb.TimePeriod{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		PageToken: "bad",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, end, start, domain.PacketFilter{}, domain.PageRequest{}).
+		Return(nil, fmt.Errorf("%w: end time must be after start time", domain.ErrInvalidQuery))
+	_, err = server.GetMaxValuesByPeriod(context.Background(), &pb.TimePeriod{
+		StartTime: end.Format(time.RFC3339),
+		EndTime:   start.Format(time.RFC3339),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.GetMaxValuesByPeriod(context.Background(), &pb.TimePeriod{
+		StartTime: start.Format(time.RFC3339),
+		EndTime:   end.Format(time.RFC3339),
+		PageSize:  -1,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockService.AssertExpectations(t)
+}
+
+// maxValueStream собирает отправленные сообщения потокового вызова
+type maxValueStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	sent    []*pb.MaxValue
+	sendErr error
+}
+
+func (s *maxValueStream) Context() context.Context { return s.ctx }
+
+func (s *maxValueStream) Send(m *pb.MaxValue) error {
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestGRPCServer_StreamMaxValuesByPeriod(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockService := new(MockService)
+	server := &GRPCServer{service: mockService, logger: logger}
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	req := &pb.TimePeriod{StartTime: start.Format(time.RFC3339), EndTime: end.Format(time.RFC3339)}
+	rows := []*domain.ProcessedData{
+		{PacketID: uuid.New(), MaxValue: 1},
+		{PacketID: uuid.New(), MaxValue: 1 << 40},
+	}
+	mockService.On("StreamMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{}).Return(rows, nil)
+
+	stream := &maxValueStream{ctx: context.Background()}
+	assert.NoError(t, server.StreamMaxValuesByPeriod(req, stream))
+	assert.Len(t, stream.sent, 2)
+	assert.Equal(t, rows[0].PacketID.String(), stream.sent[0].Id)
+	assert.Equal(t, int64(1<<40), stream.sent[1].MaxValueInt64)
+
+	// Ошибка отправки клиенту останавливает выгрузку и возвращается с её кодом
+	stream = &maxValueStream{ctx: context.Background(), sendErr: status.Error(codes.Unavailable, "transport is closing")}
+	assert.Equal(t, codes.Unavailable, status.Code(server.StreamMaxValuesByPeriod(req, stream)))
+
+	// Отменённый клиентом вызов завершается с Canceled, а не Internal
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stream = &maxValueStream{ctx: ctx, sendErr: context.Canceled}
+	assert.Equal(t, codes.Canceled, status.Code(server.StreamMaxValuesByPeriod(req, stream)))
+
+	err := server.StreamMaxValuesByPeriod(&pb.TimePeriod{StartTime: "yesterday", EndTime: req.EndTime}, &maxValueStream{ctx: context.Background()})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	mockService.AssertExpectations(t)
+}
+
+func TestGRPCServer_GetRawPacket(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockService := new(MockService)
+	server := &GRPCServer{service: mockService, logger: logger}
+
+	packetID := uuid.New()
+	mockService.On("GetRawPacket", mock.Anything, packetID.String()).
+		Return(&domain.RawPacket{PacketID: packetID, PayloadKind: domain.PayloadKindInt, Payload: []int64{3, 1 << 40}}, nil)
+
+	response, err := server.GetRawPacket(context.Background(), &pb.PackageID{Id: packetID.String()})
+	assert.NoError(t, err)
+	assert.Equal(t, "int", response.PayloadKind)
+	assert.Equal(t, []int64{3, 1 << 40}, response.Payload)
+	mockService.AssertExpectations(t)
+}
+
+type MockAlertService struct {
+	mock.Mock
+}
+
+func (m *MockAlertService) CreateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error) {
+	args := m.Called(ctx, rule)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AlertRule), args.Error(1)
+}
+
+func (m *MockAlertService) UpdateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error) {
+	args := m.Called(ctx, rule)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AlertRule), args.Error(1)
+}
+
+func (m *MockAlertService) DeleteRule(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockAlertService) GetRule(ctx context.Context, id uuid.UUID) (*domain.AlertRule, bool) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1)
+	}
+	return args.Get(0).(*domain.AlertRule), args.Bool(1)
+}
+
+func (m *MockAlertService) ListRules(ctx context.Context) []*domain.AlertRule {
+	args := m.Called(ctx)
+	return args.Get(0).([]*domain.AlertRule)
+}
+
+func TestGRPCServer_AlertRules(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	server := NewGRPCServer(new(MockService), logger)
+
+	_, err := server.ListAlertRules(context.Background(), &pb.ListAlertRulesRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	alertService := new(MockAlertService)
+	server.SetAlertService(alertService)
+
+	rule := &domain.AlertRule{ID: uuid.New(), Name: "high", Condition: domain.AlertConditionAbove, Threshold: 100, ForPackets: 3}
+	alertService.On("CreateRule", mock.Anything, mock.MatchedBy(func(r domain.AlertRule) bool {
+		return r.Name == "high" && r.ForPackets == 3
+	})).Return(rule, nil).Once()
+	alertService.On("CreateRule", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("%w: name is required", alert.ErrInvalidRule))
+	alertService.On("GetRule", mock.Anything, mock.Anything).Return(nil, false)
+
+	resp, err := server.CreateAlertRule(context.Background(), &pb.AlertRule{Name: "high", Condition: "above", Threshold: 100, ForPackets: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, rule.ID.String(), resp.Id)
+	assert.Equal(t, int32(3), resp.ForPackets)
+
+	_, err = server.CreateAlertRule(context.Background(), &pb.AlertRule{Condition: "above"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.GetAlertRule(context.Background(), &pb.AlertRuleID{Id: uuid.New().String()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	alertService.AssertExpectations(t)
+}
+
+type staticAuthenticator map[string]string
+
+func (a staticAuthenticator) Authenticate(key string) (string, error) {
+	if tenantID, ok := a[key]; ok {
+		return tenantID, nil
+	}
+	return "", tenant.ErrUnauthenticated
+}
+
+func TestGRPCServer_AuthInterceptor(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	server := NewGRPCServer(new(MockService), logger)
+	info := &grpc.UnaryServerInfo{FullMethod: "/aggregator.v1.DataAggregationService/GetMaxValueByID"}
+
+	var got string
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		got, _ = tenant.FromContext(ctx)
+		return nil, nil
+	}
+
+	// Без аутентификатора все вызовы выполняются от арендатора по умолчанию
+	_, err := server.authInterceptor(context.Background(), nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.DefaultTenantID, got)
+
+	server.SetAuthenticator(staticAuthenticator{"key-a": "team-a"})
+
+	_, err = server.authInterceptor(context.Background(), nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer wrong"))
+	_, err = server.authInterceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "key-a"))
+	_, err = server.authInterceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", got)
+}
+
+func TestGRPCServer_StreamAuthInterceptor(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	server := NewGRPCServer(new(MockService), logger)
+	server.SetAuthenticator(staticAuthenticator{"key-a": "team-a"})
+	info := &grpc.StreamServerInfo{FullMethod: "/aggregator.v1.DataAggregationService/StreamMaxValuesByPeriod", IsServerStream: true}
+
+	var got string
+	handler := func(_ interface{}, stream grpc.ServerStream) error {
+		got, _ = tenant.FromContext(stream.Context())
+		return nil
+	}
+
+	err := server.streamAuthInterceptor(nil, &maxValueStream{ctx: context.Background()}, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "key-a"))
+	err = server.streamAuthInterceptor(nil, &maxValueStream{ctx: ctx}, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", got)
+}
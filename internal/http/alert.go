@@ -0,0 +1,126 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/CoolE88/data-aggregation-service/internal/alert"
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// AlertService управляет правилами алертов
+type AlertService interface {
+	CreateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error)
+	UpdateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error)
+	DeleteRule(ctx context.Context, id uuid.UUID) error
+	GetRule(ctx context.Context, id uuid.UUID) (*domain.AlertRule, bool)
+	ListRules(ctx context.Context) []*domain.AlertRule
+}
+
+// RegisterAlertRoutes добавляет CRUD маршруты правил алертов
+func (s *HTTPServer) RegisterAlertRoutes(svc AlertService) {
+	h := &alertHandler{service: svc, logger: s.logger}
+
+	s.router.HandleFunc("/api/v1/alert-rules", h.createRule).Methods("POST")
+	s.router.HandleFunc("/api/v1/alert-rules", h.listRules).Methods("GET")
+	s.router.HandleFunc("/api/v1/alert-rules/{id}", h.getRule).Methods("GET")
+	s.router.HandleFunc("/api/v1/alert-rules/{id}", h.updateRule).Methods("PUT")
+	s.router.HandleFunc("/api/v1/alert-rules/{id}", h.deleteRule).Methods("DELETE")
+}
+
+type alertHandler struct {
+	service AlertService
+	logger  *zap.Logger
+}
+
+func (h *alertHandler) createRule(w http.ResponseWriter, r *http.Request) {
+	var rule domain.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.service.CreateRule(r.Context(), rule)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusCreated, created)
+}
+
+func (h *alertHandler) listRules(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.logger, http.StatusOK, h.service.ListRules(r.Context()))
+}
+
+func (h *alertHandler) getRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid rule id", http.StatusBadRequest)
+		return
+	}
+
+	rule, ok := h.service.GetRule(r.Context(), id)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, rule)
+}
+
+func (h *alertHandler) updateRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid rule id", http.StatusBadRequest)
+		return
+	}
+
+	var rule domain.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	rule.ID = id
+
+	updated, err := h.service.UpdateRule(r.Context(), rule)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, updated)
+}
+
+func (h *alertHandler) deleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid rule id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteRule(r.Context(), id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *alertHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, alert.ErrInvalidRule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, alert.ErrRuleNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		h.logger.Error("Alert rule operation failed", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
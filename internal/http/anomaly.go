@@ -0,0 +1,106 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/CoolE88/data-aggregation-service/internal/anomaly"
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// AnomalyService управляет параметрами детектора аномалий по источникам арендаторов
+type AnomalyService interface {
+	SetParams(ctx context.Context, params domain.AnomalyParams) (*domain.AnomalyParams, error)
+	GetParams(tenantID, sourceID string) (*domain.AnomalyParams, bool)
+	ListParams(tenantID string) []*domain.AnomalyParams
+	DeleteParams(ctx context.Context, tenantID, sourceID string) (bool, error)
+}
+
+// RegisterAnomalyRoutes добавляет административные маршруты параметров детектора аномалий
+func (s *HTTPServer) RegisterAnomalyRoutes(svc AnomalyService) {
+	h := &anomalyHandler{service: svc, logger: s.logger}
+
+	s.router.HandleFunc("/api/v1/admin/anomaly/sources", h.listParams).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/anomaly/sources/{source}", h.getParams).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/anomaly/sources/{source}", h.setParams).Methods("PUT")
+	s.router.HandleFunc("/api/v1/admin/anomaly/sources/{source}", h.deleteParams).Methods("DELETE")
+}
+
+type anomalyHandler struct {
+	service AnomalyService
+	logger  *zap.Logger
+}
+
+func (h *anomalyHandler) listParams(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, h.service.ListParams(tenantID))
+}
+
+// getParams возвращает действующие параметры, в том числе параметры по умолчанию
+func (h *anomalyHandler) getParams(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	params, _ := h.service.GetParams(tenantID, mux.Vars(r)["source"])
+	writeJSON(w, h.logger, http.StatusOK, params)
+}
+
+func (h *anomalyHandler) setParams(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	var params domain.AnomalyParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	params.TenantID = tenantID
+	params.SourceID = mux.Vars(r)["source"]
+
+	saved, err := h.service.SetParams(r.Context(), params)
+	if err != nil {
+		if errors.Is(err, anomaly.ErrInvalidParams) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.logger.Error("Failed to save anomaly params", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, saved)
+}
+
+func (h *anomalyHandler) deleteParams(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := h.service.DeleteParams(r.Context(), tenantID, mux.Vars(r)["source"])
+	if err != nil {
+		h.logger.Error("Failed to delete anomaly params", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
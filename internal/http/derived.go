@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/CoolE88/data-aggregation-service/internal/derived"
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// DerivedMetricService управляет производными метриками источников арендаторов
+type DerivedMetricService interface {
+	SetMetric(ctx context.Context, metric domain.DerivedMetric) (*domain.DerivedMetric, error)
+	DeleteMetric(ctx context.Context, tenantID, sourceID, name string) (bool, error)
+	ListMetrics(tenantID string) []*domain.DerivedMetric
+}
+
+// RegisterDerivedRoutes добавляет административные маршруты производных метрик
+func (s *HTTPServer) RegisterDerivedRoutes(svc DerivedMetricService) {
+	h := &derivedHandler{service: svc, logger: s.logger}
+
+	s.router.HandleFunc("/api/v1/admin/derived-metrics", h.listMetrics).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/derived-metrics/{source}/{name}", h.setMetric).Methods("PUT")
+	s.router.HandleFunc("/api/v1/admin/derived-metrics/{source}/{name}", h.deleteMetric).Methods("DELETE")
+}
+
+type derivedHandler struct {
+	service DerivedMetricService
+	logger  *zap.Logger
+}
+
+func (h *derivedHandler) listMetrics(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, h.service.ListMetrics(tenantID))
+}
+
+// setMetric компилирует выражение и сохраняет метрику; ошибка компиляции возвращается с кодом 400
+func (h *derivedHandler) setMetric(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	saved, err := h.service.SetMetric(r.Context(), domain.DerivedMetric{
+		TenantID:   tenantID,
+		SourceID:   vars["source"],
+		Name:       vars["name"],
+		Expression: body.Expression,
+	})
+	if err != nil {
+		if errors.Is(err, derived.ErrInvalidMetric) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.logger.Error("Failed to save derived metric", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, saved)
+}
+
+func (h *derivedHandler) deleteMetric(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	found, err := h.service.DeleteMetric(r.Context(), tenantID, vars["source"], vars["name"])
+	if err != nil {
+		h.logger.Error("Failed to delete derived metric", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
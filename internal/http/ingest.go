@@ -0,0 +1,82 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/signing"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
+
+	"go.uber.org/zap"
+)
+
+// maxIngestBodySize ограничение тела пакета, присланного клиентом
+const maxIngestBodySize = 1 << 20
+
+// PacketProcessor принимает пакеты от клиентов (цепочка проверки подписи, валидации, квот и DataService)
+type PacketProcessor interface {
+	ProcessPacket(ctx context.Context, packet *domain.DataPacket) error
+}
+
+// RegisterIngestRoutes добавляет маршрут приёма пакетов от клиентов
+func (s *HTTPServer) RegisterIngestRoutes(processor PacketProcessor) {
+	h := &ingestHandler{processor: processor, logger: s.logger}
+
+	s.router.HandleFunc("/api/v1/packets", h.ingest).Methods("POST")
+}
+
+type ingestHandler struct {
+	processor PacketProcessor
+	logger    *zap.Logger
+}
+
+func (h *ingestHandler) ingest(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := tenant.Require(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var packet domain.DataPacket
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIngestBodySize)).Decode(&packet); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Арендатор берётся только из ключа клиента, чтобы нельзя было записать данные в чужой раздел
+	packet.TenantID = tenantID
+	packet.ReceivedAt = time.Now().UTC()
+	if packet.Timestamp.IsZero() {
+		packet.Timestamp = packet.ReceivedAt
+	}
+
+	if err := h.processor.ProcessPacket(r.Context(), &packet); err != nil {
+		var validationErr *validation.Error
+		switch {
+		case errors.As(err, &validationErr),
+			errors.Is(err, domain.ErrValueOutOfRange):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, signing.ErrInvalidSignature):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, tenant.ErrQuotaExceeded):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		case errors.Is(err, domain.ErrPacketQuarantined):
+			// Пакет принят, но попадёт в результаты только после разбора карантина
+			writeJSON(w, h.logger, http.StatusAccepted, map[string]string{"id": packet.ID.String(), "status": "quarantined"})
+		default:
+			h.logger.Error("Failed to process ingested packet",
+				zap.String("tenant", tenantID),
+				zap.String("packet_id", packet.ID.String()),
+				zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]string{"id": packet.ID.String()})
+}
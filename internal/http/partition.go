@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/partition"
+
+	"go.uber.org/zap"
+)
+
+// PartitionService управляет партициями processed_packets и их сроком хранения
+type PartitionService interface {
+	ListPartitions(ctx context.Context) ([]domain.Partition, error)
+	ApplyRetention(ctx context.Context, dryRun bool) ([]*domain.RetentionAuditEntry, error)
+	ListRetentionAudit(ctx context.Context, limit int) ([]*domain.RetentionAuditEntry, error)
+}
+
+// RegisterPartitionRoutes добавляет административные маршруты партиций
+func (s *HTTPServer) RegisterPartitionRoutes(svc PartitionService) {
+	h := &partitionHandler{service: svc, logger: s.logger}
+
+	s.router.HandleFunc("/api/v1/admin/partitions", h.listPartitions).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/partitions/retention", h.applyRetention).Methods("POST")
+	s.router.HandleFunc("/api/v1/admin/partitions/retention/audit", h.listAudit).Methods("GET")
+}
+
+type partitionHandler struct {
+	service PartitionService
+	logger  *zap.Logger
+}
+
+func (h *partitionHandler) listPartitions(w http.ResponseWriter, r *http.Request) {
+	partitions, err := h.service.ListPartitions(r.Context())
+	if err != nil {
+		h.logger.Error("Failed to list partitions", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, partitions)
+}
+
+// applyRetention запускает удаление партиций старше срока хранения. Тело {"dry_run": true}
+// необязательно; пробный прогон только возвращает и записывает в журнал удаляемые партиции.
+// Ошибки отдельных партиций видны в их записях журнала в ответе.
+func (h *partitionHandler) applyRetention(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.service.ApplyRetention(r.Context(), req.DryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, partition.ErrRetentionDisabled), errors.Is(err, partition.ErrRetentionBusy):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case entries == nil:
+			h.logger.Error("Failed to apply partition retention", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		h.logger.Warn("Partition retention finished with errors", zap.Error(err))
+	}
+	if entries == nil {
+		entries = []*domain.RetentionAuditEntry{}
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, entries)
+}
+
+func (h *partitionHandler) listAudit(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := h.service.ListRetentionAudit(r.Context(), limit)
+	if err != nil {
+		h.logger.Error("Failed to list retention audit", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []*domain.RetentionAuditEntry{}
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, entries)
+}
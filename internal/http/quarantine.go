@@ -0,0 +1,138 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// QuarantineService разбор пакетов, отложенных в карантин из-за времени устройства.
+// Арендатор берётся из контекста запроса.
+type QuarantineService interface {
+	ListQuarantined(ctx context.Context, limit int) ([]*domain.QuarantinedPacket, error)
+	GetQuarantined(ctx context.Context, packetID uuid.UUID) (*domain.QuarantinedPacket, error)
+	Release(ctx context.Context, packetID uuid.UUID) (bool, error)
+	Discard(ctx context.Context, packetID uuid.UUID) (bool, error)
+}
+
+// RegisterQuarantineRoutes добавляет маршруты разбора карантина арендатора
+func (s *HTTPServer) RegisterQuarantineRoutes(svc QuarantineService) {
+	h := &quarantineHandler{service: svc, logger: s.logger}
+
+	s.router.HandleFunc("/api/v1/quarantine", h.listPackets).Methods("GET")
+	s.router.HandleFunc("/api/v1/quarantine/{id}", h.getPacket).Methods("GET")
+	s.router.HandleFunc("/api/v1/quarantine/{id}/release", h.releasePacket).Methods("POST")
+	s.router.HandleFunc("/api/v1/quarantine/{id}", h.discardPacket).Methods("DELETE")
+}
+
+type quarantineHandler struct {
+	service QuarantineService
+	logger  *zap.Logger
+}
+
+func (h *quarantineHandler) listPackets(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	list, err := h.service.ListQuarantined(r.Context(), limit)
+	if err != nil {
+		h.writeError(w, "Failed to list quarantined packets", err)
+		return
+	}
+	if list == nil {
+		list = []*domain.QuarantinedPacket{}
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, list)
+}
+
+func (h *quarantineHandler) getPacket(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid packet id", http.StatusBadRequest)
+		return
+	}
+
+	packet, err := h.service.GetQuarantined(r.Context(), id)
+	if err != nil {
+		h.writeError(w, "Failed to get quarantined packet", err)
+		return
+	}
+	if packet == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, packet)
+}
+
+// releasePacket передаёт пакет в обработку с исходным временем устройства
+func (h *quarantineHandler) releasePacket(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid packet id", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.service.Release(r.Context(), id)
+	if err != nil {
+		h.writeError(w, "Failed to release quarantined packet", err)
+		return
+	}
+	if !found {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]string{"id": id.String(), "status": "released"})
+}
+
+func (h *quarantineHandler) discardPacket(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid packet id", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.service.Discard(r.Context(), id)
+	if err != nil {
+		h.writeError(w, "Failed to discard quarantined packet", err)
+		return
+	}
+	if !found {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *quarantineHandler) writeError(w http.ResponseWriter, message string, err error) {
+	var validationErr *validation.Error
+	switch {
+	case errors.Is(err, tenant.ErrUnauthenticated):
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	case errors.As(err, &validationErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, tenant.ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		h.logger.Error(message, zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
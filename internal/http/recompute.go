@@ -0,0 +1,99 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/recompute"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// RecomputeService управляет задачами пересчёта
+type RecomputeService interface {
+	StartJob(ctx context.Context, req domain.RecomputeRequest) (*domain.RecomputeJob, error)
+	GetJob(id uuid.UUID) (*domain.RecomputeJob, bool)
+	ListJobs() []*domain.RecomputeJob
+	CancelJob(id uuid.UUID) bool
+}
+
+// RegisterRecomputeRoutes добавляет административные маршруты пересчёта
+func (s *HTTPServer) RegisterRecomputeRoutes(svc RecomputeService) {
+	h := &recomputeHandler{service: svc, logger: s.logger}
+
+	s.router.HandleFunc("/api/v1/admin/recompute", h.startJob).Methods("POST")
+	s.router.HandleFunc("/api/v1/admin/recompute", h.listJobs).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/recompute/{id}", h.getJob).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/recompute/{id}", h.cancelJob).Methods("DELETE")
+}
+
+type recomputeHandler struct {
+	service RecomputeService
+	logger  *zap.Logger
+}
+
+func (h *recomputeHandler) startJob(w http.ResponseWriter, r *http.Request) {
+	var req domain.RecomputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.service.StartJob(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, recompute.ErrInvalidRequest) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.logger.Error("Failed to start recompute job", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusAccepted, job)
+}
+
+func (h *recomputeHandler) listJobs(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, h.logger, http.StatusOK, h.service.ListJobs())
+}
+
+func (h *recomputeHandler) getJob(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+
+	job, ok := h.service.GetJob(id)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, job)
+}
+
+func (h *recomputeHandler) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := h.service.GetJob(id); !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.service.CancelJob(id) {
+		http.Error(w, "job is already finished", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/schema"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// SchemaService управляет версиями схем пакетов источников арендаторов
+type SchemaService interface {
+	Register(ctx context.Context, schema domain.PacketSchema) (*domain.PacketSchema, error)
+	DeleteVersion(ctx context.Context, tenantID, sourceID string, version int) (bool, error)
+	ListSchemas(tenantID, sourceID string) []*domain.PacketSchema
+}
+
+// RegisterSchemaRoutes добавляет административные маршруты реестра схем
+func (s *HTTPServer) RegisterSchemaRoutes(svc SchemaService) {
+	h := &schemaHandler{service: svc, logger: s.logger}
+
+	s.router.HandleFunc("/api/v1/admin/schemas", h.listSchemas).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/schemas/{source}", h.sourceSchemas).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/schemas/{source}", h.registerSchema).Methods("POST")
+	s.router.HandleFunc("/api/v1/admin/schemas/{source}/{version}", h.deleteSchema).Methods("DELETE")
+}
+
+type schemaHandler struct {
+	service SchemaService
+	logger  *zap.Logger
+}
+
+func (h *schemaHandler) listSchemas(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, h.service.ListSchemas(tenantID, ""))
+}
+
+func (h *schemaHandler) sourceSchemas(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	list := h.service.ListSchemas(tenantID, mux.Vars(r)["source"])
+	if len(list) == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, list)
+}
+
+// registerSchema сохраняет следующую версию схемы источника. Версия в теле необязательна,
+// но если указана, должна быть следующей по порядку, иначе возвращается 409.
+func (h *schemaHandler) registerSchema(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	var body domain.PacketSchema
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	body.TenantID = tenantID
+	body.SourceID = mux.Vars(r)["source"]
+
+	saved, err := h.service.Register(r.Context(), body)
+	if err != nil {
+		switch {
+		case errors.Is(err, schema.ErrInvalidSchema):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, schema.ErrVersionConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			h.logger.Error("Failed to register packet schema", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusCreated, saved)
+}
+
+func (h *schemaHandler) deleteSchema(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.service.DeleteVersion(r.Context(), tenantID, vars["source"], version)
+	if err != nil {
+		if errors.Is(err, schema.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		h.logger.Error("Failed to delete packet schema", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
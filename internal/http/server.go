@@ -3,12 +3,17 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/CoolE88/data-aggregation-service/internal/domain"
 	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -16,15 +21,37 @@ import (
 )
 
 type DataService interface {
-	GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time) ([]*domain.ProcessedData, error)
-	GetMaxValueByPacketID(ctx context.Context, packetID string) (*domain.ProcessedData, error)
+	GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, page domain.PageRequest) (*domain.MaxValuesPage, error)
+	StreamMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, fn func(*domain.ProcessedData) error) error
+	GetMaxValueByPacketID(ctx context.Context, packetID, series string) (*domain.ProcessedData, error)
+	GetTopK(ctx context.Context, start, end time.Time, k int, order domain.TopKOrder, filter domain.PacketFilter) ([]*domain.ProcessedData, error)
+	GetRollups(ctx context.Context, start, end time.Time, step time.Duration, series string) ([]*domain.RollupBucket, error)
+	GetQuantiles(ctx context.Context, start, end time.Time, step time.Duration, quantiles []float64, series string) ([]*domain.QuantileBucket, error)
+	GetRawPacket(ctx context.Context, packetID string) (*domain.RawPacket, error)
 	CheckDBConnection(ctx context.Context) error
 }
 
+// Authenticator определяет арендатора по API-ключу клиента
+type Authenticator interface {
+	Authenticate(key string) (string, error)
+	IsAdmin(tenantID string) bool
+}
+
+// adminPathPrefix маршруты, доступные только административному арендатору
+const adminPathPrefix = "/api/v1/admin/"
+
+// HealthReporter сообщает о состоянии, которое не мешает обслуживать запросы, но требует внимания
+type HealthReporter interface {
+	HealthWarnings() []string
+}
+
 type HTTPServer struct {
-	server  *http.Server
-	service DataService
-	logger  *zap.Logger
+	server    *http.Server
+	router    *mux.Router
+	service   DataService
+	auth      Authenticator
+	reporters []HealthReporter
+	logger    *zap.Logger
 }
 
 func NewHTTPServer(addr string, service DataService, logger *zap.Logger) *HTTPServer {
@@ -35,18 +62,25 @@ func NewHTTPServer(addr string, service DataService, logger *zap.Logger) *HTTPSe
 			Addr:    addr,
 			Handler: router,
 		},
+		router:  router,
 		service: service,
 		logger:  logger,
 	}
 
-	// Middleware регистрации
+	// Middleware регистрации. Арендатор определяется первым, чтобы попасть в метрики и логи.
+	router.Use(s.authMiddleware)
 	router.Use(s.metricsMiddleware)
 	router.Use(s.loggingMiddleware)
 
 	// Маршруты
 	router.HandleFunc("/health", s.healthCheck).Methods("GET")
 	router.HandleFunc("/api/v1/max-values", s.getMaxValuesByTimeRange).Methods("GET")
+	router.HandleFunc("/api/v1/max-values/export", s.exportMaxValues).Methods("GET")
 	router.HandleFunc("/api/v1/max-values/{id}", s.getMaxValueByID).Methods("GET")
+	router.HandleFunc("/api/v1/top-k", s.getTopK).Methods("GET")
+	router.HandleFunc("/api/v1/rollups", s.getRollups).Methods("GET")
+	router.HandleFunc("/api/v1/quantiles", s.getQuantiles).Methods("GET")
+	router.HandleFunc("/api/v1/raw-packets/{id}", s.getRawPacket).Methods("GET")
 
 	// Метрики Prometheus
 	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
@@ -54,6 +88,17 @@ func NewHTTPServer(addr string, service DataService, logger *zap.Logger) *HTTPSe
 	return s
 }
 
+// AddHealthReporter добавляет источник предупреждений для /health
+func (s *HTTPServer) AddHealthReporter(reporter HealthReporter) {
+	s.reporters = append(s.reporters, reporter)
+}
+
+// SetAuthenticator включает аутентификацию по API-ключу. Без него все запросы
+// выполняются от арендатора по умолчанию, а административные маршруты закрыты. Вызывать до Start.
+func (s *HTTPServer) SetAuthenticator(auth Authenticator) {
+	s.auth = auth
+}
+
 func (s *HTTPServer) Start() error {
 	s.logger.Info("Starting HTTP server", zap.String("addr", s.server.Addr))
 	return s.server.ListenAndServe()
@@ -82,6 +127,11 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
+// Unwrap открывает исходный ResponseWriter для http.ResponseController, например для Flush при выгрузке
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // middleware для сбора метрик HTTP запросов с использованием шаблона пути
 func (s *HTTPServer) metricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -94,21 +144,90 @@ func (s *HTTPServer) metricsMiddleware(next http.Handler) http.Handler {
 		duration := time.Since(start).Seconds()
 		method := r.Method
 		status := strconv.Itoa(rw.statusCode)
+		path := routePath(r)
+		tenantID, _ := tenant.FromContext(r.Context())
 
-		// Получаем шаблон пути из mux (если доступен)
-		path := r.URL.Path
-		if route := mux.CurrentRoute(r); route != nil {
-			if tpl, err := route.GetPathTemplate(); err == nil {
-				path = tpl
+		metrics.HTTPRequests.WithLabelValues(method, path, status, tenantID).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(method, path).Observe(duration)
+		metrics.HTTPResponseSize.WithLabelValues(method, path).Observe(float64(rw.size))
+	})
+}
+
+// routePath возвращает шаблон пути из mux (если доступен), чтобы не плодить лейблы метрик
+func routePath(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return r.URL.Path
+}
+
+// authMiddleware определяет арендатора по ключу из заголовка X-API-Key или Authorization: Bearer
+// и передаёт его обработчикам через контекст. /health и /metrics доступны без ключа.
+func (s *HTTPServer) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tenantID, isAdmin := domain.DefaultTenantID, false
+		if s.auth != nil {
+			id, err := s.auth.Authenticate(apiKey(r))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				s.rejectRequest(w, r, http.StatusUnauthorized)
+				return
 			}
+			tenantID, isAdmin = id, s.auth.IsAdmin(id)
 		}
 
-		metrics.HTTPRequests.WithLabelValues(method, path, status).Inc()
-		metrics.HTTPRequestDuration.WithLabelValues(method, path).Observe(duration)
-		metrics.HTTPResponseSize.WithLabelValues(method, path).Observe(float64(rw.size))
+		if strings.HasPrefix(r.URL.Path, adminPathPrefix) && !isAdmin {
+			s.rejectRequest(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), tenantID)))
 	})
 }
 
+// rejectRequest отвечает на запрос, не прошедший аутентификацию, и учитывает его в метриках
+func (s *HTTPServer) rejectRequest(w http.ResponseWriter, r *http.Request, status int) {
+	metrics.HTTPRequests.WithLabelValues(r.Method, routePath(r), strconv.Itoa(status), "").Inc()
+	s.logger.Warn("HTTP request rejected",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("ip", r.RemoteAddr),
+		zap.Int("status", status))
+	http.Error(w, http.StatusText(status), status)
+}
+
+// configTenant возвращает арендатора, настройками источников которого управляет административный
+// запрос: параметр tenant или арендатор по умолчанию. На некорректный параметр отвечает 400.
+func configTenant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tenantID := r.URL.Query().Get("tenant")
+	if tenantID == "" {
+		return domain.DefaultTenantID, true
+	}
+	if err := tenant.ValidateID(tenantID); err != nil {
+		http.Error(w, "invalid tenant", http.StatusBadRequest)
+		return "", false
+	}
+	return tenantID, true
+}
+
+// apiKey возвращает ключ клиента из X-API-Key или Authorization: Bearer
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
 // middleware для логирования HTTP запросов
 func (s *HTTPServer) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -117,7 +236,9 @@ func (s *HTTPServer) loggingMiddleware(next http.Handler) http.Handler {
 		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(rw, r)
 
+		tenantID, _ := tenant.FromContext(r.Context())
 		s.logger.Info("HTTP request",
+			zap.String("tenant", tenantID),
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.String("query", r.URL.RawQuery),
@@ -137,8 +258,19 @@ func (s *HTTPServer) healthCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Предупреждения не переводят сервис в состояние недоступности: он продолжает принимать пакеты
+	response := map[string]any{"status": "healthy"}
+	var warnings []string
+	for _, reporter := range s.reporters {
+		warnings = append(warnings, reporter.HealthWarnings()...)
+	}
+	if len(warnings) > 0 {
+		response["status"] = "degraded"
+		response["warnings"] = warnings
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{"status": "healthy"}); err != nil {
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		s.logger.Error("Failed to encode health check response", zap.Error(err))
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
@@ -147,35 +279,264 @@ func (s *HTTPServer) healthCheck(w http.ResponseWriter, r *http.Request) {
 
 func (s *HTTPServer) getMaxValuesByTimeRange(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	startStr := r.URL.Query().Get("start")
-	endStr := r.URL.Query().Get("end")
+	start, end, filter, err := parsePeriodFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if startStr == "" || endStr == "" {
-		http.Error(w, "start and end parameters are required", http.StatusBadRequest)
+	page := domain.PageRequest{Cursor: r.URL.Query().Get("cursor")}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if page.Limit, err = strconv.Atoi(limitStr); err != nil || page.Limit < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := s.service.GetMaxValuesByTimeRange(ctx, start, end, filter, page)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCursor) || errors.Is(err, domain.ErrInvalidQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.Error("Failed to get max values by time range", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	start, err := time.Parse(time.RFC3339, startStr)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// exportFlushRows через сколько строк выгрузка отправляется клиенту, не дожидаясь заполнения буфера
+const exportFlushRows = 1000
+
+// exportMaxValues выгружает все результаты за период в формате NDJSON по мере чтения из базы.
+// После начала ответа статус уже не изменить, поэтому при ошибке соединение обрывается:
+// клиент получает незавершённый ответ, а не выгрузку, которую можно принять за полную.
+func (s *HTTPServer) exportMaxValues(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start, end, filter, err := parsePeriodFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	rows := 0
+	err = s.service.StreamMaxValuesByTimeRange(ctx, start, end, filter, func(data *domain.ProcessedData) error {
+		if rows == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		rows++
+		if err := encoder.Encode(data); err != nil {
+			return err
+		}
+		if rows%exportFlushRows == 0 {
+			return controller.Flush()
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil && rows == 0:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	case err == nil:
+	case ctx.Err() != nil:
+		// Клиент отключился, отвечать некому
+		s.logger.Debug("Export cancelled by client", zap.Int("rows", rows))
+	case errors.Is(err, domain.ErrInvalidQuery):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case rows == 0:
+		s.logger.Error("Failed to export max values", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	default:
+		s.logger.Error("Export interrupted", zap.Int("rows", rows), zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (s *HTTPServer) getMaxValueByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	data, err := s.service.GetMaxValueByPacketID(r.Context(), id, r.URL.Query().Get("series"))
+	if err != nil {
+		s.logger.Error("Failed to get max value by ID", zap.String("id", id), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if data == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *HTTPServer) getTopK(w http.ResponseWriter, r *http.Request) {
+	start, end, filter, err := parsePeriodFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	k := 10
+	if kStr := query.Get("k"); kStr != "" {
+		k, err = strconv.Atoi(kStr)
+		if err != nil || k < 1 || k > domain.MaxTopK {
+			http.Error(w, "k must be an integer in [1, "+strconv.Itoa(domain.MaxTopK)+"]", http.StatusBadRequest)
+			return
+		}
+	}
+
+	order := domain.TopKOrderTop
+	if orderStr := query.Get("order"); orderStr != "" {
+		order = domain.TopKOrder(orderStr)
+		if order != domain.TopKOrderTop && order != domain.TopKOrderBottom {
+			http.Error(w, "order must be top or bottom", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := s.service.GetTopK(r.Context(), start, end, k, order, filter)
 	if err != nil {
-		s.logger.Error("invalid start time format",
-			zap.Error(err),
-			zap.String("received_start", startStr))
-		http.Error(w, "invalid start time format", http.StatusBadRequest)
+		if errors.Is(err, domain.ErrInvalidQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.Error("Failed to get top-k", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// parsePeriod разбирает обязательный период start/end в формате RFC3339
+func parsePeriod(query url.Values) (time.Time, time.Time, error) {
+	startStr := query.Get("start")
+	endStr := query.Get("end")
+
+	if startStr == "" || endStr == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("start and end parameters are required")
+	}
+
+	start, err := time.Parse(time.RFC3339, startStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start time format")
+	}
+
 	end, err := time.Parse(time.RFC3339, endStr)
 	if err != nil {
-		s.logger.Error("invalid end time format",
-			zap.Error(err),
-			zap.String("received_end", endStr))
-		http.Error(w, "invalid end time format", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end time format")
+	}
+
+	return start, end, nil
+}
+
+// parsePeriodFilter разбирает период start/end и фильтр source, label, series и time_axis
+func parsePeriodFilter(r *http.Request) (time.Time, time.Time, domain.PacketFilter, error) {
+	query := r.URL.Query()
+	start, end, err := parsePeriod(query)
+	if err != nil {
+		return time.Time{}, time.Time{}, domain.PacketFilter{}, err
+	}
+
+	labels, err := parseLabelFilters(query["label"])
+	if err != nil {
+		return time.Time{}, time.Time{}, domain.PacketFilter{}, err
+	}
+
+	timeAxis := domain.TimeAxis(query.Get("time_axis"))
+	if !timeAxis.Valid() {
+		return time.Time{}, time.Time{}, domain.PacketFilter{}, fmt.Errorf("time_axis must be event or processing")
+	}
+
+	filter := domain.PacketFilter{
+		SourceID: query.Get("source"),
+		Labels:   labels,
+		Series:   query["series"],
+		TimeAxis: timeAxis,
+	}
+	return start, end, filter, nil
+}
+
+// parseStep разбирает шаг бакетов step; без параметра возвращается 0
+func parseStep(query url.Values) (time.Duration, error) {
+	stepStr := query.Get("step")
+	if stepStr == "" {
+		return 0, nil
+	}
+
+	step, err := time.ParseDuration(stepStr)
+	if err != nil || step <= 0 {
+		return 0, fmt.Errorf("invalid step format, expected duration like 1m or 24h")
+	}
+	return step, nil
+}
+
+// parseLabelFilters разбирает параметры вида label=key=value в фильтр по точному совпадению
+func parseLabelFilters(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(values))
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label filter %q, expected key=value", value)
+		}
+		labels[key] = val
+	}
+	return labels, nil
+}
+
+func (s *HTTPServer) getRollups(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	start, end, err := parsePeriod(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	data, err := s.service.GetMaxValuesByTimeRange(ctx, start, end)
+	step, err := parseStep(query)
 	if err != nil {
-		s.logger.Error("Failed to get max values by time range", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if step == 0 {
+		http.Error(w, "step parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := s.service.GetRollups(r.Context(), start, end, step, query.Get("series"))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.Error("Failed to get rollups", zap.Error(err))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -188,13 +549,66 @@ func (s *HTTPServer) getMaxValuesByTimeRange(w http.ResponseWriter, r *http.Requ
 	}
 }
 
-func (s *HTTPServer) getMaxValueByID(w http.ResponseWriter, r *http.Request) {
+func (s *HTTPServer) getQuantiles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	start, end, err := parsePeriod(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(query["q"]) == 0 {
+		http.Error(w, "q parameter is required", http.StatusBadRequest)
+		return
+	}
+	if len(query["q"]) > domain.MaxQuantiles {
+		http.Error(w, "at most "+strconv.Itoa(domain.MaxQuantiles)+" quantiles are allowed", http.StatusBadRequest)
+		return
+	}
+
+	quantiles := make([]float64, 0, len(query["q"]))
+	for _, qStr := range query["q"] {
+		q, err := strconv.ParseFloat(qStr, 64)
+		if err != nil || q < 0 || q > 1 {
+			http.Error(w, "q must be a number in [0, 1]", http.StatusBadRequest)
+			return
+		}
+		quantiles = append(quantiles, q)
+	}
+
+	// Без step возвращается один бакет на весь интервал
+	step, err := parseStep(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := s.service.GetQuantiles(r.Context(), start, end, step, quantiles, query.Get("series"))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.Error("Failed to get quantiles", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *HTTPServer) getRawPacket(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	data, err := s.service.GetMaxValueByPacketID(r.Context(), id)
+	data, err := s.service.GetRawPacket(r.Context(), id)
 	if err != nil {
-		s.logger.Error("Failed to get max value by ID", zap.String("id", id), zap.Error(err))
+		s.logger.Error("Failed to get raw packet", zap.String("id", id), zap.Error(err))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -211,3 +625,12 @@ func (s *HTTPServer) getMaxValueByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// writeJSON пишет ответ с заданным статусом
+func writeJSON(w http.ResponseWriter, logger *zap.Logger, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
@@ -3,12 +3,21 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/CoolE88/data-aggregation-service/internal/alert"
 	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/partition"
+	"github.com/CoolE88/data-aggregation-service/internal/recompute"
+	"github.com/CoolE88/data-aggregation-service/internal/schema"
+	"github.com/CoolE88/data-aggregation-service/internal/signing"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -21,22 +30,67 @@ type MockService struct {
 	mock.Mock
 }
 
-func (m *MockService) GetMaxValueByPacketID(ctx context.Context, packetID string) (*domain.ProcessedData, error) {
-	args := m.Called(ctx, packetID)
+func (m *MockService) GetMaxValueByPacketID(ctx context.Context, packetID, series string) (*domain.ProcessedData, error) {
+	args := m.Called(ctx, packetID, series)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*domain.ProcessedData), args.Error(1)
 }
 
-func (m *MockService) GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time) ([]*domain.ProcessedData, error) {
-	args := m.Called(ctx, start, end)
+func (m *MockService) GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, page domain.PageRequest) (*domain.MaxValuesPage, error) {
+	args := m.Called(ctx, start, end, filter, page)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.MaxValuesPage), args.Error(1)
+}
+
+// StreamMaxValuesByTimeRange передаёт fn строки, заданные первым значением Return, и возвращает второе
+func (m *MockService) StreamMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, fn func(*domain.ProcessedData) error) error {
+	args := m.Called(ctx, start, end, filter)
+	if rows, ok := args.Get(0).([]*domain.ProcessedData); ok {
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockService) GetTopK(ctx context.Context, start, end time.Time, k int, order domain.TopKOrder, filter domain.PacketFilter) ([]*domain.ProcessedData, error) {
+	args := m.Called(ctx, start, end, k, order, filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]*domain.ProcessedData), args.Error(1)
 }
 
+func (m *MockService) GetRollups(ctx context.Context, start, end time.Time, step time.Duration, series string) ([]*domain.RollupBucket, error) {
+	args := m.Called(ctx, start, end, step, series)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RollupBucket), args.Error(1)
+}
+
+func (m *MockService) GetQuantiles(ctx context.Context, start, end time.Time, step time.Duration, quantiles []float64, series string) ([]*domain.QuantileBucket, error) {
+	args := m.Called(ctx, start, end, step, quantiles, series)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.QuantileBucket), args.Error(1)
+}
+
+func (m *MockService) GetRawPacket(ctx context.Context, packetID string) (*domain.RawPacket, error) {
+	args := m.Called(ctx, packetID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RawPacket), args.Error(1)
+}
+
 func (m *MockService) CheckDBConnection(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
@@ -59,6 +113,34 @@ func TestHTTPServer_HealthCheck(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+type staticHealthReporter []string
+
+func (r staticHealthReporter) HealthWarnings() []string {
+	return r
+}
+
+func TestHTTPServer_HealthCheck_Warnings(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+	server.AddHealthReporter(staticHealthReporter(nil))
+	server.AddHealthReporter(staticHealthReporter{"default partition of processed_packets holds 3 rows outside monthly partitions"})
+
+	mockService.On("CheckDBConnection", mock.Anything).Return(nil)
+
+	w := httptest.NewRecorder()
+	server.healthCheck(w, httptest.NewRequest("GET", "/health", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Status   string   `json:"status"`
+		Warnings []string `json:"warnings"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "degraded", body.Status)
+	assert.Len(t, body.Warnings, 1)
+}
+
 func TestHTTPServer_GetMaxValuesByTimeRange(t *testing.T) {
 	mockService := new(MockService)
 	logger, _ := zap.NewDevelopment()
@@ -85,7 +167,9 @@ func TestHTTPServer_GetMaxValuesByTimeRange(t *testing.T) {
 		mock.MatchedBy(func(t time.Time) bool {
 			return t.Truncate(time.Second).Equal(end.Truncate(time.Second))
 		}),
-	).Return(expectedData, nil)
+		domain.PacketFilter{},
+		domain.PageRequest{},
+	).Return(&domain.MaxValuesPage{MaxValues: expectedData}, nil)
 
 	req := httptest.NewRequest(
 		"GET",
@@ -99,11 +183,186 @@ func TestHTTPServer_GetMaxValuesByTimeRange(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	var response []*domain.ProcessedData
+	var response domain.MaxValuesPage
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Len(t, response, 1)
-	assert.Equal(t, 100, response[0].MaxValue)
+	assert.Len(t, response.MaxValues, 1)
+	assert.Equal(t, int64(100), response.MaxValues[0].MaxValue)
+	assert.Empty(t, response.NextCursor)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHTTPServer_GetMaxValuesByTimeRange_Filter(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	filter := domain.PacketFilter{SourceID: "sensor-1", Labels: map[string]string{"site": "a"}, Series: []string{"cpu"}}
+	expected := []*domain.ProcessedData{{PacketID: uuid.New(), SourceID: "sensor-1", Labels: map[string]string{"site": "a"}, Series: "cpu", MaxValue: 7}}
+
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, start, end, filter, domain.PageRequest{}).
+		Return(&domain.MaxValuesPage{MaxValues: expected}, nil)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values?start=2025-09-01T00:00:00Z&end=2025-09-01T01:00:00Z&source=sensor-1&label=site=a&series=cpu", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response domain.MaxValuesPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.MaxValues, 1)
+	assert.Equal(t, "sensor-1", response.MaxValues[0].SourceID)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values?start=2025-09-01T00:00:00Z&end=2025-09-01T01:00:00Z&label=site", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHTTPServer_GetMaxValuesByTimeRange_TimeAxis(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{TimeAxis: domain.TimeAxisEvent}, domain.PageRequest{}).
+		Return(&domain.MaxValuesPage{MaxValues: []*domain.ProcessedData{{PacketID: uuid.New(), MaxValue: 3}}}, nil)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values?start=2024-01-01T00:00:00Z&end=2024-01-02T00:00:00Z&time_axis=event", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values?start=2024-01-01T00:00:00Z&end=2024-01-02T00:00:00Z&time_axis=ingest", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/top-k?start=2024-01-01T00:00:00Z&end=2024-01-02T00:00:00Z&time_axis=ingest", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHTTPServer_GetMaxValuesByTimeRange_Page(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{}, domain.PageRequest{Limit: 2, Cursor: "abc"}).
+		Return(&domain.MaxValuesPage{MaxValues: []*domain.ProcessedData{{PacketID: uuid.New(), MaxValue: 3}}, NextCursor: "def"}, nil)
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{}, domain.PageRequest{Cursor: "bad"}).
+		Return(nil, domain.ErrInvalidCursor)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values?start=2025-09-01T00:00:00Z&end=2025-09-01T01:00:00Z&limit=2&cursor=abc", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response domain.MaxValuesPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.MaxValues, 1)
+	assert.Equal(t, "def", response.NextCursor)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values?start=2025-09-01T00:00:00Z&end=2025-09-01T01:00:00Z&cursor=bad", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Некорректный интервал — ошибка клиента, а не сервера
+	mockService.On("GetMaxValuesByTimeRange", mock.Anything, end, start, domain.PacketFilter{}, domain.PageRequest{}).
+		Return(nil, fmt.Errorf("%w: end time must be after start time", domain.ErrInvalidQuery))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values?start=2025-09-01T01:00:00Z&end=2025-09-01T00:00:00Z", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "end time must be after start time")
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values?start=2025-09-01T00:00:00Z&end=2025-09-01T01:00:00Z&limit=0", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHTTPServer_ExportMaxValues(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	rows := []*domain.ProcessedData{
+		{PacketID: uuid.New(), MaxValue: 1},
+		{PacketID: uuid.New(), MaxValue: 2},
+	}
+	filter := domain.PacketFilter{SourceID: "sensor-1"}
+	mockService.On("StreamMaxValuesByTimeRange", mock.Anything, start, end, filter).Return(rows, nil)
+	mockService.On("StreamMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{}).Return(nil, nil)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values/export?start=2025-09-01T00:00:00Z&end=2025-09-01T01:00:00Z&source=sensor-1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	// Каждая строка ответа — отдельный результат
+	decoder := json.NewDecoder(w.Body)
+	for _, row := range rows {
+		var got domain.ProcessedData
+		assert.NoError(t, decoder.Decode(&got))
+		assert.Equal(t, row.PacketID, got.PacketID)
+	}
+	assert.False(t, decoder.More())
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values/export?start=2025-09-01T00:00:00Z&end=2025-09-01T01:00:00Z", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values/export?start=2025-09-01T00:00:00Z", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHTTPServer_ExportMaxValues_Error(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	failed := fmt.Errorf("connection reset")
+	mockService.On("StreamMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{}).Return(nil, failed).Once()
+
+	// До первой строки ошибку ещё можно вернуть статусом
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/max-values/export?start=2025-09-01T00:00:00Z&end=2025-09-01T01:00:00Z", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// После начала ответа соединение обрывается, чтобы выгрузку не приняли за полную
+	mockService.On("StreamMaxValuesByTimeRange", mock.Anything, start, end, domain.PacketFilter{}).
+		Return([]*domain.ProcessedData{{PacketID: uuid.New(), MaxValue: 1}}, failed).Once()
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		server.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET",
+			"/api/v1/max-values/export?start=2025-09-01T00:00:00Z&end=2025-09-01T01:00:00Z", nil))
+	})
 
 	mockService.AssertExpectations(t)
 }
@@ -120,10 +379,10 @@ func TestHTTPServer_GetMaxValueByID(t *testing.T) {
 		MaxValue:        42,
 	}
 
-	mockService.On("GetMaxValueByPacketID", mock.Anything, packetID.String()).
+	mockService.On("GetMaxValueByPacketID", mock.Anything, packetID.String(), "cpu").
 		Return(expectedData, nil)
 
-	req := httptest.NewRequest("GET", "/api/v1/max-values/"+packetID.String(), nil)
+	req := httptest.NewRequest("GET", "/api/v1/max-values/"+packetID.String()+"?series=cpu", nil)
 	w := httptest.NewRecorder()
 
 	router := mux.NewRouter()
@@ -135,6 +394,771 @@ func TestHTTPServer_GetMaxValueByID(t *testing.T) {
 	var response domain.ProcessedData
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Equal(t, 42, response.MaxValue)
+	assert.Equal(t, int64(42), response.MaxValue)
+	mockService.AssertExpectations(t)
+}
+
+func TestHTTPServer_GetTopK(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	expected := []*domain.ProcessedData{{PacketID: uuid.New(), MaxValue: 1}}
+
+	filter := domain.PacketFilter{
+		SourceID: "sensor-1",
+		Labels:   map[string]string{"region": "eu", "rack": "7"},
+		Series:   []string{"cpu", "mem"},
+	}
+	mockService.On("GetTopK", mock.Anything, start, end, 5, domain.TopKOrderBottom, filter).
+		Return(expected, nil)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET",
+		"/api/v1/top-k?start=2025-09-01T00:00:00Z&end=2025-09-02T00:00:00Z&k=5&order=bottom&label=region=eu&label=rack=7&source=sensor-1&series=cpu&series=mem", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response []*domain.ProcessedData
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 1)
+
+	for _, query := range []string{"k=0", "k=5000", "order=middle", "label=region"} {
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET",
+			"/api/v1/top-k?start=2025-09-01T00:00:00Z&end=2025-09-02T00:00:00Z&"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	for _, query := range []string{"start=2025-09-01T00:00:00Z", "start=yesterday&end=2025-09-02T00:00:00Z", "start=2025-09-01T00:00:00Z&end=2025-09-02T00:00:00Z&time_axis=wall"} {
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/top-k?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHTTPServer_GetRollups(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 2)
+	expectedData := []*domain.RollupBucket{
+		{BucketStart: start, Resolution: domain.RollupResolutionDay, MaxValue: 90, MinValue: 3, Count: 4, Sum: 120},
+	}
+
+	mockService.On("GetRollups", mock.Anything, start, end, 24*time.Hour, "").Return(expectedData, nil)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/api/v1/rollups?start="+start.Format(time.RFC3339)+"&end="+end.Format(time.RFC3339)+"&step=24h",
+		nil)
+	w := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/rollups", server.getRollups).Methods("GET")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response []*domain.RollupBucket
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response, 1)
+	assert.Equal(t, int64(90), response[0].MaxValue)
+	assert.Equal(t, int64(4), response[0].Count)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHTTPServer_GetRollups_InvalidStep(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	for _, query := range []string{
+		"start=2025-09-01T00:00:00Z&end=2025-09-02T00:00:00Z&step=daily",
+		"start=2025-09-01T00:00:00Z&end=2025-09-02T00:00:00Z",
+		"start=2025-09-01T00:00:00Z&step=24h",
+		"start=2025-09-01&end=2025-09-02T00:00:00Z&step=24h",
+	} {
+		w := httptest.NewRecorder()
+		server.getRollups(w, httptest.NewRequest("GET", "/api/v1/rollups?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	mockService.AssertNotCalled(t, "GetRollups")
+}
+
+func TestHTTPServer_GetQuantiles(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 7)
+	expectedData := []*domain.QuantileBucket{
+		{
+			BucketStart: start,
+			Resolution:  domain.RollupResolutionDay,
+			Count:       1000,
+			Quantiles:   []domain.QuantileValue{{Quantile: 0.5, Value: 41.8}, {Quantile: 0.99, Value: 97.2}},
+		},
+	}
+
+	mockService.On("GetQuantiles", mock.Anything, start, end, time.Duration(0), []float64{0.5, 0.99}, "cpu").
+		Return(expectedData, nil)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/api/v1/quantiles?start="+start.Format(time.RFC3339)+"&end="+end.Format(time.RFC3339)+"&q=0.5&q=0.99&series=cpu",
+		nil)
+	w := httptest.NewRecorder()
+
+	server.getQuantiles(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response []*domain.QuantileBucket
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response, 1)
+	assert.Equal(t, int64(1000), response[0].Count)
+	assert.Equal(t, 97.2, response[0].Quantiles[1].Value)
+
+	for _, query := range []string{
+		"start=2025-09-01T00:00:00Z&end=2025-09-08T00:00:00Z",
+		"start=2025-09-01T00:00:00Z&end=2025-09-08T00:00:00Z&q=1.5",
+		"start=2025-09-01T00:00:00Z&end=2025-09-08T00:00:00Z&q=p99",
+		"start=2025-09-01T00:00:00Z&end=2025-09-08T00:00:00Z&q=0.5&step=daily",
+		"end=2025-09-08T00:00:00Z&q=0.5",
+		"start=2025-09-01T00:00:00Z&end=next-week&q=0.5",
+	} {
+		w := httptest.NewRecorder()
+		server.getQuantiles(w, httptest.NewRequest("GET", "/api/v1/quantiles?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHTTPServer_GetRawPacket(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+
+	packetID := uuid.New()
+	missingID := uuid.New()
+	mockService.On("GetRawPacket", mock.Anything, packetID.String()).
+		Return(&domain.RawPacket{PacketID: packetID, PayloadKind: domain.PayloadKindFloat, FloatPayload: []float64{1.5, 2.5}}, nil)
+	mockService.On("GetRawPacket", mock.Anything, missingID.String()).
+		Return((*domain.RawPacket)(nil), nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/raw-packets/{id}", server.getRawPacket).Methods("GET")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/raw-packets/"+packetID.String(), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response domain.RawPacket
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []float64{1.5, 2.5}, response.FloatPayload)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/raw-packets/"+missingID.String(), nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+type MockRecomputeService struct {
+	mock.Mock
+}
+
+func (m *MockRecomputeService) StartJob(ctx context.Context, req domain.RecomputeRequest) (*domain.RecomputeJob, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RecomputeJob), args.Error(1)
+}
+
+func (m *MockRecomputeService) GetJob(id uuid.UUID) (*domain.RecomputeJob, bool) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1)
+	}
+	return args.Get(0).(*domain.RecomputeJob), args.Bool(1)
+}
+
+func (m *MockRecomputeService) ListJobs() []*domain.RecomputeJob {
+	args := m.Called()
+	return args.Get(0).([]*domain.RecomputeJob)
+}
+
+func (m *MockRecomputeService) CancelJob(id uuid.UUID) bool {
+	args := m.Called(id)
+	return args.Bool(0)
+}
+
+func TestHTTPServer_Recompute(t *testing.T) {
+	recomputeService := new(MockRecomputeService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", new(MockService), logger)
+	server.SetAuthenticator(openAdminAuth)
+	server.RegisterRecomputeRoutes(recomputeService)
+
+	jobID := uuid.New()
+	job := &domain.RecomputeJob{ID: jobID, Status: domain.RecomputeStatusRunning}
+
+	recomputeService.On("StartJob", mock.Anything, mock.MatchedBy(func(req domain.RecomputeRequest) bool {
+		return req.DryRun && len(req.Functions) == 1 && req.Functions[0] == "max"
+	})).Return(job, nil).Once()
+	recomputeService.On("StartJob", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("%w: unknown function", recompute.ErrInvalidRequest))
+	recomputeService.On("GetJob", jobID).Return(job, true)
+	recomputeService.On("CancelJob", jobID).Return(true)
+
+	body := `{"start":"2025-09-01T00:00:00Z","end":"2025-09-02T00:00:00Z","functions":["max"],"dry_run":true}`
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/recompute", strings.NewReader(body)))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	var response domain.RecomputeJob
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, jobID, response.ID)
+
+	body = `{"start":"2025-09-01T00:00:00Z","end":"2025-09-02T00:00:00Z","functions":["p99"]}`
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/recompute", strings.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/recompute/"+jobID.String(), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/v1/admin/recompute/"+jobID.String(), nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	recomputeService.AssertExpectations(t)
+}
+
+type MockAlertService struct {
+	mock.Mock
+}
+
+func (m *MockAlertService) CreateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error) {
+	args := m.Called(ctx, rule)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AlertRule), args.Error(1)
+}
+
+func (m *MockAlertService) UpdateRule(ctx context.Context, rule domain.AlertRule) (*domain.AlertRule, error) {
+	args := m.Called(ctx, rule)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AlertRule), args.Error(1)
+}
+
+func (m *MockAlertService) DeleteRule(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockAlertService) GetRule(ctx context.Context, id uuid.UUID) (*domain.AlertRule, bool) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1)
+	}
+	return args.Get(0).(*domain.AlertRule), args.Bool(1)
+}
+
+func (m *MockAlertService) ListRules(ctx context.Context) []*domain.AlertRule {
+	args := m.Called(ctx)
+	return args.Get(0).([]*domain.AlertRule)
+}
+
+func TestHTTPServer_AlertRules(t *testing.T) {
+	alertService := new(MockAlertService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", new(MockService), logger)
+	server.RegisterAlertRoutes(alertService)
+
+	ruleID := uuid.New()
+	rule := &domain.AlertRule{ID: ruleID, Name: "high", Condition: domain.AlertConditionAbove, Threshold: 100}
+
+	alertService.On("CreateRule", mock.Anything, mock.MatchedBy(func(r domain.AlertRule) bool {
+		return r.Name == "high" && r.Threshold == 100
+	})).Return(rule, nil).Once()
+	alertService.On("CreateRule", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("%w: condition must be above or below", alert.ErrInvalidRule))
+	alertService.On("UpdateRule", mock.Anything, mock.MatchedBy(func(r domain.AlertRule) bool {
+		return r.ID == ruleID
+	})).Return(rule, nil)
+	alertService.On("DeleteRule", mock.Anything, ruleID).Return(alert.ErrRuleNotFound)
+
+	w := httptest.NewRecorder()
+	body := `{"name":"high","condition":"above","threshold":100}`
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/alert-rules", strings.NewReader(body)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	body = `{"name":"bad","condition":"equals"}`
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/alert-rules", strings.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	body = `{"name":"high","condition":"above","threshold":200}`
+	server.router.ServeHTTP(w, httptest.NewRequest("PUT", "/api/v1/alert-rules/"+ruleID.String(), strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/v1/alert-rules/"+ruleID.String(), nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	alertService.AssertExpectations(t)
+}
+
+// openAdminAuth открывает административные маршруты без ключей, как AUTH_DISABLED
+var openAdminAuth = tenant.NewAuthenticator(nil, "", true)
+
+type MockSchemaService struct {
+	mock.Mock
+}
+
+func (m *MockSchemaService) Register(ctx context.Context, schema domain.PacketSchema) (*domain.PacketSchema, error) {
+	args := m.Called(ctx, schema)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PacketSchema), args.Error(1)
+}
+
+func (m *MockSchemaService) DeleteVersion(ctx context.Context, tenantID, sourceID string, version int) (bool, error) {
+	args := m.Called(ctx, tenantID, sourceID, version)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSchemaService) ListSchemas(tenantID, sourceID string) []*domain.PacketSchema {
+	args := m.Called(tenantID, sourceID)
+	return args.Get(0).([]*domain.PacketSchema)
+}
+
+func TestHTTPServer_SchemaRoutes(t *testing.T) {
+	schemaService := new(MockSchemaService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", new(MockService), logger)
+	server.SetAuthenticator(openAdminAuth)
+	server.RegisterSchemaRoutes(schemaService)
+
+	saved := &domain.PacketSchema{SourceID: "sensor-1", Version: 1, PayloadType: domain.PayloadKindInt}
+	schemaService.On("Register", mock.Anything, mock.MatchedBy(func(s domain.PacketSchema) bool {
+		return s.TenantID == domain.DefaultTenantID && s.SourceID == "sensor-1" && s.PayloadType == domain.PayloadKindInt
+	})).Return(saved, nil).Once()
+	schemaService.On("Register", mock.Anything, mock.MatchedBy(func(s domain.PacketSchema) bool {
+		return s.Version == 5
+	})).Return(nil, fmt.Errorf("%w: next version is 2", schema.ErrVersionConflict)).Once()
+	schemaService.On("Register", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("%w: unknown payload type", schema.ErrInvalidSchema)).Once()
+	schemaService.On("ListSchemas", domain.DefaultTenantID, "sensor-1").Return([]*domain.PacketSchema{saved})
+	schemaService.On("ListSchemas", "team-b", "sensor-1").Return([]*domain.PacketSchema{})
+	schemaService.On("ListSchemas", domain.DefaultTenantID, "sensor-2").Return([]*domain.PacketSchema{})
+	schemaService.On("DeleteVersion", mock.Anything, domain.DefaultTenantID, "sensor-1", 1).Return(true, nil)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/schemas/sensor-1", strings.NewReader(`{"payload_type":"int"}`)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/schemas/sensor-1", strings.NewReader(`{"version":5}`)))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/schemas/sensor-1", strings.NewReader(`{"payload_type":"text"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/schemas/sensor-1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list []domain.PacketSchema
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list, 1)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/schemas/sensor-2", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Схемы ведутся по арендаторам: параметр tenant выбирает арендатора
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/schemas/sensor-1?tenant=team-b", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/schemas/sensor-1?tenant=team%20b", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/v1/admin/schemas/sensor-1/1", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/v1/admin/schemas/sensor-1/x", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	schemaService.AssertExpectations(t)
+}
+
+type MockSigningKeyService struct {
+	mock.Mock
+}
+
+func (m *MockSigningKeyService) AddKey(ctx context.Context, key domain.SigningKey, retireOthersAfter time.Duration) (*domain.SigningKey, error) {
+	args := m.Called(ctx, key, retireOthersAfter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.SigningKey), args.Error(1)
+}
+
+func (m *MockSigningKeyService) DeleteKey(ctx context.Context, tenantID, sourceID, keyID string) (bool, error) {
+	args := m.Called(ctx, tenantID, sourceID, keyID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSigningKeyService) ListKeys(tenantID, sourceID string) []*domain.SigningKey {
+	args := m.Called(tenantID, sourceID)
+	return args.Get(0).([]*domain.SigningKey)
+}
+
+func TestHTTPServer_SigningKeys(t *testing.T) {
+	keyService := new(MockSigningKeyService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", new(MockService), logger)
+	server.SetAuthenticator(openAdminAuth)
+	server.RegisterSigningRoutes(keyService)
+
+	saved := &domain.SigningKey{SourceID: "meter", KeyID: "k2", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: []byte("secret")}
+	keyService.On("AddKey", mock.Anything, mock.MatchedBy(func(k domain.SigningKey) bool {
+		return k.TenantID == "team-b" && k.SourceID == "meter" && k.KeyID == "k2" && string(k.Key) == "0123456789abcdef"
+	}), 24*time.Hour).Return(saved, nil).Once()
+	keyService.On("AddKey", mock.Anything, mock.Anything, time.Duration(0)).
+		Return(nil, fmt.Errorf("%w: key %q", signing.ErrKeyExists, "k2")).Once()
+	keyService.On("ListKeys", domain.DefaultTenantID, "meter").Return([]*domain.SigningKey{saved})
+	keyService.On("DeleteKey", mock.Anything, domain.DefaultTenantID, "meter", "k1").Return(true, nil)
+
+	// Ротация: новый ключ и период перекрытия для прежних
+	body := `{"key_id":"k2","algorithm":"hmac-sha256","key":"MDEyMzQ1Njc4OWFiY2RlZg==","retire_others_after":"24h"}`
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/signing-keys/meter?tenant=team-b", strings.NewReader(body)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	// Секрет не возвращается в ответе
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/signing-keys/meter", strings.NewReader(`{"key_id":"k2","algorithm":"hmac-sha256","key":"MDEyMzQ1Njc4OWFiY2RlZg=="}`)))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/signing-keys/meter", strings.NewReader(`{"key_id":"k3","key":"%%%"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/signing-keys/meter", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/v1/admin/signing-keys/meter/k1", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	keyService.AssertExpectations(t)
+}
+
+func tenantIs(tenantID string) interface{} {
+	return mock.MatchedBy(func(ctx context.Context) bool {
+		got, ok := tenant.FromContext(ctx)
+		return ok && got == tenantID
+	})
+}
+
+func TestHTTPServer_Auth(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", mockService, logger)
+	server.SetAuthenticator(tenant.NewAuthenticator(map[string]string{"key-a": "team-a", "key-ops": "ops"}, "ops", false))
+	server.RegisterRecomputeRoutes(new(MockRecomputeService))
+
+	packetID := uuid.New()
+	mockService.On("GetMaxValueByPacketID", tenantIs("team-a"), packetID.String(), "").
+		Return(&domain.ProcessedData{PacketID: packetID, TenantID: "team-a"}, nil)
+
+	// Без ключа данные недоступны, а health остаётся открытым
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/max-values/"+packetID.String(), nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/max-values/"+packetID.String(), nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	server.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	mockService.On("CheckDBConnection", mock.Anything).Return(nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Арендатор ключа передаётся в сервис через контекст
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/max-values/"+packetID.String(), nil)
+	req.Header.Set("X-API-Key", "key-a")
+	server.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Административные маршруты доступны только административному арендатору
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/admin/recompute", nil)
+	req.Header.Set("X-API-Key", "key-a")
+	server.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
 	mockService.AssertExpectations(t)
 }
+
+func TestHTTPServer_AdminClosedWithoutKeys(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	recomputeService := new(MockRecomputeService)
+	recomputeService.On("ListJobs").Return([]*domain.RecomputeJob{})
+
+	// Без ключей и без AUTH_DISABLED анонимный клиент не получает прав администратора
+	for _, auth := range []Authenticator{nil, tenant.NewAuthenticator(nil, "", false)} {
+		server := NewHTTPServer(":8080", new(MockService), logger)
+		if auth != nil {
+			server.SetAuthenticator(auth)
+		}
+		server.RegisterRecomputeRoutes(recomputeService)
+
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/recompute", nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}
+
+	server := NewHTTPServer(":8080", new(MockService), logger)
+	server.SetAuthenticator(openAdminAuth)
+	server.RegisterRecomputeRoutes(recomputeService)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/recompute", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+type MockPacketProcessor struct {
+	mock.Mock
+}
+
+func (m *MockPacketProcessor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	args := m.Called(ctx, packet)
+	return args.Error(0)
+}
+
+func TestHTTPServer_Ingest(t *testing.T) {
+	processor := new(MockPacketProcessor)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", new(MockService), logger)
+	server.SetAuthenticator(tenant.NewAuthenticator(map[string]string{"key-a": "team-a"}, "", false))
+	server.RegisterIngestRoutes(processor)
+
+	packetID := uuid.New()
+	processor.On("ProcessPacket", mock.Anything, mock.MatchedBy(func(p *domain.DataPacket) bool {
+		return p.ID == packetID && p.TenantID == "team-a" && !p.Timestamp.IsZero() && !p.ReceivedAt.IsZero()
+	})).Return(nil).Once()
+	processor.On("ProcessPacket", mock.Anything, mock.Anything).Return(validation.ErrEmptyPayload).Once()
+	processor.On("ProcessPacket", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: ingest_rate", tenant.ErrQuotaExceeded)).Once()
+	processor.On("ProcessPacket", mock.Anything, mock.Anything).Return(domain.ErrPacketQuarantined).Once()
+	processor.On("ProcessPacket", mock.Anything, mock.Anything).
+		Return(&signing.VerificationError{Reason: signing.ReasonBadSignature, Message: "signature does not match"}).Once()
+
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/v1/packets", strings.NewReader(body))
+		req.Header.Set("X-API-Key", "key-a")
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Арендатор из тела игнорируется: пакет записывается арендатору ключа
+	w := send(fmt.Sprintf(`{"id":"%s","tenant_id":"team-b","payload":[1,2,3]}`, packetID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), packetID.String())
+
+	w = send(fmt.Sprintf(`{"id":"%s","payload":[]}`, uuid.New()))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send(fmt.Sprintf(`{"id":"%s","payload":[1]}`, uuid.New()))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Пакет в карантине принят, но ещё не обработан
+	w = send(fmt.Sprintf(`{"id":"%s","timestamp":"1990-01-01T00:00:00Z","payload":[1]}`, uuid.New()))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), "quarantined")
+
+	w = send(fmt.Sprintf(`{"id":"%s","payload":[1],"signature":{"key_id":"k1","value":"AAAA"}}`, uuid.New()))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = send(`{"id":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	processor.AssertExpectations(t)
+}
+
+type MockQuarantineService struct {
+	mock.Mock
+}
+
+func (m *MockQuarantineService) ListQuarantined(ctx context.Context, limit int) ([]*domain.QuarantinedPacket, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.QuarantinedPacket), args.Error(1)
+}
+
+func (m *MockQuarantineService) GetQuarantined(ctx context.Context, packetID uuid.UUID) (*domain.QuarantinedPacket, error) {
+	args := m.Called(ctx, packetID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.QuarantinedPacket), args.Error(1)
+}
+
+func (m *MockQuarantineService) Release(ctx context.Context, packetID uuid.UUID) (bool, error) {
+	args := m.Called(ctx, packetID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockQuarantineService) Discard(ctx context.Context, packetID uuid.UUID) (bool, error) {
+	args := m.Called(ctx, packetID)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestHTTPServer_Quarantine(t *testing.T) {
+	quarantineService := new(MockQuarantineService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", new(MockService), logger)
+	server.SetAuthenticator(tenant.NewAuthenticator(map[string]string{"key-a": "team-a"}, "", false))
+	server.RegisterQuarantineRoutes(quarantineService)
+
+	packetID := uuid.New()
+	quarantined := &domain.QuarantinedPacket{PacketID: packetID, TenantID: "team-a", Reason: "too_old", Packet: &domain.DataPacket{ID: packetID}}
+	quarantineService.On("ListQuarantined", tenantIs("team-a"), 5).Return([]*domain.QuarantinedPacket{quarantined}, nil)
+	quarantineService.On("GetQuarantined", tenantIs("team-a"), packetID).Return(quarantined, nil)
+	quarantineService.On("Release", tenantIs("team-a"), packetID).Return(true, fmt.Errorf("%w: ingest_rate", tenant.ErrQuotaExceeded)).Once()
+	quarantineService.On("Release", tenantIs("team-a"), packetID).Return(true, nil).Once()
+	quarantineService.On("Discard", tenantIs("team-a"), packetID).Return(false, nil)
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", "key-a")
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("GET", "/api/v1/quarantine?limit=5")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list []domain.QuarantinedPacket
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list, 1)
+
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/api/v1/quarantine?limit=0").Code)
+	assert.Equal(t, http.StatusOK, send("GET", "/api/v1/quarantine/"+packetID.String()).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("POST", "/api/v1/quarantine/"+packetID.String()+"/release").Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/api/v1/quarantine/"+packetID.String()+"/release").Code)
+	assert.Equal(t, http.StatusNotFound, send("DELETE", "/api/v1/quarantine/"+packetID.String()).Code)
+	assert.Equal(t, http.StatusBadRequest, send("DELETE", "/api/v1/quarantine/bad-id").Code)
+
+	quarantineService.AssertExpectations(t)
+}
+
+type MockPartitionService struct {
+	mock.Mock
+}
+
+func (m *MockPartitionService) ListPartitions(ctx context.Context) ([]domain.Partition, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Partition), args.Error(1)
+}
+
+func (m *MockPartitionService) ApplyRetention(ctx context.Context, dryRun bool) ([]*domain.RetentionAuditEntry, error) {
+	args := m.Called(ctx, dryRun)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RetentionAuditEntry), args.Error(1)
+}
+
+func (m *MockPartitionService) ListRetentionAudit(ctx context.Context, limit int) ([]*domain.RetentionAuditEntry, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RetentionAuditEntry), args.Error(1)
+}
+
+func TestHTTPServer_PartitionRoutes(t *testing.T) {
+	partitionService := new(MockPartitionService)
+	logger, _ := zap.NewDevelopment()
+	server := NewHTTPServer(":8080", new(MockService), logger)
+	server.SetAuthenticator(openAdminAuth)
+	server.RegisterPartitionRoutes(partitionService)
+
+	planned := &domain.RetentionAuditEntry{Partition: "processed_packets_06_2026", Status: domain.RetentionStatusPlanned, DryRun: true, Bytes: 4096}
+	failed := &domain.RetentionAuditEntry{Partition: "processed_packets_06_2026", Status: domain.RetentionStatusFailed, Error: "disk full"}
+	partitionService.On("ApplyRetention", mock.Anything, true).Return([]*domain.RetentionAuditEntry{planned}, nil).Once()
+	partitionService.On("ApplyRetention", mock.Anything, false).Return([]*domain.RetentionAuditEntry{failed}, fmt.Errorf("partition processed_packets_06_2026: disk full")).Once()
+	partitionService.On("ApplyRetention", mock.Anything, false).Return(nil, partition.ErrRetentionBusy).Once()
+	partitionService.On("ListRetentionAudit", mock.Anything, 10).Return([]*domain.RetentionAuditEntry{planned}, nil)
+	partitionService.On("ListPartitions", mock.Anything).Return([]domain.Partition{{Name: "processed_packets_10_2026"}}, nil)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/partitions/retention", strings.NewReader(`{"dry_run":true}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var entries []domain.RetentionAuditEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, int64(4096), entries[0].Bytes)
+
+	// Ошибки отдельных партиций возвращаются в записях журнала
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/partitions/retention", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"failed"`)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/admin/partitions/retention", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/partitions/retention/audit?limit=10", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/partitions/retention/audit?limit=0", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/partitions", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	partitionService.AssertExpectations(t)
+}
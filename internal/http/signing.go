@@ -0,0 +1,141 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/signing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// SigningKeyService управляет ключами проверки подписей пакетов источников арендаторов
+type SigningKeyService interface {
+	AddKey(ctx context.Context, key domain.SigningKey, retireOthersAfter time.Duration) (*domain.SigningKey, error)
+	DeleteKey(ctx context.Context, tenantID, sourceID, keyID string) (bool, error)
+	ListKeys(tenantID, sourceID string) []*domain.SigningKey
+}
+
+// RegisterSigningRoutes добавляет административные маршруты ключей подписи
+func (s *HTTPServer) RegisterSigningRoutes(svc SigningKeyService) {
+	h := &signingHandler{service: svc, logger: s.logger}
+
+	s.router.HandleFunc("/api/v1/admin/signing-keys", h.listKeys).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/signing-keys/{source}", h.sourceKeys).Methods("GET")
+	s.router.HandleFunc("/api/v1/admin/signing-keys/{source}", h.addKey).Methods("POST")
+	s.router.HandleFunc("/api/v1/admin/signing-keys/{source}/{key_id}", h.deleteKey).Methods("DELETE")
+}
+
+type signingHandler struct {
+	service SigningKeyService
+	logger  *zap.Logger
+}
+
+func (h *signingHandler) listKeys(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, h.service.ListKeys(tenantID, ""))
+}
+
+func (h *signingHandler) sourceKeys(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	list := h.service.ListKeys(tenantID, mux.Vars(r)["source"])
+	if len(list) == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, list)
+}
+
+// addKey регистрирует ключ источника. Ключ передаётся в base64: общий секрет для hmac-sha256
+// или открытый ключ для ed25519. retire_others_after задаёт период перекрытия при ротации.
+func (h *signingHandler) addKey(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		KeyID             string                  `json:"key_id"`
+		Algorithm         domain.SigningAlgorithm `json:"algorithm"`
+		Key               string                  `json:"key"`
+		ExpiresAt         *time.Time              `json:"expires_at"`
+		RetireOthersAfter string                  `json:"retire_others_after"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	key, err := base64.StdEncoding.DecodeString(body.Key)
+	if err != nil {
+		http.Error(w, "key must be base64 encoded", http.StatusBadRequest)
+		return
+	}
+	var retireOthersAfter time.Duration
+	if body.RetireOthersAfter != "" {
+		if retireOthersAfter, err = time.ParseDuration(body.RetireOthersAfter); err != nil {
+			http.Error(w, "invalid retire_others_after duration", http.StatusBadRequest)
+			return
+		}
+	}
+
+	saved, err := h.service.AddKey(r.Context(), domain.SigningKey{
+		TenantID:  tenantID,
+		SourceID:  mux.Vars(r)["source"],
+		KeyID:     body.KeyID,
+		Algorithm: body.Algorithm,
+		Key:       key,
+		ExpiresAt: body.ExpiresAt,
+	}, retireOthersAfter)
+	if err != nil {
+		switch {
+		case errors.Is(err, signing.ErrInvalidKey):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, signing.ErrKeyExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			h.logger.Error("Failed to add signing key", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusCreated, saved)
+}
+
+func (h *signingHandler) deleteKey(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := configTenant(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	found, err := h.service.DeleteKey(r.Context(), tenantID, vars["source"], vars["key_id"])
+	if err != nil {
+		h.logger.Error("Failed to delete signing key", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
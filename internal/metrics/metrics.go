@@ -10,7 +10,7 @@ var (
 	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "http_requests_total",
 		Help: "Total number of HTTP requests",
-	}, []string{"method", "path", "status"})
+	}, []string{"method", "path", "status", "tenant"})
 
 	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "http_request_duration_seconds",
@@ -28,7 +28,7 @@ var (
 	GRPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "grpc_requests_total",
 		Help: "Total number of gRPC requests",
-	}, []string{"method", "status"})
+	}, []string{"method", "status", "tenant"})
 
 	GRPCRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "grpc_request_duration_seconds",
@@ -36,6 +36,11 @@ var (
 		Buckets: prometheus.DefBuckets,
 	}, []string{"method", "status"})
 
+	GRPCLegacyValueOverflow = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "grpc_legacy_value_overflow_total",
+		Help: "Total number of values that did not fit the deprecated int32 max_value field",
+	})
+
 	// DB метрики
 	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "db_query_duration_seconds",
@@ -53,6 +58,11 @@ var (
 		Help: "Number of idle database connections",
 	})
 
+	StreamedRows = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "db_streamed_rows_total",
+		Help: "Total number of result rows streamed to clients by exports",
+	})
+
 	// метрики для агрегатора
 	AggregatorPacketsReceived = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "aggregator_packets_received_total",
@@ -79,4 +89,198 @@ var (
 		Name: "aggregator_active_workers",
 		Help: "Current number of active workers processing packets",
 	})
+
+	// метрики валидации пакетов
+	ValidationRejectedPackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "validation_rejected_packets_total",
+		Help: "Total number of packets rejected by validation",
+	}, []string{"reason", "tenant"})
+
+	// метрики окон событийного времени
+	WindowResultsEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "window_results_emitted_total",
+		Help: "Total number of emitted event-time window results",
+	}, []string{"kind"})
+
+	WindowLatePackets = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "window_late_packets_total",
+		Help: "Total number of packets routed to the late side output",
+	})
+
+	WindowOpenWindows = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "window_open_windows",
+		Help: "Current number of open event-time windows",
+	})
+
+	WindowWatermark = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "window_watermark_seconds",
+		Help: "Most advanced event-time watermark across window streams as unix timestamp",
+	})
+
+	// метрики архива сырых пейлоадов
+	RawArchivePackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "raw_archive_packets_total",
+		Help: "Total number of raw payloads archived, by status",
+	}, []string{"status"})
+
+	RawArchivePartitionsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "raw_archive_partitions_dropped_total",
+		Help: "Total number of raw_packets partitions dropped by retention",
+	})
+
+	// метрики пересчёта результатов
+	RecomputeJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "recompute_jobs_total",
+		Help: "Total number of finished recompute jobs, by final status",
+	}, []string{"status"})
+
+	RecomputeJobsActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "recompute_jobs_active",
+		Help: "Current number of running recompute jobs",
+	})
+
+	RecomputePacketsProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "recompute_packets_processed_total",
+		Help: "Total number of archived packets processed by recompute jobs",
+	})
+
+	// метрики алертов
+	AlertEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alert_events_total",
+		Help: "Total number of alert state transitions, by status",
+	}, []string{"status"})
+
+	AlertsFiring = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "alerts_firing",
+		Help: "Current number of firing alert rules",
+	})
+
+	AlertNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alert_notifications_total",
+		Help: "Total number of webhook notifications, by result",
+	}, []string{"result"})
+
+	AlertNotificationRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "alert_notification_retries_total",
+		Help: "Total number of webhook delivery retries",
+	})
+
+	// метрики детектора аномалий
+	AnomalyEvaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anomaly_evaluations_total",
+		Help: "Total number of values evaluated by the anomaly detector, by result",
+	}, []string{"result"})
+
+	AnomalyScore = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "anomaly_score_abs",
+		Help:    "Absolute anomaly score of evaluated values",
+		Buckets: []float64{0.5, 1, 2, 3, 4, 5, 7.5, 10, 20},
+	})
+
+	AnomalySources = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "anomaly_sources",
+		Help: "Current number of sources tracked by the anomaly detector",
+	})
+
+	// метрики дедупликации пакетов
+	DuplicatePackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "duplicate_packets_total",
+		Help: "Total number of resent packets skipped by deduplication, by layer that detected them",
+	}, []string{"layer", "tenant"})
+
+	DedupCacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dedup_cache_entries",
+		Help: "Current number of packet IDs held by the in-memory deduplication filter",
+	})
+
+	// метрики производных метрик
+	DerivedEvaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "derived_metric_evaluations_total",
+		Help: "Total number of derived metric evaluations, by result",
+	}, []string{"result"})
+
+	// метрики схем пакетов
+	SchemaUpcastedPackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "schema_upcasted_packets_total",
+		Help: "Total number of packets migrated from an older schema version, by source",
+	}, []string{"source"})
+
+	// метрики подписей пакетов
+	SignatureVerifiedPackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signature_verified_packets_total",
+		Help: "Total number of packets with a valid signature, by source",
+	}, []string{"source"})
+
+	SignatureRejectedPackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signature_rejected_packets_total",
+		Help: "Total number of packets rejected by signature verification, by reason",
+	}, []string{"reason"})
+
+	// метрики партиций processed_packets
+	PartitionsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "processed_partitions_created_total",
+		Help: "Total number of processed_packets partitions created by the partition manager",
+	})
+
+	PartitionMaintenanceFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "processed_partition_maintenance_failures_total",
+		Help: "Total number of failed processed_packets partition maintenance runs",
+	})
+
+	PartitionRunway = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "processed_partition_runway_seconds",
+		Help: "Time until the upper bound of the last processed_packets partition",
+	})
+
+	PartitionRunwayShort = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "processed_partition_runway_short",
+		Help: "1 if the processed_packets partition runway is below the configured minimum, 0 otherwise",
+	})
+
+	DefaultPartitionRows = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "processed_partition_default_rows",
+		Help: "Number of rows in the processed_packets default partition as of the last maintenance run",
+	})
+
+	DefaultPartitionRowsMoved = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "processed_partition_default_rows_moved_total",
+		Help: "Total number of rows moved from the processed_packets default partition into monthly partitions",
+	})
+
+	PartitionRetention = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "processed_partition_retention_total",
+		Help: "Total number of processed_packets partitions handled by retention, by status",
+	}, []string{"status"})
+
+	PartitionBytesReclaimed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "processed_partition_retention_bytes_reclaimed_total",
+		Help: "Total size in bytes of processed_packets partitions dropped by retention",
+	})
+
+	// метрики проверки времени пакетов
+	TimestampSkewedPackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "timestamp_skewed_packets_total",
+		Help: "Total number of packets with device time outside the tolerance window, by direction and applied action",
+	}, []string{"direction", "action"})
+
+	QuarantinedPackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "quarantine_packets_total",
+		Help: "Total number of quarantine operations, by result",
+	}, []string{"result"})
+
+	// метрики арендаторов
+	TenantPacketsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tenant_packets_processed_total",
+		Help: "Total number of packets saved, by tenant",
+	}, []string{"tenant"})
+
+	TenantQuotaRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tenant_quota_rejected_packets_total",
+		Help: "Total number of packets rejected by tenant quotas, by tenant and quota",
+	}, []string{"tenant", "quota"})
+
+	TenantStoredRows = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tenant_stored_rows",
+		Help: "Number of stored result rows per tenant as of the last quota refresh",
+	}, []string{"tenant"})
 )
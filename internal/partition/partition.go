@@ -0,0 +1,248 @@
+// Package partition заранее создаёт месячные партиции processed_packets, следит за тем,
+// на сколько вперёд хватает уже созданных партиций, и удаляет партиции старше срока хранения.
+package partition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+// Store хранилище с месячными партициями processed_packets
+type Store interface {
+	// EnsureProcessedPartitions создаёт партиции для месяцев из [from, to], перенося в них строки
+	// этих месяцев из партиции по умолчанию, и возвращает имена созданных партиций и число
+	// перенесённых строк. Вызовы из нескольких экземпляров сервиса не должны мешать друг другу.
+	// Если таблица месяца существует, но отсоединена, остальные партиции создаются, а возвращается ошибка.
+	EnsureProcessedPartitions(ctx context.Context, from, to time.Time) ([]string, int64, error)
+	ListProcessedPartitions(ctx context.Context) ([]domain.Partition, error)
+	// DefaultPartitionMonths возвращает месяцы, строки которых лежат в партиции по умолчанию
+	DefaultPartitionMonths(ctx context.Context) ([]time.Time, error)
+	CountDefaultPartitionRows(ctx context.Context) (int64, error)
+	// ListDetachedProcessedPartitions возвращает отсоединённые, но ещё не удалённые месячные партиции
+	ListDetachedProcessedPartitions(ctx context.Context) ([]domain.Partition, error)
+
+	// TryLockRetention захватывает блокировку удаления партиций; false — её держит другой экземпляр
+	TryLockRetention(ctx context.Context) (unlock func(), ok bool, err error)
+	ProcessedPartitionSize(ctx context.Context, name string) (int64, error)
+	// DetachProcessedPartition отсоединяет партицию, ожидая блокировку processed_packets не дольше lockTimeout
+	DetachProcessedPartition(ctx context.Context, name string, lockTimeout time.Duration) error
+	// ExportProcessedPartition выгружает строки партиции в CSV с заголовком
+	ExportProcessedPartition(ctx context.Context, name string, w io.Writer) error
+	DropProcessedPartition(ctx context.Context, name string) error
+
+	SaveRetentionAudit(ctx context.Context, entry *domain.RetentionAuditEntry) error
+	ListRetentionAudit(ctx context.Context, limit int) ([]*domain.RetentionAuditEntry, error)
+}
+
+type Config struct {
+	MonthsAhead       int           // на сколько месяцев после текущего создавать партиции
+	MinRunway         time.Duration // запас партиций, при котором выставляется предупреждение
+	MaintenancePeriod time.Duration
+	RetentionMonths   int    // сколько месяцев хранить результаты, 0 — не удалять партиции
+	RetentionDryRun   bool   // при плановом обслуживании только записывать в журнал, что было бы удалено
+	ExportDir         string // каталог для gzip-выгрузки партиций перед удалением, пусто — без выгрузки
+	// DetachLockTimeout ограничивает ожидание блокировки при отсоединении: пока DETACH ждёт долгие
+	// запросы (например, потоковую выгрузку), за ним в очереди стоят все записи в processed_packets
+	DetachLockTimeout time.Duration
+}
+
+// Manager поддерживает партиции processed_packets на MonthsAhead месяцев вперёд
+// и удаляет партиции старше RetentionMonths
+type Manager struct {
+	store  Store
+	cfg    Config
+	logger *zap.Logger
+	now    func() time.Time
+
+	defaultRows atomic.Int64 // строк в партиции по умолчанию на момент последней проверки
+}
+
+func NewManager(store Store, cfg Config, logger *zap.Logger) *Manager {
+	if cfg.MonthsAhead <= 0 {
+		cfg.MonthsAhead = 3
+	}
+	if cfg.MaintenancePeriod <= 0 {
+		cfg.MaintenancePeriod = time.Hour
+	}
+	if cfg.DetachLockTimeout <= 0 {
+		cfg.DetachLockTimeout = 5 * time.Second
+	}
+
+	return &Manager{
+		store:  store,
+		cfg:    cfg,
+		logger: logger,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Maintain создаёт партиции наперёд и применяет срок хранения
+func (m *Manager) Maintain(ctx context.Context) error {
+	ensureErr := m.EnsurePartitions(ctx)
+
+	var retentionErr error
+	if m.cfg.RetentionMonths > 0 {
+		_, retentionErr = m.ApplyRetention(ctx, m.cfg.RetentionDryRun)
+		if errors.Is(retentionErr, ErrRetentionBusy) {
+			m.logger.Debug("[Partition] Retention is running on another instance")
+			retentionErr = nil
+		}
+	}
+
+	return errors.Join(ensureErr, retentionErr)
+}
+
+// EnsurePartitions создаёт партиции с текущего месяца на MonthsAhead месяцев вперёд, переносит строки
+// из партиции по умолчанию в партиции их месяцев и обновляет метрики. Запас пересчитывается и при ошибке
+// создания, чтобы предупреждение не пропало, пока база недоступна для DDL.
+func (m *Manager) EnsurePartitions(ctx context.Context) error {
+	now := m.now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	ensureErr := m.ensure(ctx, month, month.AddDate(0, m.cfg.MonthsAhead, 0))
+	recoverErr := m.recoverDefault(ctx)
+	runwayErr := m.checkRunway(ctx, now)
+	defaultErr := m.checkDefault(ctx)
+
+	if err := errors.Join(ensureErr, recoverErr, runwayErr, defaultErr); err != nil {
+		metrics.PartitionMaintenanceFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) ensure(ctx context.Context, from, to time.Time) error {
+	created, moved, err := m.store.EnsureProcessedPartitions(ctx, from, to)
+	if len(created) > 0 {
+		metrics.PartitionsCreated.Add(float64(len(created)))
+		m.logger.Info("[Partition] Partitions created", zap.Strings("partitions", created))
+	}
+	if moved > 0 {
+		metrics.DefaultPartitionRowsMoved.Add(float64(moved))
+		m.logger.Info("[Partition] Rows moved from default partition",
+			zap.Strings("partitions", created),
+			zap.Int64("rows", moved))
+	}
+	return err
+}
+
+// recoverDefault создаёт партиции для месяцев, строки которых попали в партицию по умолчанию,
+// например пока сервис был остановлен дольше запаса партиций или партиции не удавалось создать
+func (m *Manager) recoverDefault(ctx context.Context) error {
+	months, err := m.store.DefaultPartitionMonths(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, month := range months {
+		if err := m.ensure(ctx, month, month); err != nil {
+			errs = append(errs, fmt.Errorf("failed to recover default partition rows of %s: %w", month.Format("2006-01"), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkDefault обновляет число строк в партиции по умолчанию
+func (m *Manager) checkDefault(ctx context.Context) error {
+	rows, err := m.store.CountDefaultPartitionRows(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.defaultRows.Store(rows)
+	metrics.DefaultPartitionRows.Set(float64(rows))
+	if rows > 0 {
+		m.logger.Warn("[Partition] Default partition is not empty", zap.Int64("rows", rows))
+	}
+	return nil
+}
+
+// HealthWarnings сообщает о строках, оставшихся в партиции по умолчанию после последнего обслуживания
+func (m *Manager) HealthWarnings() []string {
+	if rows := m.defaultRows.Load(); rows > 0 {
+		return []string{fmt.Sprintf("default partition of processed_packets holds %d rows outside monthly partitions", rows)}
+	}
+	return nil
+}
+
+// checkRunway считает, до какого момента непрерывно от now есть партиции
+func (m *Manager) checkRunway(ctx context.Context, now time.Time) error {
+	partitions, err := m.store.ListProcessedPartitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	end := coverage(partitions, now)
+	runway := end.Sub(now)
+	if runway < 0 {
+		runway = 0
+	}
+	metrics.PartitionRunway.Set(runway.Seconds())
+
+	if runway < m.cfg.MinRunway {
+		metrics.PartitionRunwayShort.Set(1)
+		m.logger.Warn("[Partition] Partition runway is short",
+			zap.Duration("runway", runway),
+			zap.Duration("min_runway", m.cfg.MinRunway),
+			zap.Time("covered_until", end))
+		return nil
+	}
+
+	metrics.PartitionRunwayShort.Set(0)
+	return nil
+}
+
+// coverage возвращает конец непрерывного покрытия партициями, начиная с момента at.
+// Если at не попадает ни в одну партицию, возвращается at.
+func coverage(partitions []domain.Partition, at time.Time) time.Time {
+	sorted := append([]domain.Partition(nil), partitions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].From.Before(sorted[j].From) })
+
+	end := at
+	for _, p := range sorted {
+		if !p.From.After(end) && p.To.After(end) {
+			end = p.To
+		}
+	}
+	return end
+}
+
+// ListPartitions возвращает подключённые месячные партиции в порядке времени
+func (m *Manager) ListPartitions(ctx context.Context) ([]domain.Partition, error) {
+	partitions, err := m.store.ListProcessedPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].From.Before(partitions[j].From) })
+	return partitions, nil
+}
+
+// Run выполняет обслуживание партиций с периодом MaintenancePeriod. Партиции создаются
+// при старте сервиса через EnsurePartitions до приёма пакетов.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.MaintenancePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := m.Maintain(ctx); err != nil && ctx.Err() == nil {
+			m.logger.Error("[Partition] Partition maintenance failed", zap.Error(err))
+		}
+	}
+}
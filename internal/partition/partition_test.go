@@ -0,0 +1,245 @@
+package partition
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) EnsureProcessedPartitions(ctx context.Context, from, to time.Time) ([]string, int64, error) {
+	args := m.Called(ctx, from, to)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]string), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockStore) DefaultPartitionMonths(ctx context.Context) ([]time.Time, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]time.Time), args.Error(1)
+}
+
+func (m *MockStore) CountDefaultPartitionRows(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStore) ListProcessedPartitions(ctx context.Context) ([]domain.Partition, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Partition), args.Error(1)
+}
+
+func (m *MockStore) ListDetachedProcessedPartitions(ctx context.Context) ([]domain.Partition, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Partition), args.Error(1)
+}
+
+func (m *MockStore) TryLockRetention(ctx context.Context) (func(), bool, error) {
+	args := m.Called(ctx)
+	if !args.Bool(0) {
+		return nil, false, args.Error(1)
+	}
+	return func() { m.MethodCalled("Unlock") }, true, args.Error(1)
+}
+
+func (m *MockStore) ProcessedPartitionSize(ctx context.Context, name string) (int64, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStore) DetachProcessedPartition(ctx context.Context, name string, lockTimeout time.Duration) error {
+	args := m.Called(ctx, name, lockTimeout)
+	return args.Error(0)
+}
+
+func (m *MockStore) ExportProcessedPartition(ctx context.Context, name string, w io.Writer) error {
+	args := m.Called(ctx, name, w)
+	return args.Error(0)
+}
+
+func (m *MockStore) DropProcessedPartition(ctx context.Context, name string) error {
+	args := m.Called(ctx, name)
+	return args.Error(0)
+}
+
+func (m *MockStore) SaveRetentionAudit(ctx context.Context, entry *domain.RetentionAuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *MockStore) ListRetentionAudit(ctx context.Context, limit int) ([]*domain.RetentionAuditEntry, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RetentionAuditEntry), args.Error(1)
+}
+
+func monthly(from time.Time, count int) []domain.Partition {
+	var partitions []domain.Partition
+	for i := 0; i < count; i++ {
+		month := from.AddDate(0, i, 0)
+		partitions = append(partitions, domain.Partition{Name: month.Format("processed_packets_01_2006"), From: month, To: month.AddDate(0, 1, 0)})
+	}
+	return partitions
+}
+
+func TestManager_Maintain(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	manager := NewManager(store, Config{MonthsAhead: 2, MinRunway: 30 * 24 * time.Hour}, logger)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+
+	october := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	store.On("EnsureProcessedPartitions", mock.Anything, october, october.AddDate(0, 2, 0)).
+		Return([]string{"processed_packets_10_2026", "processed_packets_11_2026", "processed_packets_12_2026"}, int64(0), nil)
+	store.On("ListProcessedPartitions", mock.Anything).Return(monthly(october, 3), nil)
+	store.On("DefaultPartitionMonths", mock.Anything).Return([]time.Time{}, nil)
+	store.On("CountDefaultPartitionRows", mock.Anything).Return(int64(0), nil)
+
+	created := testutil.ToFloat64(metrics.PartitionsCreated)
+	assert.NoError(t, manager.Maintain(context.Background()))
+	store.AssertExpectations(t)
+
+	assert.Equal(t, created+3, testutil.ToFloat64(metrics.PartitionsCreated))
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC).Sub(now).Seconds(), testutil.ToFloat64(metrics.PartitionRunway))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.PartitionRunwayShort))
+	assert.Empty(t, manager.HealthWarnings())
+}
+
+func TestManager_Maintain_ShortRunwayWhenEnsureFails(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	manager := NewManager(store, Config{MinRunway: 30 * 24 * time.Hour}, logger)
+	now := time.Date(2026, 8, 20, 0, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+
+	store.On("EnsureProcessedPartitions", mock.Anything, mock.Anything, mock.Anything).Return(nil, int64(0), errors.New("permission denied"))
+	store.On("ListProcessedPartitions", mock.Anything).Return(monthly(time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), 2), nil)
+	store.On("DefaultPartitionMonths", mock.Anything).Return([]time.Time{}, nil)
+	store.On("CountDefaultPartitionRows", mock.Anything).Return(int64(0), nil)
+
+	failures := testutil.ToFloat64(metrics.PartitionMaintenanceFailures)
+	assert.Error(t, manager.Maintain(context.Background()))
+	store.AssertExpectations(t)
+
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.PartitionMaintenanceFailures))
+	assert.Equal(t, (12 * 24 * time.Hour).Seconds(), testutil.ToFloat64(metrics.PartitionRunway))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.PartitionRunwayShort))
+}
+
+func TestManager_EnsurePartitions_RecoversDefaultPartition(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	manager := NewManager(store, Config{MonthsAhead: 1}, logger)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+
+	september := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	october := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	// Строки октября переносятся при создании партиций наперёд, сентябрь — отдельным проходом
+	store.On("EnsureProcessedPartitions", mock.Anything, october, october.AddDate(0, 1, 0)).
+		Return([]string{"processed_packets_10_2026", "processed_packets_11_2026"}, int64(40), nil)
+	store.On("DefaultPartitionMonths", mock.Anything).Return([]time.Time{september}, nil)
+	store.On("EnsureProcessedPartitions", mock.Anything, september, september).
+		Return([]string{"processed_packets_09_2026"}, int64(2), nil)
+	store.On("ListProcessedPartitions", mock.Anything).Return(monthly(september, 3), nil)
+	store.On("CountDefaultPartitionRows", mock.Anything).Return(int64(0), nil)
+
+	moved := testutil.ToFloat64(metrics.DefaultPartitionRowsMoved)
+	assert.NoError(t, manager.EnsurePartitions(context.Background()))
+	store.AssertExpectations(t)
+
+	assert.Equal(t, moved+42, testutil.ToFloat64(metrics.DefaultPartitionRowsMoved))
+	assert.Empty(t, manager.HealthWarnings())
+}
+
+func TestManager_EnsurePartitions_DetachedPartitionFails(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	manager := NewManager(store, Config{MonthsAhead: 1}, logger)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+
+	october := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	// Отсоединённая таблица октября не мешает создать ноябрь, но обслуживание завершается ошибкой
+	store.On("EnsureProcessedPartitions", mock.Anything, october, october.AddDate(0, 1, 0)).
+		Return([]string{"processed_packets_11_2026"}, int64(0), errors.New("table processed_packets_10_2026 exists but is not attached to processed_packets")).Once()
+	store.On("DefaultPartitionMonths", mock.Anything).Return([]time.Time{}, nil)
+	store.On("ListProcessedPartitions", mock.Anything).Return(monthly(october.AddDate(0, 1, 0), 1), nil)
+	store.On("CountDefaultPartitionRows", mock.Anything).Return(int64(0), nil)
+
+	created := testutil.ToFloat64(metrics.PartitionsCreated)
+	failures := testutil.ToFloat64(metrics.PartitionMaintenanceFailures)
+	err := manager.EnsurePartitions(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "processed_packets_10_2026")
+	}
+	store.AssertExpectations(t)
+
+	assert.Equal(t, created+1, testutil.ToFloat64(metrics.PartitionsCreated))
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.PartitionMaintenanceFailures))
+}
+
+func TestManager_EnsurePartitions_DefaultPartitionNotEmpty(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	manager := NewManager(store, Config{}, logger)
+
+	september := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	store.On("EnsureProcessedPartitions", mock.Anything, mock.Anything, mock.Anything).Return([]string{}, int64(0), nil).Once()
+	store.On("DefaultPartitionMonths", mock.Anything).Return([]time.Time{september}, nil)
+	store.On("EnsureProcessedPartitions", mock.Anything, september, september).
+		Return(nil, int64(0), errors.New("updated partition constraint for default partition would be violated")).Once()
+	store.On("ListProcessedPartitions", mock.Anything).Return(monthly(september, 6), nil)
+	store.On("CountDefaultPartitionRows", mock.Anything).Return(int64(7), nil)
+
+	assert.Error(t, manager.EnsurePartitions(context.Background()))
+	store.AssertExpectations(t)
+
+	assert.Equal(t, float64(7), testutil.ToFloat64(metrics.DefaultPartitionRows))
+	warnings := manager.HealthWarnings()
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "7 rows")
+}
+
+func TestCoverage(t *testing.T) {
+	at := time.Date(2026, 9, 15, 0, 0, 0, 0, time.UTC)
+	september := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	// Партиции вне порядка сливаются в непрерывный диапазон
+	partitions := monthly(september, 3)
+	partitions[0], partitions[2] = partitions[2], partitions[0]
+	assert.Equal(t, time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), coverage(partitions, at))
+
+	// Пропущенный месяц обрывает покрытие
+	gap := append(monthly(september, 1), monthly(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), 2)...)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), coverage(gap, at))
+
+	// Нет партиции для текущего момента — запаса нет
+	assert.Equal(t, at, coverage(monthly(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), 2), at))
+}
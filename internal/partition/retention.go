@@ -0,0 +1,194 @@
+package partition
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+var (
+	// ErrRetentionDisabled возвращается при запуске удаления без настроенного срока хранения
+	ErrRetentionDisabled = errors.New("partition retention is not configured")
+	// ErrRetentionBusy возвращается, когда удаление уже выполняет другой экземпляр сервиса
+	ErrRetentionBusy = errors.New("partition retention is already running")
+)
+
+// ApplyRetention отсоединяет партиции, целиком лежащие раньше срока хранения, при настроенном
+// каталоге выгружает их в сжатые CSV и удаляет. Каждая партиция записывается в журнал; в пробном
+// прогоне в журнал попадают только партиции, которые были бы удалены. Отсоединённые партиции,
+// оставшиеся от прерванного прогона, дочищаются.
+func (m *Manager) ApplyRetention(ctx context.Context, dryRun bool) ([]*domain.RetentionAuditEntry, error) {
+	if m.cfg.RetentionMonths <= 0 {
+		return nil, ErrRetentionDisabled
+	}
+
+	unlock, ok, err := m.store.TryLockRetention(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRetentionBusy
+	}
+	defer unlock()
+
+	cutoff := m.now().AddDate(0, -m.cfg.RetentionMonths, 0)
+
+	attached, err := m.store.ListProcessedPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := m.store.ListDetachedProcessedPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		entries []*domain.RetentionAuditEntry
+		errs    []error
+	)
+	for _, group := range []struct {
+		partitions []domain.Partition
+		attached   bool
+	}{{attached, true}, {detached, false}} {
+		sort.Slice(group.partitions, func(i, j int) bool { return group.partitions[i].From.Before(group.partitions[j].From) })
+		for _, p := range group.partitions {
+			if p.To.After(cutoff) {
+				continue
+			}
+			entry, err := m.retire(ctx, p, group.attached, dryRun)
+			entries = append(entries, entry)
+			errs = append(errs, err)
+		}
+	}
+
+	return entries, errors.Join(errs...)
+}
+
+// retire удаляет одну партицию и записывает результат в журнал
+func (m *Manager) retire(ctx context.Context, p domain.Partition, attached, dryRun bool) (*domain.RetentionAuditEntry, error) {
+	entry := &domain.RetentionAuditEntry{
+		Partition: p.Name,
+		RangeFrom: p.From,
+		RangeTo:   p.To,
+		DryRun:    dryRun,
+	}
+	if m.cfg.ExportDir != "" {
+		entry.ExportPath = filepath.Join(m.cfg.ExportDir, p.Name+".csv.gz")
+	}
+
+	err := func() error {
+		size, err := m.store.ProcessedPartitionSize(ctx, p.Name)
+		if err != nil {
+			return err
+		}
+		entry.Bytes = size
+
+		if dryRun {
+			return nil
+		}
+		// Отсоединённая партиция больше не принимает записи, поэтому выгрузка полная
+		if attached {
+			if err := m.store.DetachProcessedPartition(ctx, p.Name, m.cfg.DetachLockTimeout); err != nil {
+				return err
+			}
+		}
+		if entry.ExportPath != "" {
+			if err := m.export(ctx, p.Name, entry.ExportPath); err != nil {
+				return err
+			}
+		}
+		return m.store.DropProcessedPartition(ctx, p.Name)
+	}()
+
+	fields := []zap.Field{
+		zap.String("partition", p.Name),
+		zap.Time("range_to", p.To),
+		zap.Int64("bytes", entry.Bytes),
+		zap.Bool("dry_run", dryRun),
+	}
+	switch {
+	case err != nil:
+		entry.Status = domain.RetentionStatusFailed
+		entry.Error = err.Error()
+		m.logger.Error("[Partition] Failed to apply retention", append(fields, zap.Error(err))...)
+	case dryRun:
+		entry.Status = domain.RetentionStatusPlanned
+		m.logger.Info("[Partition] Partition would be dropped by retention", fields...)
+	default:
+		entry.Status = domain.RetentionStatusDropped
+		metrics.PartitionBytesReclaimed.Add(float64(entry.Bytes))
+		m.logger.Info("[Partition] Partition dropped by retention", append(fields, zap.String("export_path", entry.ExportPath))...)
+	}
+	metrics.PartitionRetention.WithLabelValues(entry.Status).Inc()
+
+	entry.CreatedAt = m.now()
+	if auditErr := m.store.SaveRetentionAudit(ctx, entry); auditErr != nil {
+		m.logger.Error("[Partition] Failed to write retention audit", zap.String("partition", p.Name), zap.Error(auditErr))
+		err = errors.Join(err, auditErr)
+	}
+
+	if err != nil {
+		return entry, fmt.Errorf("partition %s: %w", p.Name, err)
+	}
+	return entry, nil
+}
+
+// export пишет партицию во временный файл и переименовывает его только после полной записи,
+// чтобы прерванная выгрузка не оставила усечённый архив под итоговым именем
+func (m *Manager) export(ctx context.Context, name, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(tmp) // после переименования ничего не делает
+
+	writer := gzip.NewWriter(file)
+	err = m.store.ExportProcessedPartition(ctx, name, writer)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export partition: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to finalize export file: %w", err)
+	}
+	return nil
+}
+
+// ListRetentionAudit возвращает последние записи журнала срока хранения
+func (m *Manager) ListRetentionAudit(ctx context.Context, limit int) ([]*domain.RetentionAuditEntry, error) {
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	return m.store.ListRetentionAudit(ctx, limit)
+}
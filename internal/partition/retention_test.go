@@ -0,0 +1,174 @@
+package partition
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newRetentionManager(store *MockStore, cfg Config) *Manager {
+	logger, _ := zap.NewDevelopment()
+	cfg.RetentionMonths = 3
+	manager := NewManager(store, cfg, logger)
+	manager.now = func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }
+	return manager
+}
+
+func TestManager_ApplyRetention_DryRun(t *testing.T) {
+	store := new(MockStore)
+	manager := newRetentionManager(store, Config{ExportDir: "/exports"})
+
+	// Срок хранения 3 месяца: граница 2026-07-18, июнь удаляется целиком, июль ещё нет
+	store.On("TryLockRetention", mock.Anything).Return(true, nil)
+	store.On("Unlock").Return()
+	store.On("ListProcessedPartitions", mock.Anything).Return(monthly(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), 5), nil)
+	store.On("ListDetachedProcessedPartitions", mock.Anything).Return([]domain.Partition{}, nil)
+	store.On("ProcessedPartitionSize", mock.Anything, "processed_packets_06_2026").Return(int64(4096), nil)
+	store.On("SaveRetentionAudit", mock.Anything, mock.AnythingOfType("*domain.RetentionAuditEntry")).Return(nil)
+
+	reclaimed := testutil.ToFloat64(metrics.PartitionBytesReclaimed)
+	entries, err := manager.ApplyRetention(context.Background(), true)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	assert.Equal(t, "processed_packets_06_2026", entries[0].Partition)
+	assert.Equal(t, domain.RetentionStatusPlanned, entries[0].Status)
+	assert.True(t, entries[0].DryRun)
+	assert.Equal(t, int64(4096), entries[0].Bytes)
+	assert.Equal(t, filepath.Join("/exports", "processed_packets_06_2026.csv.gz"), entries[0].ExportPath)
+	assert.Equal(t, reclaimed, testutil.ToFloat64(metrics.PartitionBytesReclaimed))
+
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "DetachProcessedPartition", mock.Anything, mock.Anything, mock.Anything)
+	store.AssertNotCalled(t, "DropProcessedPartition", mock.Anything, mock.Anything)
+}
+
+func TestManager_ApplyRetention_ExportAndDrop(t *testing.T) {
+	store := new(MockStore)
+	dir := t.TempDir()
+	manager := newRetentionManager(store, Config{ExportDir: dir})
+
+	detached := monthly(time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC), 1)
+	store.On("TryLockRetention", mock.Anything).Return(true, nil)
+	store.On("Unlock").Return()
+	store.On("ListProcessedPartitions", mock.Anything).Return(monthly(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), 5), nil)
+	store.On("ListDetachedProcessedPartitions", mock.Anything).Return(detached, nil)
+	store.On("ProcessedPartitionSize", mock.Anything, "processed_packets_06_2026").Return(int64(8192), nil)
+	store.On("ProcessedPartitionSize", mock.Anything, "processed_packets_05_2026").Return(int64(1024), nil)
+	store.On("DetachProcessedPartition", mock.Anything, "processed_packets_06_2026", 5*time.Second).Return(nil)
+	store.On("ExportProcessedPartition", mock.Anything, mock.Anything, mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) {
+			_, _ = io.WriteString(args.Get(2).(io.Writer), "packet_id\n"+args.String(1)+"\n")
+		})
+	store.On("DropProcessedPartition", mock.Anything, "processed_packets_06_2026").Return(nil)
+	store.On("DropProcessedPartition", mock.Anything, "processed_packets_05_2026").Return(nil)
+	store.On("SaveRetentionAudit", mock.Anything, mock.AnythingOfType("*domain.RetentionAuditEntry")).Return(nil)
+
+	reclaimed := testutil.ToFloat64(metrics.PartitionBytesReclaimed)
+	entries, err := manager.ApplyRetention(context.Background(), false)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, domain.RetentionStatusDropped, entry.Status)
+	}
+	assert.Equal(t, reclaimed+8192+1024, testutil.ToFloat64(metrics.PartitionBytesReclaimed))
+	store.AssertExpectations(t)
+	// Уже отсоединённая партиция прерванного прогона не отсоединяется повторно
+	store.AssertNotCalled(t, "DetachProcessedPartition", mock.Anything, "processed_packets_05_2026", mock.Anything)
+
+	file, err := os.Open(filepath.Join(dir, "processed_packets_06_2026.csv.gz"))
+	require.NoError(t, err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "packet_id\nprocessed_packets_06_2026\n", string(content))
+}
+
+func TestManager_ApplyRetention_ExportFailureKeepsPartition(t *testing.T) {
+	store := new(MockStore)
+	dir := t.TempDir()
+	manager := newRetentionManager(store, Config{ExportDir: dir})
+
+	store.On("TryLockRetention", mock.Anything).Return(true, nil)
+	store.On("Unlock").Return()
+	store.On("ListProcessedPartitions", mock.Anything).Return(monthly(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), 1), nil)
+	store.On("ListDetachedProcessedPartitions", mock.Anything).Return([]domain.Partition{}, nil)
+	store.On("ProcessedPartitionSize", mock.Anything, "processed_packets_06_2026").Return(int64(8192), nil)
+	store.On("DetachProcessedPartition", mock.Anything, "processed_packets_06_2026", mock.Anything).Return(nil)
+	store.On("ExportProcessedPartition", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("connection reset"))
+	store.On("SaveRetentionAudit", mock.Anything, mock.MatchedBy(func(entry *domain.RetentionAuditEntry) bool {
+		return entry.Status == domain.RetentionStatusFailed && entry.Error != ""
+	})).Return(nil)
+
+	entries, err := manager.ApplyRetention(context.Background(), false)
+	assert.Error(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, domain.RetentionStatusFailed, entries[0].Status)
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "DropProcessedPartition", mock.Anything, mock.Anything)
+
+	// Незавершённая выгрузка не оставляет файлов
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestManager_ApplyRetention_Busy(t *testing.T) {
+	store := new(MockStore)
+	manager := newRetentionManager(store, Config{})
+
+	store.On("TryLockRetention", mock.Anything).Return(false, nil)
+
+	_, err := manager.ApplyRetention(context.Background(), false)
+	assert.ErrorIs(t, err, ErrRetentionBusy)
+	store.AssertNotCalled(t, "ListProcessedPartitions", mock.Anything)
+}
+
+func TestManager_ApplyRetention_Disabled(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	manager := NewManager(new(MockStore), Config{}, logger)
+
+	_, err := manager.ApplyRetention(context.Background(), true)
+	assert.ErrorIs(t, err, ErrRetentionDisabled)
+}
+
+func TestManager_ApplyRetention_DetachLockTimeoutKeepsPartition(t *testing.T) {
+	store := new(MockStore)
+	manager := newRetentionManager(store, Config{ExportDir: t.TempDir(), DetachLockTimeout: 2 * time.Second})
+
+	store.On("TryLockRetention", mock.Anything).Return(true, nil)
+	store.On("Unlock").Return()
+	store.On("ListProcessedPartitions", mock.Anything).Return(monthly(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), 1), nil)
+	store.On("ListDetachedProcessedPartitions", mock.Anything).Return([]domain.Partition{}, nil)
+	store.On("ProcessedPartitionSize", mock.Anything, "processed_packets_06_2026").Return(int64(8192), nil)
+	// Потоковая выгрузка держит processed_packets дольше таймаута
+	store.On("DetachProcessedPartition", mock.Anything, "processed_packets_06_2026", 2*time.Second).
+		Return(errors.New("failed to detach partition processed_packets_06_2026: processed_packets is locked by running queries longer than 2s"))
+	store.On("SaveRetentionAudit", mock.Anything, mock.MatchedBy(func(entry *domain.RetentionAuditEntry) bool {
+		return entry.Status == domain.RetentionStatusFailed
+	})).Return(nil)
+
+	entries, err := manager.ApplyRetention(context.Background(), false)
+	assert.Error(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, domain.RetentionStatusFailed, entries[0].Status)
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "ExportProcessedPartition", mock.Anything, mock.Anything, mock.Anything)
+	store.AssertNotCalled(t, "DropProcessedPartition", mock.Anything, mock.Anything)
+}
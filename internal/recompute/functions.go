@@ -0,0 +1,135 @@
+package recompute
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+)
+
+// Function функция агрегации пейлоада. Version увеличивается при изменении логики,
+// чтобы пересчитанные результаты хранились рядом со старыми.
+type Function struct {
+	Name    string
+	Version int
+	// Compute возвращает nil, если для пейлоада результат не определён (например, max пустого пейлоада)
+	Compute func(values []*big.Rat) *big.Rat
+}
+
+var functions = map[string]Function{
+	"max":   {Name: "max", Version: 1, Compute: maxOf},
+	"min":   {Name: "min", Version: 1, Compute: minOf},
+	"sum":   {Name: "sum", Version: 1, Compute: sumOf},
+	"count": {Name: "count", Version: 1, Compute: countOf},
+	"mean":  {Name: "mean", Version: 1, Compute: meanOf},
+}
+
+// Lookup возвращает функцию агрегации по имени
+func Lookup(name string) (Function, bool) {
+	fn, ok := functions[name]
+	return fn, ok
+}
+
+// Names возвращает имена зарегистрированных функций
+func Names() []string {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func maxOf(values []*big.Rat) *big.Rat {
+	var result *big.Rat
+	for _, value := range values {
+		if result == nil || value.Cmp(result) > 0 {
+			result = value
+		}
+	}
+	return result
+}
+
+func minOf(values []*big.Rat) *big.Rat {
+	var result *big.Rat
+	for _, value := range values {
+		if result == nil || value.Cmp(result) < 0 {
+			result = value
+		}
+	}
+	return result
+}
+
+func sumOf(values []*big.Rat) *big.Rat {
+	result := new(big.Rat)
+	for _, value := range values {
+		result.Add(result, value)
+	}
+	return result
+}
+
+func countOf(values []*big.Rat) *big.Rat {
+	return new(big.Rat).SetInt64(int64(len(values)))
+}
+
+func meanOf(values []*big.Rat) *big.Rat {
+	if len(values) == 0 {
+		return nil
+	}
+	return new(big.Rat).Quo(sumOf(values), countOf(values))
+}
+
+// payloadValues приводит пейлоад серии любого типа к точным рациональным числам
+func payloadValues(payload domain.SeriesPayload) ([]*big.Rat, error) {
+	switch payload.Kind() {
+	case domain.PayloadKindFloat:
+		values := make([]*big.Rat, len(payload.FloatPayload))
+		for i, value := range payload.FloatPayload {
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				return nil, fmt.Errorf("non-finite value at index %d", i)
+			}
+			values[i] = new(big.Rat).SetFloat64(value)
+		}
+		return values, nil
+	case domain.PayloadKindDecimal:
+		values := make([]*big.Rat, len(payload.DecimalPayload))
+		for i, text := range payload.DecimalPayload {
+			value, ok := new(big.Rat).SetString(text)
+			if !ok {
+				return nil, fmt.Errorf("invalid decimal %q at index %d", text, i)
+			}
+			values[i] = value
+		}
+		return values, nil
+	default:
+		values := make([]*big.Rat, len(payload.Payload))
+		for i, value := range payload.Payload {
+			values[i] = new(big.Rat).SetInt64(value)
+		}
+		return values, nil
+	}
+}
+
+// formatValue форматирует результат в десятичную запись для NUMERIC.
+// Непериодические дроби выводятся точно, периодические округляются до 18 знаков.
+func formatValue(value *big.Rat) string {
+	if value.IsInt() {
+		return value.RatString()
+	}
+	text := value.FloatString(18)
+	text = strings.TrimRight(text, "0")
+	return strings.TrimSuffix(text, ".")
+}
+
+// equalValues сравнивает десятичные записи численно
+func equalValues(a, b string) bool {
+	x, okX := new(big.Rat).SetString(a)
+	y, okY := new(big.Rat).SetString(b)
+	if !okX || !okY {
+		return a == b
+	}
+	return x.Cmp(y) == 0
+}
@@ -0,0 +1,429 @@
+package recompute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBatchSize = 500
+	maxReportedDiffs = 1000
+)
+
+// ErrInvalidRequest возвращается для некорректных параметров пересчёта
+var ErrInvalidRequest = errors.New("invalid recompute request")
+
+// Store источник сырых пейлоадов и хранилище версионированных результатов
+type Store interface {
+	CountRawPackets(ctx context.Context, start, end time.Time) (int64, error)
+	// ListRawPackets возвращает пакеты по возрастанию (archived_at, packet_id) строго после курсора
+	ListRawPackets(ctx context.Context, start, end time.Time, afterTime time.Time, afterID uuid.UUID, limit int) ([]*domain.RawPacket, error)
+	// GetCurrentResults возвращает текущие значения функции по сериям пакетов арендаторов: последнюю версию
+	// пересчитанного результата, а для max — значение из processed_packets, если пересчёта не было
+	GetCurrentResults(ctx context.Context, function string, packets []domain.TenantPacketKey) (map[domain.PacketSeriesKey]string, error)
+	SavePacketResults(ctx context.Context, results []*domain.PacketResult) error
+	SaveRecomputeJob(ctx context.Context, job *domain.RecomputeJob) error
+	ListRecomputeJobs(ctx context.Context) ([]*domain.RecomputeJob, error)
+}
+
+// errInterrupted записывается в задачи, которые выполнялись при остановке процесса
+const errInterrupted = "interrupted by service restart"
+
+// Manager запускает фоновые задачи пересчёта и хранит их прогресс
+type Manager struct {
+	store     Store
+	logger    *zap.Logger
+	batchSize int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	jobs    map[uuid.UUID]*domain.RecomputeJob
+	cancels map[uuid.UUID]context.CancelFunc
+}
+
+func NewManager(store Store, logger *zap.Logger) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Manager{
+		store:     store,
+		logger:    logger,
+		batchSize: defaultBatchSize,
+		ctx:       ctx,
+		cancel:    cancel,
+		jobs:      make(map[uuid.UUID]*domain.RecomputeJob),
+		cancels:   make(map[uuid.UUID]context.CancelFunc),
+	}
+}
+
+// Restore загружает сохранённые задачи. Задачи в статусе running были прерваны
+// остановкой процесса и помечаются как failed.
+func (m *Manager) Restore(ctx context.Context) error {
+	jobs, err := m.store.ListRecomputeJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load recompute jobs: %w", err)
+	}
+
+	var interrupted []*domain.RecomputeJob
+	m.mu.Lock()
+	for _, job := range jobs {
+		if job.Status == domain.RecomputeStatusRunning {
+			finished := time.Now().UTC()
+			job.Status = domain.RecomputeStatusFailed
+			job.Error = errInterrupted
+			job.FinishedAt = &finished
+			interrupted = append(interrupted, copyJob(job))
+		}
+		m.jobs[job.ID] = job
+	}
+	m.mu.Unlock()
+
+	for _, job := range interrupted {
+		if err := m.store.SaveRecomputeJob(ctx, job); err != nil {
+			return fmt.Errorf("failed to mark recompute job %s as failed: %w", job.ID, err)
+		}
+		metrics.RecomputeJobs.WithLabelValues(string(job.Status)).Inc()
+		m.logger.Warn("[Recompute] Job interrupted by restart marked as failed",
+			zap.String("job_id", job.ID.String()),
+			zap.Int64("processed", job.Processed),
+			zap.Int64("total", job.Total))
+	}
+
+	m.logger.Info("[Recompute] Jobs restored",
+		zap.Int("jobs", len(jobs)),
+		zap.Int("interrupted", len(interrupted)))
+
+	return nil
+}
+
+// StartJob проверяет запрос и запускает пересчёт в фоне
+func (m *Manager) StartJob(_ context.Context, req domain.RecomputeRequest) (*domain.RecomputeJob, error) {
+	fns, err := validateRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &domain.RecomputeJob{
+		ID:        uuid.New(),
+		Request:   req,
+		Status:    domain.RecomputeStatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+
+	jobCtx, cancel := context.WithCancel(m.ctx)
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.cancels[job.ID] = cancel
+	snapshot := copyJob(job)
+	m.mu.Unlock()
+
+	metrics.RecomputeJobsActive.Inc()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer metrics.RecomputeJobsActive.Dec()
+		defer cancel()
+		m.run(jobCtx, job.ID, fns)
+	}()
+
+	m.logger.Info("[Recompute] Job started",
+		zap.String("job_id", job.ID.String()),
+		zap.Time("start", req.Start),
+		zap.Time("end", req.End),
+		zap.Strings("functions", req.Functions),
+		zap.Bool("dry_run", req.DryRun))
+
+	return snapshot, nil
+}
+
+// GetJob возвращает снимок состояния задачи
+func (m *Manager) GetJob(id uuid.UUID) (*domain.RecomputeJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return copyJob(job), true
+}
+
+// ListJobs возвращает снимки всех задач, включая восстановленные при старте
+func (m *Manager) ListJobs() []*domain.RecomputeJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]*domain.RecomputeJob, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, copyJob(job))
+	}
+	return jobs
+}
+
+// CancelJob останавливает выполняющуюся задачу
+func (m *Manager) CancelJob(id uuid.UUID) bool {
+	m.mu.Lock()
+	cancel, ok := m.cancels[id]
+	m.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Stop отменяет все задачи и дожидается их завершения
+func (m *Manager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+func validateRequest(req domain.RecomputeRequest) ([]Function, error) {
+	if req.Start.IsZero() || req.End.IsZero() || !req.End.After(req.Start) {
+		return nil, fmt.Errorf("%w: end must be after start", ErrInvalidRequest)
+	}
+	if len(req.Functions) == 0 {
+		return nil, fmt.Errorf("%w: at least one function is required", ErrInvalidRequest)
+	}
+	if req.RatePerSecond < 0 {
+		return nil, fmt.Errorf("%w: rate_per_second must not be negative", ErrInvalidRequest)
+	}
+
+	fns := make([]Function, 0, len(req.Functions))
+	for _, name := range req.Functions {
+		fn, ok := Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown function %q, available: %v", ErrInvalidRequest, name, Names())
+		}
+		fns = append(fns, fn)
+	}
+	return fns, nil
+}
+
+func (m *Manager) run(ctx context.Context, id uuid.UUID, fns []Function) {
+	m.mu.Lock()
+	req := m.jobs[id].Request
+	m.mu.Unlock()
+
+	err := m.process(ctx, id, req, fns)
+
+	m.update(id, func(job *domain.RecomputeJob) {
+		finished := time.Now().UTC()
+		job.FinishedAt = &finished
+		switch {
+		case err == nil:
+			job.Status = domain.RecomputeStatusCompleted
+		case errors.Is(err, context.Canceled):
+			job.Status = domain.RecomputeStatusCancelled
+		default:
+			job.Status = domain.RecomputeStatusFailed
+			job.Error = err.Error()
+		}
+	})
+
+	m.mu.Lock()
+	delete(m.cancels, id)
+	job := copyJob(m.jobs[id])
+	m.mu.Unlock()
+
+	metrics.RecomputeJobs.WithLabelValues(string(job.Status)).Inc()
+	m.persist(job)
+
+	m.logger.Info("[Recompute] Job finished",
+		zap.String("job_id", id.String()),
+		zap.String("status", string(job.Status)),
+		zap.Int64("processed", job.Processed),
+		zap.Int64("changed", job.Changed),
+		zap.Error(err))
+}
+
+func (m *Manager) process(ctx context.Context, id uuid.UUID, req domain.RecomputeRequest, fns []Function) error {
+	total, err := m.store.CountRawPackets(ctx, req.Start, req.End)
+	if err != nil {
+		return err
+	}
+	m.update(id, func(job *domain.RecomputeJob) { job.Total = total })
+
+	var (
+		afterTime time.Time
+		afterID   uuid.UUID
+	)
+	for {
+		batchStart := time.Now()
+
+		packets, err := m.store.ListRawPackets(ctx, req.Start, req.End, afterTime, afterID, m.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(packets) == 0 {
+			return nil
+		}
+
+		if err := m.processBatch(ctx, id, req, fns, packets); err != nil {
+			return err
+		}
+
+		last := packets[len(packets)-1]
+		afterTime, afterID = last.ArchivedAt, last.PacketID
+
+		m.mu.Lock()
+		snapshot := copyJob(m.jobs[id])
+		m.mu.Unlock()
+		m.persist(snapshot)
+
+		if err := throttle(ctx, req.RatePerSecond, len(packets), time.Since(batchStart)); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Manager) processBatch(ctx context.Context, id uuid.UUID, req domain.RecomputeRequest, fns []Function, packets []*domain.RawPacket) error {
+	keys := make([]domain.TenantPacketKey, len(packets))
+	for i, packet := range packets {
+		keys[i] = domain.TenantPacketKey{TenantID: packet.DataPacket().Tenant(), PacketID: packet.PacketID}
+	}
+
+	now := time.Now().UTC()
+	var (
+		results []*domain.PacketResult
+		diffs   []domain.RecomputeDiff
+	)
+
+	for _, fn := range fns {
+		current, err := m.store.GetCurrentResults(ctx, fn.Name, keys)
+		if err != nil {
+			return err
+		}
+
+		for _, packet := range packets {
+			data := packet.DataPacket()
+			tenantID := data.Tenant()
+			// Каждая серия пересчитывается отдельно, как и при обработке пакета
+			for _, series := range data.SeriesNames() {
+				values, err := payloadValues(data.SeriesValues(series))
+				if err != nil {
+					m.logger.Warn("[Recompute] Skipping series with invalid payload",
+						zap.String("packet_id", packet.PacketID.String()),
+						zap.String("series", series),
+						zap.Error(err))
+					continue
+				}
+
+				value := fn.Compute(values)
+				if value == nil {
+					continue
+				}
+				newValue := formatValue(value)
+
+				key := domain.PacketSeriesKey{TenantID: tenantID, PacketID: packet.PacketID, Series: series}
+				if oldValue, ok := current[key]; !ok || !equalValues(oldValue, newValue) {
+					diffs = append(diffs, domain.RecomputeDiff{
+						TenantID: tenantID,
+						PacketID: packet.PacketID,
+						Series:   series,
+						Function: fn.Name,
+						OldValue: oldValue,
+						NewValue: newValue,
+					})
+				}
+
+				results = append(results, &domain.PacketResult{
+					TenantID:   tenantID,
+					PacketID:   packet.PacketID,
+					Series:     series,
+					Function:   fn.Name,
+					Version:    fn.Version,
+					Value:      newValue,
+					ComputedAt: now,
+					JobID:      id,
+				})
+			}
+		}
+	}
+
+	if !req.DryRun && len(results) > 0 {
+		if err := m.store.SavePacketResults(ctx, results); err != nil {
+			return err
+		}
+	}
+
+	metrics.RecomputePacketsProcessed.Add(float64(len(packets)))
+	m.update(id, func(job *domain.RecomputeJob) {
+		job.Processed += int64(len(packets))
+		job.Changed += int64(len(diffs))
+		if !req.DryRun {
+			job.Written += int64(len(results))
+		}
+		for _, diff := range diffs {
+			if len(job.Diffs) >= maxReportedDiffs {
+				break
+			}
+			job.Diffs = append(job.Diffs, diff)
+		}
+	})
+
+	return nil
+}
+
+// throttle выдерживает паузу, чтобы скорость не превышала ratePerSecond пакетов в секунду
+func throttle(ctx context.Context, ratePerSecond, processed int, elapsed time.Duration) error {
+	if ratePerSecond <= 0 {
+		return ctx.Err()
+	}
+
+	wait := time.Duration(float64(processed)/float64(ratePerSecond)*float64(time.Second)) - elapsed
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (m *Manager) update(id uuid.UUID, fn func(job *domain.RecomputeJob)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(m.jobs[id])
+}
+
+// persist сохраняет состояние задачи; ошибки не прерывают пересчёт
+func (m *Manager) persist(job *domain.RecomputeJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := m.store.SaveRecomputeJob(ctx, job); err != nil {
+		m.logger.Error("[Recompute] Failed to persist job state",
+			zap.String("job_id", job.ID.String()),
+			zap.Error(err))
+	}
+}
+
+func copyJob(job *domain.RecomputeJob) *domain.RecomputeJob {
+	copied := *job
+	copied.Request.Functions = append([]string(nil), job.Request.Functions...)
+	copied.Diffs = append([]domain.RecomputeDiff(nil), job.Diffs...)
+	if job.FinishedAt != nil {
+		finished := *job.FinishedAt
+		copied.FinishedAt = &finished
+	}
+	return &copied
+}
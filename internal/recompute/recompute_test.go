@@ -0,0 +1,335 @@
+package recompute
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) CountRawPackets(ctx context.Context, start, end time.Time) (int64, error) {
+	args := m.Called(ctx, start, end)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStore) ListRawPackets(ctx context.Context, start, end time.Time, afterTime time.Time, afterID uuid.UUID, limit int) ([]*domain.RawPacket, error) {
+	args := m.Called(ctx, start, end, afterTime, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RawPacket), args.Error(1)
+}
+
+func (m *MockStore) GetCurrentResults(ctx context.Context, function string, packets []domain.TenantPacketKey) (map[domain.PacketSeriesKey]string, error) {
+	args := m.Called(ctx, function, packets)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[domain.PacketSeriesKey]string), args.Error(1)
+}
+
+func (m *MockStore) SavePacketResults(ctx context.Context, results []*domain.PacketResult) error {
+	args := m.Called(ctx, results)
+	return args.Error(0)
+}
+
+func (m *MockStore) SaveRecomputeJob(ctx context.Context, job *domain.RecomputeJob) error {
+	args := m.Called(ctx, job)
+	return args.Error(0)
+}
+
+func (m *MockStore) ListRecomputeJobs(ctx context.Context) ([]*domain.RecomputeJob, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RecomputeJob), args.Error(1)
+}
+
+func waitFinished(t *testing.T, m *Manager, id uuid.UUID) *domain.RecomputeJob {
+	t.Helper()
+
+	var job *domain.RecomputeJob
+	require.Eventually(t, func() bool {
+		job, _ = m.GetJob(id)
+		return job.Status != domain.RecomputeStatusRunning
+	}, 2*time.Second, 5*time.Millisecond)
+	return job
+}
+
+func TestFunctions(t *testing.T) {
+	values, err := payloadValues(domain.SeriesPayload{DecimalPayload: []string{"1.5", "-2", "3.25"}})
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"max":   "3.25",
+		"min":   "-2",
+		"sum":   "2.75",
+		"count": "3",
+		"mean":  "0.916666666666666667",
+	}
+	for name, want := range tests {
+		fn, ok := Lookup(name)
+		require.True(t, ok, name)
+		assert.Equal(t, want, formatValue(fn.Compute(values)), name)
+	}
+
+	fn, _ := Lookup("max")
+	assert.Nil(t, fn.Compute([]*big.Rat{}))
+	assert.True(t, equalValues("10", "10.000"))
+}
+
+func TestManager_DryRunReportsDiffs(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	m := NewManager(store, logger)
+	defer m.Stop()
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	unchanged := &domain.RawPacket{PacketID: uuid.New(), ArchivedAt: start.Add(time.Minute), PayloadKind: domain.PayloadKindInt, Payload: []int64{1, 7, 3}}
+	changed := &domain.RawPacket{PacketID: uuid.New(), ArchivedAt: start.Add(2 * time.Minute), PayloadKind: domain.PayloadKindFloat, FloatPayload: []float64{1.5, 2.5}}
+
+	store.On("CountRawPackets", mock.Anything, start, end).Return(int64(2), nil)
+	store.On("ListRawPackets", mock.Anything, start, end, time.Time{}, uuid.Nil, defaultBatchSize).
+		Return([]*domain.RawPacket{unchanged, changed}, nil)
+	store.On("ListRawPackets", mock.Anything, start, end, changed.ArchivedAt, changed.PacketID, defaultBatchSize).
+		Return([]*domain.RawPacket{}, nil)
+	store.On("GetCurrentResults", mock.Anything, "max", []domain.TenantPacketKey{
+		{TenantID: domain.DefaultTenantID, PacketID: unchanged.PacketID},
+		{TenantID: domain.DefaultTenantID, PacketID: changed.PacketID},
+	}).Return(map[domain.PacketSeriesKey]string{
+		{TenantID: domain.DefaultTenantID, PacketID: unchanged.PacketID}: "7",
+		{TenantID: domain.DefaultTenantID, PacketID: changed.PacketID}:   "3",
+	}, nil)
+	store.On("SaveRecomputeJob", mock.Anything, mock.Anything).Return(nil)
+
+	job, err := m.StartJob(context.Background(), domain.RecomputeRequest{Start: start, End: end, Functions: []string{"max"}, DryRun: true})
+	require.NoError(t, err)
+
+	job = waitFinished(t, m, job.ID)
+	assert.Equal(t, domain.RecomputeStatusCompleted, job.Status)
+	assert.Equal(t, int64(2), job.Total)
+	assert.Equal(t, int64(2), job.Processed)
+	assert.Equal(t, int64(1), job.Changed)
+	assert.Equal(t, int64(0), job.Written)
+	require.Len(t, job.Diffs, 1)
+	assert.Equal(t, domain.RecomputeDiff{TenantID: domain.DefaultTenantID, PacketID: changed.PacketID, Function: "max", OldValue: "3", NewValue: "2.5"}, job.Diffs[0])
+
+	store.AssertNotCalled(t, "SavePacketResults", mock.Anything, mock.Anything)
+}
+
+func TestManager_WritesVersionedResults(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	m := NewManager(store, logger)
+	defer m.Stop()
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	packet := &domain.RawPacket{PacketID: uuid.New(), ArchivedAt: start, PayloadKind: domain.PayloadKindInt, Payload: []int64{2, 4}}
+
+	store.On("CountRawPackets", mock.Anything, start, end).Return(int64(1), nil)
+	store.On("ListRawPackets", mock.Anything, start, end, time.Time{}, uuid.Nil, defaultBatchSize).
+		Return([]*domain.RawPacket{packet}, nil)
+	store.On("ListRawPackets", mock.Anything, start, end, packet.ArchivedAt, packet.PacketID, defaultBatchSize).
+		Return([]*domain.RawPacket{}, nil)
+	store.On("GetCurrentResults", mock.Anything, "mean", []domain.TenantPacketKey{{TenantID: domain.DefaultTenantID, PacketID: packet.PacketID}}).
+		Return(map[domain.PacketSeriesKey]string{}, nil)
+	store.On("SaveRecomputeJob", mock.Anything, mock.Anything).Return(nil)
+
+	var saved []*domain.PacketResult
+	store.On("SavePacketResults", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		saved = args.Get(1).([]*domain.PacketResult)
+	})
+
+	job, err := m.StartJob(context.Background(), domain.RecomputeRequest{Start: start, End: end, Functions: []string{"mean"}})
+	require.NoError(t, err)
+
+	job = waitFinished(t, m, job.ID)
+	assert.Equal(t, domain.RecomputeStatusCompleted, job.Status)
+	assert.Equal(t, int64(1), job.Written)
+	require.Len(t, saved, 1)
+	assert.Equal(t, "mean", saved[0].Function)
+	assert.Equal(t, 1, saved[0].Version)
+	assert.Equal(t, "3", saved[0].Value)
+	assert.Equal(t, job.ID, saved[0].JobID)
+}
+
+func TestManager_RecomputesEachSeries(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	m := NewManager(store, logger)
+	defer m.Stop()
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	packet := &domain.RawPacket{PacketID: uuid.New(), ArchivedAt: start, Series: map[string]domain.SeriesPayload{
+		"pressure":    {Payload: []int64{5, 9}},
+		"temperature": {FloatPayload: []float64{20.5, 21.5}},
+	}}
+
+	store.On("CountRawPackets", mock.Anything, start, end).Return(int64(1), nil)
+	store.On("ListRawPackets", mock.Anything, start, end, time.Time{}, uuid.Nil, defaultBatchSize).
+		Return([]*domain.RawPacket{packet}, nil)
+	store.On("ListRawPackets", mock.Anything, start, end, packet.ArchivedAt, packet.PacketID, defaultBatchSize).
+		Return([]*domain.RawPacket{}, nil)
+	store.On("GetCurrentResults", mock.Anything, "max", []domain.TenantPacketKey{{TenantID: domain.DefaultTenantID, PacketID: packet.PacketID}}).
+		Return(map[domain.PacketSeriesKey]string{
+			{TenantID: domain.DefaultTenantID, PacketID: packet.PacketID, Series: "pressure"}:    "9",
+			{TenantID: domain.DefaultTenantID, PacketID: packet.PacketID, Series: "temperature"}: "21",
+		}, nil)
+	store.On("SaveRecomputeJob", mock.Anything, mock.Anything).Return(nil)
+
+	var saved []*domain.PacketResult
+	store.On("SavePacketResults", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		saved = args.Get(1).([]*domain.PacketResult)
+	})
+
+	job, err := m.StartJob(context.Background(), domain.RecomputeRequest{Start: start, End: end, Functions: []string{"max"}})
+	require.NoError(t, err)
+
+	job = waitFinished(t, m, job.ID)
+	assert.Equal(t, domain.RecomputeStatusCompleted, job.Status)
+	require.Len(t, saved, 2)
+	assert.Equal(t, "pressure", saved[0].Series)
+	assert.Equal(t, "9", saved[0].Value)
+	assert.Equal(t, "temperature", saved[1].Series)
+	assert.Equal(t, "21.5", saved[1].Value)
+
+	require.Len(t, job.Diffs, 1)
+	assert.Equal(t, domain.RecomputeDiff{TenantID: domain.DefaultTenantID, PacketID: packet.PacketID, Series: "temperature", Function: "max", OldValue: "21", NewValue: "21.5"}, job.Diffs[0])
+}
+
+func TestManager_ScopesResultsByTenant(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	m := NewManager(store, logger)
+	defer m.Stop()
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	// Арендаторы выбрали одинаковый packet_id
+	packetID := uuid.New()
+	acme := &domain.RawPacket{TenantID: "acme", PacketID: packetID, ArchivedAt: start, PayloadKind: domain.PayloadKindInt, Payload: []int64{5}}
+	globex := &domain.RawPacket{TenantID: "globex", PacketID: packetID, ArchivedAt: start, PayloadKind: domain.PayloadKindInt, Payload: []int64{8}}
+
+	store.On("CountRawPackets", mock.Anything, start, end).Return(int64(2), nil)
+	store.On("ListRawPackets", mock.Anything, start, end, time.Time{}, uuid.Nil, defaultBatchSize).
+		Return([]*domain.RawPacket{acme, globex}, nil)
+	store.On("ListRawPackets", mock.Anything, start, end, start, packetID, defaultBatchSize).
+		Return([]*domain.RawPacket{}, nil)
+	store.On("GetCurrentResults", mock.Anything, "max", []domain.TenantPacketKey{
+		{TenantID: "acme", PacketID: packetID},
+		{TenantID: "globex", PacketID: packetID},
+	}).Return(map[domain.PacketSeriesKey]string{
+		{TenantID: "acme", PacketID: packetID}:   "5",
+		{TenantID: "globex", PacketID: packetID}: "8",
+	}, nil)
+	store.On("SaveRecomputeJob", mock.Anything, mock.Anything).Return(nil)
+
+	var saved []*domain.PacketResult
+	store.On("SavePacketResults", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		saved = args.Get(1).([]*domain.PacketResult)
+	})
+
+	job, err := m.StartJob(context.Background(), domain.RecomputeRequest{Start: start, End: end, Functions: []string{"max"}})
+	require.NoError(t, err)
+
+	job = waitFinished(t, m, job.ID)
+	assert.Equal(t, domain.RecomputeStatusCompleted, job.Status)
+	assert.Equal(t, int64(0), job.Changed, "results of one tenant are not compared with another")
+	require.Len(t, saved, 2)
+	assert.Equal(t, "acme", saved[0].TenantID)
+	assert.Equal(t, "5", saved[0].Value)
+	assert.Equal(t, "globex", saved[1].TenantID)
+	assert.Equal(t, "8", saved[1].Value)
+}
+
+func TestManager_RestoreMarksInterruptedJobsFailed(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	m := NewManager(store, logger)
+	defer m.Stop()
+
+	finished := time.Date(2025, 9, 1, 1, 0, 0, 0, time.UTC)
+	completed := &domain.RecomputeJob{ID: uuid.New(), Status: domain.RecomputeStatusCompleted, FinishedAt: &finished}
+	running := &domain.RecomputeJob{ID: uuid.New(), Status: domain.RecomputeStatusRunning, Processed: 10, Total: 100}
+
+	store.On("ListRecomputeJobs", mock.Anything).Return([]*domain.RecomputeJob{completed, running}, nil)
+	store.On("SaveRecomputeJob", mock.Anything, mock.MatchedBy(func(job *domain.RecomputeJob) bool {
+		return job.ID == running.ID && job.Status == domain.RecomputeStatusFailed && job.FinishedAt != nil
+	})).Return(nil).Once()
+
+	require.NoError(t, m.Restore(context.Background()))
+
+	job, ok := m.GetJob(running.ID)
+	require.True(t, ok)
+	assert.Equal(t, domain.RecomputeStatusFailed, job.Status)
+	assert.Equal(t, errInterrupted, job.Error)
+	assert.Equal(t, int64(10), job.Processed)
+
+	job, ok = m.GetJob(completed.ID)
+	require.True(t, ok)
+	assert.Equal(t, domain.RecomputeStatusCompleted, job.Status)
+
+	assert.Len(t, m.ListJobs(), 2)
+	assert.False(t, m.CancelJob(running.ID))
+	store.AssertExpectations(t)
+}
+
+func TestManager_Cancel(t *testing.T) {
+	store := new(MockStore)
+	logger, _ := zap.NewDevelopment()
+	m := NewManager(store, logger)
+	m.batchSize = 1
+	defer m.Stop()
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	packet := &domain.RawPacket{PacketID: uuid.New(), ArchivedAt: start, Payload: []int64{1}}
+
+	store.On("CountRawPackets", mock.Anything, start, end).Return(int64(100), nil)
+	store.On("ListRawPackets", mock.Anything, start, end, mock.Anything, mock.Anything, 1).
+		Return([]*domain.RawPacket{packet}, nil)
+	store.On("GetCurrentResults", mock.Anything, "max", mock.Anything).Return(map[domain.PacketSeriesKey]string{}, nil)
+	store.On("SavePacketResults", mock.Anything, mock.Anything).Return(nil)
+	store.On("SaveRecomputeJob", mock.Anything, mock.Anything).Return(nil)
+
+	// Один пакет в секунду — задача гарантированно ждёт в throttle
+	job, err := m.StartJob(context.Background(), domain.RecomputeRequest{Start: start, End: end, Functions: []string{"max"}, RatePerSecond: 1})
+	require.NoError(t, err)
+
+	assert.True(t, m.CancelJob(job.ID))
+	job = waitFinished(t, m, job.ID)
+	assert.Equal(t, domain.RecomputeStatusCancelled, job.Status)
+	assert.False(t, m.CancelJob(job.ID))
+}
+
+func TestManager_InvalidRequest(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	m := NewManager(new(MockStore), logger)
+	defer m.Stop()
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := m.StartJob(context.Background(), domain.RecomputeRequest{Start: start, End: start, Functions: []string{"max"}})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+
+	_, err = m.StartJob(context.Background(), domain.RecomputeRequest{Start: start, End: start.Add(time.Hour), Functions: []string{"p99"}})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+
+	assert.Empty(t, m.ListJobs())
+}
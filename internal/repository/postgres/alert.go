@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+func (r *PostgresRepository) ListAlertRules(ctx context.Context) ([]*domain.AlertRule, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_alert_rules").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT id, tenant_id, name, source_id, series, condition, threshold, for_packets, window_seconds, webhooks, disabled, created_at, updated_at
+FROM alert_rules ORDER BY created_at`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []*domain.AlertRule
+	for rows.Next() {
+		var (
+			rule      domain.AlertRule
+			condition string
+		)
+		if err := rows.Scan(&rule.ID, &rule.TenantID, &rule.Name, &rule.SourceID, &rule.Series, &condition, &rule.Threshold, &rule.ForPackets, &rule.WindowSeconds,
+			&rule.Webhooks, &rule.Disabled, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan alert rule: %w", err)
+		}
+		rule.Condition = domain.AlertCondition(condition)
+		rules = append(rules, &rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+func (r *PostgresRepository) SaveAlertRule(ctx context.Context, rule *domain.AlertRule) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_alert_rule").Observe(time.Since(start).Seconds())
+	}()
+
+	// Правило другого арендатора с тем же id не перезаписывается
+	query := `INSERT INTO alert_rules (id, name, condition, threshold, for_packets, window_seconds, webhooks, disabled, created_at, updated_at, tenant_id, source_id, series)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+ON CONFLICT (id) DO UPDATE SET
+    name = EXCLUDED.name,
+    source_id = EXCLUDED.source_id,
+    series = EXCLUDED.series,
+    condition = EXCLUDED.condition,
+    threshold = EXCLUDED.threshold,
+    for_packets = EXCLUDED.for_packets,
+    window_seconds = EXCLUDED.window_seconds,
+    webhooks = EXCLUDED.webhooks,
+    disabled = EXCLUDED.disabled,
+    updated_at = EXCLUDED.updated_at
+WHERE alert_rules.tenant_id = EXCLUDED.tenant_id`
+
+	webhooks := rule.Webhooks
+	if webhooks == nil {
+		webhooks = []string{}
+	}
+	series := rule.Series
+	if series == nil {
+		series = []string{}
+	}
+
+	_, err := r.pool.Exec(ctx, query, rule.ID, rule.Name, string(rule.Condition), rule.Threshold, rule.ForPackets,
+		rule.WindowSeconds, webhooks, rule.Disabled, rule.CreatedAt, rule.UpdatedAt, rule.TenantID, rule.SourceID, series)
+	if err != nil {
+		return fmt.Errorf("failed to save alert rule: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) DeleteAlertRule(ctx context.Context, tenantID string, id uuid.UUID) (bool, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("delete_alert_rule").Observe(time.Since(start).Seconds())
+	}()
+
+	tag, err := r.pool.Exec(ctx, "DELETE FROM alert_rules WHERE tenant_id = $1 AND id = $2", tenantID, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete alert rule: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *PostgresRepository) SaveAlertEvent(ctx context.Context, event *domain.AlertEvent) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_alert_event").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `INSERT INTO alert_events (id, incident_id, rule_id, rule_name, status, condition, threshold, value, packet_id, created_at, tenant_id, source_id, series)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+ON CONFLICT (id) DO NOTHING`
+
+	_, err := r.pool.Exec(ctx, query, event.ID, event.IncidentID, event.RuleID, event.RuleName, string(event.Status),
+		string(event.Condition), event.Threshold, event.Value, event.PacketID, event.CreatedAt, event.TenantID, event.SourceID, event.Series)
+	if err != nil {
+		return fmt.Errorf("failed to save alert event: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) GetLastAlertEvents(ctx context.Context) ([]*domain.AlertEvent, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("get_last_alert_events").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT DISTINCT ON (rule_id, source_id, series) id, incident_id, rule_id, rule_name, source_id, series, status, condition, threshold, value, packet_id, created_at
+FROM alert_events
+ORDER BY rule_id, source_id, series, created_at DESC`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*domain.AlertEvent
+	for rows.Next() {
+		var (
+			event             domain.AlertEvent
+			status, condition string
+		)
+		if err := rows.Scan(&event.ID, &event.IncidentID, &event.RuleID, &event.RuleName, &event.SourceID, &event.Series, &status, &condition,
+			&event.Threshold, &event.Value, &event.PacketID, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan alert event: %w", err)
+		}
+		event.Status = domain.AlertStatus(status)
+		event.Condition = domain.AlertCondition(condition)
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating alert events: %w", err)
+	}
+
+	return events, nil
+}
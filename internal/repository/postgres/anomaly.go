@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *PostgresRepository) ListAnomalyParams(ctx context.Context) ([]*domain.AnomalyParams, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_anomaly_params").Observe(time.Since(start).Seconds())
+	}()
+
+	rows, err := r.pool.Query(ctx, "SELECT tenant_id, source_id, method, alpha, threshold, warm_up, window_size, notify FROM anomaly_params")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query anomaly params: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*domain.AnomalyParams
+	for rows.Next() {
+		var (
+			params domain.AnomalyParams
+			method string
+		)
+		if err := rows.Scan(&params.TenantID, &params.SourceID, &method, &params.Alpha, &params.Threshold, &params.WarmUp, &params.WindowSize, &params.Notify); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly params: %w", err)
+		}
+		params.Method = domain.AnomalyMethod(method)
+		list = append(list, &params)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating anomaly params: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *PostgresRepository) SaveAnomalyParams(ctx context.Context, params *domain.AnomalyParams) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_anomaly_params").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `INSERT INTO anomaly_params (source_id, method, alpha, threshold, warm_up, window_size, notify, tenant_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (tenant_id, source_id) DO UPDATE SET
+    method = EXCLUDED.method,
+    alpha = EXCLUDED.alpha,
+    threshold = EXCLUDED.threshold,
+    warm_up = EXCLUDED.warm_up,
+    window_size = EXCLUDED.window_size,
+    notify = EXCLUDED.notify`
+
+	_, err := r.pool.Exec(ctx, query, params.SourceID, string(params.Method), params.Alpha, params.Threshold,
+		params.WarmUp, params.WindowSize, params.Notify, params.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to save anomaly params: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) DeleteAnomalyParams(ctx context.Context, tenantID, sourceID string) (bool, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("delete_anomaly_params").Observe(time.Since(start).Seconds())
+	}()
+
+	tag, err := r.pool.Exec(ctx, "DELETE FROM anomaly_params WHERE tenant_id = $1 AND source_id = $2", tenantID, sourceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete anomaly params: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *PostgresRepository) LoadAnomalyStates(ctx context.Context) (map[string][]byte, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("load_anomaly_states").Observe(time.Since(start).Seconds())
+	}()
+
+	rows, err := r.pool.Query(ctx, "SELECT source_id, state FROM anomaly_states")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query anomaly states: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[string][]byte)
+	for rows.Next() {
+		var (
+			source string
+			state  []byte
+		)
+		if err := rows.Scan(&source, &state); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly state: %w", err)
+		}
+		states[source] = state
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating anomaly states: %w", err)
+	}
+
+	return states, nil
+}
+
+func (r *PostgresRepository) SaveAnomalyStates(ctx context.Context, states map[string][]byte) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_anomaly_states").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `INSERT INTO anomaly_states (source_id, state, updated_at) VALUES ($1, $2, $3)
+ON CONFLICT (source_id) DO UPDATE SET state = EXCLUDED.state, updated_at = EXCLUDED.updated_at`
+
+	now := time.Now().UTC()
+	batch := &pgx.Batch{}
+	for source, state := range states {
+		batch.Queue(query, source, state, now)
+	}
+
+	if err := r.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to save anomaly states: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+)
+
+func (r *PostgresRepository) ListDerivedMetrics(ctx context.Context) ([]*domain.DerivedMetric, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_derived_metrics").Observe(time.Since(start).Seconds())
+	}()
+
+	rows, err := r.pool.Query(ctx, "SELECT tenant_id, source_id, name, expression, updated_at FROM derived_metrics")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query derived metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*domain.DerivedMetric
+	for rows.Next() {
+		var metric domain.DerivedMetric
+		if err := rows.Scan(&metric.TenantID, &metric.SourceID, &metric.Name, &metric.Expression, &metric.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan derived metric: %w", err)
+		}
+		list = append(list, &metric)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating derived metrics: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *PostgresRepository) SaveDerivedMetric(ctx context.Context, metric *domain.DerivedMetric) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_derived_metric").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `INSERT INTO derived_metrics (tenant_id, source_id, name, expression, updated_at) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (tenant_id, source_id, name) DO UPDATE SET expression = EXCLUDED.expression, updated_at = EXCLUDED.updated_at`
+
+	if _, err := r.pool.Exec(ctx, query, metric.TenantID, metric.SourceID, metric.Name, metric.Expression, metric.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save derived metric: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) DeleteDerivedMetric(ctx context.Context, tenantID, sourceID, name string) (bool, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("delete_derived_metric").Observe(time.Since(start).Seconds())
+	}()
+
+	tag, err := r.pool.Exec(ctx, "DELETE FROM derived_metrics WHERE tenant_id = $1 AND source_id = $2 AND name = $3", tenantID, sourceID, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete derived metric: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,395 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+const (
+	processedPartitionPrefix = "processed_packets_"
+	processedPartitionLayout = "01_2006" // processed_packets_MM_YYYY, как в исходных миграциях
+	// processedDefaultPartition принимает строки, для времени обработки которых нет месячной партиции
+	processedDefaultPartition = "processed_packets_default"
+	// processedPartitionLock ключ advisory-блокировки, под которой экземпляры сервиса создают партиции по очереди
+	processedPartitionLock = "processed_packets_partitions"
+	// processedRetentionLock ключ advisory-блокировки, которую держит экземпляр, удаляющий партиции
+	processedRetentionLock = "processed_packets_retention"
+	// lockNotAvailable SQLSTATE ошибки по lock_timeout
+	lockNotAvailable = "55P03"
+)
+
+// EnsureProcessedPartitions создаёт месячные партиции processed_packets с индексом по
+// packet_created_at для месяцев из [from, to]. DDL выполняется в одной транзакции под
+// advisory-блокировкой, поэтому одновременный запуск на нескольких экземплярах безопасен.
+// Postgres не создаёт партицию, пока строки её диапазона лежат в партиции по умолчанию,
+// поэтому они переносятся во временную таблицу и после создания партиции вставляются обратно.
+// Таблица с именем партиции, отсоединённая от processed_packets (например, ожидающая выгрузки
+// при удалении по сроку хранения), не присоединяется обратно: остальные партиции создаются,
+// а для неё возвращается ошибка, так как строки её месяца продолжают попадать в партицию по умолчанию.
+func (r *PostgresRepository) EnsureProcessedPartitions(ctx context.Context, from, to time.Time) ([]string, int64, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("ensure_processed_partitions").Observe(time.Since(start).Seconds())
+	}()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // после Commit ничего не делает
+	}()
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", processedPartitionLock); err != nil {
+		return nil, 0, fmt.Errorf("failed to acquire partition lock: %w", err)
+	}
+
+	from = from.UTC()
+	var (
+		created  []string
+		moved    int64
+		detached []error
+	)
+	for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(to); month = month.AddDate(0, 1, 0) {
+		name := processedPartitionPrefix + month.Format(processedPartitionLayout)
+
+		var exists, attached bool
+		query := `SELECT to_regclass($1) IS NOT NULL, EXISTS (
+    SELECT 1 FROM pg_inherits WHERE inhrelid = to_regclass($1) AND inhparent = 'processed_packets'::regclass
+)`
+		if err := tx.QueryRow(ctx, query, name).Scan(&exists, &attached); err != nil {
+			return nil, 0, fmt.Errorf("failed to check partition %s: %w", name, err)
+		}
+
+		if exists && !attached {
+			detached = append(detached, fmt.Errorf("table %s exists but is not attached to processed_packets: re-attach or drop it", name))
+			continue
+		}
+
+		if !exists {
+			rows, err := createProcessedPartition(ctx, tx, name, month, month.AddDate(0, 1, 0))
+			if err != nil {
+				return nil, 0, err
+			}
+			created = append(created, name)
+			moved += rows
+		}
+
+		// Индекс создаётся и для существующих партиций, если его удалили вручную
+		index := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_packet_created_at ON %s (packet_created_at)", name, name)
+		if _, err := tx.Exec(ctx, index); err != nil {
+			return nil, 0, fmt.Errorf("failed to create index on partition %s: %w", name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, 0, fmt.Errorf("failed to commit partitions: %w", err)
+	}
+
+	return created, moved, errors.Join(detached...)
+}
+
+// createProcessedPartition создаёт партицию [from, to) и переносит в неё строки этого диапазона
+// из партиции по умолчанию. Возвращает число перенесённых строк.
+func createProcessedPartition(ctx context.Context, tx pgx.Tx, name string, from, to time.Time) (int64, error) {
+	relocated := pgx.Identifier{"relocated_" + name}.Sanitize()
+
+	if _, err := tx.Exec(ctx, "CREATE TEMP TABLE "+relocated+" (LIKE processed_packets) ON COMMIT DROP"); err != nil {
+		return 0, fmt.Errorf("failed to prepare rows of partition %s: %w", name, err)
+	}
+	tag, err := tx.Exec(ctx, "WITH moved AS (DELETE FROM "+processedDefaultPartition+" WHERE created_at >= $1 AND created_at < $2 RETURNING *) INSERT INTO "+relocated+" SELECT * FROM moved", from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to move rows of partition %s from default partition: %w", name, err)
+	}
+
+	query := fmt.Sprintf("CREATE TABLE %s PARTITION OF processed_packets FOR VALUES FROM ('%s') TO ('%s')",
+		name, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return 0, fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+
+	if tag.RowsAffected() > 0 {
+		if _, err := tx.Exec(ctx, "INSERT INTO processed_packets SELECT * FROM "+relocated); err != nil {
+			return 0, fmt.Errorf("failed to restore rows of partition %s: %w", name, err)
+		}
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListProcessedPartitions возвращает месячные партиции processed_packets с их диапазонами
+func (r *PostgresRepository) ListProcessedPartitions(ctx context.Context) ([]domain.Partition, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_processed_partitions").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT c.relname FROM pg_inherits i
+JOIN pg_class c ON c.oid = i.inhrelid
+JOIN pg_class p ON p.oid = i.inhparent
+WHERE p.relname = 'processed_packets'`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processed partitions: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processed partitions: %w", err)
+	}
+
+	return r.processedPartitions(names), nil
+}
+
+// ListDetachedProcessedPartitions возвращает таблицы с именами месячных партиций processed_packets,
+// которые уже отсоединены от родительской таблицы
+func (r *PostgresRepository) ListDetachedProcessedPartitions(ctx context.Context) ([]domain.Partition, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_detached_processed_partitions").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT relname FROM pg_class
+WHERE relkind = 'r' AND NOT relispartition AND pg_table_is_visible(oid)
+AND relname ~ '^processed_packets_[0-9]{2}_[0-9]{4}$'`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list detached partitions: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list detached partitions: %w", err)
+	}
+
+	return r.processedPartitions(names), nil
+}
+
+// processedPartitions восстанавливает диапазоны партиций по именам processed_packets_MM_YYYY
+func (r *PostgresRepository) processedPartitions(names []string) []domain.Partition {
+	partitions := make([]domain.Partition, 0, len(names))
+	for _, name := range names {
+		if name == processedDefaultPartition {
+			continue
+		}
+		month, err := time.Parse(processedPartitionLayout, strings.TrimPrefix(name, processedPartitionPrefix))
+		if err != nil {
+			r.logger.Warn("skipping processed partition with unexpected name", zap.String("partition", name))
+			continue
+		}
+		partitions = append(partitions, domain.Partition{Name: name, From: month, To: month.AddDate(0, 1, 0)})
+	}
+	return partitions
+}
+
+// DefaultPartitionMonths возвращает начала месяцев (UTC), строки которых лежат в партиции по умолчанию
+func (r *PostgresRepository) DefaultPartitionMonths(ctx context.Context) ([]time.Time, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("default_partition_months").Observe(time.Since(start).Seconds())
+	}()
+
+	query := "SELECT DISTINCT date_trunc('month', created_at AT TIME ZONE 'UTC') FROM " + processedDefaultPartition + " ORDER BY 1"
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query default partition months: %w", err)
+	}
+	months, err := pgx.CollectRows(rows, pgx.RowTo[time.Time])
+	if err != nil {
+		return nil, fmt.Errorf("failed to query default partition months: %w", err)
+	}
+
+	// timestamp без зоны читается как UTC
+	for i, month := range months {
+		months[i] = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return months, nil
+}
+
+func (r *PostgresRepository) CountDefaultPartitionRows(ctx context.Context) (int64, error) {
+	var count int64
+	if err := r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM "+processedDefaultPartition).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count default partition rows: %w", err)
+	}
+	return count, nil
+}
+
+// TryLockRetention захватывает сессионную advisory-блокировку на отдельном соединении пула.
+// Соединение возвращается в пул при снятии блокировки.
+func (r *PostgresRepository) TryLockRetention(ctx context.Context) (func(), bool, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", processedRetentionLock).Scan(&locked); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to acquire retention lock: %w", err)
+	}
+	if !locked {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", processedRetentionLock); err != nil {
+			// Закрытое соединение не вернётся в пул, и блокировка снимется вместе с сессией
+			r.logger.Warn("failed to release retention lock", zap.Error(err))
+			_ = conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+	}
+	return unlock, true, nil
+}
+
+// ProcessedPartitionSize возвращает размер партиции вместе с индексами и TOAST
+func (r *PostgresRepository) ProcessedPartitionSize(ctx context.Context, name string) (int64, error) {
+	var size int64
+	if err := r.pool.QueryRow(ctx, "SELECT COALESCE(pg_total_relation_size(to_regclass($1)), 0)", name).Scan(&size); err != nil {
+		return 0, fmt.Errorf("failed to get size of partition %s: %w", name, err)
+	}
+	return size, nil
+}
+
+// DetachProcessedPartition отсоединяет партицию под той же блокировкой, что и создание партиций.
+// DETACH CONCURRENTLY недоступен, пока у processed_packets есть партиция по умолчанию, а обычный
+// DETACH ждёт завершения открытых на таблице транзакций (например, курсора потоковой выгрузки) и
+// всё это время блокирует вставки. Поэтому ожидание ограничено lock_timeout: при таймауте партиция
+// остаётся присоединённой и отсоединяется при следующем проходе.
+func (r *PostgresRepository) DetachProcessedPartition(ctx context.Context, name string, lockTimeout time.Duration) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("detach_processed_partition").Observe(time.Since(start).Seconds())
+	}()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // после Commit ничего не делает
+	}()
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", processedPartitionLock); err != nil {
+		return fmt.Errorf("failed to acquire partition lock: %w", err)
+	}
+	// lock_timeout выставляется после advisory-блокировки, чтобы ограничить только ожидание DETACH
+	if _, err := tx.Exec(ctx, "SELECT set_config('lock_timeout', $1, true)", fmt.Sprintf("%dms", lockTimeout.Milliseconds())); err != nil {
+		return fmt.Errorf("failed to set lock timeout: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "ALTER TABLE processed_packets DETACH PARTITION "+pgx.Identifier{name}.Sanitize()); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == lockNotAvailable {
+			return fmt.Errorf("failed to detach partition %s: processed_packets is locked by running queries longer than %s: %w", name, lockTimeout, err)
+		}
+		return fmt.Errorf("failed to detach partition %s: %w", name, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit partition detach: %w", err)
+	}
+	return nil
+}
+
+// ExportProcessedPartition выгружает партицию через COPY в CSV с заголовком
+func (r *PostgresRepository) ExportProcessedPartition(ctx context.Context, name string, w io.Writer) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("export_processed_partition").Observe(time.Since(start).Seconds())
+	}()
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	query := fmt.Sprintf("COPY %s TO STDOUT WITH (FORMAT csv, HEADER)", pgx.Identifier{name}.Sanitize())
+	if _, err := conn.Conn().PgConn().CopyTo(ctx, w, query); err != nil {
+		return fmt.Errorf("failed to copy partition %s: %w", name, err)
+	}
+	return nil
+}
+
+// DropProcessedPartition удаляет отсоединённую партицию. Подключённая партиция не удаляется,
+// чтобы ошибка в списке партиций не стёрла данные, которые ещё видны в processed_packets.
+func (r *PostgresRepository) DropProcessedPartition(ctx context.Context, name string) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("drop_processed_partition").Observe(time.Since(start).Seconds())
+	}()
+
+	var attached bool
+	err := r.pool.QueryRow(ctx, "SELECT relispartition FROM pg_class WHERE oid = to_regclass($1)", name).Scan(&attached)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check partition %s: %w", name, err)
+	}
+	if attached {
+		return fmt.Errorf("partition %s is still attached", name)
+	}
+
+	if _, err := r.pool.Exec(ctx, "DROP TABLE IF EXISTS "+pgx.Identifier{name}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to drop partition %s: %w", name, err)
+	}
+	return nil
+}
+
+// SaveRetentionAudit добавляет запись в журнал срока хранения
+func (r *PostgresRepository) SaveRetentionAudit(ctx context.Context, entry *domain.RetentionAuditEntry) error {
+	query := `INSERT INTO partition_retention_audit (partition_name, range_from, range_to, status, dry_run, bytes, export_path, error, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+
+	if err := r.pool.QueryRow(ctx, query,
+		entry.Partition, entry.RangeFrom, entry.RangeTo, entry.Status, entry.DryRun, entry.Bytes, entry.ExportPath, entry.Error, entry.CreatedAt,
+	).Scan(&entry.ID); err != nil {
+		return fmt.Errorf("failed to save retention audit: %w", err)
+	}
+	return nil
+}
+
+// ListRetentionAudit возвращает последние записи журнала срока хранения
+func (r *PostgresRepository) ListRetentionAudit(ctx context.Context, limit int) ([]*domain.RetentionAuditEntry, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_retention_audit").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT id, partition_name, range_from, range_to, status, dry_run, bytes, export_path, error, created_at
+FROM partition_retention_audit ORDER BY created_at DESC, id DESC LIMIT $1`
+
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query retention audit: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*domain.RetentionAuditEntry
+	for rows.Next() {
+		var entry domain.RetentionAuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Partition, &entry.RangeFrom, &entry.RangeTo, &entry.Status,
+			&entry.DryRun, &entry.Bytes, &entry.ExportPath, &entry.Error, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan retention audit: %w", err)
+		}
+		list = append(list, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating retention audit: %w", err)
+	}
+
+	return list, nil
+}
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/CoolE88/data-aggregation-service/internal/config"
@@ -77,24 +78,84 @@ func monitorConnections(ctx context.Context, pool *pgxpool.Pool, logger *zap.Log
 	}
 }
 
-func (r *PostgresRepository) SaveProcessedData(ctx context.Context, data *domain.ProcessedData) error {
+// SaveProcessedData сохраняет результаты всех серий одного пакета в одной транзакции
+func (r *PostgresRepository) SaveProcessedData(ctx context.Context, results []*domain.ProcessedData) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
+	if len(results) == 0 {
+		return nil
+	}
 
 	start := time.Now()
 	defer func() {
 		metrics.DBQueryDuration.WithLabelValues("save_processed_data").Observe(time.Since(start).Seconds())
 	}()
 
-	query := "INSERT INTO processed_packets (packet_id, packet_created_at, max_value, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (packet_id, created_at) DO NOTHING RETURNING packet_id"
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // после Commit ничего не делает
+	}()
+
+	// Уникальный ключ packet_dedup отсекает повторную отправку пакета: параллельная
+	// вставка того же идентификатора ждёт завершения этой транзакции и ничего не вставляет
+	first := results[0]
+	var reserved uuid.UUID
+	err = tx.QueryRow(ctx,
+		"INSERT INTO packet_dedup (tenant_id, packet_id, first_seen_at) VALUES ($1, $2, $3) ON CONFLICT (tenant_id, packet_id) DO NOTHING RETURNING packet_id",
+		first.TenantID, first.PacketID, first.CreatedAt,
+	).Scan(&reserved)
+	if err == pgx.ErrNoRows {
+		return domain.ErrDuplicatePacket
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reserve packet id: %w", err)
+	}
+
+	for _, data := range results {
+		if err := insertProcessedData(ctx, tx, data); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit processed data: %w", err)
+	}
+
+	return nil
+}
+
+// insertProcessedData сохраняет результат одной серии пакета и обновляет её роллапы
+func insertProcessedData(ctx context.Context, tx pgx.Tx, data *domain.ProcessedData) error {
+	query := "INSERT INTO processed_packets (packet_id, packet_created_at, max_value, created_at, value_kind, max_value_float, max_value_decimal, empty_payload, anomaly_score, anomalous, labels, derived, source_id, tenant_id, series, received_at, clamped_from) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) ON CONFLICT (packet_id, series, created_at) DO NOTHING RETURNING packet_id"
+
+	var maxValue *int64
+	if !data.EmptyPayload {
+		maxValue = &data.MaxValue
+	}
 
 	var insertedID uuid.UUID
-	err := r.pool.QueryRow(ctx, query,
+	err := tx.QueryRow(ctx, query,
 		data.PacketID,
 		data.PacketCreatedAt,
-		data.MaxValue,
+		maxValue,
 		data.CreatedAt,
+		valueKind(data.ValueKind),
+		data.MaxValueFloat,
+		nullableDecimal(data.MaxValueDecimal),
+		data.EmptyPayload,
+		data.AnomalyScore,
+		data.Anomalous,
+		labelsOrEmpty(data.Labels),
+		derivedOrEmpty(data.Derived),
+		data.SourceID,
+		data.TenantID,
+		data.Series,
+		data.ReceivedAt,
+		data.ClampedFrom,
 	).Scan(&insertedID)
 
 	if err != nil && err != pgx.ErrNoRows {
@@ -102,28 +163,34 @@ func (r *PostgresRepository) SaveProcessedData(ctx context.Context, data *domain
 	}
 
 	if err == pgx.ErrNoRows {
-		r.logger.Debug("duplicate packet ignored", zap.String("packet_id", data.PacketID.String()))
+		return domain.ErrDuplicatePacket
 	}
 
+	// Роллапы обновляются в той же транзакции, чтобы дубликаты не учитывались дважды.
+	// Пустые пакеты в роллапы не попадают.
+	if !data.EmptyPayload {
+		return upsertRollups(ctx, tx, data)
+	}
 	return nil
 }
 
-func (r *PostgresRepository) GetMaxValueByPacketID(ctx context.Context, packetID uuid.UUID) (*domain.ProcessedData, error) {
+// GetMaxValueByPacketID возвращает результат серии series пакета. Без series возвращается
+// безымянная серия или первая по имени.
+func (r *PostgresRepository) GetMaxValueByPacketID(ctx context.Context, tenantID string, packetID uuid.UUID, series string) (*domain.ProcessedData, error) {
 	start := time.Now()
 	defer func() {
 		metrics.DBQueryDuration.WithLabelValues("get_max_value_by_packet_id").Observe(time.Since(start).Seconds())
 	}()
 
-	query := "SELECT packet_id, packet_created_at, max_value, created_at FROM processed_packets WHERE packet_id = $1"
-
-	var data domain.ProcessedData
-	err := r.pool.QueryRow(ctx, query, packetID).Scan(
-		&data.PacketID,
-		&data.PacketCreatedAt,
-		&data.MaxValue,
-		&data.CreatedAt,
-	)
+	query := "SELECT " + processedDataColumns + " FROM processed_packets WHERE tenant_id = $1 AND packet_id = $2"
+	args := []any{tenantID, packetID}
+	if series != "" {
+		query += " AND series = $3"
+		args = append(args, series)
+	}
+	query += " ORDER BY series LIMIT 1"
 
+	data, err := scanProcessedData(r.pool.QueryRow(ctx, query, args...))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
@@ -131,18 +198,28 @@ func (r *PostgresRepository) GetMaxValueByPacketID(ctx context.Context, packetID
 		return nil, fmt.Errorf("failed to get processed data: %w", err)
 	}
 
-	return &data, nil
+	return data, nil
 }
 
-func (r *PostgresRepository) GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time) ([]*domain.ProcessedData, error) {
+// GetMaxValuesByTimeRange возвращает не больше limit результатов за период в порядке
+// (время на оси фильтра, packet_id, серия), начиная после позиции after
+func (r *PostgresRepository) GetMaxValuesByTimeRange(ctx context.Context, tenantID string, start, end time.Time, filter domain.PacketFilter, after *domain.PageCursor, limit int) ([]*domain.ProcessedData, error) {
 	startTime := time.Now()
 	defer func() {
 		metrics.DBQueryDuration.WithLabelValues("get_max_values_by_time_range").Observe(time.Since(startTime).Seconds())
 	}()
 
-	query := "SELECT packet_id, packet_created_at, max_value, created_at FROM processed_packets WHERE created_at >= $1 AND created_at < $2 ORDER BY packet_created_at"
+	column := timeAxisColumn(filter.TimeAxis)
+	conditions, args := filterConditions(tenantID, filter, start, end)
+	if after != nil {
+		args = append(args, after.Time, after.PacketID, after.Series)
+		conditions += fmt.Sprintf(" AND (%s, packet_id, series) > ($%d, $%d, $%d)", column, len(args)-2, len(args)-1, len(args))
+	}
+	args = append(args, limit)
+	query := "SELECT " + processedDataColumns + " FROM processed_packets WHERE " + conditions +
+		fmt.Sprintf(" ORDER BY %s, packet_id, series LIMIT $%d", column, len(args))
 
-	rows, err := r.pool.Query(ctx, query, start, end)
+	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query processed data: %w", err)
 	}
@@ -150,17 +227,11 @@ func (r *PostgresRepository) GetMaxValuesByTimeRange(ctx context.Context, start,
 
 	var results []*domain.ProcessedData
 	for rows.Next() {
-		var data domain.ProcessedData
-		err := rows.Scan(
-			&data.PacketID,
-			&data.PacketCreatedAt,
-			&data.MaxValue,
-			&data.CreatedAt,
-		)
+		data, err := scanProcessedData(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
-		results = append(results, &data)
+		results = append(results, data)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -170,6 +241,230 @@ func (r *PostgresRepository) GetMaxValuesByTimeRange(ctx context.Context, start,
 	return results, nil
 }
 
+// streamFetchSize сколько строк курсора читается из базы за один FETCH
+const streamFetchSize = 1000
+
+// StreamMaxValuesByTimeRange передаёт fn результаты за период в порядке (время на оси фильтра, packet_id, серия).
+// Строки читаются серверным курсором порциями по streamFetchSize, поэтому память не зависит от размера выборки.
+// Ошибка fn останавливает чтение и возвращается без обёртки; отмена ctx прерывает запрос в базе.
+func (r *PostgresRepository) StreamMaxValuesByTimeRange(ctx context.Context, tenantID string, start, end time.Time, filter domain.PacketFilter, fn func(*domain.ProcessedData) error) error {
+	startTime := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("stream_max_values_by_time_range").Observe(time.Since(startTime).Seconds())
+	}()
+
+	conditions, args := filterConditions(tenantID, filter, start, end)
+	query := "SELECT " + processedDataColumns + " FROM processed_packets WHERE " + conditions +
+		" ORDER BY " + timeAxisColumn(filter.TimeAxis) + ", packet_id, series"
+
+	// Курсор живёт до конца транзакции; откат закрывает его и при ошибке, и при отмене
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if _, err := tx.Exec(ctx, "DECLARE max_values_stream NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return fmt.Errorf("failed to declare cursor: %w", err)
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM max_values_stream", streamFetchSize)
+	for {
+		fetched, err := r.fetchMaxValues(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if fetched < streamFetchSize {
+			return nil
+		}
+	}
+}
+
+// fetchMaxValues читает одну порцию курсора и возвращает число прочитанных строк
+func (r *PostgresRepository) fetchMaxValues(ctx context.Context, tx pgx.Tx, fetch string, fn func(*domain.ProcessedData) error) (int, error) {
+	rows, err := tx.Query(ctx, fetch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	defer rows.Close()
+
+	fetched := 0
+	for rows.Next() {
+		data, err := scanProcessedData(rows)
+		if err != nil {
+			return fetched, fmt.Errorf("failed to scan row: %w", err)
+		}
+		fetched++
+		if err := fn(data); err != nil {
+			return fetched, err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fetched, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return fetched, nil
+}
+
+// CountRowsByTenant возвращает количество строк результатов по арендаторам
+func (r *PostgresRepository) CountRowsByTenant(ctx context.Context) (map[string]int64, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("count_rows_by_tenant").Observe(time.Since(start).Seconds())
+	}()
+
+	rows, err := r.pool.Query(ctx, "SELECT tenant_id, COUNT(*) FROM processed_packets GROUP BY tenant_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rows by tenant: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var (
+			tenantID string
+			count    int64
+		)
+		if err := rows.Scan(&tenantID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant row count: %w", err)
+		}
+		counts[tenantID] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tenant row counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// DeleteDedupEntriesBefore удаляет идентификаторы пакетов, впервые увиденных раньше before
+func (r *PostgresRepository) DeleteDedupEntriesBefore(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("delete_dedup_entries").Observe(time.Since(start).Seconds())
+	}()
+
+	tag, err := r.pool.Exec(ctx, "DELETE FROM packet_dedup WHERE first_seen_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete dedup entries: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// filterConditions строит условие WHERE по арендатору, интервалу на оси времени фильтра и фильтру.
+// Условия на источник, лейблы и серии добавляются, только если заданы, чтобы планировщик выбирал индекс.
+func filterConditions(tenantID string, filter domain.PacketFilter, start, end time.Time) (string, []any) {
+	column := timeAxisColumn(filter.TimeAxis)
+	conditions := []string{"tenant_id = $1", column + " >= $2", column + " < $3"}
+	args := []any{tenantID, start, end}
+
+	if filter.SourceID != "" {
+		args = append(args, filter.SourceID)
+		conditions = append(conditions, fmt.Sprintf("source_id = $%d", len(args)))
+	}
+	if len(filter.Labels) > 0 {
+		args = append(args, filter.Labels)
+		conditions = append(conditions, fmt.Sprintf("labels @> $%d", len(args)))
+	}
+	if len(filter.Series) > 0 {
+		args = append(args, filter.Series)
+		conditions = append(conditions, fmt.Sprintf("series = ANY($%d)", len(args)))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// timeAxisColumn колонка processed_packets для оси времени запроса. По времени обработки
+// выборка ограничивается партициями интервала, по времени устройства — индексом
+// (tenant_id, packet_created_at) во всех партициях.
+func timeAxisColumn(axis domain.TimeAxis) string {
+	if axis == domain.TimeAxisEvent {
+		return "packet_created_at"
+	}
+	return "created_at"
+}
+
+// processedDataColumns колонки processed_packets в порядке, который ожидает scanProcessedData
+// Для строк, записанных до появления received_at, временем приёма считается время обработки.
+const processedDataColumns = "packet_id, packet_created_at, max_value, created_at, value_kind, max_value_float, max_value_decimal::TEXT, empty_payload, anomaly_score, anomalous, labels, derived, source_id, tenant_id, series, COALESCE(received_at, created_at), clamped_from"
+
+// scanProcessedData читает строку processed_packets, выбранную с processedDataColumns
+func scanProcessedData(row pgx.Row) (*domain.ProcessedData, error) {
+	var (
+		data      domain.ProcessedData
+		maxValue  *int64
+		valueKind string
+		decimal   *string
+	)
+	err := row.Scan(
+		&data.PacketID,
+		&data.PacketCreatedAt,
+		&maxValue,
+		&data.CreatedAt,
+		&valueKind,
+		&data.MaxValueFloat,
+		&decimal,
+		&data.EmptyPayload,
+		&data.AnomalyScore,
+		&data.Anomalous,
+		&data.Labels,
+		&data.Derived,
+		&data.SourceID,
+		&data.TenantID,
+		&data.Series,
+		&data.ReceivedAt,
+		&data.ClampedFrom,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxValue != nil {
+		data.MaxValue = *maxValue
+	}
+	data.ValueKind = domain.PayloadKind(valueKind)
+	if decimal != nil {
+		data.MaxValueDecimal = *decimal
+	}
+	return &data, nil
+}
+
+// valueKind подставляет целочисленный тип для записей без явного типа пейлоада
+func valueKind(kind domain.PayloadKind) string {
+	if kind == "" {
+		return string(domain.PayloadKindInt)
+	}
+	return string(kind)
+}
+
+// labelsOrEmpty сохраняет отсутствие лейблов как пустой объект, а не JSON null
+func labelsOrEmpty(labels map[string]string) map[string]string {
+	if labels == nil {
+		return map[string]string{}
+	}
+	return labels
+}
+
+// derivedOrEmpty сохраняет отсутствие производных метрик как пустой объект
+func derivedOrEmpty(derived map[string]float64) map[string]float64 {
+	if derived == nil {
+		return map[string]float64{}
+	}
+	return derived
+}
+
+func nullableDecimal(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
 func (r *PostgresRepository) HealthCheck(ctx context.Context) error {
 	start := time.Now()
 	defer func() {
@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const quarantineColumns = "tenant_id, packet_id, source_id, reason, packet_created_at, received_at, packet"
+
+// SaveQuarantinedPacket сохраняет пакет в карантин. Повторно присланный пакет заменяет прежнюю запись.
+func (r *PostgresRepository) SaveQuarantinedPacket(ctx context.Context, packet *domain.QuarantinedPacket) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_quarantined_packet").Observe(time.Since(start).Seconds())
+	}()
+
+	body, err := json.Marshal(packet.Packet)
+	if err != nil {
+		return fmt.Errorf("failed to encode quarantined packet: %w", err)
+	}
+
+	query := `INSERT INTO quarantined_packets (` + quarantineColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (tenant_id, packet_id) DO UPDATE SET source_id = EXCLUDED.source_id, reason = EXCLUDED.reason,
+packet_created_at = EXCLUDED.packet_created_at, received_at = EXCLUDED.received_at, packet = EXCLUDED.packet`
+
+	if _, err := r.pool.Exec(ctx, query,
+		packet.TenantID, packet.PacketID, packet.SourceID, packet.Reason, packet.Timestamp, packet.ReceivedAt, body,
+	); err != nil {
+		return fmt.Errorf("failed to save quarantined packet: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) ListQuarantinedPackets(ctx context.Context, tenantID string, limit int) ([]*domain.QuarantinedPacket, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_quarantined_packets").Observe(time.Since(start).Seconds())
+	}()
+
+	query := "SELECT " + quarantineColumns + " FROM quarantined_packets WHERE tenant_id = $1 ORDER BY received_at DESC, packet_id LIMIT $2"
+	rows, err := r.pool.Query(ctx, query, tenantID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quarantined packets: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*domain.QuarantinedPacket
+	for rows.Next() {
+		packet, err := scanQuarantinedPacket(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan quarantined packet: %w", err)
+		}
+		list = append(list, packet)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating quarantined packets: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *PostgresRepository) GetQuarantinedPacket(ctx context.Context, tenantID string, packetID uuid.UUID) (*domain.QuarantinedPacket, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("get_quarantined_packet").Observe(time.Since(start).Seconds())
+	}()
+
+	query := "SELECT " + quarantineColumns + " FROM quarantined_packets WHERE tenant_id = $1 AND packet_id = $2"
+	packet, err := scanQuarantinedPacket(r.pool.QueryRow(ctx, query, tenantID, packetID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get quarantined packet: %w", err)
+	}
+
+	return packet, nil
+}
+
+func (r *PostgresRepository) DeleteQuarantinedPacket(ctx context.Context, tenantID string, packetID uuid.UUID) (bool, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("delete_quarantined_packet").Observe(time.Since(start).Seconds())
+	}()
+
+	tag, err := r.pool.Exec(ctx, "DELETE FROM quarantined_packets WHERE tenant_id = $1 AND packet_id = $2", tenantID, packetID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete quarantined packet: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// scanQuarantinedPacket читает строку quarantined_packets, выбранную с quarantineColumns
+func scanQuarantinedPacket(row pgx.Row) (*domain.QuarantinedPacket, error) {
+	var (
+		packet domain.QuarantinedPacket
+		body   []byte
+	)
+	if err := row.Scan(&packet.TenantID, &packet.PacketID, &packet.SourceID, &packet.Reason,
+		&packet.Timestamp, &packet.ReceivedAt, &body); err != nil {
+		return nil, err
+	}
+
+	packet.Packet = new(domain.DataPacket)
+	if err := json.Unmarshal(body, packet.Packet); err != nil {
+		return nil, fmt.Errorf("failed to decode quarantined packet: %w", err)
+	}
+	packet.Packet.TenantID = packet.TenantID
+	packet.Packet.ReceivedAt = packet.ReceivedAt
+	return &packet, nil
+}
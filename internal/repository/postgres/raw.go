@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const rawPartitionPrefix = "raw_packets_"
+
+// rawPayload сериализуемая часть сырого пакета
+type rawPayload struct {
+	Payload        []int64   `json:"payload,omitempty"`
+	FloatPayload   []float64 `json:"float_payload,omitempty"`
+	DecimalPayload []string  `json:"decimal_payload,omitempty"`
+
+	Series map[string]domain.SeriesPayload `json:"series,omitempty"`
+}
+
+func compressPayload(packet *domain.RawPacket) ([]byte, error) {
+	data, err := json.Marshal(rawPayload{
+		Payload:        packet.Payload,
+		FloatPayload:   packet.FloatPayload,
+		DecimalPayload: packet.DecimalPayload,
+		Series:         packet.Series,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressPayload(data []byte, packet *domain.RawPacket) error {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	var payload rawPayload
+	if err := json.Unmarshal(decoded, &payload); err != nil {
+		return err
+	}
+
+	packet.Payload = payload.Payload
+	packet.FloatPayload = payload.FloatPayload
+	packet.DecimalPayload = payload.DecimalPayload
+	packet.Series = payload.Series
+	return nil
+}
+
+func (r *PostgresRepository) SaveRawPacket(ctx context.Context, packet *domain.RawPacket) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_raw_packet").Observe(time.Since(start).Seconds())
+	}()
+
+	payload, err := compressPayload(packet)
+	if err != nil {
+		return fmt.Errorf("failed to compress raw payload: %w", err)
+	}
+
+	query := "INSERT INTO raw_packets (tenant_id, packet_id, packet_created_at, archived_at, payload_kind, payload) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (packet_id, archived_at) DO NOTHING"
+
+	_, err = r.pool.Exec(ctx, query,
+		packet.TenantID,
+		packet.PacketID,
+		packet.PacketCreatedAt,
+		packet.ArchivedAt,
+		string(packet.PayloadKind),
+		payload,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save raw packet: %w", err)
+	}
+
+	return nil
+}
+
+// GetRawPacket возвращает последнюю архивную копию пейлоада пакета арендатора или (nil, nil)
+func (r *PostgresRepository) GetRawPacket(ctx context.Context, tenantID string, packetID uuid.UUID) (*domain.RawPacket, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("get_raw_packet").Observe(time.Since(start).Seconds())
+	}()
+
+	query := "SELECT tenant_id, packet_id, packet_created_at, archived_at, payload_kind, payload FROM raw_packets WHERE tenant_id = $1 AND packet_id = $2 ORDER BY archived_at DESC LIMIT 1"
+
+	var (
+		packet      domain.RawPacket
+		payloadKind string
+		payload     []byte
+	)
+	err := r.pool.QueryRow(ctx, query, tenantID, packetID).Scan(
+		&packet.TenantID,
+		&packet.PacketID,
+		&packet.PacketCreatedAt,
+		&packet.ArchivedAt,
+		&payloadKind,
+		&payload,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get raw packet: %w", err)
+	}
+
+	packet.PayloadKind = domain.PayloadKind(payloadKind)
+	if err := decompressPayload(payload, &packet); err != nil {
+		return nil, fmt.Errorf("failed to decompress raw payload: %w", err)
+	}
+
+	return &packet, nil
+}
+
+// EnsureRawPartitions создаёт суточные партиции raw_packets для дней из [from, to]
+func (r *PostgresRepository) EnsureRawPartitions(ctx context.Context, from, to time.Time) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("ensure_raw_partitions").Observe(time.Since(start).Seconds())
+	}()
+
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		name := rawPartitionPrefix + day.Format("20060102")
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF raw_packets FOR VALUES FROM ('%s') TO ('%s')",
+			name, day.Format(time.RFC3339), day.AddDate(0, 0, 1).Format(time.RFC3339))
+
+		if _, err := r.pool.Exec(ctx, query); err != nil {
+			return fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// DropRawPartitionsBefore удаляет суточные партиции raw_packets, которые целиком старше before
+func (r *PostgresRepository) DropRawPartitionsBefore(ctx context.Context, before time.Time) ([]string, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("drop_raw_partitions").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `SELECT c.relname FROM pg_inherits i
+JOIN pg_class c ON c.oid = i.inhrelid
+JOIN pg_class p ON p.oid = i.inhparent
+WHERE p.relname = 'raw_packets'`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list raw partitions: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list raw partitions: %w", err)
+	}
+
+	var dropped []string
+	for _, name := range names {
+		day, err := time.Parse("20060102", strings.TrimPrefix(name, rawPartitionPrefix))
+		if err != nil {
+			r.logger.Warn("skipping raw partition with unexpected name", zap.String("partition", name))
+			continue
+		}
+		if day.AddDate(0, 0, 1).After(before) {
+			continue
+		}
+
+		if _, err := r.pool.Exec(ctx, "DROP TABLE IF EXISTS "+pgx.Identifier{name}.Sanitize()); err != nil {
+			return dropped, fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		dropped = append(dropped, name)
+	}
+
+	return dropped, nil
+}
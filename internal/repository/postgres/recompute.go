@@ -0,0 +1,220 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *PostgresRepository) CountRawPackets(ctx context.Context, start, end time.Time) (int64, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("count_raw_packets").Observe(time.Since(startTime).Seconds())
+	}()
+
+	var count int64
+	err := r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM raw_packets WHERE archived_at >= $1 AND archived_at < $2", start, end).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count raw packets: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r *PostgresRepository) ListRawPackets(ctx context.Context, start, end time.Time, afterTime time.Time, afterID uuid.UUID, limit int) ([]*domain.RawPacket, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_raw_packets").Observe(time.Since(startTime).Seconds())
+	}()
+
+	query := `SELECT tenant_id, packet_id, packet_created_at, archived_at, payload_kind, payload FROM raw_packets
+WHERE archived_at >= $1 AND archived_at < $2 AND (archived_at, packet_id) > ($3, $4)
+ORDER BY archived_at, packet_id
+LIMIT $5`
+
+	rows, err := r.pool.Query(ctx, query, start, end, afterTime, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query raw packets: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*domain.RawPacket
+	for rows.Next() {
+		var (
+			packet      domain.RawPacket
+			payloadKind string
+			payload     []byte
+		)
+		if err := rows.Scan(&packet.TenantID, &packet.PacketID, &packet.PacketCreatedAt, &packet.ArchivedAt, &payloadKind, &payload); err != nil {
+			return nil, fmt.Errorf("failed to scan raw packet: %w", err)
+		}
+		packet.PayloadKind = domain.PayloadKind(payloadKind)
+		if err := decompressPayload(payload, &packet); err != nil {
+			return nil, fmt.Errorf("failed to decompress raw payload of %s: %w", packet.PacketID, err)
+		}
+		results = append(results, &packet)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating raw packets: %w", err)
+	}
+
+	return results, nil
+}
+
+func (r *PostgresRepository) GetCurrentResults(ctx context.Context, function string, packets []domain.TenantPacketKey) (map[domain.PacketSeriesKey]string, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("get_current_results").Observe(time.Since(start).Seconds())
+	}()
+
+	// packet_id уникален только в пределах арендатора, поэтому пакеты ищутся по паре (tenant_id, packet_id)
+	tenantIDs := make([]string, len(packets))
+	packetIDs := make([]uuid.UUID, len(packets))
+	for i, packet := range packets {
+		tenantIDs[i] = packet.TenantID
+		packetIDs[i] = packet.PacketID
+	}
+
+	query := `SELECT DISTINCT ON (tenant_id, packet_id, series) tenant_id, packet_id, series, value::TEXT FROM packet_results
+WHERE function = $1 AND (tenant_id, packet_id) IN (SELECT * FROM unnest($2::TEXT[], $3::UUID[]))
+ORDER BY tenant_id, packet_id, series, version DESC`
+
+	results, err := r.collectValues(ctx, query, function, tenantIDs, packetIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Для max исходный результат каждой серии хранится в processed_packets
+	if function == "max" {
+		query := `SELECT DISTINCT ON (tenant_id, packet_id, series) tenant_id, packet_id, series,
+    COALESCE(max_value_decimal::TEXT, max_value_float::TEXT, max_value::TEXT)
+FROM processed_packets
+WHERE (tenant_id, packet_id) IN (SELECT * FROM unnest($1::TEXT[], $2::UUID[])) AND NOT empty_payload
+ORDER BY tenant_id, packet_id, series, created_at DESC`
+
+		processed, err := r.collectValues(ctx, query, tenantIDs, packetIDs)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range processed {
+			if _, ok := results[key]; !ok {
+				results[key] = value
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func (r *PostgresRepository) collectValues(ctx context.Context, query string, args ...any) (map[domain.PacketSeriesKey]string, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query current results: %w", err)
+	}
+	defer rows.Close()
+
+	results := make(map[domain.PacketSeriesKey]string)
+	for rows.Next() {
+		var (
+			key   domain.PacketSeriesKey
+			value string
+		)
+		if err := rows.Scan(&key.TenantID, &key.PacketID, &key.Series, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan current result: %w", err)
+		}
+		results[key] = value
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating current results: %w", err)
+	}
+
+	return results, nil
+}
+
+func (r *PostgresRepository) SavePacketResults(ctx context.Context, results []*domain.PacketResult) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_packet_results").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `INSERT INTO packet_results (tenant_id, packet_id, series, function, version, value, computed_at, job_id)
+VALUES ($1, $2, $3, $4, $5, $6::NUMERIC, $7, $8)
+ON CONFLICT (tenant_id, packet_id, series, function, version) DO UPDATE SET
+    value = EXCLUDED.value,
+    computed_at = EXCLUDED.computed_at,
+    job_id = EXCLUDED.job_id`
+
+	batch := &pgx.Batch{}
+	for _, result := range results {
+		batch.Queue(query, result.TenantID, result.PacketID, result.Series, result.Function, result.Version, result.Value, result.ComputedAt, result.JobID)
+	}
+
+	if err := r.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to save packet results: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) SaveRecomputeJob(ctx context.Context, job *domain.RecomputeJob) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_recompute_job").Observe(time.Since(start).Seconds())
+	}()
+
+	state, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode recompute job: %w", err)
+	}
+
+	query := `INSERT INTO recompute_jobs (id, status, state, started_at, updated_at) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, state = EXCLUDED.state, updated_at = EXCLUDED.updated_at`
+
+	if _, err := r.pool.Exec(ctx, query, job.ID, string(job.Status), state, job.StartedAt, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to save recompute job: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) ListRecomputeJobs(ctx context.Context) ([]*domain.RecomputeJob, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_recompute_jobs").Observe(time.Since(start).Seconds())
+	}()
+
+	rows, err := r.pool.Query(ctx, "SELECT state FROM recompute_jobs ORDER BY started_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recompute jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*domain.RecomputeJob
+	for rows.Next() {
+		var state []byte
+		if err := rows.Scan(&state); err != nil {
+			return nil, fmt.Errorf("failed to scan recompute job: %w", err)
+		}
+
+		var job domain.RecomputeJob
+		if err := json.Unmarshal(state, &job); err != nil {
+			return nil, fmt.Errorf("failed to decode recompute job: %w", err)
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recompute jobs: %w", err)
+	}
+
+	return jobs, nil
+}
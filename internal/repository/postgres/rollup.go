@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+	"github.com/CoolE88/data-aggregation-service/internal/sketch"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// rollupTables сопоставляет разрешение роллапа с таблицей
+var rollupTables = map[domain.RollupResolution]string{
+	domain.RollupResolutionMinute: "processed_packets_rollup_1m",
+	domain.RollupResolutionHour:   "processed_packets_rollup_1h",
+	domain.RollupResolutionDay:    "processed_packets_rollup_1d",
+}
+
+// upsertRollups инкрементально добавляет обработанное значение во все роллапы серии арендатора.
+// max/min/sum хранятся в NUMERIC по точному значению, скетч строится по его приближению float64.
+// Десятичные значения вне диапазона float64 попадают в скетч округлёнными.
+func upsertRollups(ctx context.Context, tx pgx.Tx, data *domain.ProcessedData) error {
+	value, err := data.ExactValue()
+	if err != nil {
+		value = float64(data.MaxValue)
+	}
+	sketchKey := sketch.Key(value)
+
+	for _, resolution := range domain.RollupResolutions {
+		query := fmt.Sprintf(`INSERT INTO %s (tenant_id, series, bucket_start, max_value, min_value, count, sum, sketch)
+VALUES ($4, $5, $1, $2::NUMERIC, $2::NUMERIC, 1, $2::NUMERIC, jsonb_build_object($3::TEXT, 1))
+ON CONFLICT (tenant_id, series, bucket_start) DO UPDATE SET
+    max_value = GREATEST(%[1]s.max_value, EXCLUDED.max_value),
+    min_value = LEAST(%[1]s.min_value, EXCLUDED.min_value),
+    count = %[1]s.count + 1,
+    sum = %[1]s.sum + EXCLUDED.sum,
+    sketch = %[1]s.sketch || jsonb_build_object($3::TEXT, COALESCE((%[1]s.sketch->>$3::TEXT)::BIGINT, 0) + 1)`, rollupTables[resolution])
+
+		bucketStart := data.CreatedAt.UTC().Truncate(resolution.Duration())
+		if _, err := tx.Exec(ctx, query, bucketStart, data.ExactDecimal(), sketchKey, data.TenantID, data.Series); err != nil {
+			return fmt.Errorf("failed to update %s rollup: %w", resolution, err)
+		}
+	}
+
+	return nil
+}
+
+// GetRollups возвращает агрегаты серии арендатора из таблицы заданного разрешения, сгруппированные с шагом step
+func (r *PostgresRepository) GetRollups(ctx context.Context, tenantID, series string, resolution domain.RollupResolution, start, end time.Time, step time.Duration) ([]*domain.RollupBucket, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("get_rollups").Observe(time.Since(startTime).Seconds())
+	}()
+
+	table, ok := rollupTables[resolution]
+	if !ok {
+		return nil, fmt.Errorf("unknown rollup resolution: %q", resolution)
+	}
+
+	query := fmt.Sprintf(`SELECT to_timestamp(floor(extract(epoch FROM bucket_start) / $3) * $3) AS bucket,
+    MAX(max_value)::TEXT, MIN(min_value)::TEXT, SUM(count)::BIGINT, SUM(sum)::TEXT
+FROM %s
+WHERE tenant_id = $4 AND series = $5 AND bucket_start >= $1 AND bucket_start < $2
+GROUP BY bucket
+ORDER BY bucket`, table)
+
+	rows, err := r.pool.Query(ctx, query, start, end, step.Seconds(), tenantID, series)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*domain.RollupBucket
+	for rows.Next() {
+		bucket := domain.RollupBucket{Resolution: resolution}
+		err := rows.Scan(
+			&bucket.BucketStart,
+			&bucket.MaxValueDecimal,
+			&bucket.MinValueDecimal,
+			&bucket.Count,
+			&bucket.SumDecimal,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rollup row: %w", err)
+		}
+		// Агрегаты хранятся в NUMERIC и могут выйти за int64, целые поля ограничиваются его диапазоном
+		if bucket.MaxValue, _, err = domain.DecimalToInt64(bucket.MaxValueDecimal); err != nil {
+			return nil, fmt.Errorf("failed to parse rollup max: %w", err)
+		}
+		if bucket.MinValue, _, err = domain.DecimalToInt64(bucket.MinValueDecimal); err != nil {
+			return nil, fmt.Errorf("failed to parse rollup min: %w", err)
+		}
+		if bucket.Sum, _, err = domain.DecimalToInt64(bucket.SumDecimal); err != nil {
+			return nil, fmt.Errorf("failed to parse rollup sum: %w", err)
+		}
+		results = append(results, &bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rollup rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// GetRollupSketches возвращает скетчи бакетов серии арендатора заданного разрешения за интервал
+func (r *PostgresRepository) GetRollupSketches(ctx context.Context, tenantID, series string, resolution domain.RollupResolution, start, end time.Time) ([]*domain.RollupSketch, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("get_rollup_sketches").Observe(time.Since(startTime).Seconds())
+	}()
+
+	table, ok := rollupTables[resolution]
+	if !ok {
+		return nil, fmt.Errorf("unknown rollup resolution: %q", resolution)
+	}
+
+	query := fmt.Sprintf(`SELECT bucket_start, sketch FROM %s
+WHERE tenant_id = $3 AND series = $4 AND bucket_start >= $1 AND bucket_start < $2
+ORDER BY bucket_start`, table)
+
+	rows, err := r.pool.Query(ctx, query, start, end, tenantID, series)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollup sketches: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*domain.RollupSketch
+	for rows.Next() {
+		var bucket domain.RollupSketch
+		if err := rows.Scan(&bucket.BucketStart, &bucket.Buckets); err != nil {
+			return nil, fmt.Errorf("failed to scan rollup sketch: %w", err)
+		}
+		results = append(results, &bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rollup sketches: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+)
+
+func (r *PostgresRepository) ListPacketSchemas(ctx context.Context) ([]*domain.PacketSchema, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_packet_schemas").Observe(time.Since(start).Seconds())
+	}()
+
+	rows, err := r.pool.Query(ctx, "SELECT tenant_id, source_id, version, definition, created_at FROM packet_schemas")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query packet schemas: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*domain.PacketSchema
+	for rows.Next() {
+		var (
+			schema     domain.PacketSchema
+			tenantID   string
+			definition []byte
+		)
+		if err := rows.Scan(&tenantID, &schema.SourceID, &schema.Version, &definition, &schema.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan packet schema: %w", err)
+		}
+		if err := json.Unmarshal(definition, &schema); err != nil {
+			return nil, fmt.Errorf("failed to decode packet schema %s v%d: %w", schema.SourceID, schema.Version, err)
+		}
+		// Определения, сохранённые до появления арендаторов, не содержат tenant_id
+		schema.TenantID = tenantID
+		list = append(list, &schema)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating packet schemas: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *PostgresRepository) SavePacketSchema(ctx context.Context, schema *domain.PacketSchema) (bool, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_packet_schema").Observe(time.Since(start).Seconds())
+	}()
+
+	// Определение хранится целиком: арендатор, источник, версия и время создания дублируются в колонках
+	definition, err := json.Marshal(schema)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode packet schema: %w", err)
+	}
+
+	query := `INSERT INTO packet_schemas (tenant_id, source_id, version, definition, created_at) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (tenant_id, source_id, version) DO NOTHING`
+
+	tag, err := r.pool.Exec(ctx, query, schema.TenantID, schema.SourceID, schema.Version, definition, schema.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to save packet schema: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *PostgresRepository) DeletePacketSchema(ctx context.Context, tenantID, sourceID string, version int) (bool, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("delete_packet_schema").Observe(time.Since(start).Seconds())
+	}()
+
+	tag, err := r.pool.Exec(ctx, "DELETE FROM packet_schemas WHERE tenant_id = $1 AND source_id = $2 AND version = $3",
+		tenantID, sourceID, version)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete packet schema: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+)
+
+func (r *PostgresRepository) ListSigningKeys(ctx context.Context) ([]*domain.SigningKey, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("list_signing_keys").Observe(time.Since(start).Seconds())
+	}()
+
+	rows, err := r.pool.Query(ctx, "SELECT tenant_id, source_id, key_id, algorithm, key, created_at, expires_at FROM signing_keys")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*domain.SigningKey
+	for rows.Next() {
+		var (
+			key       domain.SigningKey
+			algorithm string
+		)
+		if err := rows.Scan(&key.TenantID, &key.SourceID, &key.KeyID, &algorithm, &key.Key, &key.CreatedAt, &key.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan signing key: %w", err)
+		}
+		key.Algorithm = domain.SigningAlgorithm(algorithm)
+		list = append(list, &key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating signing keys: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *PostgresRepository) SaveSigningKey(ctx context.Context, key *domain.SigningKey) (bool, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_signing_key").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `INSERT INTO signing_keys (tenant_id, source_id, key_id, algorithm, key, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (tenant_id, source_id, key_id) DO NOTHING`
+
+	tag, err := r.pool.Exec(ctx, query, key.TenantID, key.SourceID, key.KeyID, string(key.Algorithm), key.Key, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to save signing key: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *PostgresRepository) ExpireSigningKey(ctx context.Context, tenantID, sourceID, keyID string, expiresAt time.Time) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("expire_signing_key").Observe(time.Since(start).Seconds())
+	}()
+
+	if _, err := r.pool.Exec(ctx, "UPDATE signing_keys SET expires_at = $4 WHERE tenant_id = $1 AND source_id = $2 AND key_id = $3",
+		tenantID, sourceID, keyID, expiresAt); err != nil {
+		return fmt.Errorf("failed to expire signing key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) DeleteSigningKey(ctx context.Context, tenantID, sourceID, keyID string) (bool, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("delete_signing_key").Observe(time.Since(start).Seconds())
+	}()
+
+	tag, err := r.pool.Exec(ctx, "DELETE FROM signing_keys WHERE tenant_id = $1 AND source_id = $2 AND key_id = $3",
+		tenantID, sourceID, keyID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete signing key: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+)
+
+// exactValueExpr точный максимум для сортировки: десятичный, дробный или целый
+const exactValueExpr = "COALESCE(max_value_decimal, max_value_float::NUMERIC, max_value::NUMERIC)"
+
+func (r *PostgresRepository) GetTopK(ctx context.Context, tenantID string, start, end time.Time, k int, order domain.TopKOrder, filter domain.PacketFilter) ([]*domain.ProcessedData, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("get_top_k").Observe(time.Since(startTime).Seconds())
+	}()
+
+	direction := "DESC"
+	if order == domain.TopKOrderBottom {
+		direction = "ASC"
+	}
+
+	conditions, args := filterConditions(tenantID, filter, start, end)
+	args = append(args, k)
+	query := "SELECT " + processedDataColumns + " FROM processed_packets" +
+		" WHERE " + conditions + " AND NOT empty_payload" +
+		" ORDER BY " + exactValueExpr + " " + direction + ", packet_id, series" +
+		fmt.Sprintf(" LIMIT $%d", len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top-k: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*domain.ProcessedData
+	for rows.Next() {
+		data, err := scanProcessedData(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		results = append(results, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return results, nil
+}
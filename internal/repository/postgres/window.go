@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveWindowResult сохраняет результат окна, перезаписывая его при обновлении опоздавшими пакетами
+func (r *PostgresRepository) SaveWindowResult(ctx context.Context, result *domain.WindowResult) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_window_result").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `INSERT INTO window_results (tenant_id, source_id, series, window_start, window_end, max_value, count, late, emitted_at)
+VALUES ($1, $2, $3, $4, $5, $6::NUMERIC, $7, $8, $9)
+ON CONFLICT (tenant_id, source_id, series, window_start, window_end) DO UPDATE SET
+    max_value = EXCLUDED.max_value,
+    count = EXCLUDED.count,
+    late = EXCLUDED.late,
+    emitted_at = EXCLUDED.emitted_at`
+
+	_, err := r.pool.Exec(ctx, query,
+		result.TenantID,
+		result.SourceID,
+		result.Series,
+		result.WindowStart,
+		result.WindowEnd,
+		result.MaxValueDecimal,
+		result.Count,
+		result.Late,
+		result.EmittedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save window result: %w", err)
+	}
+
+	return nil
+}
+
+// SaveLatePacket сохраняет пакет из side output опоздавших данных
+func (r *PostgresRepository) SaveLatePacket(ctx context.Context, packet *domain.LatePacket) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_late_packet").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `INSERT INTO late_packets (packet_id, tenant_id, source_id, series, packet_created_at, max_value, watermark, received_at)
+VALUES ($1, $2, $3, $4, $5, $6::NUMERIC, $7, $8)`
+
+	_, err := r.pool.Exec(ctx, query,
+		packet.PacketID,
+		packet.TenantID,
+		packet.SourceID,
+		packet.Series,
+		packet.PacketCreatedAt,
+		packet.MaxValueDecimal,
+		packet.Watermark,
+		packet.ReceivedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save late packet: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) SaveWindowCheckpoint(ctx context.Context, name string, state []byte) error {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("save_window_checkpoint").Observe(time.Since(start).Seconds())
+	}()
+
+	query := `INSERT INTO window_checkpoints (name, state, updated_at) VALUES ($1, $2, $3)
+ON CONFLICT (name) DO UPDATE SET state = EXCLUDED.state, updated_at = EXCLUDED.updated_at`
+
+	if _, err := r.pool.Exec(ctx, query, name, state, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to save window checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) LoadWindowCheckpoint(ctx context.Context, name string) ([]byte, error) {
+	start := time.Now()
+	defer func() {
+		metrics.DBQueryDuration.WithLabelValues("load_window_checkpoint").Observe(time.Since(start).Seconds())
+	}()
+
+	var state []byte
+	err := r.pool.QueryRow(ctx, "SELECT state FROM window_checkpoints WHERE name = $1", name).Scan(&state)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load window checkpoint: %w", err)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
+
+	"go.uber.org/zap"
+)
+
+// PacketProcessor обрабатывает пакет, прошедший проверку по схеме
+type PacketProcessor interface {
+	ProcessPacket(ctx context.Context, packet *domain.DataPacket) error
+}
+
+// Processor проверяет пакеты по схеме источника и переводит их в текущую версию
+// перед передачей дальше по цепочке
+type Processor struct {
+	next     PacketProcessor
+	registry *Registry
+	required bool // отклонять пакеты источников без схемы
+	logger   *zap.Logger
+}
+
+func NewProcessor(next PacketProcessor, registry *Registry, required bool, logger *zap.Logger) *Processor {
+	return &Processor{
+		next:     next,
+		registry: registry,
+		required: required,
+		logger:   logger,
+	}
+}
+
+func (p *Processor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	// Пустой пакет отклонит общая валидация
+	if packet == nil {
+		return p.next.ProcessPacket(ctx, packet)
+	}
+
+	found, err := p.registry.Apply(packet)
+	if err == nil && !found && p.required {
+		err = &validation.Error{
+			Reason:  validation.ReasonUnknownSchema,
+			Message: fmt.Sprintf("source %q has no registered schema", sourceKey(packet)),
+		}
+	}
+	if err != nil {
+		reason := validation.Reason("unknown")
+		if validationErr, ok := err.(*validation.Error); ok {
+			reason = validationErr.Reason
+		}
+		metrics.ValidationRejectedPackets.WithLabelValues(string(reason), packet.Tenant()).Inc()
+
+		p.logger.Warn("[Schema] Packet rejected",
+			zap.String("reason", string(reason)),
+			zap.String("packet_id", packet.ID.String()),
+			zap.String("source_id", sourceKey(packet)),
+			zap.Int("schema_version", packet.SchemaVersion),
+			zap.Error(err))
+		return err
+	}
+
+	return p.next.ProcessPacket(ctx, packet)
+}
@@ -0,0 +1,526 @@
+// Package schema ведёт реестр версионированных схем пакетов по источникам арендаторов: проверяет
+// пакет по объявленной версии схемы и переводит пакеты старых версий в текущую модель.
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
+
+	"go.uber.org/zap"
+)
+
+const (
+	maxSourceLength   = 128
+	maxFields         = 32 // как и серий в пакете
+	maxRequiredLabels = 32
+	maxLabelKeyLength = 64
+)
+
+var (
+	// ErrInvalidSchema возвращается для некорректного определения схемы
+	ErrInvalidSchema = errors.New("invalid packet schema")
+	// ErrVersionConflict возвращается при регистрации не следующей по порядку версии
+	// или удалении версии, которая не является текущей
+	ErrVersionConflict = errors.New("schema version conflict")
+)
+
+// Store хранилище схем
+type Store interface {
+	ListPacketSchemas(ctx context.Context) ([]*domain.PacketSchema, error)
+	// SavePacketSchema сохраняет новую версию; false, если такая версия уже есть
+	SavePacketSchema(ctx context.Context, schema *domain.PacketSchema) (bool, error)
+	DeletePacketSchema(ctx context.Context, tenantID, sourceID string, version int) (bool, error)
+}
+
+// sourceRef источник арендатора: одноимённые источники разных арендаторов имеют свои схемы
+type sourceRef struct {
+	tenantID string
+	sourceID string
+}
+
+type compiledSchema struct {
+	schema    *domain.PacketSchema
+	fields    map[string]domain.SchemaField
+	validator *validation.Validator
+}
+
+// Registry хранит схемы источников в памяти и проверяет по ним пакеты.
+// Версии источника всегда идут подряд с 1: удалить можно только текущую версию.
+type Registry struct {
+	store  Store
+	logger *zap.Logger
+
+	writeMu  sync.Mutex // упорядочивает регистрацию и удаление версий
+	mu       sync.RWMutex
+	bySource map[sourceRef][]*compiledSchema // версия N лежит по индексу N-1
+}
+
+func NewRegistry(store Store, logger *zap.Logger) *Registry {
+	return &Registry{
+		store:    store,
+		logger:   logger,
+		bySource: make(map[sourceRef][]*compiledSchema),
+	}
+}
+
+// Load загружает схемы из хранилища. Некорректная версия и все версии после неё
+// пропускаются с ошибкой в логе, чтобы не нарушать непрерывность цепочки.
+func (r *Registry) Load(ctx context.Context) error {
+	list, err := r.store.ListPacketSchemas(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load packet schemas: %w", err)
+	}
+
+	sortSchemas(list)
+
+	bySource := make(map[sourceRef][]*compiledSchema)
+	loaded := 0
+	for _, schema := range list {
+		ref := sourceRef{schema.TenantID, schema.SourceID}
+		versions := bySource[ref]
+		if schema.Version != len(versions)+1 {
+			r.logger.Error("[Schema] Skipping stored schema out of version order",
+				zap.String("tenant", schema.TenantID),
+				zap.String("source_id", schema.SourceID),
+				zap.Int("version", schema.Version))
+			continue
+		}
+		compiled, err := compile(schema)
+		if err != nil {
+			r.logger.Error("[Schema] Skipping stored schema",
+				zap.String("tenant", schema.TenantID),
+				zap.String("source_id", schema.SourceID),
+				zap.Int("version", schema.Version),
+				zap.Error(err))
+			continue
+		}
+		bySource[ref] = append(versions, compiled)
+		loaded++
+	}
+
+	r.mu.Lock()
+	r.bySource = bySource
+	r.mu.Unlock()
+
+	r.logger.Info("[Schema] Schemas loaded",
+		zap.Int("sources", len(bySource)),
+		zap.Int("versions", loaded))
+	return nil
+}
+
+// Register проверяет и сохраняет следующую версию схемы источника арендатора.
+// Без версии схема регистрируется как следующая по порядку, без арендатора — для арендатора по умолчанию.
+func (r *Registry) Register(ctx context.Context, schema domain.PacketSchema) (*domain.PacketSchema, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	if schema.TenantID == "" {
+		schema.TenantID = domain.DefaultTenantID
+	}
+	ref := sourceRef{schema.TenantID, schema.SourceID}
+	next := len(r.versions(ref)) + 1
+	if schema.Version == 0 {
+		schema.Version = next
+	}
+	if schema.Version != next {
+		return nil, fmt.Errorf("%w: next version of source %q is %d", ErrVersionConflict, schema.SourceID, next)
+	}
+	schema.CreatedAt = time.Now().UTC()
+
+	compiled, err := compile(&schema)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := r.store.SavePacketSchema(ctx, compiled.schema)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, fmt.Errorf("%w: version %d of source %q already exists", ErrVersionConflict, schema.Version, schema.SourceID)
+	}
+
+	r.mu.Lock()
+	r.bySource[ref] = append(r.bySource[ref][:next-1:next-1], compiled)
+	r.mu.Unlock()
+
+	r.logger.Info("[Schema] Schema registered",
+		zap.String("tenant", schema.TenantID),
+		zap.String("source_id", schema.SourceID),
+		zap.Int("version", schema.Version))
+	return copySchema(compiled.schema), nil
+}
+
+// DeleteVersion удаляет текущую версию схемы источника арендатора; предыдущая версия снова становится текущей
+func (r *Registry) DeleteVersion(ctx context.Context, tenantID, sourceID string, version int) (bool, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	ref := sourceRef{tenantID, sourceID}
+	versions := r.versions(ref)
+	if version < 1 || version > len(versions) {
+		return false, nil
+	}
+	if version != len(versions) {
+		return false, fmt.Errorf("%w: only the current version %d of source %q can be deleted", ErrVersionConflict, len(versions), sourceID)
+	}
+
+	if _, err := r.store.DeletePacketSchema(ctx, tenantID, sourceID, version); err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	if version == 1 {
+		delete(r.bySource, ref)
+	} else {
+		r.bySource[ref] = versions[:version-1]
+	}
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// ListSchemas возвращает версии схем источника арендатора, а для пустого sourceID — схемы всех
+// источников арендатора, упорядоченные по источнику и версии
+func (r *Registry) ListSchemas(tenantID, sourceID string) []*domain.PacketSchema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []*domain.PacketSchema
+	for ref, versions := range r.bySource {
+		if ref.tenantID != tenantID || (sourceID != "" && ref.sourceID != sourceID) {
+			continue
+		}
+		for _, compiled := range versions {
+			list = append(list, copySchema(compiled.schema))
+		}
+	}
+	sortSchemas(list)
+	return list
+}
+
+// Apply проверяет пакет по объявленной версии схемы его источника и переводит пакет
+// старой версии в текущую. Пакет без версии проверяется по текущей схеме.
+// Возвращает false, если у источника нет схемы: такой пакет не изменяется.
+func (r *Registry) Apply(packet *domain.DataPacket) (bool, error) {
+	source := sourceKey(packet)
+	versions := r.versions(sourceRef{packet.Tenant(), source})
+	if len(versions) == 0 {
+		return false, nil
+	}
+
+	current := len(versions)
+	version := packet.SchemaVersion
+	if version == 0 {
+		version = current
+	}
+	if version < 0 || version > current {
+		return true, &validation.Error{
+			Reason:  validation.ReasonUnknownSchema,
+			Message: fmt.Sprintf("source %q has no schema version %d, current version is %d", source, version, current),
+		}
+	}
+
+	if err := versions[version-1].check(packet); err != nil {
+		return true, err
+	}
+
+	if version < current {
+		packet.Series = maps.Clone(packet.Series)
+		packet.Labels = maps.Clone(packet.Labels)
+		for _, compiled := range versions[version:] {
+			upcast(packet, compiled.schema.Upcast)
+		}
+
+		// Результат перевода должен соответствовать текущей схеме
+		if err := versions[current-1].check(packet); err != nil {
+			return true, &validation.Error{
+				Reason:  validation.ReasonSchemaMismatch,
+				Message: fmt.Sprintf("packet of version %d does not match version %d after upcast: %v", version, current, err),
+			}
+		}
+		metrics.SchemaUpcastedPackets.WithLabelValues(source).Inc()
+	}
+
+	versions[current-1].coerce(packet)
+	packet.SchemaVersion = current
+	return true, nil
+}
+
+func (r *Registry) versions(ref sourceRef) []*compiledSchema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.bySource[ref]
+}
+
+// sortSchemas упорядочивает схемы по арендатору, источнику и версии
+func sortSchemas(list []*domain.PacketSchema) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].TenantID != list[j].TenantID {
+			return list[i].TenantID < list[j].TenantID
+		}
+		if list[i].SourceID != list[j].SourceID {
+			return list[i].SourceID < list[j].SourceID
+		}
+		return list[i].Version < list[j].Version
+	})
+}
+
+// compile проверяет определение схемы и готовит валидатор ограничений
+func compile(schema *domain.PacketSchema) (*compiledSchema, error) {
+	if schema.SourceID == "" || len(schema.SourceID) > maxSourceLength {
+		return nil, fmt.Errorf("%w: source id must be 1 to %d characters", ErrInvalidSchema, maxSourceLength)
+	}
+	if schema.Version < 1 {
+		return nil, fmt.Errorf("%w: version must be positive", ErrInvalidSchema)
+	}
+
+	if len(schema.Fields) > maxFields {
+		return nil, fmt.Errorf("%w: at most %d fields allowed", ErrInvalidSchema, maxFields)
+	}
+	fields := make(map[string]domain.SchemaField, len(schema.Fields))
+	for _, field := range schema.Fields {
+		if !validation.ValidSeriesName(field.Name) {
+			return nil, fmt.Errorf("%w: invalid field name %q", ErrInvalidSchema, field.Name)
+		}
+		if _, exists := fields[field.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate field %q", ErrInvalidSchema, field.Name)
+		}
+		if !validKind(field.Type) {
+			return nil, fmt.Errorf("%w: field %q has unknown type %q", ErrInvalidSchema, field.Name, field.Type)
+		}
+		fields[field.Name] = field
+	}
+
+	if schema.PayloadType != "" {
+		if len(fields) > 0 {
+			return nil, fmt.Errorf("%w: payload_type is only allowed for schemas without fields", ErrInvalidSchema)
+		}
+		if !validKind(schema.PayloadType) {
+			return nil, fmt.Errorf("%w: unknown payload type %q", ErrInvalidSchema, schema.PayloadType)
+		}
+	}
+
+	if len(schema.RequiredLabels) > maxRequiredLabels {
+		return nil, fmt.Errorf("%w: at most %d required labels allowed", ErrInvalidSchema, maxRequiredLabels)
+	}
+	for _, key := range schema.RequiredLabels {
+		if key == "" || len(key) > maxLabelKeyLength {
+			return nil, fmt.Errorf("%w: required label must be 1 to %d characters", ErrInvalidSchema, maxLabelKeyLength)
+		}
+	}
+
+	if err := validateUpcast(schema); err != nil {
+		return nil, err
+	}
+
+	// Пустые серии допускаются: их обрабатывает общая валидация по VALIDATION_EMPTY_PAYLOAD
+	validator, err := validation.NewValidator(validation.Rules{
+		EmptyPayload:     validation.EmptyPayloadStoreNull,
+		MinPayloadLength: schema.Constraints.MinLength,
+		MaxPayloadLength: schema.Constraints.MaxLength,
+		MinValue:         schema.Constraints.MinValue,
+		MaxValue:         schema.Constraints.MaxValue,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+
+	return &compiledSchema{schema: copySchema(schema), fields: fields, validator: validator}, nil
+}
+
+func validateUpcast(schema *domain.PacketSchema) error {
+	u := schema.Upcast
+	if u == nil {
+		return nil
+	}
+	if schema.Version == 1 {
+		return fmt.Errorf("%w: version 1 has no previous version to upcast from", ErrInvalidSchema)
+	}
+
+	if u.PayloadToSeries != "" && !validation.ValidSeriesName(u.PayloadToSeries) {
+		return fmt.Errorf("%w: invalid series name %q in payload_to_series", ErrInvalidSchema, u.PayloadToSeries)
+	}
+	for from, to := range u.RenameSeries {
+		if !validation.ValidSeriesName(from) || !validation.ValidSeriesName(to) {
+			return fmt.Errorf("%w: invalid series rename %q -> %q", ErrInvalidSchema, from, to)
+		}
+	}
+	for from, to := range u.RenameLabels {
+		if from == "" || to == "" {
+			return fmt.Errorf("%w: label rename must have non-empty keys", ErrInvalidSchema)
+		}
+	}
+	for key := range u.DefaultLabels {
+		if key == "" {
+			return fmt.Errorf("%w: default label key is empty", ErrInvalidSchema)
+		}
+	}
+	return nil
+}
+
+// check проверяет пакет по этой версии схемы
+func (c *compiledSchema) check(packet *domain.DataPacket) error {
+	for _, key := range c.schema.RequiredLabels {
+		if packet.Labels[key] == "" {
+			return mismatch("required label %q is missing", key)
+		}
+	}
+
+	if len(c.fields) == 0 {
+		if len(packet.Series) > 0 {
+			return mismatch("schema version %d does not declare series", c.schema.Version)
+		}
+		payload := packet.SeriesValues(domain.DefaultSeries)
+		if c.schema.PayloadType != "" && payload.Len() > 0 && !compatible(c.schema.PayloadType, payload.Kind()) {
+			return mismatch("payload must be %s, got %s", c.schema.PayloadType, payload.Kind())
+		}
+	} else {
+		if len(packet.Series) == 0 {
+			return mismatch("schema version %d requires named series", c.schema.Version)
+		}
+		for name, values := range packet.Series {
+			field, ok := c.fields[name]
+			if !ok {
+				return mismatch("series %q is not declared in schema version %d", name, c.schema.Version)
+			}
+			if values.Len() > 0 && !compatible(field.Type, values.Kind()) {
+				return mismatch("series %q must be %s, got %s", name, field.Type, values.Kind())
+			}
+		}
+		for _, field := range c.schema.Fields {
+			if _, ok := packet.Series[field.Name]; field.Required && !ok {
+				return mismatch("required series %q is missing", field.Name)
+			}
+		}
+	}
+
+	return c.validator.Validate(packet)
+}
+
+// coerce приводит целые значения к типу, объявленному в схеме
+func (c *compiledSchema) coerce(packet *domain.DataPacket) {
+	if len(c.fields) == 0 {
+		if c.schema.PayloadType == "" {
+			return
+		}
+		payload := coercePayload(packet.SeriesValues(domain.DefaultSeries), c.schema.PayloadType)
+		packet.Payload, packet.FloatPayload, packet.DecimalPayload = payload.Payload, payload.FloatPayload, payload.DecimalPayload
+		return
+	}
+
+	for name, values := range packet.Series {
+		if field := c.fields[name]; values.Kind() != field.Type {
+			packet.Series[name] = coercePayload(values, field.Type)
+		}
+	}
+}
+
+func coercePayload(payload domain.SeriesPayload, kind domain.PayloadKind) domain.SeriesPayload {
+	if payload.Kind() != domain.PayloadKindInt || payload.Len() == 0 {
+		return payload
+	}
+
+	switch kind {
+	case domain.PayloadKindFloat:
+		values := make([]float64, len(payload.Payload))
+		for i, value := range payload.Payload {
+			values[i] = float64(value)
+		}
+		return domain.SeriesPayload{FloatPayload: values}
+	case domain.PayloadKindDecimal:
+		values := make([]string, len(payload.Payload))
+		for i, value := range payload.Payload {
+			values[i] = strconv.FormatInt(value, 10)
+		}
+		return domain.SeriesPayload{DecimalPayload: values}
+	default:
+		return payload
+	}
+}
+
+// upcast применяет шаги перевода пакета из предыдущей версии схемы
+func upcast(packet *domain.DataPacket, u *domain.SchemaUpcast) {
+	if u == nil {
+		return
+	}
+
+	if u.PayloadToSeries != "" && len(packet.Series) == 0 {
+		packet.Series = map[string]domain.SeriesPayload{
+			u.PayloadToSeries: packet.SeriesValues(domain.DefaultSeries),
+		}
+		packet.Payload, packet.FloatPayload, packet.DecimalPayload = nil, nil, nil
+	}
+	for from, to := range u.RenameSeries {
+		if values, ok := packet.Series[from]; ok {
+			delete(packet.Series, from)
+			packet.Series[to] = values
+		}
+	}
+	for _, name := range u.DropSeries {
+		delete(packet.Series, name)
+	}
+
+	for from, to := range u.RenameLabels {
+		if value, ok := packet.Labels[from]; ok {
+			delete(packet.Labels, from)
+			if _, exists := packet.Labels[to]; !exists {
+				packet.Labels[to] = value
+			}
+		}
+	}
+	for key, value := range u.DefaultLabels {
+		if _, ok := packet.Labels[key]; !ok {
+			if packet.Labels == nil {
+				packet.Labels = make(map[string]string, len(u.DefaultLabels))
+			}
+			packet.Labels[key] = value
+		}
+	}
+}
+
+func mismatch(format string, args ...any) error {
+	return &validation.Error{Reason: validation.ReasonSchemaMismatch, Message: fmt.Sprintf(format, args...)}
+}
+
+// compatible сообщает, подходит ли пейлоад типа actual под объявленный тип: целые допускаются для любого типа
+func compatible(declared, actual domain.PayloadKind) bool {
+	return declared == actual || actual == domain.PayloadKindInt
+}
+
+func validKind(kind domain.PayloadKind) bool {
+	switch kind {
+	case domain.PayloadKindInt, domain.PayloadKindFloat, domain.PayloadKindDecimal:
+		return true
+	default:
+		return false
+	}
+}
+
+func sourceKey(packet *domain.DataPacket) string {
+	if packet.SourceID == "" {
+		return domain.DefaultSourceID
+	}
+	return packet.SourceID
+}
+
+func copySchema(schema *domain.PacketSchema) *domain.PacketSchema {
+	copied := *schema
+	copied.Fields = append([]domain.SchemaField(nil), schema.Fields...)
+	copied.RequiredLabels = append([]string(nil), schema.RequiredLabels...)
+	if schema.Upcast != nil {
+		upcast := *schema.Upcast
+		copied.Upcast = &upcast
+	}
+	return &copied
+}
@@ -0,0 +1,258 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) ListPacketSchemas(ctx context.Context) ([]*domain.PacketSchema, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.PacketSchema), args.Error(1)
+}
+
+func (m *MockStore) SavePacketSchema(ctx context.Context, schema *domain.PacketSchema) (bool, error) {
+	args := m.Called(ctx, schema)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) DeletePacketSchema(ctx context.Context, tenantID, sourceID string, version int) (bool, error) {
+	args := m.Called(ctx, tenantID, sourceID, version)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockPacketProcessor struct {
+	mock.Mock
+}
+
+func (m *MockPacketProcessor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	args := m.Called(ctx, packet)
+	return args.Error(0)
+}
+
+func newRegistry() (*Registry, *MockStore) {
+	store := new(MockStore)
+	store.On("SavePacketSchema", mock.Anything, mock.Anything).Return(true, nil)
+	logger, _ := zap.NewDevelopment()
+	return NewRegistry(store, logger), store
+}
+
+func register(t *testing.T, registry *Registry, schema domain.PacketSchema) *domain.PacketSchema {
+	saved, err := registry.Register(context.Background(), schema)
+	require.NoError(t, err)
+	return saved
+}
+
+func reason(err error) validation.Reason {
+	var validationErr *validation.Error
+	if errors.As(err, &validationErr) {
+		return validationErr.Reason
+	}
+	return ""
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestRegistry_Register(t *testing.T) {
+	registry, store := newRegistry()
+
+	// Без версии схема регистрируется следующей по порядку
+	saved := register(t, registry, domain.PacketSchema{SourceID: "sensor-1", PayloadType: domain.PayloadKindInt})
+	assert.Equal(t, 1, saved.Version)
+	assert.False(t, saved.CreatedAt.IsZero())
+
+	_, err := registry.Register(context.Background(), domain.PacketSchema{SourceID: "sensor-1", Version: 3})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	saved = register(t, registry, domain.PacketSchema{SourceID: "sensor-1", Version: 2, PayloadType: domain.PayloadKindFloat})
+	assert.Equal(t, 2, saved.Version)
+
+	for _, schema := range []domain.PacketSchema{
+		{SourceID: ""},
+		{SourceID: "sensor-2", Fields: []domain.SchemaField{{Name: "bad name", Type: domain.PayloadKindInt}}},
+		{SourceID: "sensor-2", Fields: []domain.SchemaField{{Name: "a", Type: "text"}}},
+		{SourceID: "sensor-2", Fields: []domain.SchemaField{{Name: "a", Type: "int"}, {Name: "a", Type: "int"}}},
+		{SourceID: "sensor-2", Fields: []domain.SchemaField{{Name: "a", Type: "int"}}, PayloadType: domain.PayloadKindInt},
+		{SourceID: "sensor-2", Constraints: domain.PayloadConstraints{MinValue: floatPtr(5), MaxValue: floatPtr(1)}},
+		{SourceID: "sensor-2", Upcast: &domain.SchemaUpcast{PayloadToSeries: "a"}},
+	} {
+		_, err := registry.Register(context.Background(), schema)
+		assert.ErrorIs(t, err, ErrInvalidSchema, schema)
+	}
+
+	// Хранилище отказало в сохранении уже существующей версии
+	store.ExpectedCalls = nil
+	store.On("SavePacketSchema", mock.Anything, mock.Anything).Return(false, nil)
+	_, err = registry.Register(context.Background(), domain.PacketSchema{SourceID: "sensor-1"})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	// Удалить можно только текущую версию
+	store.On("DeletePacketSchema", mock.Anything, domain.DefaultTenantID, "sensor-1", 2).Return(true, nil)
+	_, err = registry.DeleteVersion(context.Background(), domain.DefaultTenantID, "sensor-1", 1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	found, err := registry.DeleteVersion(context.Background(), domain.DefaultTenantID, "sensor-1", 2)
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = registry.DeleteVersion(context.Background(), domain.DefaultTenantID, "sensor-1", 5)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	list := registry.ListSchemas(domain.DefaultTenantID, "sensor-1")
+	require.Len(t, list, 1)
+	assert.Equal(t, domain.PayloadKindInt, list[0].PayloadType)
+	assert.Equal(t, domain.DefaultTenantID, list[0].TenantID)
+}
+
+func TestRegistry_SchemasAreScopedByTenant(t *testing.T) {
+	registry, _ := newRegistry()
+	register(t, registry, domain.PacketSchema{TenantID: "team-a", SourceID: "sensor-1", PayloadType: domain.PayloadKindInt})
+
+	// Одноимённый источник другого арендатора не проверяется по чужой схеме
+	found, err := registry.Apply(&domain.DataPacket{ID: uuid.New(), TenantID: "team-b", SourceID: "sensor-1", FloatPayload: []float64{1.5}})
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, registry.ListSchemas("team-b", ""))
+
+	found, err = registry.Apply(&domain.DataPacket{ID: uuid.New(), TenantID: "team-a", SourceID: "sensor-1", FloatPayload: []float64{1.5}})
+	assert.True(t, found)
+	assert.Error(t, err)
+
+	// Версии у арендаторов нумеруются независимо
+	saved := register(t, registry, domain.PacketSchema{TenantID: "team-b", SourceID: "sensor-1"})
+	assert.Equal(t, 1, saved.Version)
+}
+
+func TestRegistry_Apply(t *testing.T) {
+	registry, _ := newRegistry()
+	register(t, registry, domain.PacketSchema{
+		SourceID:       "sensor-1",
+		PayloadType:    domain.PayloadKindFloat,
+		RequiredLabels: []string{"site"},
+		Constraints:    domain.PayloadConstraints{MaxLength: 3},
+	})
+
+	packet := &domain.DataPacket{ID: uuid.New(), SourceID: "sensor-1", Labels: map[string]string{"site": "a"}, Payload: []int64{1, 2}}
+	found, err := registry.Apply(packet)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, packet.SchemaVersion)
+	// Целые значения приводятся к объявленному типу
+	assert.Equal(t, []float64{1, 2}, packet.FloatPayload)
+	assert.Nil(t, packet.Payload)
+
+	_, err = registry.Apply(&domain.DataPacket{ID: uuid.New(), SourceID: "sensor-1", Payload: []int64{1}})
+	assert.Equal(t, validation.ReasonSchemaMismatch, reason(err))
+
+	_, err = registry.Apply(&domain.DataPacket{ID: uuid.New(), SourceID: "sensor-1", Labels: map[string]string{"site": "a"}, DecimalPayload: []string{"1.5"}})
+	assert.Equal(t, validation.ReasonSchemaMismatch, reason(err))
+
+	_, err = registry.Apply(&domain.DataPacket{ID: uuid.New(), SourceID: "sensor-1", Labels: map[string]string{"site": "a"}, Payload: []int64{1, 2, 3, 4}})
+	assert.Equal(t, validation.ReasonPayloadTooLong, reason(err))
+
+	_, err = registry.Apply(&domain.DataPacket{ID: uuid.New(), SourceID: "sensor-1", SchemaVersion: 2, Payload: []int64{1}})
+	assert.Equal(t, validation.ReasonUnknownSchema, reason(err))
+
+	// Источник без схемы не проверяется
+	found, err = registry.Apply(&domain.DataPacket{ID: uuid.New(), SourceID: "sensor-2", Payload: []int64{1}})
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestRegistry_ApplyUpcast(t *testing.T) {
+	registry, _ := newRegistry()
+	register(t, registry, domain.PacketSchema{SourceID: "meter", PayloadType: domain.PayloadKindInt})
+	register(t, registry, domain.PacketSchema{
+		SourceID: "meter",
+		Fields:   []domain.SchemaField{{Name: "temp", Type: domain.PayloadKindFloat, Required: true}},
+		Upcast:   &domain.SchemaUpcast{PayloadToSeries: "temp", RenameLabels: map[string]string{"loc": "site"}},
+	})
+	register(t, registry, domain.PacketSchema{
+		SourceID:       "meter",
+		Fields:         []domain.SchemaField{{Name: "temperature", Type: domain.PayloadKindFloat, Required: true}},
+		RequiredLabels: []string{"site", "unit"},
+		Upcast: &domain.SchemaUpcast{
+			RenameSeries:  map[string]string{"temp": "temperature"},
+			DefaultLabels: map[string]string{"unit": "celsius"},
+		},
+	})
+
+	labels := map[string]string{"loc": "north"}
+	packet := &domain.DataPacket{ID: uuid.New(), SourceID: "meter", SchemaVersion: 1, Labels: labels, Payload: []int64{20, 21}}
+	found, err := registry.Apply(packet)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 3, packet.SchemaVersion)
+	assert.Nil(t, packet.Payload)
+	assert.Equal(t, map[string]domain.SeriesPayload{"temperature": {FloatPayload: []float64{20, 21}}}, packet.Series)
+	assert.Equal(t, map[string]string{"site": "north", "unit": "celsius"}, packet.Labels)
+	// Метки клиента не изменяются на месте
+	assert.Equal(t, map[string]string{"loc": "north"}, labels)
+
+	// Пакет старой версии проверяется по своей схеме
+	_, err = registry.Apply(&domain.DataPacket{ID: uuid.New(), SourceID: "meter", SchemaVersion: 1, FloatPayload: []float64{1.5}})
+	assert.Equal(t, validation.ReasonSchemaMismatch, reason(err))
+
+	// После перевода не хватает метки site, обязательной в текущей версии
+	_, err = registry.Apply(&domain.DataPacket{ID: uuid.New(), SourceID: "meter", SchemaVersion: 1, Payload: []int64{1}})
+	assert.Equal(t, validation.ReasonSchemaMismatch, reason(err))
+	assert.Contains(t, err.Error(), "after upcast")
+}
+
+func TestRegistry_LoadSkipsGap(t *testing.T) {
+	store := new(MockStore)
+	store.On("ListPacketSchemas", mock.Anything).Return([]*domain.PacketSchema{
+		{TenantID: domain.DefaultTenantID, SourceID: "a", Version: 3},
+		{TenantID: domain.DefaultTenantID, SourceID: "a", Version: 1},
+		{TenantID: domain.DefaultTenantID, SourceID: "b", Version: 1, PayloadType: "text"},
+		{TenantID: domain.DefaultTenantID, SourceID: "b", Version: 2},
+	}, nil)
+	logger, _ := zap.NewDevelopment()
+	registry := NewRegistry(store, logger)
+
+	require.NoError(t, registry.Load(context.Background()))
+
+	list := registry.ListSchemas(domain.DefaultTenantID, "")
+	require.Len(t, list, 1)
+	assert.Equal(t, "a", list[0].SourceID)
+	assert.Equal(t, 1, list[0].Version)
+}
+
+func TestProcessor(t *testing.T) {
+	registry, _ := newRegistry()
+	register(t, registry, domain.PacketSchema{SourceID: "sensor-1", PayloadType: domain.PayloadKindInt})
+
+	next := new(MockPacketProcessor)
+	next.On("ProcessPacket", mock.Anything, mock.Anything).Return(nil)
+	logger, _ := zap.NewDevelopment()
+
+	optional := NewProcessor(next, registry, false, logger)
+	require.NoError(t, optional.ProcessPacket(context.Background(), &domain.DataPacket{ID: uuid.New(), SourceID: "sensor-2", Payload: []int64{1}}))
+
+	required := NewProcessor(next, registry, true, logger)
+	err := required.ProcessPacket(context.Background(), &domain.DataPacket{ID: uuid.New(), SourceID: "sensor-2", Payload: []int64{1}})
+	assert.Equal(t, validation.ReasonUnknownSchema, reason(err))
+
+	err = required.ProcessPacket(context.Background(), &domain.DataPacket{ID: uuid.New(), SourceID: "sensor-1", FloatPayload: []float64{1.5}})
+	assert.Equal(t, validation.ReasonSchemaMismatch, reason(err))
+
+	require.NoError(t, required.ProcessPacket(context.Background(), &domain.DataPacket{ID: uuid.New(), SourceID: "sensor-1", Payload: []int64{1}}))
+	next.AssertNumberOfCalls(t, "ProcessPacket", 2)
+}
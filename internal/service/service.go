@@ -2,25 +2,65 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"time"
 
 	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+	"github.com/CoolE88/data-aggregation-service/internal/sketch"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+// Repository хранилище результатов. Каждый запрос на чтение ограничен арендатором tenantID,
+// результат сохраняется под data.TenantID.
 type Repository interface {
-	SaveProcessedData(ctx context.Context, data *domain.ProcessedData) error
-	GetMaxValueByPacketID(ctx context.Context, packetID uuid.UUID) (*domain.ProcessedData, error)
-	GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time) ([]*domain.ProcessedData, error)
+	// SaveProcessedData атомарно сохраняет результаты всех серий одного пакета
+	SaveProcessedData(ctx context.Context, results []*domain.ProcessedData) error
+	GetMaxValueByPacketID(ctx context.Context, tenantID string, packetID uuid.UUID, series string) (*domain.ProcessedData, error)
+	// GetMaxValuesByTimeRange возвращает не больше limit результатов в порядке (время на оси фильтра, packet_id, серия) после after
+	GetMaxValuesByTimeRange(ctx context.Context, tenantID string, start, end time.Time, filter domain.PacketFilter, after *domain.PageCursor, limit int) ([]*domain.ProcessedData, error)
+	// StreamMaxValuesByTimeRange передаёт fn результаты за период в том же порядке по мере чтения из базы;
+	// ошибка fn останавливает чтение и возвращается как есть
+	StreamMaxValuesByTimeRange(ctx context.Context, tenantID string, start, end time.Time, filter domain.PacketFilter, fn func(*domain.ProcessedData) error) error
+	GetTopK(ctx context.Context, tenantID string, start, end time.Time, k int, order domain.TopKOrder, filter domain.PacketFilter) ([]*domain.ProcessedData, error)
+	GetRollups(ctx context.Context, tenantID, series string, resolution domain.RollupResolution, start, end time.Time, step time.Duration) ([]*domain.RollupBucket, error)
+	GetRollupSketches(ctx context.Context, tenantID, series string, resolution domain.RollupResolution, start, end time.Time) ([]*domain.RollupSketch, error)
+	GetRawPacket(ctx context.Context, tenantID string, packetID uuid.UUID) (*domain.RawPacket, error)
 	HealthCheck(ctx context.Context) error
 }
 
+// ProcessedObserver получает каждый успешно сохранённый результат обработки пакета.
+// Для пакета с именованными сериями вызывается по разу на серию (data.Series).
+type ProcessedObserver interface {
+	OnProcessed(ctx context.Context, packet *domain.DataPacket, data *domain.ProcessedData)
+}
+
+// ProcessedEnricher дополняет результат обработки серии пакета перед сохранением
+type ProcessedEnricher interface {
+	Enrich(ctx context.Context, packet *domain.DataPacket, data *domain.ProcessedData)
+}
+
+// DedupFilter быстрая проверка повторно присланных пакетов до обработки.
+// Идентификаторы пакетов уникальны в пределах арендатора.
+// Окончательно дубликаты отсекает репозиторий, возвращая domain.ErrDuplicatePacket.
+type DedupFilter interface {
+	Reserve(tenantID string, packetID uuid.UUID) bool
+	Forget(tenantID string, packetID uuid.UUID)
+}
+
 type DataService struct {
-	repo   Repository
-	logger *zap.Logger
+	repo      Repository
+	logger    *zap.Logger
+	dedup     DedupFilter
+	enrichers []ProcessedEnricher
+	observers []ProcessedObserver
 }
 
 func (s *DataService) CheckDBConnection(ctx context.Context) error {
@@ -34,7 +74,24 @@ func NewDataService(repo Repository, logger *zap.Logger) *DataService {
 	}
 }
 
-// ProcessPacket находит максимальное число из пакетного пейлода
+// AddObserver регистрирует наблюдателя обработанных пакетов. Вызывать до запуска агрегатора.
+func (s *DataService) AddObserver(observer ProcessedObserver) {
+	s.observers = append(s.observers, observer)
+}
+
+// AddEnricher регистрирует стадию, дополняющую результат перед сохранением. Вызывать до запуска агрегатора.
+func (s *DataService) AddEnricher(enricher ProcessedEnricher) {
+	s.enrichers = append(s.enrichers, enricher)
+}
+
+// SetDedupFilter подключает фильтр повторных пакетов. Вызывать до запуска агрегатора.
+func (s *DataService) SetDedupFilter(filter DedupFilter) {
+	s.dedup = filter
+}
+
+// ProcessPacket находит максимальное число из пакетного пейлода, для пакета
+// с именованными сериями — отдельно по каждой серии.
+// Повторно присланный пакет пропускается без ошибки: стадии и наблюдатели его не видят.
 func (s *DataService) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
 	if err := ctx.Err(); err != nil {
 		s.logger.Warn("[DataService] Processing cancelled by context",
@@ -42,30 +99,133 @@ func (s *DataService) ProcessPacket(ctx context.Context, packet *domain.DataPack
 		return ctx.Err()
 	}
 
-	maxValue := s.FindMaxValue(packet.Payload)
+	tenantID := packet.Tenant()
+	if s.dedup != nil && !s.dedup.Reserve(tenantID, packet.ID) {
+		metrics.DuplicatePackets.WithLabelValues("memory", tenantID).Inc()
+		s.logger.Debug("[DataService] Duplicate packet skipped",
+			zap.String("packet_id", packet.ID.String()))
+		return nil
+	}
+
+	createdAt := time.Now().UTC() // время обработки в UTC, общее для всех серий пакета
+	receivedAt := packet.ReceivedAt
+	if receivedAt.IsZero() {
+		receivedAt = createdAt
+	}
+	var clampedFrom *time.Time
+	if !packet.ClampedFrom.IsZero() {
+		clampedFrom = &packet.ClampedFrom
+	}
+	names := packet.SeriesNames()
+	results := make([]*domain.ProcessedData, 0, len(names))
+	for _, name := range names {
+		values := packet.SeriesValues(name)
+		processedData := &domain.ProcessedData{
+			PacketID:        packet.ID,
+			TenantID:        tenantID,
+			PacketCreatedAt: packet.Timestamp, // timestamp из пакета
+			ReceivedAt:      receivedAt,
+			ClampedFrom:     clampedFrom,
+			CreatedAt:       createdAt,
+			SourceID:        packet.SourceID,
+			Series:          name,
+			ValueKind:       values.Kind(),
+			Labels:          packet.Labels,
+		}
 
-	processedData := &domain.ProcessedData{
-		PacketID:        packet.ID,
-		PacketCreatedAt: packet.Timestamp, // timestamp из пакета
-		CreatedAt:       time.Now().UTC(), // время обработки в UTC
-		MaxValue:        maxValue,
+		if values.Len() == 0 {
+			// Пустой пакет не является показанием 0 — сохраняем его без максимума
+			processedData.EmptyPayload = true
+		} else if err := s.aggregatePayload(values, processedData); err != nil {
+			s.forget(tenantID, packet.ID)
+			var validationErr *validation.Error
+			if errors.As(err, &validationErr) {
+				metrics.ValidationRejectedPackets.WithLabelValues(string(validationErr.Reason), tenantID).Inc()
+			}
+			s.logger.Warn("[DataService] Invalid packet payload",
+				zap.String("packet_id", packet.ID.String()),
+				zap.String("series", name),
+				zap.Error(err))
+			return err
+		}
+
+		for _, enricher := range s.enrichers {
+			enricher.Enrich(ctx, packet, processedData)
+		}
+		results = append(results, processedData)
 	}
 
-	if err := s.repo.SaveProcessedData(ctx, processedData); err != nil {
+	if err := s.repo.SaveProcessedData(ctx, results); err != nil {
+		if errors.Is(err, domain.ErrDuplicatePacket) {
+			metrics.DuplicatePackets.WithLabelValues("store", tenantID).Inc()
+			s.logger.Debug("[DataService] Duplicate packet skipped",
+				zap.String("packet_id", packet.ID.String()))
+			return nil
+		}
+		s.forget(tenantID, packet.ID)
 		s.logger.Error("[DataService] Failed to save processed data",
 			zap.String("packet_id", packet.ID.String()),
 			zap.Error(err))
 		return err
 	}
 
-	s.logger.Info("[DataService] Packet processed successfully",
+	metrics.TenantPacketsProcessed.WithLabelValues(tenantID).Inc()
+	for _, processedData := range results {
+		for _, observer := range s.observers {
+			observer.OnProcessed(ctx, packet, processedData)
+		}
+	}
+
+	fields := []zap.Field{
 		zap.String("packet_id", packet.ID.String()),
-		zap.Int("max_value", maxValue))
+		zap.String("tenant", tenantID),
+	}
+	if len(results) == 1 {
+		fields = append(fields,
+			zap.String("value_kind", string(results[0].ValueKind)),
+			zap.Int64("max_value", results[0].MaxValue))
+	} else {
+		fields = append(fields, zap.Strings("series", names))
+	}
+	s.logger.Info("[DataService] Packet processed successfully", fields...)
+
+	return nil
+}
 
+// forget снимает отметку фильтра, чтобы повторная отправка несохранённого пакета была обработана
+func (s *DataService) forget(tenantID string, packetID uuid.UUID) {
+	if s.dedup != nil {
+		s.dedup.Forget(tenantID, packetID)
+	}
+}
+
+// aggregatePayload считает максимум пейлоада серии в зависимости от его типа
+func (s *DataService) aggregatePayload(payload domain.SeriesPayload, data *domain.ProcessedData) error {
+	switch data.ValueKind {
+	case domain.PayloadKindFloat:
+		maxValue, err := s.FindMaxFloatValue(payload.FloatPayload)
+		if err != nil {
+			return err
+		}
+		data.MaxValueFloat = &maxValue
+		// Точное значение хранится в MaxValueFloat, выход за int64 только ограничивает целое поле
+		data.MaxValue, _ = domain.RatToInt64(new(big.Rat).SetFloat64(maxValue))
+	case domain.PayloadKindDecimal:
+		maxValue, err := s.FindMaxDecimalValue(payload.DecimalPayload)
+		if err != nil {
+			return err
+		}
+		data.MaxValueDecimal = maxValue
+		if data.MaxValue, _, err = domain.DecimalToInt64(maxValue); err != nil {
+			return err
+		}
+	default:
+		data.MaxValue = s.FindMaxValue(payload.Payload)
+	}
 	return nil
 }
 
-func (s *DataService) FindMaxValue(payload []int) int {
+func (s *DataService) FindMaxValue(payload []int64) int64 {
 	if len(payload) == 0 {
 		return 0
 	}
@@ -79,15 +239,59 @@ func (s *DataService) FindMaxValue(payload []int) int {
 	return max
 }
 
+// FindMaxFloatValue находит максимум дробного пейлоада. NaN и ±Inf не допускаются,
+// так как сравнение с ними не определяет реальный максимум показаний.
+func (s *DataService) FindMaxFloatValue(payload []float64) (float64, error) {
+	if len(payload) == 0 {
+		return 0, nil
+	}
+
+	max := math.Inf(-1)
+	for i, value := range payload {
+		if err := validation.CheckFinite(value, i); err != nil {
+			return 0, err
+		}
+		if value > max {
+			max = value
+		}
+	}
+	return max, nil
+}
+
+// FindMaxDecimalValue находит максимум десятичного пейлоада без потери точности
+// и возвращает его в исходной записи
+func (s *DataService) FindMaxDecimalValue(payload []string) (string, error) {
+	var (
+		max     *big.Rat
+		maxText = "0"
+	)
+	for i, text := range payload {
+		value, err := validation.ParseDecimal(text, i)
+		if err != nil {
+			return "", err
+		}
+		if max == nil || value.Cmp(max) > 0 {
+			max, maxText = value, text
+		}
+	}
+	return maxText, nil
+}
+
 // GetMaxValueByPacketID возвращает запись с максимальным значением по заданному packetID.
-// Если запись не найдена, возвращает (nil, nil).
-func (s *DataService) GetMaxValueByPacketID(ctx context.Context, packetID string) (*domain.ProcessedData, error) {
+// series выбирает серию пакета; если она не задана, возвращается безымянная серия или первая по имени.
+// Если запись не найдена или принадлежит другому арендатору, возвращает (nil, nil).
+func (s *DataService) GetMaxValueByPacketID(ctx context.Context, packetID, series string) (*domain.ProcessedData, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	id, err := uuid.Parse(packetID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid packet ID: %w", err) // оборачиваем ошибку
 	}
 
-	data, err := s.repo.GetMaxValueByPacketID(ctx, id)
+	data, err := s.repo.GetMaxValueByPacketID(ctx, tenantID, id, series)
 	if err != nil {
 		s.logger.Error("[DataService] Failed to get max value by packet ID",
 			zap.String("packet_id", packetID),
@@ -98,13 +302,65 @@ func (s *DataService) GetMaxValueByPacketID(ctx context.Context, packetID string
 	return data, nil
 }
 
-// GetMaxValuesByTimeRange возвращает запись с максимальным значением по заданному временному интервалу
-func (s *DataService) GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time) ([]*domain.ProcessedData, error) {
+// GetRawPacket возвращает архивный пейлоад пакета. Если архива нет, возвращает (nil, nil).
+func (s *DataService) GetRawPacket(ctx context.Context, packetID string) (*domain.RawPacket, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(packetID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid packet ID: %w", err)
+	}
+
+	data, err := s.repo.GetRawPacket(ctx, tenantID, id)
+	if err != nil {
+		s.logger.Error("[DataService] Failed to get raw packet",
+			zap.String("packet_id", packetID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// GetMaxValuesByTimeRange возвращает страницу результатов за заданный временной интервал.
+// filter ограничивает выборку источником, лейблами и сериями и задаёт ось времени интервала;
+// результаты упорядочены по той же оси. Размер страницы ограничен domain.MaxPageSize,
+// следующая страница запрашивается курсором NextCursor с теми же параметрами: курсор привязан к
+// интервалу и фильтру и с другими параметрами отклоняется с domain.ErrInvalidCursor.
+func (s *DataService) GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, page domain.PageRequest) (*domain.MaxValuesPage, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	if end.Before(start) {
-		return nil, fmt.Errorf("end time must be after start time")
+		return nil, fmt.Errorf("%w: end time must be after start time", domain.ErrInvalidQuery)
+	}
+	if !filter.TimeAxis.Valid() {
+		return nil, fmt.Errorf("%w: time axis must be %q or %q", domain.ErrInvalidQuery, domain.TimeAxisEvent, domain.TimeAxisProcessing)
+	}
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = domain.DefaultPageSize
+	}
+	if limit > domain.MaxPageSize {
+		limit = domain.MaxPageSize
+	}
+
+	query := domain.PageQueryHash(start, end, filter)
+	var after *domain.PageCursor
+	if page.Cursor != "" {
+		if after, err = domain.DecodePageCursor(page.Cursor, filter.TimeAxis, query); err != nil {
+			return nil, err
+		}
 	}
 
-	data, err := s.repo.GetMaxValuesByTimeRange(ctx, start, end)
+	// Лишняя строка показывает, что за страницей есть продолжение
+	data, err := s.repo.GetMaxValuesByTimeRange(ctx, tenantID, start, end, filter, after, limit+1)
 	if err != nil {
 		s.logger.Error("[DataService] Failed to get max values by time range",
 			zap.Time("start", start),
@@ -113,5 +369,236 @@ func (s *DataService) GetMaxValuesByTimeRange(ctx context.Context, start, end ti
 		return nil, err
 	}
 
+	result := &domain.MaxValuesPage{MaxValues: data}
+	if len(data) > limit {
+		result.MaxValues = data[:limit]
+		result.NextCursor = domain.CursorAfter(data[limit-1], filter.TimeAxis, query).Encode()
+	}
+	if result.MaxValues == nil {
+		result.MaxValues = []*domain.ProcessedData{}
+	}
+
+	return result, nil
+}
+
+// StreamMaxValuesByTimeRange передаёт fn все результаты за период без постраничной разбивки, для выгрузок.
+// fn вызывается по мере чтения строк; ошибка fn или отмена ctx останавливает запрос.
+func (s *DataService) StreamMaxValuesByTimeRange(ctx context.Context, start, end time.Time, filter domain.PacketFilter, fn func(*domain.ProcessedData) error) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	if end.Before(start) {
+		return fmt.Errorf("%w: end time must be after start time", domain.ErrInvalidQuery)
+	}
+	if !filter.TimeAxis.Valid() {
+		return fmt.Errorf("%w: time axis must be %q or %q", domain.ErrInvalidQuery, domain.TimeAxisEvent, domain.TimeAxisProcessing)
+	}
+
+	streamed := 0
+	err = s.repo.StreamMaxValuesByTimeRange(ctx, tenantID, start, end, filter, func(data *domain.ProcessedData) error {
+		streamed++
+		return fn(data)
+	})
+	metrics.StreamedRows.Add(float64(streamed))
+	if err != nil && ctx.Err() == nil {
+		s.logger.Error("[DataService] Failed to stream max values by time range",
+			zap.Time("start", start),
+			zap.Time("end", end),
+			zap.Int("streamed", streamed),
+			zap.Error(err))
+	}
+	return err
+}
+
+// GetTopK возвращает k пакетов с наибольшими (top) или наименьшими (bottom) максимумами за интервал
+// времени обработки. filter ограничивает выборку источником, лейблами и сериями; результаты
+// разных серий сравниваются между собой, поэтому серии стоит выбирать с одной шкалой.
+func (s *DataService) GetTopK(ctx context.Context, start, end time.Time, k int, order domain.TopKOrder, filter domain.PacketFilter) ([]*domain.ProcessedData, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: end time must be after start time", domain.ErrInvalidQuery)
+	}
+	if k < 1 || k > domain.MaxTopK {
+		return nil, fmt.Errorf("%w: k must be in [1, %d]", domain.ErrInvalidQuery, domain.MaxTopK)
+	}
+	if order != domain.TopKOrderTop && order != domain.TopKOrderBottom {
+		return nil, fmt.Errorf("%w: order must be %q or %q", domain.ErrInvalidQuery, domain.TopKOrderTop, domain.TopKOrderBottom)
+	}
+	if !filter.TimeAxis.Valid() {
+		return nil, fmt.Errorf("%w: time axis must be %q or %q", domain.ErrInvalidQuery, domain.TimeAxisEvent, domain.TimeAxisProcessing)
+	}
+
+	data, err := s.repo.GetTopK(ctx, tenantID, start, end, k, order, filter)
+	if err != nil {
+		s.logger.Error("[DataService] Failed to get top-k",
+			zap.Time("start", start),
+			zap.Time("end", end),
+			zap.Int("k", k),
+			zap.String("order", string(order)),
+			zap.Error(err))
+		return nil, err
+	}
+
 	return data, nil
 }
+
+// GetRollups возвращает агрегаты max/min/count/sum серии за интервал с шагом step.
+// Используется самое грубое разрешение роллапа, которое укладывается в интервал и шаг.
+func (s *DataService) GetRollups(ctx context.Context, start, end time.Time, step time.Duration, series string) ([]*domain.RollupBucket, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: end time must be after start time", domain.ErrInvalidQuery)
+	}
+
+	resolution, err := ChooseRollupResolution(start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.repo.GetRollups(ctx, tenantID, series, resolution, start, end, step)
+	if err != nil {
+		s.logger.Error("[DataService] Failed to get rollups",
+			zap.Time("start", start),
+			zap.Time("end", end),
+			zap.Duration("step", step),
+			zap.String("resolution", string(resolution)),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// GetQuantiles оценивает квантили максимумов серии за интервал, объединяя скетчи роллапов.
+// При step == 0 возвращается один бакет на весь интервал, иначе бакеты с шагом step.
+// Ошибка оценки значения ограничена sketch.RelativeAccuracy; границы интервала
+// округляются до бакетов выбранного роллапа.
+func (s *DataService) GetQuantiles(ctx context.Context, start, end time.Time, step time.Duration, quantiles []float64, series string) ([]*domain.QuantileBucket, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !end.After(start) {
+		return nil, fmt.Errorf("%w: end time must be after start time", domain.ErrInvalidQuery)
+	}
+	if len(quantiles) == 0 || len(quantiles) > domain.MaxQuantiles {
+		return nil, fmt.Errorf("%w: between 1 and %d quantiles are required", domain.ErrInvalidQuery, domain.MaxQuantiles)
+	}
+	for _, q := range quantiles {
+		if q < 0 || q > 1 || math.IsNaN(q) {
+			return nil, fmt.Errorf("%w: quantile must be in [0, 1], got %v", domain.ErrInvalidQuery, q)
+		}
+	}
+
+	// Без шага весь интервал — один бакет; квантили берутся из роллапов, самый мелкий из которых минутный
+	single := step == 0
+	if single {
+		step = end.Sub(start)
+		if step < domain.RollupResolutionMinute.Duration() {
+			return nil, fmt.Errorf("%w: range must be at least %s", domain.ErrInvalidQuery, domain.RollupResolutionMinute.Duration())
+		}
+	}
+
+	resolution, err := ChooseRollupResolution(start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.repo.GetRollupSketches(ctx, tenantID, series, resolution, start, end)
+	if err != nil {
+		s.logger.Error("[DataService] Failed to get rollup sketches",
+			zap.Time("start", start),
+			zap.Time("end", end),
+			zap.String("resolution", string(resolution)),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Объединяем скетчи бакетов роллапа в бакеты ответа
+	var (
+		order  []time.Time
+		merged = make(map[time.Time]*sketch.DDSketch)
+	)
+	for _, row := range rows {
+		bucketStart := start
+		if !single {
+			bucketStart = alignToStep(row.BucketStart, step)
+		}
+
+		sk, err := sketch.FromBuckets(row.Buckets)
+		if err != nil {
+			return nil, fmt.Errorf("corrupted sketch in %s rollup at %s: %w", resolution, row.BucketStart, err)
+		}
+
+		if current, ok := merged[bucketStart]; ok {
+			current.Merge(sk)
+			continue
+		}
+		merged[bucketStart] = sk
+		order = append(order, bucketStart)
+	}
+
+	results := make([]*domain.QuantileBucket, 0, len(order))
+	for _, bucketStart := range order {
+		sk := merged[bucketStart]
+		if sk.Count() == 0 {
+			continue
+		}
+
+		bucket := &domain.QuantileBucket{
+			BucketStart: bucketStart,
+			Resolution:  resolution,
+			Count:       sk.Count(),
+			Quantiles:   make([]domain.QuantileValue, len(quantiles)),
+		}
+		for i, q := range quantiles {
+			value, err := sk.Quantile(q)
+			if err != nil {
+				return nil, err
+			}
+			bucket.Quantiles[i] = domain.QuantileValue{Quantile: q, Value: value}
+		}
+		results = append(results, bucket)
+	}
+
+	return results, nil
+}
+
+// alignToStep выравнивает время по шагу от начала эпохи, как группировка в GetRollups
+func alignToStep(t time.Time, step time.Duration) time.Time {
+	stepSeconds := int64(step / time.Second)
+	unix := t.Unix()
+	return time.Unix(unix-unix%stepSeconds, 0).UTC()
+}
+
+// ChooseRollupResolution выбирает самое грубое разрешение, кратное шагу и выровненное по границам интервала.
+// Если границы не выровнены ни по одному разрешению, используется минутный роллап.
+func ChooseRollupResolution(start, end time.Time, step time.Duration) (domain.RollupResolution, error) {
+	if step < domain.RollupResolutionMinute.Duration() {
+		return "", fmt.Errorf("%w: step must be at least %s", domain.ErrInvalidQuery, domain.RollupResolutionMinute.Duration())
+	}
+
+	for _, resolution := range domain.RollupResolutions {
+		d := resolution.Duration()
+		if step%d != 0 {
+			continue
+		}
+		if !start.Equal(start.Truncate(d)) || !end.Equal(end.Truncate(d)) {
+			continue
+		}
+		return resolution, nil
+	}
+
+	return domain.RollupResolutionMinute, nil
+}
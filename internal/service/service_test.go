@@ -2,42 +2,103 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"math"
 	"testing"
 	"time"
 
+	"github.com/CoolE88/data-aggregation-service/internal/anomaly"
 	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+	"github.com/CoolE88/data-aggregation-service/internal/sketch"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
+const testTenant = "team-a"
+
+func tenantCtx() context.Context {
+	return tenant.WithID(context.Background(), testTenant)
+}
+
 type MockRepository struct {
 	mock.Mock
 }
 
-func (m *MockRepository) SaveProcessedData(ctx context.Context, data *domain.ProcessedData) error {
-	args := m.Called(ctx, data)
+func (m *MockRepository) SaveProcessedData(ctx context.Context, results []*domain.ProcessedData) error {
+	args := m.Called(ctx, results)
 	return args.Error(0)
 }
 
-func (m *MockRepository) GetMaxValueByPacketID(ctx context.Context, packetID uuid.UUID) (*domain.ProcessedData, error) {
-	args := m.Called(ctx, packetID)
+func (m *MockRepository) GetMaxValueByPacketID(ctx context.Context, tenantID string, packetID uuid.UUID, series string) (*domain.ProcessedData, error) {
+	args := m.Called(ctx, tenantID, packetID, series)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*domain.ProcessedData), args.Error(1)
 }
 
-func (m *MockRepository) GetMaxValuesByTimeRange(ctx context.Context, start, end time.Time) ([]*domain.ProcessedData, error) {
-	args := m.Called(ctx, start, end)
+func (m *MockRepository) GetMaxValuesByTimeRange(ctx context.Context, tenantID string, start, end time.Time, filter domain.PacketFilter, after *domain.PageCursor, limit int) ([]*domain.ProcessedData, error) {
+	args := m.Called(ctx, tenantID, start, end, filter, after, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.ProcessedData), args.Error(1)
+}
+
+// StreamMaxValuesByTimeRange передаёт fn строки, заданные первым значением Return, и возвращает второе
+func (m *MockRepository) StreamMaxValuesByTimeRange(ctx context.Context, tenantID string, start, end time.Time, filter domain.PacketFilter, fn func(*domain.ProcessedData) error) error {
+	args := m.Called(ctx, tenantID, start, end, filter)
+	if rows, ok := args.Get(0).([]*domain.ProcessedData); ok {
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockRepository) GetTopK(ctx context.Context, tenantID string, start, end time.Time, k int, order domain.TopKOrder, filter domain.PacketFilter) ([]*domain.ProcessedData, error) {
+	args := m.Called(ctx, tenantID, start, end, k, order, filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]*domain.ProcessedData), args.Error(1)
 }
 
+func (m *MockRepository) GetRollups(ctx context.Context, tenantID, series string, resolution domain.RollupResolution, start, end time.Time, step time.Duration) ([]*domain.RollupBucket, error) {
+	args := m.Called(ctx, tenantID, series, resolution, start, end, step)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RollupBucket), args.Error(1)
+}
+
+func (m *MockRepository) GetRollupSketches(ctx context.Context, tenantID, series string, resolution domain.RollupResolution, start, end time.Time) ([]*domain.RollupSketch, error) {
+	args := m.Called(ctx, tenantID, series, resolution, start, end)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RollupSketch), args.Error(1)
+}
+
+func (m *MockRepository) GetRawPacket(ctx context.Context, tenantID string, packetID uuid.UUID) (*domain.RawPacket, error) {
+	args := m.Called(ctx, tenantID, packetID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RawPacket), args.Error(1)
+}
+
 func (m *MockRepository) HealthCheck(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
@@ -54,15 +115,15 @@ func TestDataService_FindMaxValue(t *testing.T) {
 
 	tests := []struct {
 		name     string
-		payload  []int
-		expected int
+		payload  []int64
+		expected int64
 	}{
-		{"positive numbers", []int{1, 5, 3, 9, 2}, 9},
-		{"negative numbers", []int{-1, -5, -3}, -1},
-		{"mixed numbers", []int{-1, 5, 0, -10}, 5},
-		{"single element", []int{42}, 42},
-		{"empty slice", []int{}, 0},
-		{"zeros", []int{0, 0, 0}, 0},
+		{"positive numbers", []int64{1, 5, 3, 9, 2}, 9},
+		{"negative numbers", []int64{-1, -5, -3}, -1},
+		{"mixed numbers", []int64{-1, 5, 0, -10}, 5},
+		{"single element", []int64{42}, 42},
+		{"empty slice", []int64{}, 0},
+		{"zeros", []int64{0, 0, 0}, 0},
 	}
 
 	for _, tt := range tests {
@@ -81,7 +142,7 @@ func TestDataService_ProcessPacket_Success(t *testing.T) {
 	packet := &domain.DataPacket{
 		ID:        uuid.New(),
 		Timestamp: time.Now(),
-		Payload:   []int{1, 5, 3, 9, 2},
+		Payload:   []int64{1, 5, 3, 9, 2},
 	}
 
 	expectedData := &domain.ProcessedData{
@@ -91,12 +152,16 @@ func TestDataService_ProcessPacket_Success(t *testing.T) {
 		CreatedAt:       time.Now(),
 	}
 
-	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("*domain.ProcessedData")).
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).
 		Return(nil).
 		Run(func(args mock.Arguments) {
-			data := args.Get(1).(*domain.ProcessedData)
+			data := args.Get(1).([]*domain.ProcessedData)[0]
 			assert.Equal(t, expectedData.PacketID, data.PacketID)
 			assert.Equal(t, expectedData.MaxValue, data.MaxValue)
+			assert.Equal(t, domain.DefaultTenantID, data.TenantID)
+			// Без времени приёма им считается время обработки
+			assert.Equal(t, data.CreatedAt, data.ReceivedAt)
+			assert.Nil(t, data.ClampedFrom)
 		})
 
 	err := service.ProcessPacket(context.Background(), packet)
@@ -104,6 +169,55 @@ func TestDataService_ProcessPacket_Success(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestDataService_ProcessPacket_ReceivedAndClampedTime(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	receivedAt := time.Date(2025, 9, 18, 12, 0, 0, 0, time.UTC)
+	packet := &domain.DataPacket{
+		ID:          uuid.New(),
+		Timestamp:   receivedAt.Add(5 * time.Minute),
+		ReceivedAt:  receivedAt,
+		ClampedFrom: receivedAt.AddDate(1, 0, 0),
+		Series:      map[string]domain.SeriesPayload{"a": {Payload: []int64{1}}, "b": {Payload: []int64{2}}},
+	}
+
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			for _, data := range args.Get(1).([]*domain.ProcessedData) {
+				assert.Equal(t, packet.Timestamp, data.PacketCreatedAt)
+				assert.Equal(t, receivedAt, data.ReceivedAt)
+				require.NotNil(t, data.ClampedFrom)
+				assert.Equal(t, packet.ClampedFrom, *data.ClampedFrom)
+			}
+		})
+
+	require.NoError(t, service.ProcessPacket(context.Background(), packet))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDataService_RequiresTenant(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+	start, end := time.Now().Add(-time.Hour), time.Now()
+
+	// Без арендатора в контексте запрос не доходит до репозитория
+	_, err := service.GetMaxValueByPacketID(context.Background(), uuid.New().String(), "")
+	assert.ErrorIs(t, err, tenant.ErrUnauthenticated)
+	_, err = service.GetMaxValuesByTimeRange(context.Background(), start, end, domain.PacketFilter{}, domain.PageRequest{})
+	assert.ErrorIs(t, err, tenant.ErrUnauthenticated)
+	_, err = service.GetRollups(context.Background(), start, end, time.Minute, "")
+	assert.ErrorIs(t, err, tenant.ErrUnauthenticated)
+	_, err = service.GetRawPacket(context.Background(), uuid.New().String())
+	assert.ErrorIs(t, err, tenant.ErrUnauthenticated)
+
+	mockRepo.AssertNotCalled(t, "GetMaxValueByPacketID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "GetMaxValuesByTimeRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestDataService_GetMaxValueByPacketID_Success(t *testing.T) {
 	mockRepo := new(MockRepository)
 	logger, _ := zap.NewDevelopment()
@@ -117,10 +231,10 @@ func TestDataService_GetMaxValueByPacketID_Success(t *testing.T) {
 		CreatedAt:       time.Now(),
 	}
 
-	mockRepo.On("GetMaxValueByPacketID", mock.Anything, packetID).
+	mockRepo.On("GetMaxValueByPacketID", mock.Anything, testTenant, packetID, "").
 		Return(expectedData, nil)
 
-	result, err := service.GetMaxValueByPacketID(context.Background(), packetID.String())
+	result, err := service.GetMaxValueByPacketID(tenantCtx(), packetID.String(), "")
 	assert.NoError(t, err)
 	assert.Equal(t, expectedData, result)
 	mockRepo.AssertExpectations(t)
@@ -131,7 +245,7 @@ func TestDataService_GetMaxValueByPacketID_InvalidID(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	service := NewDataService(mockRepo, logger)
 
-	result, err := service.GetMaxValueByPacketID(context.Background(), "invalid-id")
+	result, err := service.GetMaxValueByPacketID(tenantCtx(), "invalid-id", "")
 	assert.Error(t, err)
 	assert.Nil(t, result)
 	assert.Contains(t, err.Error(), "invalid packet ID")
@@ -149,15 +263,95 @@ func TestDataService_GetMaxValuesByTimeRange_Success(t *testing.T) {
 		{PacketID: uuid.New(), PacketCreatedAt: start.Add(45 * time.Minute), MaxValue: 20},
 	}
 
-	mockRepo.On("GetMaxValuesByTimeRange", mock.Anything, start, end).
+	filter := domain.PacketFilter{SourceID: "sensor-1", Labels: map[string]string{"site": "a"}}
+	mockRepo.On("GetMaxValuesByTimeRange", mock.Anything, testTenant, start, end, filter, (*domain.PageCursor)(nil), domain.DefaultPageSize+1).
 		Return(expectedData, nil)
 
-	result, err := service.GetMaxValuesByTimeRange(context.Background(), start, end)
+	result, err := service.GetMaxValuesByTimeRange(tenantCtx(), start, end, filter, domain.PageRequest{})
 	assert.NoError(t, err)
-	assert.Equal(t, expectedData, result)
+	assert.Equal(t, expectedData, result.MaxValues)
+	assert.Empty(t, result.NextCursor)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDataService_GetMaxValuesByTimeRange_Pages(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	rows := []*domain.ProcessedData{
+		{PacketID: uuid.New(), CreatedAt: start.Add(time.Minute), MaxValue: 1},
+		{PacketID: uuid.New(), CreatedAt: start.Add(2 * time.Minute), MaxValue: 2},
+		{PacketID: uuid.New(), CreatedAt: start.Add(3 * time.Minute), MaxValue: 3},
+	}
+
+	// Репозиторий вернул на строку больше страницы — есть следующая страница
+	mockRepo.On("GetMaxValuesByTimeRange", mock.Anything, testTenant, start, end, domain.PacketFilter{}, (*domain.PageCursor)(nil), 3).
+		Return(rows, nil).Once()
+
+	first, err := service.GetMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{}, domain.PageRequest{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, rows[:2], first.MaxValues)
+	assert.NotEmpty(t, first.NextCursor)
+
+	// Следующая страница начинается строго после последней строки первой
+	after := &domain.PageCursor{TimeAxis: domain.TimeAxisProcessing, Time: rows[1].CreatedAt, PacketID: rows[1].PacketID,
+		Query: domain.PageQueryHash(start, end, domain.PacketFilter{})}
+	mockRepo.On("GetMaxValuesByTimeRange", mock.Anything, testTenant, start, end, domain.PacketFilter{}, after, 3).
+		Return(rows[2:], nil).Once()
+
+	second, err := service.GetMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{}, domain.PageRequest{Limit: 2, Cursor: first.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, rows[2:], second.MaxValues)
+	assert.Empty(t, second.NextCursor)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDataService_GetMaxValuesByTimeRange_PageSizeLimit(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	start := time.Now().Add(-time.Hour)
+	end := time.Now()
+	mockRepo.On("GetMaxValuesByTimeRange", mock.Anything, testTenant, start, end, domain.PacketFilter{}, (*domain.PageCursor)(nil), domain.MaxPageSize+1).
+		Return(nil, nil)
+
+	result, err := service.GetMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{}, domain.PageRequest{Limit: domain.MaxPageSize * 10})
+	assert.NoError(t, err)
+	assert.NotNil(t, result.MaxValues)
+	assert.Empty(t, result.MaxValues)
 	mockRepo.AssertExpectations(t)
 }
 
+func TestDataService_GetMaxValuesByTimeRange_InvalidCursor(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	start := time.Now().Add(-time.Hour)
+	end := time.Now()
+
+	_, err := service.GetMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{}, domain.PageRequest{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+
+	// Курсор оси времени обработки нельзя продолжить по времени устройства
+	query := domain.PageQueryHash(start, end, domain.PacketFilter{})
+	cursor := domain.CursorAfter(&domain.ProcessedData{PacketID: uuid.New(), CreatedAt: start}, domain.TimeAxisProcessing, query).Encode()
+	_, err = service.GetMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{TimeAxis: domain.TimeAxisEvent}, domain.PageRequest{Cursor: cursor})
+	assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+
+	// Курсор привязан к интервалу и фильтру запроса, для которого выдан
+	_, err = service.GetMaxValuesByTimeRange(tenantCtx(), start, end.Add(time.Hour), domain.PacketFilter{}, domain.PageRequest{Cursor: cursor})
+	assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+	_, err = service.GetMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{SourceID: "pump"}, domain.PageRequest{Cursor: cursor})
+	assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+
+	mockRepo.AssertNotCalled(t, "GetMaxValuesByTimeRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestDataService_GetMaxValuesByTimeRange_InvalidRange(t *testing.T) {
 	mockRepo := new(MockRepository)
 	logger, _ := zap.NewDevelopment()
@@ -166,8 +360,553 @@ func TestDataService_GetMaxValuesByTimeRange_InvalidRange(t *testing.T) {
 	end := time.Now().Add(-time.Hour)
 	start := time.Now()
 
-	result, err := service.GetMaxValuesByTimeRange(context.Background(), start, end)
-	assert.Error(t, err)
+	result, err := service.GetMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{}, domain.PageRequest{})
+	assert.ErrorIs(t, err, domain.ErrInvalidQuery)
 	assert.Nil(t, result)
 	assert.Contains(t, err.Error(), "end time must be after start time")
 }
+
+func TestDataService_GetMaxValuesByTimeRange_TimeAxis(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	filter := domain.PacketFilter{TimeAxis: domain.TimeAxisEvent}
+	mockRepo.On("GetMaxValuesByTimeRange", mock.Anything, testTenant, start, end, filter, (*domain.PageCursor)(nil), domain.DefaultPageSize+1).
+		Return([]*domain.ProcessedData{{PacketID: uuid.New(), MaxValue: 1}}, nil)
+
+	result, err := service.GetMaxValuesByTimeRange(tenantCtx(), start, end, filter, domain.PageRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, result.MaxValues, 1)
+
+	_, err = service.GetMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{TimeAxis: "ingest"}, domain.PageRequest{})
+	assert.Error(t, err)
+	mockRepo.AssertNumberOfCalls(t, "GetMaxValuesByTimeRange", 1)
+}
+
+func TestDataService_StreamMaxValuesByTimeRange(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	rows := []*domain.ProcessedData{
+		{PacketID: uuid.New(), MaxValue: 1},
+		{PacketID: uuid.New(), MaxValue: 2},
+		{PacketID: uuid.New(), MaxValue: 3},
+	}
+	mockRepo.On("StreamMaxValuesByTimeRange", mock.Anything, testTenant, start, end, domain.PacketFilter{}).Return(rows, nil)
+
+	var got []*domain.ProcessedData
+	err := service.StreamMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{}, func(data *domain.ProcessedData) error {
+		got = append(got, data)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, rows, got)
+
+	// Ошибка обработчика строки останавливает выгрузку и возвращается как есть
+	stop := errors.New("client gone")
+	calls := 0
+	err = service.StreamMaxValuesByTimeRange(tenantCtx(), start, end, domain.PacketFilter{}, func(*domain.ProcessedData) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+
+	err = service.StreamMaxValuesByTimeRange(tenantCtx(), end, start, domain.PacketFilter{}, func(*domain.ProcessedData) error { return nil })
+	assert.Error(t, err)
+	err = service.StreamMaxValuesByTimeRange(context.Background(), start, end, domain.PacketFilter{}, func(*domain.ProcessedData) error { return nil })
+	assert.ErrorIs(t, err, tenant.ErrUnauthenticated)
+	mockRepo.AssertNumberOfCalls(t, "StreamMaxValuesByTimeRange", 2)
+}
+
+func TestChooseRollupResolution(t *testing.T) {
+	day := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		start    time.Time
+		end      time.Time
+		step     time.Duration
+		expected domain.RollupResolution
+	}{
+		{"daily step over aligned days", day, day.AddDate(0, 1, 0), 24 * time.Hour, domain.RollupResolutionDay},
+		{"weekly step over aligned days", day, day.AddDate(0, 3, 0), 7 * 24 * time.Hour, domain.RollupResolutionDay},
+		{"daily step with unaligned start", day.Add(time.Hour), day.AddDate(0, 1, 0), 24 * time.Hour, domain.RollupResolutionHour},
+		{"hourly step", day, day.Add(48 * time.Hour), time.Hour, domain.RollupResolutionHour},
+		{"five minute step", day, day.Add(time.Hour), 5 * time.Minute, domain.RollupResolutionMinute},
+		{"unaligned bounds", day.Add(30 * time.Second), day.Add(time.Hour), time.Hour, domain.RollupResolutionMinute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ChooseRollupResolution(tt.start, tt.end, tt.step)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	_, err := ChooseRollupResolution(day, day.Add(time.Hour), 30*time.Second)
+	assert.Error(t, err)
+}
+
+func TestDataService_GetRollups_Success(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	expectedData := []*domain.RollupBucket{
+		{BucketStart: start, Resolution: domain.RollupResolutionDay, MaxValue: 99, MinValue: 1, Count: 10, Sum: 500},
+	}
+
+	mockRepo.On("GetRollups", mock.Anything, testTenant, "", domain.RollupResolutionDay, start, end, 24*time.Hour).
+		Return(expectedData, nil)
+
+	result, err := service.GetRollups(tenantCtx(), start, end, 24*time.Hour, "")
+	assert.NoError(t, err)
+	assert.Equal(t, expectedData, result)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDataService_GetQuantiles_MergesSketches(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 2)
+
+	// Первый день — значения 1..50, второй — 51..100
+	first, second := sketch.New(), sketch.New()
+	for v := 1; v <= 50; v++ {
+		first.Add(float64(v))
+		second.Add(float64(v + 50))
+	}
+	rows := []*domain.RollupSketch{
+		{BucketStart: start, Buckets: first.Buckets()},
+		{BucketStart: start.AddDate(0, 0, 1), Buckets: second.Buckets()},
+	}
+	mockRepo.On("GetRollupSketches", mock.Anything, testTenant, "cpu", domain.RollupResolutionDay, start, end).Return(rows, nil)
+
+	result, err := service.GetQuantiles(tenantCtx(), start, end, 0, []float64{0.5, 0.99}, "cpu")
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, start, result[0].BucketStart)
+	assert.Equal(t, int64(100), result[0].Count)
+	assert.InEpsilon(t, 50.0, result[0].Quantiles[0].Value, sketch.RelativeAccuracy)
+	assert.InEpsilon(t, 99.0, result[0].Quantiles[1].Value, sketch.RelativeAccuracy)
+
+	result, err = service.GetQuantiles(tenantCtx(), start, end, 24*time.Hour, []float64{0.5}, "cpu")
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	assert.InEpsilon(t, 75.0, result[1].Quantiles[0].Value, sketch.RelativeAccuracy)
+
+	_, err = service.GetQuantiles(tenantCtx(), start, end, 0, nil, "cpu")
+	assert.Error(t, err)
+	_, err = service.GetQuantiles(tenantCtx(), start, end, 0, []float64{1.5}, "cpu")
+	assert.Error(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDataService_GetQuantiles_SingleBucketRangeShorterThanMinute(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	start := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := service.GetQuantiles(tenantCtx(), start, start.Add(30*time.Second), 0, []float64{0.5}, "cpu")
+	require.ErrorIs(t, err, domain.ErrInvalidQuery)
+	assert.Contains(t, err.Error(), "range must be at least 1m0s")
+
+	// Минутный интервал без шага — один бакет по минутным роллапам
+	mockRepo.On("GetRollupSketches", mock.Anything, testTenant, "cpu", domain.RollupResolutionMinute, start, start.Add(time.Minute)).
+		Return([]*domain.RollupSketch{}, nil)
+	_, err = service.GetQuantiles(tenantCtx(), start, start.Add(time.Minute), 0, []float64{0.5}, "cpu")
+	require.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+type recordingObserver struct {
+	processed []*domain.ProcessedData
+}
+
+func (o *recordingObserver) OnProcessed(_ context.Context, _ *domain.DataPacket, data *domain.ProcessedData) {
+	o.processed = append(o.processed, data)
+}
+
+func TestDataService_ProcessPacket_NotifiesObservers(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+	observer := &recordingObserver{}
+	service.AddObserver(observer)
+
+	packet := &domain.DataPacket{ID: uuid.New(), Timestamp: time.Now(), Payload: []int64{4, 8}}
+
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).Return(nil)
+
+	err := service.ProcessPacket(context.Background(), packet)
+	assert.NoError(t, err)
+	assert.Len(t, observer.processed, 1)
+	assert.Equal(t, int64(8), observer.processed[0].MaxValue)
+}
+
+func TestDataService_ProcessPacket_NamedSeries(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+	observer := &recordingObserver{}
+	service.AddObserver(observer)
+
+	packet := &domain.DataPacket{
+		ID:        uuid.New(),
+		Timestamp: time.Now(),
+		Series: map[string]domain.SeriesPayload{
+			"mem": {FloatPayload: []float64{0.5, 0.75}},
+			"cpu": {Payload: []int64{3, 9, 4}},
+			"io":  {},
+		},
+	}
+
+	var saved []*domain.ProcessedData
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			saved = args.Get(1).([]*domain.ProcessedData)
+		})
+
+	assert.NoError(t, service.ProcessPacket(context.Background(), packet))
+
+	// Все серии сохраняются одним вызовом, по строке на серию в порядке имён
+	mockRepo.AssertNumberOfCalls(t, "SaveProcessedData", 1)
+	if assert.Len(t, saved, 3) {
+		assert.Equal(t, "cpu", saved[0].Series)
+		assert.Equal(t, int64(9), saved[0].MaxValue)
+		assert.Equal(t, "io", saved[1].Series)
+		assert.True(t, saved[1].EmptyPayload)
+		assert.Equal(t, "mem", saved[2].Series)
+		assert.Equal(t, domain.PayloadKindFloat, saved[2].ValueKind)
+		assert.Equal(t, 0.75, *saved[2].MaxValueFloat)
+		for _, data := range saved {
+			assert.Equal(t, packet.ID, data.PacketID)
+			assert.Equal(t, saved[0].CreatedAt, data.CreatedAt)
+		}
+	}
+	assert.Equal(t, saved, observer.processed)
+}
+
+type recordingDedup struct {
+	reserved  map[uuid.UUID]bool
+	forgotten []uuid.UUID
+}
+
+func (d *recordingDedup) Reserve(_ string, id uuid.UUID) bool {
+	if d.reserved[id] {
+		return false
+	}
+	d.reserved[id] = true
+	return true
+}
+
+func (d *recordingDedup) Forget(_ string, id uuid.UUID) {
+	delete(d.reserved, id)
+	d.forgotten = append(d.forgotten, id)
+}
+
+func TestDataService_ProcessPacket_SkipsDuplicates(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+	filter := &recordingDedup{reserved: make(map[uuid.UUID]bool)}
+	service.SetDedupFilter(filter)
+	observer := &recordingObserver{}
+	service.AddObserver(observer)
+
+	packet := &domain.DataPacket{ID: uuid.New(), Timestamp: time.Now(), Payload: []int64{1, 2}}
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).Return(nil).Once()
+
+	require.NoError(t, service.ProcessPacket(context.Background(), packet))
+	// Повтор отсекается фильтром и не доходит до репозитория
+	require.NoError(t, service.ProcessPacket(context.Background(), packet))
+	mockRepo.AssertNumberOfCalls(t, "SaveProcessedData", 1)
+
+	// Повтор, который фильтр уже не помнит, отсекается репозиторием без вызова наблюдателей
+	resent := &domain.DataPacket{ID: uuid.New(), Timestamp: time.Now(), Payload: []int64{3}}
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).Return(domain.ErrDuplicatePacket).Once()
+	require.NoError(t, service.ProcessPacket(context.Background(), resent))
+	assert.Len(t, observer.processed, 1)
+	assert.Empty(t, filter.forgotten)
+
+	// Несохранённый пакет снимается с фильтра, чтобы повторная отправка была обработана
+	failed := &domain.DataPacket{ID: uuid.New(), Timestamp: time.Now(), Payload: []int64{4}}
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).Return(errors.New("db down")).Once()
+	assert.Error(t, service.ProcessPacket(context.Background(), failed))
+	assert.Equal(t, []uuid.UUID{failed.ID}, filter.forgotten)
+}
+
+func TestDataService_GetTopK(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	start := time.Now().Add(-24 * time.Hour)
+	end := time.Now()
+	filter := domain.PacketFilter{Labels: map[string]string{"region": "eu"}, Series: []string{"cpu"}}
+	expected := []*domain.ProcessedData{{PacketID: uuid.New(), MaxValue: 100}, {PacketID: uuid.New(), MaxValue: 90}}
+
+	mockRepo.On("GetTopK", mock.Anything, testTenant, start, end, 20, domain.TopKOrderTop, filter).Return(expected, nil)
+
+	result, err := service.GetTopK(tenantCtx(), start, end, 20, domain.TopKOrderTop, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	_, err = service.GetTopK(tenantCtx(), start, end, 0, domain.TopKOrderTop, domain.PacketFilter{})
+	assert.Error(t, err)
+	_, err = service.GetTopK(tenantCtx(), start, end, domain.MaxTopK+1, domain.TopKOrderBottom, domain.PacketFilter{})
+	assert.Error(t, err)
+	_, err = service.GetTopK(tenantCtx(), start, end, 5, "middle", domain.PacketFilter{})
+	assert.Error(t, err)
+
+	mockRepo.AssertNumberOfCalls(t, "GetTopK", 1)
+}
+
+type scoringEnricher struct{}
+
+func (scoringEnricher) Enrich(_ context.Context, _ *domain.DataPacket, data *domain.ProcessedData) {
+	score := 4.5
+	data.AnomalyScore = &score
+	data.Anomalous = true
+}
+
+func TestDataService_ProcessPacket_EnrichesBeforeSave(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+	service.AddEnricher(scoringEnricher{})
+
+	packet := &domain.DataPacket{ID: uuid.New(), Timestamp: time.Now(), Payload: []int64{4, 8}}
+
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.MatchedBy(func(results []*domain.ProcessedData) bool {
+		data := results[0]
+		return data.Anomalous && data.AnomalyScore != nil && *data.AnomalyScore == 4.5
+	})).Return(nil)
+
+	assert.NoError(t, service.ProcessPacket(context.Background(), packet))
+	mockRepo.AssertExpectations(t)
+}
+
+// anomalyStateStore хранилище детектора аномалий, запоминающее последний снапшот состояния
+type anomalyStateStore struct {
+	states map[string][]byte
+}
+
+func (s *anomalyStateStore) ListAnomalyParams(context.Context) ([]*domain.AnomalyParams, error) {
+	return nil, nil
+}
+func (s *anomalyStateStore) SaveAnomalyParams(context.Context, *domain.AnomalyParams) error {
+	return nil
+}
+func (s *anomalyStateStore) DeleteAnomalyParams(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+func (s *anomalyStateStore) LoadAnomalyStates(context.Context) (map[string][]byte, error) {
+	return s.states, nil
+}
+func (s *anomalyStateStore) SaveAnomalyStates(_ context.Context, states map[string][]byte) error {
+	s.states = states
+	return nil
+}
+
+func TestDataService_ProcessPacket_AnomalyStateOnlyForSavedPackets(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	store := &anomalyStateStore{}
+	detector, err := anomaly.NewDetector(store, nil, domain.AnomalyParams{
+		Method: domain.AnomalyMethodEWMA, Alpha: 0.2, Threshold: 3, WarmUp: 5, WindowSize: 20,
+	}, logger)
+	require.NoError(t, err)
+	service.AddEnricher(detector)
+	service.AddObserver(detector)
+
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.Anything).Return(nil).Twice()
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.Anything).Return(domain.ErrDuplicatePacket).Once()
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.Anything).Return(errors.New("connection refused")).Once()
+
+	packet := func() *domain.DataPacket {
+		return &domain.DataPacket{ID: uuid.New(), SourceID: "sensor-1", Timestamp: time.Now(), Payload: []int64{10}}
+	}
+	assert.NoError(t, service.ProcessPacket(context.Background(), packet()))
+	assert.NoError(t, service.ProcessPacket(context.Background(), packet()))
+	assert.NoError(t, service.ProcessPacket(context.Background(), packet()), "duplicate is skipped without error")
+	assert.Error(t, service.ProcessPacket(context.Background(), packet()))
+
+	// В статистику попали только два сохранённых пакета
+	require.NoError(t, detector.Checkpoint(context.Background()))
+	var state struct {
+		Count int64 `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal(store.states["sensor-1"], &state))
+	assert.Equal(t, int64(2), state.Count)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDataService_FindMaxFloatValue(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	service := &DataService{logger: logger}
+
+	result, err := service.FindMaxFloatValue([]float64{1.5, -2.25, 3.75, 0})
+	assert.NoError(t, err)
+	assert.Equal(t, 3.75, result)
+
+	result, err = service.FindMaxFloatValue([]float64{-1.5, -0.5})
+	assert.NoError(t, err)
+	assert.Equal(t, -0.5, result)
+
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, err = service.FindMaxFloatValue([]float64{1, value})
+		assert.ErrorIs(t, err, validation.ErrNonFiniteValue)
+	}
+}
+
+func TestDataService_FindMaxDecimalValue(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	service := &DataService{logger: logger}
+
+	result, err := service.FindMaxDecimalValue([]string{"10.10", "10.099999999999999999", "-3"})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.10", result)
+
+	_, err = service.FindMaxDecimalValue([]string{"1.0", "abc"})
+	assert.ErrorIs(t, err, validation.ErrInvalidDecimal)
+
+	_, err = service.FindMaxDecimalValue([]string{"1/3"})
+	assert.ErrorIs(t, err, validation.ErrInvalidDecimal)
+}
+
+func TestDataService_ProcessPacket_FloatPayload(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	packet := &domain.DataPacket{
+		ID:           uuid.New(),
+		Timestamp:    time.Now(),
+		FloatPayload: []float64{20.5, 21.75, 19.1},
+	}
+
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			data := args.Get(1).([]*domain.ProcessedData)[0]
+			assert.Equal(t, domain.PayloadKindFloat, data.ValueKind)
+			assert.Equal(t, 21.75, *data.MaxValueFloat)
+			assert.Equal(t, int64(22), data.MaxValue)
+		})
+
+	err := service.ProcessPacket(context.Background(), packet)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDataService_ProcessPacket_NonFiniteRejected(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	packet := &domain.DataPacket{
+		ID:           uuid.New(),
+		Timestamp:    time.Now(),
+		FloatPayload: []float64{1, math.NaN()},
+	}
+
+	rejected := testutil.ToFloat64(metrics.ValidationRejectedPackets.WithLabelValues(string(validation.ReasonNonFiniteValue), domain.DefaultTenantID))
+	err := service.ProcessPacket(context.Background(), packet)
+	var validationErr *validation.Error
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Equal(t, validation.ReasonNonFiniteValue, validationErr.Reason)
+	}
+	assert.Equal(t, rejected+1, testutil.ToFloat64(metrics.ValidationRejectedPackets.WithLabelValues(string(validation.ReasonNonFiniteValue), domain.DefaultTenantID)))
+	mockRepo.AssertNotCalled(t, "SaveProcessedData", mock.Anything, mock.Anything)
+}
+
+func TestDataService_ProcessPacket_ValuesOutOfInt64Range(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	var saved []*domain.ProcessedData
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			saved = append(saved, args.Get(1).([]*domain.ProcessedData)...)
+		})
+
+	err := service.ProcessPacket(context.Background(), &domain.DataPacket{
+		ID:           uuid.New(),
+		Timestamp:    time.Now(),
+		FloatPayload: []float64{1, 1e19},
+	})
+	assert.NoError(t, err)
+
+	err = service.ProcessPacket(context.Background(), &domain.DataPacket{
+		ID:             uuid.New(),
+		Timestamp:      time.Now(),
+		DecimalPayload: []string{"-99999999999999999999.5", "-99999999999999999999.75"},
+	})
+	assert.NoError(t, err)
+
+	// Точное значение сохраняется, а целое поле ограничивается диапазоном int64
+	assert.Len(t, saved, 2)
+	assert.Equal(t, 1e19, *saved[0].MaxValueFloat)
+	assert.Equal(t, "10000000000000000000", saved[0].ExactDecimal())
+	assert.Equal(t, int64(math.MaxInt64), saved[0].MaxValue)
+	assert.Equal(t, "-99999999999999999999.5", saved[1].MaxValueDecimal)
+	assert.Equal(t, int64(math.MinInt64), saved[1].MaxValue)
+}
+
+func TestDataService_ProcessPacket_EmptyPayloadStoredWithoutMax(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	packet := &domain.DataPacket{ID: uuid.New(), Timestamp: time.Now()}
+
+	mockRepo.On("SaveProcessedData", mock.Anything, mock.AnythingOfType("[]*domain.ProcessedData")).
+		Return(nil).
+		Run(func(args mock.Arguments) {
+			data := args.Get(1).([]*domain.ProcessedData)[0]
+			assert.True(t, data.EmptyPayload)
+		})
+
+	err := service.ProcessPacket(context.Background(), packet)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDataService_GetRawPacket(t *testing.T) {
+	mockRepo := new(MockRepository)
+	logger, _ := zap.NewDevelopment()
+	service := NewDataService(mockRepo, logger)
+
+	packetID := uuid.New()
+	expected := &domain.RawPacket{PacketID: packetID, PayloadKind: domain.PayloadKindInt, Payload: []int64{1, 2}}
+	mockRepo.On("GetRawPacket", mock.Anything, testTenant, packetID).Return(expected, nil)
+
+	result, err := service.GetRawPacket(tenantCtx(), packetID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	_, err = service.GetRawPacket(tenantCtx(), "invalid-id")
+	assert.Error(t, err)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,81 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// canonicalPacket подписываемые поля пакета в фиксированном порядке
+type canonicalPacket struct {
+	ID             uuid.UUID                       `json:"id"`
+	SourceID       string                          `json:"source_id,omitempty"`
+	Timestamp      string                          `json:"timestamp"`
+	SchemaVersion  int                             `json:"schema_version,omitempty"`
+	Labels         map[string]string               `json:"labels,omitempty"`
+	Payload        []int64                         `json:"payload,omitempty"`
+	FloatPayload   []float64                       `json:"float_payload,omitempty"`
+	DecimalPayload []string                        `json:"decimal_payload,omitempty"`
+	Series         map[string]domain.SeriesPayload `json:"series,omitempty"`
+}
+
+// Canonical возвращает каноническое представление пакета, которое подписывает источник:
+// компактный JSON с полями в порядке id, source_id, timestamp, schema_version, labels,
+// payload, float_payload, decimal_payload, series без пустых полей, ключи лейблов и серий
+// по алфавиту, время в UTC в формате RFC 3339 с наносекундами без завершающих нулей.
+// Целые значения попадают в payload, а пейлоад с дробными значениями — в float_payload.
+// Подпись и арендатор в представление не входят.
+func Canonical(packet *domain.DataPacket) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	err := encoder.Encode(canonicalPacket{
+		ID:             packet.ID,
+		SourceID:       packet.SourceID,
+		Timestamp:      packet.Timestamp.UTC().Format(time.RFC3339Nano),
+		SchemaVersion:  packet.SchemaVersion,
+		Labels:         packet.Labels,
+		Payload:        packet.Payload,
+		FloatPayload:   packet.FloatPayload,
+		DecimalPayload: packet.DecimalPayload,
+		Series:         packet.Series,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// SignHMAC подписывает пакет общим секретом источника
+func SignHMAC(packet *domain.DataPacket, keyID string, secret []byte) error {
+	message, err := Canonical(packet)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(message)
+	packet.Signature = &domain.PacketSignature{KeyID: keyID, Value: base64.StdEncoding.EncodeToString(mac.Sum(nil))}
+	return nil
+}
+
+// SignEd25519 подписывает пакет закрытым ключом источника
+func SignEd25519(packet *domain.DataPacket, keyID string, privateKey ed25519.PrivateKey) error {
+	message, err := Canonical(packet)
+	if err != nil {
+		return err
+	}
+
+	signature := ed25519.Sign(privateKey, message)
+	packet.Signature = &domain.PacketSignature{KeyID: keyID, Value: base64.StdEncoding.EncodeToString(signature)}
+	return nil
+}
@@ -0,0 +1,54 @@
+package signing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"go.uber.org/zap"
+)
+
+// PacketProcessor обрабатывает пакет с проверенной подписью
+type PacketProcessor interface {
+	ProcessPacket(ctx context.Context, packet *domain.DataPacket) error
+}
+
+// Processor проверяет подпись пакета до любых изменений пакета дальше по цепочке
+type Processor struct {
+	next     PacketProcessor
+	registry *Registry
+	logger   *zap.Logger
+}
+
+func NewProcessor(next PacketProcessor, registry *Registry, logger *zap.Logger) *Processor {
+	return &Processor{
+		next:     next,
+		registry: registry,
+		logger:   logger,
+	}
+}
+
+func (p *Processor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	// Пустой пакет отклонит общая валидация
+	if packet == nil {
+		return p.next.ProcessPacket(ctx, packet)
+	}
+
+	if err := p.registry.Verify(packet); err != nil {
+		reason := "unknown"
+		var verificationErr *VerificationError
+		if errors.As(err, &verificationErr) {
+			reason = verificationErr.Reason
+		}
+		p.logger.Warn("[Signing] Packet rejected",
+			zap.String("reason", reason),
+			zap.String("packet_id", packet.ID.String()),
+			zap.String("source_id", packet.SourceID),
+			zap.String("tenant", packet.Tenant()),
+			zap.Error(err))
+		return err
+	}
+
+	return p.next.ProcessPacket(ctx, packet)
+}
@@ -0,0 +1,366 @@
+// Package signing проверяет подписи пакетов ключами источников арендаторов. Источник с зарегистрированными
+// ключами принимает только подписанные пакеты; несколько действующих ключей позволяют
+// ротацию без перерыва приёма.
+package signing
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+// Причины отклонения пакета при проверке подписи
+const (
+	ReasonMissingSignature   = "missing_signature"
+	ReasonMalformedSignature = "malformed_signature"
+	ReasonUnknownKey         = "unknown_key"
+	ReasonExpiredKey         = "expired_key"
+	ReasonBadSignature       = "bad_signature"
+	ReasonUnregisteredSource = "unregistered_source"
+)
+
+const (
+	maxSourceLength = 128
+	minHMACKeySize  = 16
+	maxHMACKeySize  = 1024
+)
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+var (
+	// ErrInvalidSignature базовая ошибка для пакетов, не прошедших проверку подписи
+	ErrInvalidSignature = errors.New("invalid packet signature")
+	// ErrInvalidKey возвращается для некорректного ключа
+	ErrInvalidKey = errors.New("invalid signing key")
+	// ErrKeyExists возвращается при регистрации ключа с уже занятым идентификатором
+	ErrKeyExists = errors.New("signing key already exists")
+)
+
+// VerificationError причина, по которой пакет не прошёл проверку подписи
+type VerificationError struct {
+	Reason  string
+	Message string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%s (%s): %s", ErrInvalidSignature, e.Reason, e.Message)
+}
+
+func (e *VerificationError) Unwrap() error {
+	return ErrInvalidSignature
+}
+
+// Store хранилище ключей подписи
+type Store interface {
+	ListSigningKeys(ctx context.Context) ([]*domain.SigningKey, error)
+	// SaveSigningKey сохраняет новый ключ; false, если ключ с таким идентификатором уже есть
+	SaveSigningKey(ctx context.Context, key *domain.SigningKey) (bool, error)
+	ExpireSigningKey(ctx context.Context, tenantID, sourceID, keyID string, expiresAt time.Time) error
+	DeleteSigningKey(ctx context.Context, tenantID, sourceID, keyID string) (bool, error)
+}
+
+// sourceRef источник арендатора: одноимённые источники разных арендаторов имеют свои ключи
+type sourceRef struct {
+	tenantID string
+	sourceID string
+}
+
+// Registry хранит ключи источников в памяти и проверяет по ним подписи пакетов
+type Registry struct {
+	store    Store
+	required bool // отклонять пакеты источников без ключей
+	logger   *zap.Logger
+	now      func() time.Time
+
+	writeMu  sync.Mutex // упорядочивает регистрацию ключей и ротацию
+	mu       sync.RWMutex
+	bySource map[sourceRef]map[string]*domain.SigningKey
+}
+
+func NewRegistry(store Store, required bool, logger *zap.Logger) *Registry {
+	return &Registry{
+		store:    store,
+		required: required,
+		logger:   logger,
+		now:      time.Now,
+		bySource: make(map[sourceRef]map[string]*domain.SigningKey),
+	}
+}
+
+// Load загружает ключи из хранилища; некорректные ключи пропускаются с ошибкой в логе
+func (r *Registry) Load(ctx context.Context) error {
+	list, err := r.store.ListSigningKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	bySource := make(map[sourceRef]map[string]*domain.SigningKey)
+	loaded := 0
+	for _, key := range list {
+		if err := validateKey(key); err != nil {
+			r.logger.Error("[Signing] Skipping stored key",
+				zap.String("tenant", key.TenantID),
+				zap.String("source_id", key.SourceID),
+				zap.String("key_id", key.KeyID),
+				zap.Error(err))
+			continue
+		}
+		ref := sourceRef{key.TenantID, key.SourceID}
+		if bySource[ref] == nil {
+			bySource[ref] = make(map[string]*domain.SigningKey)
+		}
+		bySource[ref][key.KeyID] = key
+		loaded++
+	}
+
+	r.mu.Lock()
+	r.bySource = bySource
+	r.mu.Unlock()
+
+	r.logger.Info("[Signing] Keys loaded",
+		zap.Int("sources", len(bySource)),
+		zap.Int("keys", loaded))
+	return nil
+}
+
+// AddKey регистрирует ключ источника арендатора, без арендатора — арендатора по умолчанию.
+// При retireOthersAfter > 0 остальные действующие ключи источника истекают через этот срок:
+// так выполняется ротация с периодом перекрытия.
+func (r *Registry) AddKey(ctx context.Context, key domain.SigningKey, retireOthersAfter time.Duration) (*domain.SigningKey, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	if key.TenantID == "" {
+		key.TenantID = domain.DefaultTenantID
+	}
+	now := r.now().UTC()
+	key.CreatedAt = now
+	if err := validateKey(&key); err != nil {
+		return nil, err
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidKey)
+	}
+	if retireOthersAfter < 0 {
+		return nil, fmt.Errorf("%w: retire period must not be negative", ErrInvalidKey)
+	}
+	key.Key = append([]byte(nil), key.Key...)
+
+	saved, err := r.store.SaveSigningKey(ctx, &key)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, fmt.Errorf("%w: key %q of source %q", ErrKeyExists, key.KeyID, key.SourceID)
+	}
+	r.setKey(&key)
+
+	if retireOthersAfter > 0 {
+		retireAt := now.Add(retireOthersAfter)
+		for _, other := range r.keys(sourceRef{key.TenantID, key.SourceID}) {
+			if other.KeyID == key.KeyID || (other.ExpiresAt != nil && !other.ExpiresAt.After(retireAt)) {
+				continue
+			}
+			if err := r.store.ExpireSigningKey(ctx, other.TenantID, other.SourceID, other.KeyID, retireAt); err != nil {
+				return nil, fmt.Errorf("failed to retire key %q: %w", other.KeyID, err)
+			}
+			retired := *other
+			retired.ExpiresAt = &retireAt
+			r.setKey(&retired)
+		}
+	}
+
+	r.logger.Info("[Signing] Key registered",
+		zap.String("tenant", key.TenantID),
+		zap.String("source_id", key.SourceID),
+		zap.String("key_id", key.KeyID),
+		zap.String("algorithm", string(key.Algorithm)),
+		zap.Duration("retire_others_after", retireOthersAfter))
+	return copyKey(&key), nil
+}
+
+// DeleteKey удаляет ключ источника арендатора; подписанные им пакеты перестают приниматься сразу
+func (r *Registry) DeleteKey(ctx context.Context, tenantID, sourceID, keyID string) (bool, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	found, err := r.store.DeleteSigningKey(ctx, tenantID, sourceID, keyID)
+	if err != nil {
+		return false, err
+	}
+
+	ref := sourceRef{tenantID, sourceID}
+	r.mu.Lock()
+	if _, ok := r.bySource[ref][keyID]; ok {
+		found = true
+		keys := make(map[string]*domain.SigningKey, len(r.bySource[ref]))
+		for id, key := range r.bySource[ref] {
+			if id != keyID {
+				keys[id] = key
+			}
+		}
+		if len(keys) == 0 {
+			delete(r.bySource, ref)
+		} else {
+			r.bySource[ref] = keys
+		}
+	}
+	r.mu.Unlock()
+
+	return found, nil
+}
+
+// ListKeys возвращает ключи источника арендатора без секретов, а для пустого sourceID — ключи
+// всех источников арендатора
+func (r *Registry) ListKeys(tenantID, sourceID string) []*domain.SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []*domain.SigningKey
+	for ref, keys := range r.bySource {
+		if ref.tenantID != tenantID || (sourceID != "" && ref.sourceID != sourceID) {
+			continue
+		}
+		for _, key := range keys {
+			copied := copyKey(key)
+			copied.Key = nil
+			list = append(list, copied)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].SourceID != list[j].SourceID {
+			return list[i].SourceID < list[j].SourceID
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Verify проверяет подпись пакета ключом его источника у арендатора пакета. Пакеты источников без ключей
+// принимаются без проверки, если подпись не обязательна для всех источников.
+func (r *Registry) Verify(packet *domain.DataPacket) error {
+	source := packet.SourceID
+	if source == "" {
+		source = domain.DefaultSourceID
+	}
+
+	keys := r.keys(sourceRef{packet.Tenant(), source})
+	if len(keys) == 0 {
+		if r.required {
+			return reject(ReasonUnregisteredSource, "source %q has no signing keys", source)
+		}
+		return nil
+	}
+
+	signature := packet.Signature
+	if signature == nil || signature.Value == "" {
+		return reject(ReasonMissingSignature, "packets of source %q must be signed", source)
+	}
+	key, ok := keys[signature.KeyID]
+	if !ok {
+		return reject(ReasonUnknownKey, "source %q has no key %q", source, signature.KeyID)
+	}
+	if !key.Active(r.now()) {
+		return reject(ReasonExpiredKey, "key %q of source %q has expired", key.KeyID, source)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(signature.Value)
+	if err != nil {
+		return reject(ReasonMalformedSignature, "signature is not valid base64")
+	}
+	message, err := Canonical(packet)
+	if err != nil {
+		return reject(ReasonMalformedSignature, "failed to encode packet: %v", err)
+	}
+
+	if !verifySignature(key, message, value) {
+		return reject(ReasonBadSignature, "signature does not match key %q of source %q", key.KeyID, source)
+	}
+
+	metrics.SignatureVerifiedPackets.WithLabelValues(source).Inc()
+	return nil
+}
+
+func verifySignature(key *domain.SigningKey, message, signature []byte) bool {
+	switch key.Algorithm {
+	case domain.SigningAlgorithmHMACSHA256:
+		mac := hmac.New(sha256.New, key.Key)
+		mac.Write(message)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case domain.SigningAlgorithmEd25519:
+		return len(signature) == ed25519.SignatureSize && ed25519.Verify(ed25519.PublicKey(key.Key), message, signature)
+	default:
+		return false
+	}
+}
+
+func reject(reason, format string, args ...any) error {
+	metrics.SignatureRejectedPackets.WithLabelValues(reason).Inc()
+	return &VerificationError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+func (r *Registry) keys(ref sourceRef) map[string]*domain.SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.bySource[ref]
+}
+
+// setKey заменяет ключ в памяти копией карты источника, чтобы не мешать читателям из keys
+func (r *Registry) setKey(key *domain.SigningKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ref := sourceRef{key.TenantID, key.SourceID}
+	keys := make(map[string]*domain.SigningKey, len(r.bySource[ref])+1)
+	for id, existing := range r.bySource[ref] {
+		keys[id] = existing
+	}
+	keys[key.KeyID] = key
+	r.bySource[ref] = keys
+}
+
+func validateKey(key *domain.SigningKey) error {
+	if key.SourceID == "" || len(key.SourceID) > maxSourceLength {
+		return fmt.Errorf("%w: source id must be 1 to %d characters", ErrInvalidKey, maxSourceLength)
+	}
+	if !keyIDPattern.MatchString(key.KeyID) {
+		return fmt.Errorf("%w: key id must be 1 to 64 letters, digits, '_', '.' or '-'", ErrInvalidKey)
+	}
+
+	switch key.Algorithm {
+	case domain.SigningAlgorithmHMACSHA256:
+		if len(key.Key) < minHMACKeySize || len(key.Key) > maxHMACKeySize {
+			return fmt.Errorf("%w: hmac secret must be %d to %d bytes", ErrInvalidKey, minHMACKeySize, maxHMACKeySize)
+		}
+	case domain.SigningAlgorithmEd25519:
+		if len(key.Key) != ed25519.PublicKeySize {
+			return fmt.Errorf("%w: ed25519 public key must be %d bytes", ErrInvalidKey, ed25519.PublicKeySize)
+		}
+	default:
+		return fmt.Errorf("%w: unknown algorithm %q", ErrInvalidKey, key.Algorithm)
+	}
+	return nil
+}
+
+func copyKey(key *domain.SigningKey) *domain.SigningKey {
+	copied := *key
+	copied.Key = append([]byte(nil), key.Key...)
+	if key.ExpiresAt != nil {
+		expiresAt := *key.ExpiresAt
+		copied.ExpiresAt = &expiresAt
+	}
+	return &copied
+}
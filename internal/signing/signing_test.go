@@ -0,0 +1,268 @@
+package signing
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) ListSigningKeys(ctx context.Context) ([]*domain.SigningKey, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.SigningKey), args.Error(1)
+}
+
+func (m *MockStore) SaveSigningKey(ctx context.Context, key *domain.SigningKey) (bool, error) {
+	args := m.Called(ctx, key)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) ExpireSigningKey(ctx context.Context, tenantID, sourceID, keyID string, expiresAt time.Time) error {
+	args := m.Called(ctx, tenantID, sourceID, keyID, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteSigningKey(ctx context.Context, tenantID, sourceID, keyID string) (bool, error) {
+	args := m.Called(ctx, tenantID, sourceID, keyID)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockPacketProcessor struct {
+	mock.Mock
+}
+
+func (m *MockPacketProcessor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	args := m.Called(ctx, packet)
+	return args.Error(0)
+}
+
+var (
+	registryTime = time.Date(2025, 9, 19, 12, 0, 0, 0, time.UTC)
+	hmacSecret   = []byte("0123456789abcdef0123456789abcdef")
+)
+
+func newRegistry(required bool) (*Registry, *MockStore) {
+	store := new(MockStore)
+	store.On("SaveSigningKey", mock.Anything, mock.Anything).Return(true, nil)
+	logger, _ := zap.NewDevelopment()
+	registry := NewRegistry(store, required, logger)
+	registry.now = func() time.Time { return registryTime }
+	return registry, store
+}
+
+func signedPacket(t *testing.T, keyID string) *domain.DataPacket {
+	packet := &domain.DataPacket{
+		ID:        uuid.New(),
+		SourceID:  "meter",
+		Labels:    map[string]string{"site": "a", "floor": "<2>"},
+		Timestamp: registryTime.Add(-time.Minute),
+		Payload:   []int64{1, 5, 3},
+	}
+	require.NoError(t, SignHMAC(packet, keyID, hmacSecret))
+	return packet
+}
+
+func verificationReason(err error) string {
+	var verificationErr *VerificationError
+	if errors.As(err, &verificationErr) {
+		return verificationErr.Reason
+	}
+	return ""
+}
+
+func TestCanonical(t *testing.T) {
+	id := uuid.MustParse("6f1c2b1e-3a43-4a8e-9d2c-6d6a0f1b2c3d")
+	packet := &domain.DataPacket{
+		ID:        id,
+		SourceID:  "meter",
+		Labels:    map[string]string{"site": "a&b", "floor": "2"},
+		Timestamp: time.Date(2025, 9, 19, 15, 0, 0, 500000000, time.FixedZone("MSK", 3*3600)),
+		Series: map[string]domain.SeriesPayload{
+			"volts": {DecimalPayload: []string{"3.30"}},
+			"temp":  {FloatPayload: []float64{20.5, 1e21}},
+		},
+		Signature: &domain.PacketSignature{KeyID: "k1", Value: "ignored"},
+	}
+
+	canonical, err := Canonical(packet)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"6f1c2b1e-3a43-4a8e-9d2c-6d6a0f1b2c3d","source_id":"meter","timestamp":"2025-09-19T12:00:00.5Z",`+
+		`"labels":{"floor":"2","site":"a&b"},"series":{"temp":{"float_payload":[20.5,1e+21]},"volts":{"decimal_payload":["3.30"]}}}`,
+		string(canonical))
+}
+
+func TestRegistry_VerifyHMAC(t *testing.T) {
+	registry, _ := newRegistry(false)
+	_, err := registry.AddKey(context.Background(), domain.SigningKey{
+		SourceID: "meter", KeyID: "k1", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret,
+	}, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, registry.Verify(signedPacket(t, "k1")))
+
+	// Подпись не переживает изменения подписанных полей
+	tampered := signedPacket(t, "k1")
+	tampered.Payload[1] = 500
+	assert.Equal(t, ReasonBadSignature, verificationReason(registry.Verify(tampered)))
+
+	unsigned := signedPacket(t, "k1")
+	unsigned.Signature = nil
+	assert.Equal(t, ReasonMissingSignature, verificationReason(registry.Verify(unsigned)))
+
+	assert.Equal(t, ReasonUnknownKey, verificationReason(registry.Verify(signedPacket(t, "k2"))))
+
+	malformed := signedPacket(t, "k1")
+	malformed.Signature.Value = "not base64!"
+	err = registry.Verify(malformed)
+	assert.Equal(t, ReasonMalformedSignature, verificationReason(err))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Источник без ключей принимается без подписи, пока подпись не обязательна
+	require.NoError(t, registry.Verify(&domain.DataPacket{ID: uuid.New(), Payload: []int64{1}}))
+
+	required, _ := newRegistry(true)
+	assert.Equal(t, ReasonUnregisteredSource, verificationReason(required.Verify(&domain.DataPacket{ID: uuid.New(), Payload: []int64{1}})))
+}
+
+func TestRegistry_VerifyEd25519(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	registry, _ := newRegistry(false)
+	_, err = registry.AddKey(context.Background(), domain.SigningKey{
+		SourceID: "meter", KeyID: "device-1", Algorithm: domain.SigningAlgorithmEd25519, Key: publicKey,
+	}, 0)
+	require.NoError(t, err)
+
+	packet := &domain.DataPacket{ID: uuid.New(), SourceID: "meter", Timestamp: registryTime, FloatPayload: []float64{1.5}}
+	require.NoError(t, SignEd25519(packet, "device-1", privateKey))
+	require.NoError(t, registry.Verify(packet))
+
+	// Подпись HMAC не принимается для ключа Ed25519
+	require.NoError(t, SignHMAC(packet, "device-1", hmacSecret))
+	assert.Equal(t, ReasonBadSignature, verificationReason(registry.Verify(packet)))
+}
+
+func TestRegistry_Rotation(t *testing.T) {
+	registry, store := newRegistry(false)
+	ctx := context.Background()
+
+	_, err := registry.AddKey(ctx, domain.SigningKey{SourceID: "meter", KeyID: "k1", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret}, 0)
+	require.NoError(t, err)
+
+	retireAt := registryTime.Add(time.Hour)
+	store.On("ExpireSigningKey", ctx, domain.DefaultTenantID, "meter", "k1", retireAt).Return(nil).Once()
+	rotated, err := registry.AddKey(ctx, domain.SigningKey{SourceID: "meter", KeyID: "k2", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret}, time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, rotated.ExpiresAt)
+
+	// В период перекрытия принимаются оба ключа
+	require.NoError(t, registry.Verify(signedPacket(t, "k1")))
+	require.NoError(t, registry.Verify(signedPacket(t, "k2")))
+
+	registry.now = func() time.Time { return retireAt }
+	assert.Equal(t, ReasonExpiredKey, verificationReason(registry.Verify(signedPacket(t, "k1"))))
+	require.NoError(t, registry.Verify(signedPacket(t, "k2")))
+
+	// Секреты не возвращаются в списке ключей
+	list := registry.ListKeys(domain.DefaultTenantID, "meter")
+	require.Len(t, list, 2)
+	for _, key := range list {
+		assert.Nil(t, key.Key)
+	}
+
+	store.On("DeleteSigningKey", ctx, domain.DefaultTenantID, "meter", "k1").Return(true, nil)
+	found, err := registry.DeleteKey(ctx, domain.DefaultTenantID, "meter", "k1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, ReasonUnknownKey, verificationReason(registry.Verify(signedPacket(t, "k1"))))
+
+	store.AssertExpectations(t)
+}
+
+func TestRegistry_AddKeyInvalid(t *testing.T) {
+	registry, store := newRegistry(false)
+	past := registryTime.Add(-time.Hour)
+
+	for _, key := range []domain.SigningKey{
+		{SourceID: "", KeyID: "k1", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret},
+		{SourceID: "meter", KeyID: "bad id", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret},
+		{SourceID: "meter", KeyID: "k1", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: []byte("short")},
+		{SourceID: "meter", KeyID: "k1", Algorithm: domain.SigningAlgorithmEd25519, Key: hmacSecret[:16]},
+		{SourceID: "meter", KeyID: "k1", Algorithm: "rsa", Key: hmacSecret},
+		{SourceID: "meter", KeyID: "k1", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret, ExpiresAt: &past},
+	} {
+		_, err := registry.AddKey(context.Background(), key, 0)
+		assert.ErrorIs(t, err, ErrInvalidKey, key.KeyID)
+	}
+
+	store.ExpectedCalls = nil
+	store.On("SaveSigningKey", mock.Anything, mock.Anything).Return(false, nil)
+	_, err := registry.AddKey(context.Background(), domain.SigningKey{SourceID: "meter", KeyID: "k1", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret}, 0)
+	assert.ErrorIs(t, err, ErrKeyExists)
+}
+
+func TestRegistry_Load(t *testing.T) {
+	store := new(MockStore)
+	store.On("ListSigningKeys", mock.Anything).Return([]*domain.SigningKey{
+		{TenantID: domain.DefaultTenantID, SourceID: "meter", KeyID: "k1", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret},
+		{TenantID: domain.DefaultTenantID, SourceID: "meter", KeyID: "broken", Algorithm: domain.SigningAlgorithmEd25519, Key: []byte("short")},
+	}, nil)
+	logger, _ := zap.NewDevelopment()
+	registry := NewRegistry(store, false, logger)
+	registry.now = func() time.Time { return registryTime }
+
+	require.NoError(t, registry.Load(context.Background()))
+	assert.Len(t, registry.ListKeys(domain.DefaultTenantID, ""), 1)
+	require.NoError(t, registry.Verify(signedPacket(t, "k1")))
+}
+
+func TestRegistry_KeysAreScopedByTenant(t *testing.T) {
+	registry, _ := newRegistry(true)
+	_, err := registry.AddKey(context.Background(), domain.SigningKey{SourceID: "meter", KeyID: "k1", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret}, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, registry.Verify(signedPacket(t, "k1")))
+
+	// Ключ одноимённого источника другого арендатора не подходит
+	packet := signedPacket(t, "k1")
+	packet.TenantID = "team-b"
+	assert.Equal(t, ReasonUnregisteredSource, verificationReason(registry.Verify(packet)))
+	assert.Empty(t, registry.ListKeys("team-b", ""))
+}
+
+func TestProcessor(t *testing.T) {
+	registry, _ := newRegistry(false)
+	_, err := registry.AddKey(context.Background(), domain.SigningKey{SourceID: "meter", KeyID: "k1", Algorithm: domain.SigningAlgorithmHMACSHA256, Key: hmacSecret}, 0)
+	require.NoError(t, err)
+
+	next := new(MockPacketProcessor)
+	next.On("ProcessPacket", mock.Anything, mock.Anything).Return(nil)
+	logger, _ := zap.NewDevelopment()
+	processor := NewProcessor(next, registry, logger)
+
+	require.NoError(t, processor.ProcessPacket(context.Background(), signedPacket(t, "k1")))
+
+	packet := signedPacket(t, "k1")
+	packet.Signature.Value = base64.StdEncoding.EncodeToString([]byte("forged"))
+	assert.ErrorIs(t, processor.ProcessPacket(context.Background(), packet), ErrInvalidSignature)
+
+	next.AssertNumberOfCalls(t, "ProcessPacket", 1)
+}
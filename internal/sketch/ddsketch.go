@@ -0,0 +1,158 @@
+// Package sketch реализует DDSketch — мергируемый скетч для квантилей с ограниченной
+// относительной ошибкой. Скетч хранится как набор счётчиков по логарифмическим бакетам,
+// поэтому объединение скетчей сводится к сложению счётчиков одинаковых ключей.
+package sketch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	// RelativeAccuracy относительная ошибка оценки квантиля. Ключи бакетов зависят от неё,
+	// поэтому изменение требует пересчёта сохранённых скетчей.
+	RelativeAccuracy = 0.01
+
+	// minIndexableValue значения по модулю меньше считаются нулём
+	minIndexableValue = 1e-9
+
+	zeroKey = "z"
+)
+
+var (
+	gamma    = (1 + RelativeAccuracy) / (1 - RelativeAccuracy)
+	logGamma = math.Log(gamma)
+)
+
+// DDSketch счётчики значений по бакетам. Ключ бакета — "p<index>" для положительных значений,
+// "n<index>" для отрицательных и "z" для нуля.
+type DDSketch struct {
+	buckets map[string]int64
+	count   int64
+}
+
+func New() *DDSketch {
+	return &DDSketch{buckets: make(map[string]int64)}
+}
+
+// FromBuckets восстанавливает скетч из сохранённых счётчиков
+func FromBuckets(buckets map[string]int64) (*DDSketch, error) {
+	s := New()
+	for key, count := range buckets {
+		if _, _, err := parseKey(key); err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, fmt.Errorf("negative count %d for sketch bucket %q", count, key)
+		}
+		s.buckets[key] += count
+		s.count += count
+	}
+	return s, nil
+}
+
+// Key возвращает ключ бакета, в который попадает значение
+func Key(value float64) string {
+	switch {
+	case math.Abs(value) < minIndexableValue:
+		return zeroKey
+	case value > 0:
+		return "p" + strconv.Itoa(index(value))
+	default:
+		return "n" + strconv.Itoa(index(-value))
+	}
+}
+
+func index(value float64) int {
+	return int(math.Ceil(math.Log(value) / logGamma))
+}
+
+// Add добавляет значение в скетч. NaN и бесконечности игнорируются.
+func (s *DDSketch) Add(value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	s.buckets[Key(value)]++
+	s.count++
+}
+
+// Merge добавляет счётчики другого скетча
+func (s *DDSketch) Merge(other *DDSketch) {
+	for key, count := range other.buckets {
+		s.buckets[key] += count
+	}
+	s.count += other.count
+}
+
+// Count возвращает количество значений в скетче
+func (s *DDSketch) Count() int64 {
+	return s.count
+}
+
+// Buckets возвращает копию счётчиков для сохранения
+func (s *DDSketch) Buckets() map[string]int64 {
+	buckets := make(map[string]int64, len(s.buckets))
+	for key, count := range s.buckets {
+		buckets[key] = count
+	}
+	return buckets
+}
+
+// Quantile возвращает оценку квантиля q из [0, 1] с относительной ошибкой не больше RelativeAccuracy
+func (s *DDSketch) Quantile(q float64) (float64, error) {
+	if q < 0 || q > 1 || math.IsNaN(q) {
+		return 0, fmt.Errorf("quantile must be in [0, 1], got %v", q)
+	}
+	if s.count == 0 {
+		return 0, fmt.Errorf("sketch is empty")
+	}
+
+	type bucket struct {
+		value float64
+		count int64
+	}
+	ordered := make([]bucket, 0, len(s.buckets))
+	for key, count := range s.buckets {
+		sign, idx, _ := parseKey(key)
+		ordered = append(ordered, bucket{value: float64(sign) * representative(idx, sign), count: count})
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].value < ordered[j].value })
+
+	rank := int64(q * float64(s.count-1))
+	var seen int64
+	for _, b := range ordered {
+		seen += b.count
+		if seen > rank {
+			return b.value, nil
+		}
+	}
+	return ordered[len(ordered)-1].value, nil
+}
+
+// representative возвращает значение бакета с минимальной относительной ошибкой
+func representative(idx, sign int) float64 {
+	if sign == 0 {
+		return 0
+	}
+	return 2 * math.Pow(gamma, float64(idx)) / (gamma + 1)
+}
+
+// parseKey возвращает знак и индекс бакета
+func parseKey(key string) (int, int, error) {
+	if key == zeroKey {
+		return 0, 0, nil
+	}
+	if len(key) < 2 || (key[0] != 'p' && key[0] != 'n') {
+		return 0, 0, fmt.Errorf("invalid sketch bucket %q", key)
+	}
+	idx, err := strconv.Atoi(key[1:])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid sketch bucket %q: %w", key, err)
+	}
+	if key[0] == 'n' {
+		return -1, idx, nil
+	}
+	return 1, idx, nil
+}
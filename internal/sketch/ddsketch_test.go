@@ -0,0 +1,79 @@
+package sketch
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exactQuantile(sorted []float64, q float64) float64 {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+func TestDDSketch_RelativeAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := make([]float64, 10000)
+	s := New()
+	for i := range values {
+		values[i] = math.Exp(rng.NormFloat64()*3) * 100
+		s.Add(values[i])
+	}
+	sort.Float64s(values)
+
+	for _, q := range []float64{0, 0.1, 0.5, 0.9, 0.99, 0.999, 1} {
+		got, err := s.Quantile(q)
+		require.NoError(t, err)
+		want := exactQuantile(values, q)
+		assert.LessOrEqual(t, math.Abs(got-want)/want, RelativeAccuracy, "q=%v", q)
+	}
+}
+
+func TestDDSketch_NegativeAndZero(t *testing.T) {
+	s := New()
+	for _, v := range []float64{-50, -5, 0, 5, 50} {
+		s.Add(v)
+	}
+	s.Add(math.NaN())
+	assert.Equal(t, int64(5), s.Count())
+
+	minimum, err := s.Quantile(0)
+	require.NoError(t, err)
+	assert.InEpsilon(t, -50.0, minimum, RelativeAccuracy)
+
+	median, err := s.Quantile(0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, median)
+}
+
+func TestDDSketch_MergeEqualsCombined(t *testing.T) {
+	a, b, combined := New(), New(), New()
+	for v := 1; v <= 1000; v++ {
+		if v%3 == 0 {
+			a.Add(float64(v))
+		} else {
+			b.Add(float64(v))
+		}
+		combined.Add(float64(v))
+	}
+
+	restored, err := FromBuckets(a.Buckets())
+	require.NoError(t, err)
+	restored.Merge(b)
+
+	assert.Equal(t, combined.Buckets(), restored.Buckets())
+	assert.Equal(t, combined.Count(), restored.Count())
+}
+
+func TestFromBuckets_Invalid(t *testing.T) {
+	_, err := FromBuckets(map[string]int64{"x1": 1})
+	assert.Error(t, err)
+	_, err = FromBuckets(map[string]int64{"p1": -1})
+	assert.Error(t, err)
+
+	_, err = New().Quantile(0.5)
+	assert.Error(t, err)
+}
@@ -0,0 +1,206 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+// ErrQuotaExceeded возвращается для пакета, превышающего квоту арендатора
+var ErrQuotaExceeded = errors.New("tenant quota exceeded")
+
+// Quota ограничения арендатора. Нулевые значения означают отсутствие ограничения.
+type Quota struct {
+	IngestRate float64 // пакетов в секунду, допускается всплеск в размере секундной нормы
+	MaxRows    int64   // строк результатов в processed_packets
+}
+
+// ParseQuotas разбирает переопределения квот "tenant=rate:rows", разделённые ";"
+func ParseQuotas(spec string) (map[string]Quota, error) {
+	quotas := make(map[string]Quota)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		tenantID, limits, ok := strings.Cut(entry, "=")
+		tenantID = strings.TrimSpace(tenantID)
+		rate, rows, okLimits := strings.Cut(limits, ":")
+		if !ok || !okLimits {
+			return nil, fmt.Errorf("%w: quota entry must look like tenant=rate:rows", ErrInvalidConfig)
+		}
+		if err := validateID(tenantID); err != nil {
+			return nil, err
+		}
+
+		var quota Quota
+		var err error
+		if quota.IngestRate, err = strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil || quota.IngestRate < 0 || math.IsInf(quota.IngestRate, 0) {
+			return nil, fmt.Errorf("%w: invalid ingest rate for tenant %q", ErrInvalidConfig, tenantID)
+		}
+		if quota.MaxRows, err = strconv.ParseInt(strings.TrimSpace(rows), 10, 64); err != nil || quota.MaxRows < 0 {
+			return nil, fmt.Errorf("%w: invalid max rows for tenant %q", ErrInvalidConfig, tenantID)
+		}
+		quotas[tenantID] = quota
+	}
+	return quotas, nil
+}
+
+// RowCounter считает сохранённые строки результатов по арендаторам
+type RowCounter interface {
+	CountRowsByTenant(ctx context.Context) (map[string]int64, error)
+}
+
+// PacketProcessor обрабатывает пакет, уложившийся в квоты
+type PacketProcessor interface {
+	ProcessPacket(ctx context.Context, packet *domain.DataPacket) error
+}
+
+type QuotaConfig struct {
+	Default         Quota
+	Tenants         map[string]Quota // переопределения квоты по умолчанию
+	RefreshInterval time.Duration    // период пересчёта строк по базе
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// QuotaEnforcer проверяет квоты арендатора перед передачей пакета дальше.
+// Число строк ведётся в памяти и периодически сверяется с базой, поэтому удаление
+// старых данных освобождает квоту не сразу, а после следующего пересчёта.
+type QuotaEnforcer struct {
+	next    PacketProcessor
+	counter RowCounter
+	cfg     QuotaConfig
+	logger  *zap.Logger
+	now     func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	rows    map[string]int64
+}
+
+func NewQuotaEnforcer(next PacketProcessor, counter RowCounter, cfg QuotaConfig, logger *zap.Logger) *QuotaEnforcer {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 5 * time.Minute
+	}
+
+	return &QuotaEnforcer{
+		next:    next,
+		counter: counter,
+		cfg:     cfg,
+		logger:  logger,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+		rows:    make(map[string]int64),
+	}
+}
+
+func (q *QuotaEnforcer) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	tenantID := packet.Tenant()
+	quota := q.quotaFor(tenantID)
+
+	q.mu.Lock()
+	exceeded := ""
+	switch {
+	case quota.MaxRows > 0 && q.rows[tenantID] >= quota.MaxRows:
+		exceeded = "stored_rows"
+	case quota.IngestRate > 0 && !q.take(tenantID, quota.IngestRate):
+		exceeded = "ingest_rate"
+	}
+	q.mu.Unlock()
+
+	if exceeded != "" {
+		metrics.TenantQuotaRejected.WithLabelValues(tenantID, exceeded).Inc()
+		q.logger.Warn("[Tenant] Packet rejected by quota",
+			zap.String("tenant", tenantID),
+			zap.String("quota", exceeded),
+			zap.String("packet_id", packet.ID.String()))
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, exceeded)
+	}
+
+	if err := q.next.ProcessPacket(ctx, packet); err != nil {
+		return err
+	}
+
+	// Повторно присланный пакет тоже учитывается: пересчёт по базе исправит счётчик.
+	// Каждая серия пакета сохраняется отдельной строкой.
+	q.mu.Lock()
+	q.rows[tenantID] += int64(len(packet.SeriesNames()))
+	q.mu.Unlock()
+	return nil
+}
+
+// Refresh пересчитывает строки арендаторов по базе
+func (q *QuotaEnforcer) Refresh(ctx context.Context) error {
+	counts, err := q.counter.CountRowsByTenant(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count tenant rows: %w", err)
+	}
+
+	q.mu.Lock()
+	q.rows = counts
+	q.mu.Unlock()
+
+	for tenantID, count := range counts {
+		metrics.TenantStoredRows.WithLabelValues(tenantID).Set(float64(count))
+	}
+	return nil
+}
+
+// Run пересчитывает строки с периодом RefreshInterval до отмены ctx
+func (q *QuotaEnforcer) Run(ctx context.Context) {
+	ticker := time.NewTicker(q.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := q.Refresh(ctx); err != nil && ctx.Err() == nil {
+				q.logger.Error("[Tenant] Quota refresh failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (q *QuotaEnforcer) quotaFor(tenantID string) Quota {
+	if quota, ok := q.cfg.Tenants[tenantID]; ok {
+		return quota
+	}
+	return q.cfg.Default
+}
+
+// take забирает токен из корзины арендатора. Вызывается под q.mu.
+func (q *QuotaEnforcer) take(tenantID string, rate float64) bool {
+	now := q.now()
+	capacity := math.Max(rate, 1)
+
+	b, ok := q.buckets[tenantID]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		q.buckets[tenantID] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
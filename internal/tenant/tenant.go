@@ -0,0 +1,147 @@
+// Package tenant определяет арендатора (команду), от имени которого выполняется запрос,
+// и ограничивает приём пакетов квотами арендатора. Арендатор берётся только из
+// аутентифицированного клиента и передаётся дальше через контекст.
+package tenant
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+)
+
+var (
+	// ErrUnauthenticated возвращается для запроса без ключа, с неизвестным ключом или без арендатора в контексте
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrInvalidConfig возвращается для некорректных ключей или квот в конфигурации
+	ErrInvalidConfig = errors.New("invalid tenant configuration")
+)
+
+var idPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+type contextKey struct{}
+
+// WithID возвращает контекст с арендатором запроса
+func WithID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenantID)
+}
+
+// FromContext возвращает арендатора запроса
+func FromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(contextKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// Require возвращает арендатора запроса или ErrUnauthenticated, если его нет.
+// Запросы без арендатора не выполняются, чтобы не вернуть чужие данные.
+func Require(ctx context.Context) (string, error) {
+	tenantID, ok := FromContext(ctx)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	return tenantID, nil
+}
+
+type apiKey struct {
+	key      []byte
+	tenantID string
+}
+
+// Authenticator сопоставляет API-ключ клиента с арендатором
+type Authenticator struct {
+	keys        []apiKey
+	adminTenant string
+	disabled    bool
+}
+
+// NewAuthenticator создаёт аутентификатор. Без ключей все клиенты работают от арендатора
+// по умолчанию, а административные маршруты закрыты, пока аутентификация не выключена явно
+// (disabled): иначе любой анонимный клиент получил бы права администратора.
+// При заданных ключах disabled не действует.
+func NewAuthenticator(keys map[string]string, adminTenant string, disabled bool) *Authenticator {
+	if adminTenant == "" {
+		adminTenant = domain.DefaultTenantID
+	}
+
+	a := &Authenticator{adminTenant: adminTenant, disabled: disabled}
+	for key, tenantID := range keys {
+		a.keys = append(a.keys, apiKey{key: []byte(key), tenantID: tenantID})
+	}
+	return a
+}
+
+// Enabled сообщает, заданы ли API-ключи
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Authenticate возвращает арендатора по API-ключу. Ключи сравниваются за постоянное время.
+func (a *Authenticator) Authenticate(key string) (string, error) {
+	if !a.Enabled() {
+		return domain.DefaultTenantID, nil
+	}
+	if key == "" {
+		return "", ErrUnauthenticated
+	}
+
+	tenantID := ""
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(k.key, []byte(key)) == 1 {
+			tenantID = k.tenantID
+		}
+	}
+	if tenantID == "" {
+		return "", ErrUnauthenticated
+	}
+	return tenantID, nil
+}
+
+// IsAdmin сообщает, доступны ли арендатору административные маршруты.
+// Без ключей администратором считается любой клиент только при явно выключенной аутентификации.
+func (a *Authenticator) IsAdmin(tenantID string) bool {
+	if !a.Enabled() {
+		return a.disabled
+	}
+	return tenantID == a.adminTenant
+}
+
+// ValidateID проверяет идентификатор арендатора
+func ValidateID(tenantID string) error {
+	return validateID(tenantID)
+}
+
+// ParseAPIKeys разбирает пары "key=tenant", разделённые ";"
+func ParseAPIKeys(spec string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, tenantID, ok := strings.Cut(entry, "=")
+		key, tenantID = strings.TrimSpace(key), strings.TrimSpace(tenantID)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w: api key entry must look like key=tenant", ErrInvalidConfig)
+		}
+		if err := validateID(tenantID); err != nil {
+			return nil, err
+		}
+		if _, exists := keys[key]; exists {
+			return nil, fmt.Errorf("%w: duplicate api key for tenant %q", ErrInvalidConfig, tenantID)
+		}
+		keys[key] = tenantID
+	}
+	return keys, nil
+}
+
+func validateID(tenantID string) error {
+	if !idPattern.MatchString(tenantID) {
+		return fmt.Errorf("%w: tenant id %q must match %s", ErrInvalidConfig, tenantID, idPattern)
+	}
+	return nil
+}
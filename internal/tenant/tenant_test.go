@@ -0,0 +1,164 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys(" key-a = team-a ; key-b=team-b;")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"key-a": "team-a", "key-b": "team-b"}, keys)
+
+	keys, err = ParseAPIKeys("")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	for _, spec := range []string{"key-a", "=team-a", "key-a=", "key-a=team a", "key-a=x;key-a=y"} {
+		_, err := ParseAPIKeys(spec)
+		assert.ErrorIs(t, err, ErrInvalidConfig, spec)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	// Без ключей и явного выключения аутентификации административные маршруты закрыты
+	anonymous := NewAuthenticator(nil, "", false)
+	tenantID, err := anonymous.Authenticate("")
+	require.NoError(t, err)
+	assert.Equal(t, domain.DefaultTenantID, tenantID)
+	assert.False(t, anonymous.IsAdmin(domain.DefaultTenantID))
+
+	disabled := NewAuthenticator(nil, "", true)
+	tenantID, err = disabled.Authenticate("")
+	require.NoError(t, err)
+	assert.Equal(t, domain.DefaultTenantID, tenantID)
+	assert.True(t, disabled.IsAdmin(domain.DefaultTenantID))
+
+	auth := NewAuthenticator(map[string]string{"key-a": "team-a", "key-ops": "ops"}, "ops", true)
+	tenantID, err = auth.Authenticate("key-a")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", tenantID)
+
+	_, err = auth.Authenticate("")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = auth.Authenticate("key-b")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	assert.True(t, auth.IsAdmin("ops"))
+	assert.False(t, auth.IsAdmin("team-a"))
+	assert.False(t, auth.IsAdmin(domain.DefaultTenantID))
+}
+
+func TestRequire(t *testing.T) {
+	_, err := Require(context.Background())
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	_, err = Require(WithID(context.Background(), ""))
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	tenantID, err := Require(WithID(context.Background(), "team-a"))
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", tenantID)
+}
+
+func TestParseQuotas(t *testing.T) {
+	quotas, err := ParseQuotas("team-a=10:1000; team-b=0.5:0")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Quota{
+		"team-a": {IngestRate: 10, MaxRows: 1000},
+		"team-b": {IngestRate: 0.5},
+	}, quotas)
+
+	for _, spec := range []string{"team-a=10", "team-a", "team-a=-1:0", "team-a=1:-5", "team-a=x:1", "bad id=1:1"} {
+		_, err := ParseQuotas(spec)
+		assert.ErrorIs(t, err, ErrInvalidConfig, spec)
+	}
+}
+
+type MockRowCounter struct {
+	mock.Mock
+}
+
+func (m *MockRowCounter) CountRowsByTenant(ctx context.Context) (map[string]int64, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+type MockPacketProcessor struct {
+	mock.Mock
+}
+
+func (m *MockPacketProcessor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	args := m.Called(ctx, packet)
+	return args.Error(0)
+}
+
+func packetFor(tenantID string) *domain.DataPacket {
+	return &domain.DataPacket{ID: uuid.New(), TenantID: tenantID, Timestamp: time.Now(), Payload: []int64{1}}
+}
+
+func TestQuotaEnforcer_IngestRate(t *testing.T) {
+	next := new(MockPacketProcessor)
+	next.On("ProcessPacket", mock.Anything, mock.Anything).Return(nil)
+	logger, _ := zap.NewDevelopment()
+
+	enforcer := NewQuotaEnforcer(next, new(MockRowCounter), QuotaConfig{
+		Tenants: map[string]Quota{"team-a": {IngestRate: 2}},
+	}, logger)
+	now := time.Date(2025, 9, 15, 12, 0, 0, 0, time.UTC)
+	enforcer.now = func() time.Time { return now }
+
+	// Допускается всплеск в размере секундной нормы
+	require.NoError(t, enforcer.ProcessPacket(context.Background(), packetFor("team-a")))
+	require.NoError(t, enforcer.ProcessPacket(context.Background(), packetFor("team-a")))
+	assert.ErrorIs(t, enforcer.ProcessPacket(context.Background(), packetFor("team-a")), ErrQuotaExceeded)
+
+	// Квота одного арендатора не влияет на другого
+	require.NoError(t, enforcer.ProcessPacket(context.Background(), packetFor("team-b")))
+
+	now = now.Add(500 * time.Millisecond)
+	require.NoError(t, enforcer.ProcessPacket(context.Background(), packetFor("team-a")))
+	assert.ErrorIs(t, enforcer.ProcessPacket(context.Background(), packetFor("team-a")), ErrQuotaExceeded)
+
+	next.AssertNumberOfCalls(t, "ProcessPacket", 4)
+}
+
+func TestQuotaEnforcer_MaxRows(t *testing.T) {
+	next := new(MockPacketProcessor)
+	failed := packetFor("team-a")
+	next.On("ProcessPacket", mock.Anything, failed).Return(errors.New("db down"))
+	next.On("ProcessPacket", mock.Anything, mock.Anything).Return(nil)
+	counter := new(MockRowCounter)
+	counter.On("CountRowsByTenant", mock.Anything).Return(map[string]int64{"team-a": 1}, nil)
+	logger, _ := zap.NewDevelopment()
+
+	enforcer := NewQuotaEnforcer(next, counter, QuotaConfig{Default: Quota{MaxRows: 2}}, logger)
+	require.NoError(t, enforcer.Refresh(context.Background()))
+
+	// Несохранённый пакет не расходует квоту
+	assert.Error(t, enforcer.ProcessPacket(context.Background(), failed))
+	require.NoError(t, enforcer.ProcessPacket(context.Background(), packetFor("team-a")))
+	assert.ErrorIs(t, enforcer.ProcessPacket(context.Background(), packetFor("team-a")), ErrQuotaExceeded)
+
+	// Пакет без арендатора учитывается в квоте арендатора по умолчанию
+	require.NoError(t, enforcer.ProcessPacket(context.Background(), packetFor("")))
+
+	// После пересчёта по базе освобождённая квота снова доступна
+	counter.ExpectedCalls = nil
+	counter.On("CountRowsByTenant", mock.Anything).Return(map[string]int64{"team-a": 0}, nil)
+	require.NoError(t, enforcer.Refresh(context.Background()))
+	require.NoError(t, enforcer.ProcessPacket(context.Background(), packetFor("team-a")))
+}
@@ -0,0 +1,242 @@
+// Package timepolicy проверяет время устройства в пакете относительно времени сервера
+// и применяет к пакетам вне допуска настроенное действие, в том числе откладывает их в карантин.
+package timepolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Policy действие для пакета, время устройства которого вышло за допуск
+type Policy string
+
+const (
+	// PolicyAccept принимает пакет как есть, нарушение только учитывается в метриках
+	PolicyAccept Policy = "accept"
+	// PolicyClamp прижимает время пакета к ближайшей границе допуска, сохраняя исходное время
+	PolicyClamp Policy = "clamp"
+	// PolicyReject отклоняет пакет
+	PolicyReject Policy = "reject"
+	// PolicyQuarantine сохраняет пакет в карантин до ручного разбора
+	PolicyQuarantine Policy = "quarantine"
+)
+
+// Направления отклонения времени устройства
+const (
+	ReasonTooOld = "too_old"
+	ReasonTooNew = "too_new"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// ErrInvalidConfig возвращается для некорректной политики или допуска
+var ErrInvalidConfig = errors.New("invalid timestamp policy configuration")
+
+type Config struct {
+	Policy    Policy
+	MaxPast   time.Duration // насколько время устройства может отставать от времени сервера, 0 — без ограничения
+	MaxFuture time.Duration // насколько время устройства может опережать время сервера, 0 — без ограничения
+}
+
+// Store хранилище карантина. Записи разделены по арендаторам.
+type Store interface {
+	SaveQuarantinedPacket(ctx context.Context, packet *domain.QuarantinedPacket) error
+	ListQuarantinedPackets(ctx context.Context, tenantID string, limit int) ([]*domain.QuarantinedPacket, error)
+	// GetQuarantinedPacket возвращает nil, если пакета нет в карантине
+	GetQuarantinedPacket(ctx context.Context, tenantID string, packetID uuid.UUID) (*domain.QuarantinedPacket, error)
+	DeleteQuarantinedPacket(ctx context.Context, tenantID string, packetID uuid.UUID) (bool, error)
+}
+
+// PacketProcessor обрабатывает пакет, прошедший проверку времени
+type PacketProcessor interface {
+	ProcessPacket(ctx context.Context, packet *domain.DataPacket) error
+}
+
+// Processor проставляет время приёма пакета и проверяет время устройства перед передачей пакета дальше
+type Processor struct {
+	next   PacketProcessor
+	store  Store
+	cfg    Config
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+func NewProcessor(next PacketProcessor, store Store, cfg Config, logger *zap.Logger) (*Processor, error) {
+	switch cfg.Policy {
+	case "":
+		cfg.Policy = PolicyAccept
+	case PolicyAccept, PolicyClamp, PolicyReject, PolicyQuarantine:
+	default:
+		return nil, fmt.Errorf("%w: unknown policy %q", ErrInvalidConfig, cfg.Policy)
+	}
+	if cfg.MaxPast < 0 || cfg.MaxFuture < 0 {
+		return nil, fmt.Errorf("%w: tolerance must not be negative", ErrInvalidConfig)
+	}
+
+	return &Processor{
+		next:   next,
+		store:  store,
+		cfg:    cfg,
+		logger: logger,
+		now:    time.Now,
+	}, nil
+}
+
+func (p *Processor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	if packet == nil {
+		return p.next.ProcessPacket(ctx, packet)
+	}
+
+	if packet.ReceivedAt.IsZero() {
+		packet.ReceivedAt = p.now().UTC()
+	}
+
+	reason, bound := p.check(packet)
+	if reason == "" {
+		return p.next.ProcessPacket(ctx, packet)
+	}
+	metrics.TimestampSkewedPackets.WithLabelValues(reason, string(p.cfg.Policy)).Inc()
+
+	fields := []zap.Field{
+		zap.String("packet_id", packet.ID.String()),
+		zap.String("tenant", packet.Tenant()),
+		zap.String("reason", reason),
+		zap.Time("timestamp", packet.Timestamp),
+		zap.Time("received_at", packet.ReceivedAt),
+	}
+
+	switch p.cfg.Policy {
+	case PolicyClamp:
+		p.logger.Debug("[TimePolicy] Packet timestamp clamped", fields...)
+		packet.ClampedFrom = packet.Timestamp
+		packet.Timestamp = bound
+	case PolicyReject:
+		p.logger.Warn("[TimePolicy] Packet rejected", fields...)
+		metrics.ValidationRejectedPackets.WithLabelValues(string(validation.ReasonTimestampSkew), packet.Tenant()).Inc()
+		return &validation.Error{
+			Reason:  validation.ReasonTimestampSkew,
+			Message: fmt.Sprintf("timestamp %s is %s relative to server time %s", packet.Timestamp.Format(time.RFC3339), reason, packet.ReceivedAt.Format(time.RFC3339)),
+		}
+	case PolicyQuarantine:
+		return p.quarantine(ctx, packet, reason, fields)
+	}
+
+	return p.next.ProcessPacket(ctx, packet)
+}
+
+// check возвращает направление отклонения и ближайшую границу допуска; пустое направление — время в допуске
+func (p *Processor) check(packet *domain.DataPacket) (string, time.Time) {
+	if p.cfg.MaxPast > 0 {
+		if oldest := packet.ReceivedAt.Add(-p.cfg.MaxPast); packet.Timestamp.Before(oldest) {
+			return ReasonTooOld, oldest
+		}
+	}
+	if p.cfg.MaxFuture > 0 {
+		if newest := packet.ReceivedAt.Add(p.cfg.MaxFuture); packet.Timestamp.After(newest) {
+			return ReasonTooNew, newest
+		}
+	}
+	return "", time.Time{}
+}
+
+func (p *Processor) quarantine(ctx context.Context, packet *domain.DataPacket, reason string, fields []zap.Field) error {
+	err := p.store.SaveQuarantinedPacket(ctx, &domain.QuarantinedPacket{
+		PacketID:   packet.ID,
+		TenantID:   packet.Tenant(),
+		SourceID:   packet.SourceID,
+		Reason:     reason,
+		Timestamp:  packet.Timestamp,
+		ReceivedAt: packet.ReceivedAt,
+		Packet:     packet,
+	})
+	if err != nil {
+		metrics.QuarantinedPackets.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to quarantine packet: %w", err)
+	}
+
+	metrics.QuarantinedPackets.WithLabelValues("quarantined").Inc()
+	p.logger.Info("[TimePolicy] Packet quarantined", fields...)
+	return domain.ErrPacketQuarantined
+}
+
+// ListQuarantined возвращает пакеты карантина арендатора из контекста, начиная с последних принятых
+func (p *Processor) ListQuarantined(ctx context.Context, limit int) ([]*domain.QuarantinedPacket, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	return p.store.ListQuarantinedPackets(ctx, tenantID, limit)
+}
+
+// GetQuarantined возвращает пакет карантина арендатора из контекста или nil
+func (p *Processor) GetQuarantined(ctx context.Context, packetID uuid.UUID) (*domain.QuarantinedPacket, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.store.GetQuarantinedPacket(ctx, tenantID, packetID)
+}
+
+// Release передаёт пакет из карантина в обработку с исходным временем устройства
+// и удаляет его из карантина. Возвращает false, если пакета нет в карантине.
+func (p *Processor) Release(ctx context.Context, packetID uuid.UUID) (bool, error) {
+	quarantined, err := p.GetQuarantined(ctx, packetID)
+	if err != nil || quarantined == nil {
+		return false, err
+	}
+
+	packet := quarantined.Packet
+	packet.TenantID = quarantined.TenantID
+	packet.ReceivedAt = quarantined.ReceivedAt
+	if err := p.next.ProcessPacket(ctx, packet); err != nil {
+		return true, err
+	}
+
+	if _, err := p.store.DeleteQuarantinedPacket(ctx, quarantined.TenantID, packetID); err != nil {
+		// Пакет уже сохранён: повторный выпуск отсечёт дедупликация
+		return true, err
+	}
+
+	metrics.QuarantinedPackets.WithLabelValues("released").Inc()
+	p.logger.Info("[TimePolicy] Packet released from quarantine",
+		zap.String("packet_id", packetID.String()),
+		zap.String("tenant", quarantined.TenantID))
+	return true, nil
+}
+
+// Discard удаляет пакет из карантина без обработки
+func (p *Processor) Discard(ctx context.Context, packetID uuid.UUID) (bool, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	found, err := p.store.DeleteQuarantinedPacket(ctx, tenantID, packetID)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		metrics.QuarantinedPackets.WithLabelValues("discarded").Inc()
+	}
+	return found, nil
+}
@@ -0,0 +1,186 @@
+package timepolicy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/tenant"
+	"github.com/CoolE88/data-aggregation-service/internal/validation"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) SaveQuarantinedPacket(ctx context.Context, packet *domain.QuarantinedPacket) error {
+	args := m.Called(ctx, packet)
+	return args.Error(0)
+}
+
+func (m *MockStore) ListQuarantinedPackets(ctx context.Context, tenantID string, limit int) ([]*domain.QuarantinedPacket, error) {
+	args := m.Called(ctx, tenantID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.QuarantinedPacket), args.Error(1)
+}
+
+func (m *MockStore) GetQuarantinedPacket(ctx context.Context, tenantID string, packetID uuid.UUID) (*domain.QuarantinedPacket, error) {
+	args := m.Called(ctx, tenantID, packetID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.QuarantinedPacket), args.Error(1)
+}
+
+func (m *MockStore) DeleteQuarantinedPacket(ctx context.Context, tenantID string, packetID uuid.UUID) (bool, error) {
+	args := m.Called(ctx, tenantID, packetID)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockPacketProcessor struct {
+	mock.Mock
+}
+
+func (m *MockPacketProcessor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	args := m.Called(ctx, packet)
+	return args.Error(0)
+}
+
+var serverTime = time.Date(2025, 9, 18, 12, 0, 0, 0, time.UTC)
+
+func newProcessor(t *testing.T, policy Policy, next PacketProcessor, store Store) *Processor {
+	logger, _ := zap.NewDevelopment()
+	processor, err := NewProcessor(next, store, Config{Policy: policy, MaxPast: 24 * time.Hour, MaxFuture: 5 * time.Minute}, logger)
+	require.NoError(t, err)
+	processor.now = func() time.Time { return serverTime }
+	return processor
+}
+
+func packetAt(timestamp time.Time) *domain.DataPacket {
+	return &domain.DataPacket{ID: uuid.New(), TenantID: "team-a", Timestamp: timestamp, Payload: []int64{1}}
+}
+
+func TestNewProcessor_InvalidConfig(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	_, err := NewProcessor(nil, nil, Config{Policy: "drop"}, logger)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	_, err = NewProcessor(nil, nil, Config{Policy: PolicyReject, MaxPast: -time.Second}, logger)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestProcessor_Policies(t *testing.T) {
+	next := new(MockPacketProcessor)
+	next.On("ProcessPacket", mock.Anything, mock.Anything).Return(nil)
+
+	// Время в допуске передаётся дальше с проставленным временем приёма
+	packet := packetAt(serverTime.Add(-time.Hour))
+	require.NoError(t, newProcessor(t, PolicyReject, next, nil).ProcessPacket(context.Background(), packet))
+	assert.Equal(t, serverTime, packet.ReceivedAt)
+
+	// Время приёма, проставленное при получении пакета, не перезаписывается
+	receivedAt := serverTime.Add(-time.Minute)
+	packet = packetAt(serverTime.Add(-time.Hour))
+	packet.ReceivedAt = receivedAt
+	require.NoError(t, newProcessor(t, PolicyReject, next, nil).ProcessPacket(context.Background(), packet))
+	assert.Equal(t, receivedAt, packet.ReceivedAt)
+
+	packet = packetAt(serverTime.AddDate(-30, 0, 0))
+	require.NoError(t, newProcessor(t, PolicyAccept, next, nil).ProcessPacket(context.Background(), packet))
+	assert.True(t, packet.ClampedFrom.IsZero())
+
+	// Прижатое время сохраняет исходное время устройства
+	deviceTime := serverTime.Add(time.Hour)
+	packet = packetAt(deviceTime)
+	require.NoError(t, newProcessor(t, PolicyClamp, next, nil).ProcessPacket(context.Background(), packet))
+	assert.Equal(t, serverTime.Add(5*time.Minute), packet.Timestamp)
+	assert.Equal(t, deviceTime, packet.ClampedFrom)
+
+	packet = packetAt(serverTime.AddDate(0, 0, -2))
+	require.NoError(t, newProcessor(t, PolicyClamp, next, nil).ProcessPacket(context.Background(), packet))
+	assert.Equal(t, serverTime.Add(-24*time.Hour), packet.Timestamp)
+
+	err := newProcessor(t, PolicyReject, next, nil).ProcessPacket(context.Background(), packetAt(serverTime.AddDate(-1, 0, 0)))
+	assert.ErrorIs(t, err, validation.ErrTimestampSkew)
+
+	next.AssertNumberOfCalls(t, "ProcessPacket", 5)
+}
+
+func TestProcessor_Quarantine(t *testing.T) {
+	next := new(MockPacketProcessor)
+	store := new(MockStore)
+	processor := newProcessor(t, PolicyQuarantine, next, store)
+
+	packet := packetAt(serverTime.Add(time.Hour))
+	store.On("SaveQuarantinedPacket", mock.Anything, mock.MatchedBy(func(q *domain.QuarantinedPacket) bool {
+		return q.PacketID == packet.ID && q.TenantID == "team-a" && q.Reason == ReasonTooNew && q.ReceivedAt.Equal(serverTime)
+	})).Return(nil).Once()
+
+	err := processor.ProcessPacket(context.Background(), packet)
+	assert.ErrorIs(t, err, domain.ErrPacketQuarantined)
+	next.AssertNotCalled(t, "ProcessPacket", mock.Anything, mock.Anything)
+
+	store.On("SaveQuarantinedPacket", mock.Anything, mock.Anything).Return(errors.New("db down")).Once()
+	err = processor.ProcessPacket(context.Background(), packetAt(serverTime.Add(time.Hour)))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, domain.ErrPacketQuarantined)
+
+	store.AssertExpectations(t)
+}
+
+func TestProcessor_Review(t *testing.T) {
+	next := new(MockPacketProcessor)
+	store := new(MockStore)
+	processor := newProcessor(t, PolicyQuarantine, next, store)
+	ctx := tenant.WithID(context.Background(), "team-a")
+
+	packet := packetAt(serverTime.AddDate(-1, 0, 0))
+	quarantined := &domain.QuarantinedPacket{
+		PacketID:   packet.ID,
+		TenantID:   "team-a",
+		Reason:     ReasonTooOld,
+		Timestamp:  packet.Timestamp,
+		ReceivedAt: serverTime,
+		Packet:     packet,
+	}
+	store.On("ListQuarantinedPackets", ctx, "team-a", defaultListLimit).Return([]*domain.QuarantinedPacket{quarantined}, nil)
+	store.On("GetQuarantinedPacket", ctx, "team-a", packet.ID).Return(quarantined, nil)
+	store.On("GetQuarantinedPacket", ctx, "team-a", mock.Anything).Return(nil, nil)
+	store.On("DeleteQuarantinedPacket", ctx, "team-a", packet.ID).Return(true, nil)
+
+	list, err := processor.ListQuarantined(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	_, err = processor.ListQuarantined(context.Background(), 0)
+	assert.ErrorIs(t, err, tenant.ErrUnauthenticated)
+
+	// Выпущенный пакет обрабатывается с исходным временем устройства
+	next.On("ProcessPacket", ctx, mock.MatchedBy(func(p *domain.DataPacket) bool {
+		return p.ID == packet.ID && p.Timestamp.Equal(serverTime.AddDate(-1, 0, 0)) && p.ReceivedAt.Equal(serverTime)
+	})).Return(nil).Once()
+	found, err := processor.Release(ctx, packet.ID)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = processor.Release(ctx, uuid.New())
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	found, err = processor.Discard(ctx, packet.ID)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	next.AssertExpectations(t)
+}
@@ -0,0 +1,334 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Reason причина отклонения пакета, используется как лейбл метрики
+type Reason string
+
+const (
+	ReasonEmptyPayload    Reason = "empty_payload"
+	ReasonPayloadTooShort Reason = "payload_too_short"
+	ReasonPayloadTooLong  Reason = "payload_too_long"
+	ReasonValueOutOfRange Reason = "value_out_of_range"
+	ReasonZeroUUID        Reason = "zero_uuid"
+	ReasonInvalidDecimal  Reason = "invalid_decimal"
+	ReasonNonFiniteValue  Reason = "non_finite_value"
+	ReasonNilPacket       Reason = "nil_packet"
+	ReasonInvalidSource   Reason = "invalid_source"
+	ReasonInvalidLabels   Reason = "invalid_labels"
+	ReasonInvalidSeries   Reason = "invalid_series"
+	ReasonUnknownSchema   Reason = "unknown_schema"
+	ReasonSchemaMismatch  Reason = "schema_mismatch"
+	ReasonTimestampSkew   Reason = "timestamp_skew"
+)
+
+// Ограничения на идентификатор источника и лейблы: они хранятся в каждой строке результатов
+const (
+	maxSourceIDLength   = 128
+	maxLabels           = 32
+	maxLabelKeyLength   = 64
+	maxLabelValueLength = 256
+	maxSeries           = 32
+)
+
+// seriesNamePattern имя серии: оно хранится в каждой строке результатов и используется в запросах
+var seriesNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// Error ошибка валидации пакета. errors.Is сравнивает ошибки по причине.
+type Error struct {
+	Reason  Reason
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("packet validation failed (%s): %s", e.Reason, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Reason == e.Reason
+}
+
+var (
+	ErrEmptyPayload    = &Error{Reason: ReasonEmptyPayload, Message: "payload is empty"}
+	ErrPayloadTooShort = &Error{Reason: ReasonPayloadTooShort, Message: "payload is too short"}
+	ErrPayloadTooLong  = &Error{Reason: ReasonPayloadTooLong, Message: "payload is too long"}
+	ErrValueOutOfRange = &Error{Reason: ReasonValueOutOfRange, Message: "payload value is out of allowed range"}
+	ErrZeroUUID        = &Error{Reason: ReasonZeroUUID, Message: "packet id is zero UUID"}
+	ErrInvalidDecimal  = &Error{Reason: ReasonInvalidDecimal, Message: "payload contains invalid decimal value"}
+	ErrNonFiniteValue  = &Error{Reason: ReasonNonFiniteValue, Message: "payload contains non-finite value"}
+	ErrNilPacket       = &Error{Reason: ReasonNilPacket, Message: "packet is nil"}
+	ErrInvalidSource   = &Error{Reason: ReasonInvalidSource, Message: "source id is invalid"}
+	ErrInvalidLabels   = &Error{Reason: ReasonInvalidLabels, Message: "labels are invalid"}
+	ErrInvalidSeries   = &Error{Reason: ReasonInvalidSeries, Message: "series are invalid"}
+	ErrUnknownSchema   = &Error{Reason: ReasonUnknownSchema, Message: "packet schema is not registered"}
+	ErrSchemaMismatch  = &Error{Reason: ReasonSchemaMismatch, Message: "packet does not match its schema"}
+	ErrTimestampSkew   = &Error{Reason: ReasonTimestampSkew, Message: "packet timestamp is outside the tolerance window"}
+)
+
+// EmptyPayloadPolicy определяет, что делать с пакетом без значений
+type EmptyPayloadPolicy string
+
+const (
+	// EmptyPayloadReject отклоняет пакет
+	EmptyPayloadReject EmptyPayloadPolicy = "reject"
+	// EmptyPayloadStoreNull сохраняет пакет с NULL вместо максимума и флагом empty_payload
+	EmptyPayloadStoreNull EmptyPayloadPolicy = "store_null"
+)
+
+// Rules правила валидации. Нулевые длины и nil границы означают отсутствие ограничения.
+type Rules struct {
+	EmptyPayload     EmptyPayloadPolicy
+	MinPayloadLength int
+	MaxPayloadLength int
+	MinValue         *float64
+	MaxValue         *float64
+	RejectZeroUUID   bool
+}
+
+type Validator struct {
+	rules Rules
+}
+
+func NewValidator(rules Rules) (*Validator, error) {
+	switch rules.EmptyPayload {
+	case "":
+		rules.EmptyPayload = EmptyPayloadReject
+	case EmptyPayloadReject, EmptyPayloadStoreNull:
+	default:
+		return nil, fmt.Errorf("unknown empty payload policy: %q", rules.EmptyPayload)
+	}
+	if rules.MinPayloadLength < 0 || rules.MaxPayloadLength < 0 {
+		return nil, fmt.Errorf("payload length limits must not be negative")
+	}
+	if rules.MaxPayloadLength > 0 && rules.MinPayloadLength > rules.MaxPayloadLength {
+		return nil, fmt.Errorf("min payload length is greater than max payload length")
+	}
+	if rules.MinValue != nil && rules.MaxValue != nil && *rules.MinValue > *rules.MaxValue {
+		return nil, fmt.Errorf("min value is greater than max value")
+	}
+
+	return &Validator{rules: rules}, nil
+}
+
+// Validate проверяет пакет и возвращает *Error с причиной отклонения
+func (v *Validator) Validate(packet *domain.DataPacket) error {
+	if packet == nil {
+		return ErrNilPacket
+	}
+
+	if v.rules.RejectZeroUUID && packet.ID == uuid.Nil {
+		return ErrZeroUUID
+	}
+
+	if err := validateIdentity(packet); err != nil {
+		return err
+	}
+
+	if err := validateSeries(packet); err != nil {
+		return err
+	}
+
+	// Правила пейлоада применяются к каждой серии отдельно
+	for _, name := range packet.SeriesNames() {
+		if err := v.validateValues(name, packet.SeriesValues(name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateValues проверяет длину и границы значений одной серии
+func (v *Validator) validateValues(series string, payload domain.SeriesPayload) error {
+	values, err := payloadValues(payload)
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if series != domain.DefaultSeries {
+		prefix = fmt.Sprintf("series %q: ", series)
+	}
+
+	if len(values) == 0 {
+		if v.rules.EmptyPayload == EmptyPayloadStoreNull {
+			return nil
+		}
+		if prefix == "" {
+			return ErrEmptyPayload
+		}
+		return &Error{Reason: ReasonEmptyPayload, Message: prefix + "payload is empty"}
+	}
+
+	if v.rules.MinPayloadLength > 0 && len(values) < v.rules.MinPayloadLength {
+		return &Error{Reason: ReasonPayloadTooShort, Message: fmt.Sprintf("%spayload length %d is less than %d", prefix, len(values), v.rules.MinPayloadLength)}
+	}
+	if v.rules.MaxPayloadLength > 0 && len(values) > v.rules.MaxPayloadLength {
+		return &Error{Reason: ReasonPayloadTooLong, Message: fmt.Sprintf("%spayload length %d is greater than %d", prefix, len(values), v.rules.MaxPayloadLength)}
+	}
+
+	for i, value := range values {
+		if v.rules.MinValue != nil && value < *v.rules.MinValue {
+			return &Error{Reason: ReasonValueOutOfRange, Message: fmt.Sprintf("%svalue %v at index %d is less than %v", prefix, value, i, *v.rules.MinValue)}
+		}
+		if v.rules.MaxValue != nil && value > *v.rules.MaxValue {
+			return &Error{Reason: ReasonValueOutOfRange, Message: fmt.Sprintf("%svalue %v at index %d is greater than %v", prefix, value, i, *v.rules.MaxValue)}
+		}
+	}
+
+	return nil
+}
+
+// validateSeries проверяет количество и имена серий. Пакет с сериями не может содержать безымянный пейлоад.
+func validateSeries(packet *domain.DataPacket) error {
+	if len(packet.Series) == 0 {
+		return nil
+	}
+
+	if packet.PayloadLen() > 0 {
+		return &Error{Reason: ReasonInvalidSeries, Message: "packet has both payload and series"}
+	}
+	if len(packet.Series) > maxSeries {
+		return &Error{Reason: ReasonInvalidSeries, Message: fmt.Sprintf("packet has %d series, at most %d allowed", len(packet.Series), maxSeries)}
+	}
+	for name := range packet.Series {
+		if !ValidSeriesName(name) {
+			return &Error{Reason: ReasonInvalidSeries, Message: fmt.Sprintf("series name %q must match %s", name, seriesNamePattern)}
+		}
+	}
+
+	return nil
+}
+
+// ValidSeriesName сообщает, допустимо ли имя серии
+func ValidSeriesName(name string) bool {
+	return seriesNamePattern.MatchString(name)
+}
+
+// validateIdentity проверяет длину идентификатора источника, количество и размер лейблов
+func validateIdentity(packet *domain.DataPacket) error {
+	if len(packet.SourceID) > maxSourceIDLength {
+		return &Error{Reason: ReasonInvalidSource, Message: fmt.Sprintf("source id is longer than %d characters", maxSourceIDLength)}
+	}
+
+	if len(packet.Labels) > maxLabels {
+		return &Error{Reason: ReasonInvalidLabels, Message: fmt.Sprintf("packet has %d labels, at most %d allowed", len(packet.Labels), maxLabels)}
+	}
+	for key, value := range packet.Labels {
+		if key == "" {
+			return &Error{Reason: ReasonInvalidLabels, Message: "label key is empty"}
+		}
+		if len(key) > maxLabelKeyLength {
+			return &Error{Reason: ReasonInvalidLabels, Message: fmt.Sprintf("label key %q is longer than %d characters", key, maxLabelKeyLength)}
+		}
+		if len(value) > maxLabelValueLength {
+			return &Error{Reason: ReasonInvalidLabels, Message: fmt.Sprintf("value of label %q is longer than %d characters", key, maxLabelValueLength)}
+		}
+	}
+
+	return nil
+}
+
+// payloadValues приводит пейлоад любого типа к float64 для проверки длины и границ
+func payloadValues(payload domain.SeriesPayload) ([]float64, error) {
+	switch payload.Kind() {
+	case domain.PayloadKindFloat:
+		for i, value := range payload.FloatPayload {
+			if err := CheckFinite(value, i); err != nil {
+				return nil, err
+			}
+		}
+		return payload.FloatPayload, nil
+	case domain.PayloadKindDecimal:
+		values := make([]float64, len(payload.DecimalPayload))
+		for i, text := range payload.DecimalPayload {
+			value, err := ParseDecimal(text, i)
+			if err != nil {
+				return nil, err
+			}
+			values[i], _ = value.Float64()
+		}
+		return values, nil
+	default:
+		values := make([]float64, len(payload.Payload))
+		for i, value := range payload.Payload {
+			values[i] = float64(value)
+		}
+		return values, nil
+	}
+}
+
+// CheckFinite отклоняет NaN и ±Inf: сравнение с ними не определяет реальный максимум показаний
+func CheckFinite(value float64, index int) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return &Error{Reason: ReasonNonFiniteValue, Message: fmt.Sprintf("value %v at index %d is not finite", value, index)}
+	}
+	return nil
+}
+
+// ParseDecimal разбирает десятичную запись значения. Дроби вида 1/3 и экспоненциальная
+// запись не принимаются, так как значение хранится и отдаётся в исходной записи.
+func ParseDecimal(text string, index int) (*big.Rat, error) {
+	value, ok := new(big.Rat).SetString(text)
+	if !ok || strings.ContainsAny(text, "/eE") {
+		return nil, &Error{Reason: ReasonInvalidDecimal, Message: fmt.Sprintf("invalid decimal %q at index %d", text, index)}
+	}
+	return value, nil
+}
+
+// PacketProcessor обрабатывает пакет, прошедший валидацию
+type PacketProcessor interface {
+	ProcessPacket(ctx context.Context, packet *domain.DataPacket) error
+}
+
+// ValidatingProcessor проверяет пакеты перед передачей в DataService.ProcessPacket
+type ValidatingProcessor struct {
+	next      PacketProcessor
+	validator *Validator
+	logger    *zap.Logger
+}
+
+func NewValidatingProcessor(next PacketProcessor, validator *Validator, logger *zap.Logger) *ValidatingProcessor {
+	return &ValidatingProcessor{
+		next:      next,
+		validator: validator,
+		logger:    logger,
+	}
+}
+
+func (p *ValidatingProcessor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	if err := p.validator.Validate(packet); err != nil {
+		reason := Reason("unknown")
+		if validationErr, ok := err.(*Error); ok {
+			reason = validationErr.Reason
+		}
+		tenantID := ""
+		if packet != nil {
+			tenantID = packet.Tenant()
+		}
+		metrics.ValidationRejectedPackets.WithLabelValues(string(reason), tenantID).Inc()
+
+		fields := []zap.Field{zap.String("reason", string(reason)), zap.Error(err)}
+		if packet != nil {
+			fields = append(fields, zap.String("packet_id", packet.ID.String()), zap.String("tenant", tenantID))
+		}
+		p.logger.Warn("[Validation] Packet rejected", fields...)
+		return err
+	}
+
+	return p.next.ProcessPacket(ctx, packet)
+}
@@ -0,0 +1,126 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockProcessor struct {
+	mock.Mock
+}
+
+func (m *MockProcessor) ProcessPacket(ctx context.Context, packet *domain.DataPacket) error {
+	args := m.Called(ctx, packet)
+	return args.Error(0)
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestValidator_Validate(t *testing.T) {
+	validator, err := NewValidator(Rules{
+		EmptyPayload:     EmptyPayloadReject,
+		MinPayloadLength: 2,
+		MaxPayloadLength: 4,
+		MinValue:         float(-100),
+		MaxValue:         float(100),
+		RejectZeroUUID:   true,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		packet   *domain.DataPacket
+		expected error
+	}{
+		{"valid int payload", &domain.DataPacket{ID: uuid.New(), Payload: []int64{1, 2, 3}}, nil},
+		{"valid float payload", &domain.DataPacket{ID: uuid.New(), FloatPayload: []float64{-99.5, 99.5}}, nil},
+		{"zero uuid", &domain.DataPacket{ID: uuid.Nil, Payload: []int64{1, 2}}, ErrZeroUUID},
+		{"empty payload", &domain.DataPacket{ID: uuid.New()}, ErrEmptyPayload},
+		{"too short", &domain.DataPacket{ID: uuid.New(), Payload: []int64{1}}, ErrPayloadTooShort},
+		{"too long", &domain.DataPacket{ID: uuid.New(), Payload: []int64{1, 2, 3, 4, 5}}, ErrPayloadTooLong},
+		{"value above range", &domain.DataPacket{ID: uuid.New(), Payload: []int64{1, 101}}, ErrValueOutOfRange},
+		{"decimal below range", &domain.DataPacket{ID: uuid.New(), DecimalPayload: []string{"1.5", "-100.01"}}, ErrValueOutOfRange},
+		{"invalid decimal", &domain.DataPacket{ID: uuid.New(), DecimalPayload: []string{"1.5", "abc"}}, ErrInvalidDecimal},
+		{"exponent decimal", &domain.DataPacket{ID: uuid.New(), DecimalPayload: []string{"1.5", "1e1"}}, ErrInvalidDecimal},
+		{"fraction decimal", &domain.DataPacket{ID: uuid.New(), DecimalPayload: []string{"1.5", "1/3"}}, ErrInvalidDecimal},
+		{"nan float", &domain.DataPacket{ID: uuid.New(), FloatPayload: []float64{1.5, math.NaN()}}, ErrNonFiniteValue},
+		{"inf float", &domain.DataPacket{ID: uuid.New(), FloatPayload: []float64{math.Inf(1), 1.5}}, ErrNonFiniteValue},
+		{"nil packet", nil, ErrNilPacket},
+		{"valid source and labels", &domain.DataPacket{ID: uuid.New(), SourceID: "sensor-1", Labels: map[string]string{"site": "a"}, Payload: []int64{1, 2}}, nil},
+		{"source too long", &domain.DataPacket{ID: uuid.New(), SourceID: strings.Repeat("s", 129), Payload: []int64{1, 2}}, ErrInvalidSource},
+		{"empty label key", &domain.DataPacket{ID: uuid.New(), Labels: map[string]string{"": "a"}, Payload: []int64{1, 2}}, ErrInvalidLabels},
+		{"label value too long", &domain.DataPacket{ID: uuid.New(), Labels: map[string]string{"site": strings.Repeat("v", 257)}, Payload: []int64{1, 2}}, ErrInvalidLabels},
+		{"valid series", &domain.DataPacket{ID: uuid.New(), Series: map[string]domain.SeriesPayload{"temperature": {FloatPayload: []float64{21.5, 22}}, "humidity": {Payload: []int64{40, 42}}}}, nil},
+		{"series with payload", &domain.DataPacket{ID: uuid.New(), Payload: []int64{1, 2}, Series: map[string]domain.SeriesPayload{"humidity": {Payload: []int64{40, 42}}}}, ErrInvalidSeries},
+		{"invalid series name", &domain.DataPacket{ID: uuid.New(), Series: map[string]domain.SeriesPayload{"hum idity": {Payload: []int64{40, 42}}}}, ErrInvalidSeries},
+		{"series value above range", &domain.DataPacket{ID: uuid.New(), Series: map[string]domain.SeriesPayload{"temperature": {Payload: []int64{1, 2}}, "voltage": {Payload: []int64{230, 231}}}}, ErrValueOutOfRange},
+		{"empty series", &domain.DataPacket{ID: uuid.New(), Series: map[string]domain.SeriesPayload{"temperature": {}}}, ErrEmptyPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.Validate(tt.packet)
+			if tt.expected == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.expected)
+
+			var validationErr *Error
+			require.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, tt.expected.(*Error).Reason, validationErr.Reason)
+		})
+	}
+}
+
+func TestValidator_EmptyPayloadStoreNull(t *testing.T) {
+	validator, err := NewValidator(Rules{EmptyPayload: EmptyPayloadStoreNull, MinPayloadLength: 3})
+	require.NoError(t, err)
+
+	assert.NoError(t, validator.Validate(&domain.DataPacket{ID: uuid.New()}))
+	assert.ErrorIs(t, validator.Validate(&domain.DataPacket{ID: uuid.New(), Payload: []int64{1}}), ErrPayloadTooShort)
+}
+
+func TestNewValidator_InvalidRules(t *testing.T) {
+	_, err := NewValidator(Rules{EmptyPayload: "drop"})
+	assert.Error(t, err)
+
+	_, err = NewValidator(Rules{MinPayloadLength: 5, MaxPayloadLength: 2})
+	assert.Error(t, err)
+
+	_, err = NewValidator(Rules{MinValue: float(10), MaxValue: float(1)})
+	assert.Error(t, err)
+}
+
+func TestValidatingProcessor_ProcessPacket(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	validator, err := NewValidator(Rules{RejectZeroUUID: true})
+	require.NoError(t, err)
+
+	next := new(MockProcessor)
+	processor := NewValidatingProcessor(next, validator, logger)
+
+	valid := &domain.DataPacket{ID: uuid.New(), Timestamp: time.Now(), Payload: []int64{1}}
+	next.On("ProcessPacket", mock.Anything, valid).Return(nil)
+
+	assert.NoError(t, processor.ProcessPacket(context.Background(), valid))
+
+	invalid := &domain.DataPacket{ID: uuid.Nil, Timestamp: time.Now(), Payload: []int64{1}}
+	assert.ErrorIs(t, processor.ProcessPacket(context.Background(), invalid), ErrZeroUUID)
+
+	next.AssertNumberOfCalls(t, "ProcessPacket", 1)
+}
@@ -0,0 +1,447 @@
+package window
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+	"github.com/CoolE88/data-aggregation-service/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+// Sink принимает результаты окон и опоздавшие пакеты (side output)
+type Sink interface {
+	SaveWindowResult(ctx context.Context, result *domain.WindowResult) error
+	SaveLatePacket(ctx context.Context, packet *domain.LatePacket) error
+}
+
+// CheckpointStore хранит снапшоты состояния открытых окон
+type CheckpointStore interface {
+	SaveWindowCheckpoint(ctx context.Context, name string, state []byte) error
+	// LoadWindowCheckpoint возвращает (nil, nil), если чекпоинта ещё нет
+	LoadWindowCheckpoint(ctx context.Context, name string) ([]byte, error)
+}
+
+// Config описывает окна событийного времени.
+// Если Slide равен нулю или Size, окна tumbling, иначе sliding.
+type Config struct {
+	Size               time.Duration
+	Slide              time.Duration
+	WatermarkDelay     time.Duration // допустимая неупорядоченность событий
+	AllowedLateness    time.Duration // сколько окно живёт после срабатывания
+	CheckpointInterval time.Duration
+}
+
+func (c Config) validate() error {
+	if c.Size <= 0 {
+		return fmt.Errorf("window size must be positive")
+	}
+	if c.Slide < 0 || c.Slide > c.Size {
+		return fmt.Errorf("window slide must be in (0, size]")
+	}
+	if c.WatermarkDelay < 0 || c.AllowedLateness < 0 {
+		return fmt.Errorf("watermark delay and allowed lateness must not be negative")
+	}
+	return nil
+}
+
+// windowState состояние одного окна, сериализуется в чекпоинт.
+// MaxDecimal — точный максимум, в чекпоинтах старого формата он пуст и берётся из MaxValue.
+type windowState struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	MaxValue   int64     `json:"max_value"`
+	MaxDecimal string    `json:"max_decimal,omitempty"`
+	Count      int64     `json:"count"`
+	Fired      bool      `json:"fired"`
+}
+
+// StreamKey поток событий, для которого ведутся свои окна и водяной знак:
+// серия источника арендатора. Пустой SourceID — источник по умолчанию.
+type StreamKey struct {
+	TenantID string
+	SourceID string
+	Series   string
+}
+
+// stream окна и водяной знак одного потока
+type stream struct {
+	maxEventTime time.Time
+	watermark    time.Time
+	windows      map[int64]*windowState // ключ — начало окна в наносекундах
+}
+
+func newStream() *stream {
+	return &stream{windows: make(map[int64]*windowState)}
+}
+
+// streamCheckpoint снапшот состояния одного потока
+type streamCheckpoint struct {
+	TenantID     string         `json:"tenant_id"`
+	SourceID     string         `json:"source_id,omitempty"`
+	Series       string         `json:"series,omitempty"`
+	MaxEventTime time.Time      `json:"max_event_time"`
+	Watermark    time.Time      `json:"watermark"`
+	Windows      []*windowState `json:"windows"`
+}
+
+// checkpoint снапшот состояния менеджера окон.
+// Чекпоинты до разделения по потокам хранили одно общее состояние в полях верхнего уровня,
+// при восстановлении оно относится к безымянной серии источника по умолчанию арендатора по умолчанию.
+type checkpoint struct {
+	MaxEventTime time.Time          `json:"max_event_time"`
+	Watermark    time.Time          `json:"watermark"`
+	Windows      []*windowState     `json:"windows,omitempty"`
+	Streams      []streamCheckpoint `json:"streams"`
+}
+
+// Manager считает максимум по окнам событийного времени (DataPacket.Timestamp) с водяным знаком.
+// Окна и водяной знак ведутся отдельно для каждого потока (арендатор, источник, серия), чтобы
+// отстающие часы одного устройства не делали опоздавшими пакеты других.
+// Окно срабатывает, когда водяной знак проходит его конец. Опоздавшие пакеты в пределах
+// AllowedLateness обновляют результат окна, более поздние уходят в side output.
+type Manager struct {
+	name   string
+	cfg    Config
+	sink   Sink
+	store  CheckpointStore
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	streams map[StreamKey]*stream
+}
+
+func NewManager(name string, cfg Config, sink Sink, store CheckpointStore, logger *zap.Logger) (*Manager, error) {
+	if cfg.Slide == 0 {
+		cfg.Slide = cfg.Size
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		name:    name,
+		cfg:     cfg,
+		sink:    sink,
+		store:   store,
+		logger:  logger,
+		streams: make(map[StreamKey]*stream),
+	}, nil
+}
+
+// Restore восстанавливает открытые окна из последнего чекпоинта
+func (m *Manager) Restore(ctx context.Context) error {
+	data, err := m.store.LoadWindowCheckpoint(ctx, m.name)
+	if err != nil {
+		return fmt.Errorf("failed to load window checkpoint: %w", err)
+	}
+	if data == nil {
+		return nil
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("failed to decode window checkpoint: %w", err)
+	}
+
+	if !cp.Watermark.IsZero() || len(cp.Windows) > 0 {
+		cp.Streams = append(cp.Streams, streamCheckpoint{
+			TenantID:     domain.DefaultTenantID,
+			MaxEventTime: cp.MaxEventTime,
+			Watermark:    cp.Watermark,
+			Windows:      cp.Windows,
+		})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.streams = make(map[StreamKey]*stream, len(cp.Streams))
+	for _, sc := range cp.Streams {
+		st := newStream()
+		st.maxEventTime = sc.MaxEventTime
+		st.watermark = sc.Watermark
+		for _, w := range sc.Windows {
+			st.windows[w.Start.UnixNano()] = w
+		}
+		m.streams[StreamKey{TenantID: sc.TenantID, SourceID: sc.SourceID, Series: sc.Series}] = st
+	}
+	m.updateGauges()
+
+	m.logger.Info("[Window] State restored from checkpoint",
+		zap.String("name", m.name),
+		zap.Int("streams", len(m.streams)),
+		zap.Int("open_windows", m.openWindows()))
+
+	return nil
+}
+
+// Checkpoint сохраняет текущее состояние окон
+func (m *Manager) Checkpoint(ctx context.Context) error {
+	m.mu.Lock()
+	cp := checkpoint{Streams: make([]streamCheckpoint, 0, len(m.streams))}
+	for key, st := range m.streams {
+		sc := streamCheckpoint{
+			TenantID:     key.TenantID,
+			SourceID:     key.SourceID,
+			Series:       key.Series,
+			MaxEventTime: st.maxEventTime,
+			Watermark:    st.watermark,
+			Windows:      make([]*windowState, 0, len(st.windows)),
+		}
+		for _, w := range st.windows {
+			copied := *w
+			sc.Windows = append(sc.Windows, &copied)
+		}
+		cp.Streams = append(cp.Streams, sc)
+	}
+	m.mu.Unlock()
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to encode window checkpoint: %w", err)
+	}
+
+	if err := m.store.SaveWindowCheckpoint(ctx, m.name, data); err != nil {
+		return fmt.Errorf("failed to save window checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// Run периодически сохраняет чекпоинт и делает финальный чекпоинт при отмене ctx
+func (m *Manager) Run(ctx context.Context) {
+	interval := m.cfg.CheckpointInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Контекст приложения уже отменён, поэтому финальный чекпоинт пишем с отдельным таймаутом
+			saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := m.Checkpoint(saveCtx); err != nil {
+				m.logger.Error("[Window] Final checkpoint failed", zap.String("name", m.name), zap.Error(err))
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := m.Checkpoint(ctx); err != nil {
+				m.logger.Error("[Window] Checkpoint failed", zap.String("name", m.name), zap.Error(err))
+			}
+		}
+	}
+}
+
+// OnProcessed добавляет обработанный пакет в окна по его событийному времени
+func (m *Manager) OnProcessed(ctx context.Context, packet *domain.DataPacket, data *domain.ProcessedData) {
+	if data.EmptyPayload {
+		return
+	}
+
+	key := StreamKey{TenantID: packet.Tenant(), SourceID: packet.SourceID, Series: data.Series}
+	results, watermark, late := m.add(key, packet.Timestamp.UTC(), data.MaxValue, data.ExactDecimal())
+
+	if late {
+		metrics.WindowLatePackets.Inc()
+		latePacket := &domain.LatePacket{
+			PacketID:        packet.ID,
+			TenantID:        key.TenantID,
+			SourceID:        key.SourceID,
+			Series:          key.Series,
+			PacketCreatedAt: packet.Timestamp,
+			MaxValue:        data.MaxValue,
+			MaxValueDecimal: data.ExactDecimal(),
+			Watermark:       watermark,
+			ReceivedAt:      time.Now().UTC(),
+		}
+		if err := m.sink.SaveLatePacket(ctx, latePacket); err != nil {
+			m.logger.Error("[Window] Failed to save late packet",
+				zap.String("packet_id", packet.ID.String()),
+				zap.Error(err))
+		}
+	}
+
+	for _, result := range results {
+		if result.Late {
+			metrics.WindowResultsEmitted.WithLabelValues("late_update").Inc()
+		} else {
+			metrics.WindowResultsEmitted.WithLabelValues("on_time").Inc()
+		}
+		if err := m.sink.SaveWindowResult(ctx, result); err != nil {
+			m.logger.Error("[Window] Failed to save window result",
+				zap.Time("window_start", result.WindowStart),
+				zap.Error(err))
+		}
+	}
+}
+
+// Watermark возвращает текущий водяной знак потока; для потока без пакетов — нулевое время
+func (m *Manager) Watermark(key StreamKey) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if st, ok := m.streams[key]; ok {
+		return st.watermark
+	}
+	return time.Time{}
+}
+
+// add обновляет окна потока и возвращает результаты для эмита и водяной знак потока.
+// late == true, если пакет не попал ни в одно живое окно.
+// Максимум сравнивается по точному значению exact, value — его целое приближение.
+func (m *Manager) add(key StreamKey, eventTime time.Time, value int64, exact string) (results []*domain.WindowResult, watermark time.Time, late bool) {
+	exactRat, ok := new(big.Rat).SetString(exact)
+	if !ok {
+		exactRat = new(big.Rat).SetInt64(value)
+		exact = strconv.FormatInt(value, 10)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.streams[key]
+	if !ok {
+		st = newStream()
+		m.streams[key] = st
+	}
+
+	now := time.Now().UTC()
+	accepted := false
+
+	for _, start := range m.windowStarts(eventTime) {
+		end := start.Add(m.cfg.Size)
+		if m.expired(st, end) {
+			continue
+		}
+		accepted = true
+
+		w, ok := st.windows[start.UnixNano()]
+		if !ok {
+			w = &windowState{Start: start, End: end, MaxValue: value, MaxDecimal: exact}
+			st.windows[start.UnixNano()] = w
+		}
+		if exactRat.Cmp(w.maxRat()) > 0 {
+			w.MaxValue = value
+			w.MaxDecimal = exact
+		}
+		w.Count++
+
+		// Водяной знак уже прошёл конец окна — опоздавший пакет обновляет его результат
+		if w.Fired || !st.watermark.Before(w.End) {
+			w.Fired = true
+			results = append(results, w.result(key, true, now))
+		}
+	}
+
+	if eventTime.After(st.maxEventTime) {
+		st.maxEventTime = eventTime
+		if wm := eventTime.Add(-m.cfg.WatermarkDelay); wm.After(st.watermark) {
+			st.watermark = wm
+		}
+	}
+
+	results = append(results, m.advance(key, st, now)...)
+	m.updateGauges()
+
+	return results, st.watermark, !accepted
+}
+
+// advance срабатывает окна потока, которые прошёл его водяной знак, и удаляет окна после AllowedLateness
+func (m *Manager) advance(key StreamKey, st *stream, now time.Time) []*domain.WindowResult {
+	var results []*domain.WindowResult
+
+	for start, w := range st.windows {
+		if !w.Fired && !st.watermark.Before(w.End) {
+			w.Fired = true
+			results = append(results, w.result(key, false, now))
+		}
+		if m.expired(st, w.End) {
+			delete(st.windows, start)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].WindowStart.Before(results[j].WindowStart)
+	})
+
+	return results
+}
+
+// expired сообщает, что окно потока с концом end больше не принимает опоздавшие пакеты
+func (m *Manager) expired(st *stream, end time.Time) bool {
+	return !st.watermark.Before(end.Add(m.cfg.AllowedLateness))
+}
+
+// openWindows возвращает число открытых окон всех потоков; вызывается под m.mu
+func (m *Manager) openWindows() int {
+	n := 0
+	for _, st := range m.streams {
+		n += len(st.windows)
+	}
+	return n
+}
+
+// updateGauges обновляет число открытых окон и самый продвинувшийся водяной знак; вызывается под m.mu
+func (m *Manager) updateGauges() {
+	var latest time.Time
+	for _, st := range m.streams {
+		if st.watermark.After(latest) {
+			latest = st.watermark
+		}
+	}
+	metrics.WindowOpenWindows.Set(float64(m.openWindows()))
+	if !latest.IsZero() {
+		metrics.WindowWatermark.Set(float64(latest.Unix()))
+	}
+}
+
+// windowStarts возвращает начала всех окон, которые содержат eventTime
+func (m *Manager) windowStarts(eventTime time.Time) []time.Time {
+	last := eventTime.Truncate(m.cfg.Slide)
+
+	var starts []time.Time
+	for start := last; eventTime.Before(start.Add(m.cfg.Size)); start = start.Add(-m.cfg.Slide) {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// maxDecimal возвращает точный максимум окна
+func (w *windowState) maxDecimal() string {
+	if w.MaxDecimal == "" {
+		return strconv.FormatInt(w.MaxValue, 10)
+	}
+	return w.MaxDecimal
+}
+
+func (w *windowState) maxRat() *big.Rat {
+	if r, ok := new(big.Rat).SetString(w.maxDecimal()); ok {
+		return r
+	}
+	return new(big.Rat).SetInt64(w.MaxValue)
+}
+
+func (w *windowState) result(key StreamKey, late bool, now time.Time) *domain.WindowResult {
+	return &domain.WindowResult{
+		TenantID:        key.TenantID,
+		SourceID:        key.SourceID,
+		Series:          key.Series,
+		WindowStart:     w.Start,
+		WindowEnd:       w.End,
+		MaxValue:        w.MaxValue,
+		MaxValueDecimal: w.maxDecimal(),
+		Count:           w.Count,
+		Late:            late,
+		EmittedAt:       now,
+	}
+}
@@ -0,0 +1,213 @@
+package window
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CoolE88/data-aggregation-service/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type memorySink struct {
+	mu      sync.Mutex
+	results []*domain.WindowResult
+	late    []*domain.LatePacket
+}
+
+func (s *memorySink) SaveWindowResult(_ context.Context, result *domain.WindowResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, result)
+	return nil
+}
+
+func (s *memorySink) SaveLatePacket(_ context.Context, packet *domain.LatePacket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.late = append(s.late, packet)
+	return nil
+}
+
+type memoryStore struct {
+	states map[string][]byte
+}
+
+func (s *memoryStore) SaveWindowCheckpoint(_ context.Context, name string, state []byte) error {
+	s.states[name] = state
+	return nil
+}
+
+func (s *memoryStore) LoadWindowCheckpoint(_ context.Context, name string) ([]byte, error) {
+	return s.states[name], nil
+}
+
+var base = time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+
+var defaultStream = StreamKey{TenantID: domain.DefaultTenantID}
+
+func process(m *Manager, eventTime time.Time, value int64) {
+	packet := &domain.DataPacket{ID: uuid.New(), Timestamp: eventTime}
+	m.OnProcessed(context.Background(), packet, &domain.ProcessedData{PacketID: packet.ID, MaxValue: value})
+}
+
+func newTestManager(t *testing.T, cfg Config) (*Manager, *memorySink, *memoryStore) {
+	logger, _ := zap.NewDevelopment()
+	sink := &memorySink{}
+	store := &memoryStore{states: make(map[string][]byte)}
+	m, err := NewManager("test", cfg, sink, store, logger)
+	require.NoError(t, err)
+	return m, sink, store
+}
+
+func TestManager_TumblingWindowFiresOnWatermark(t *testing.T) {
+	m, sink, _ := newTestManager(t, Config{Size: time.Minute, WatermarkDelay: 10 * time.Second, AllowedLateness: time.Minute})
+
+	process(m, base.Add(5*time.Second), 3)
+	process(m, base.Add(40*time.Second), 7)
+	process(m, base.Add(65*time.Second), 1) // водяной знак 12:00:55 — окно ещё открыто
+	assert.Empty(t, sink.results)
+
+	process(m, base.Add(71*time.Second), 2) // водяной знак 12:01:01 — окно [12:00, 12:01) срабатывает
+	require.Len(t, sink.results, 1)
+	assert.Equal(t, base, sink.results[0].WindowStart)
+	assert.Equal(t, base.Add(time.Minute), sink.results[0].WindowEnd)
+	assert.Equal(t, int64(7), sink.results[0].MaxValue)
+	assert.Equal(t, int64(2), sink.results[0].Count)
+	assert.False(t, sink.results[0].Late)
+}
+
+func TestManager_LateDataUpdatesWindowOrGoesToSideOutput(t *testing.T) {
+	m, sink, _ := newTestManager(t, Config{Size: time.Minute, AllowedLateness: 30 * time.Second})
+
+	process(m, base.Add(10*time.Second), 5)
+	process(m, base.Add(70*time.Second), 1) // окно [12:00, 12:01) срабатывает
+	require.Len(t, sink.results, 1)
+
+	// Опоздание в пределах AllowedLateness обновляет результат окна
+	process(m, base.Add(20*time.Second), 9)
+	require.Len(t, sink.results, 2)
+	assert.True(t, sink.results[1].Late)
+	assert.Equal(t, int64(9), sink.results[1].MaxValue)
+	assert.Equal(t, int64(2), sink.results[1].Count)
+
+	// Водяной знак проходит конец окна + AllowedLateness, окно закрывается
+	process(m, base.Add(95*time.Second), 1)
+	process(m, base.Add(30*time.Second), 100)
+	require.Len(t, sink.late, 1)
+	assert.Equal(t, int64(100), sink.late[0].MaxValue)
+	assert.Equal(t, base.Add(95*time.Second), sink.late[0].Watermark)
+}
+
+func TestManager_SlidingWindows(t *testing.T) {
+	m, sink, _ := newTestManager(t, Config{Size: time.Minute, Slide: 30 * time.Second})
+
+	process(m, base.Add(45*time.Second), 4) // попадает в окна [12:00, 12:01) и [12:00:30, 12:01:30)
+	process(m, base.Add(2*time.Minute), 0)
+
+	require.Len(t, sink.results, 2)
+	assert.Equal(t, base, sink.results[0].WindowStart)
+	assert.Equal(t, base.Add(30*time.Second), sink.results[1].WindowStart)
+	assert.Equal(t, int64(4), sink.results[0].MaxValue)
+	assert.Equal(t, int64(4), sink.results[1].MaxValue)
+}
+
+func TestManager_ExactMaxBeyondInt64(t *testing.T) {
+	m, sink, _ := newTestManager(t, Config{Size: time.Minute})
+
+	// Оба значения округляются до одного целого, максимум выбирается по точному
+	for _, decimal := range []string{"1.4", "1.2"} {
+		packet := &domain.DataPacket{ID: uuid.New(), Timestamp: base.Add(10 * time.Second)}
+		m.OnProcessed(context.Background(), packet, &domain.ProcessedData{PacketID: packet.ID, MaxValue: 1, MaxValueDecimal: decimal})
+	}
+	huge := 1e19
+	packet := &domain.DataPacket{ID: uuid.New(), Timestamp: base.Add(20 * time.Second)}
+	m.OnProcessed(context.Background(), packet, &domain.ProcessedData{PacketID: packet.ID, MaxValue: math.MaxInt64, MaxValueFloat: &huge})
+	process(m, base.Add(70*time.Second), 0)
+
+	require.Len(t, sink.results, 1)
+	assert.Equal(t, "10000000000000000000", sink.results[0].MaxValueDecimal)
+	assert.Equal(t, int64(math.MaxInt64), sink.results[0].MaxValue)
+}
+
+func TestManager_CheckpointRestore(t *testing.T) {
+	cfg := Config{Size: time.Minute, AllowedLateness: time.Minute}
+	m, _, store := newTestManager(t, cfg)
+
+	process(m, base.Add(10*time.Second), 8)
+	require.NoError(t, m.Checkpoint(context.Background()))
+
+	logger, _ := zap.NewDevelopment()
+	sink := &memorySink{}
+	restored, err := NewManager("test", cfg, sink, store, logger)
+	require.NoError(t, err)
+	require.NoError(t, restored.Restore(context.Background()))
+	assert.Equal(t, base.Add(10*time.Second), restored.Watermark(defaultStream))
+
+	process(restored, base.Add(61*time.Second), 2)
+	require.Len(t, sink.results, 1)
+	assert.Equal(t, int64(8), sink.results[0].MaxValue)
+	assert.Equal(t, int64(1), sink.results[0].Count)
+}
+
+func TestManager_TenantsDoNotAffectEachOther(t *testing.T) {
+	m, sink, _ := newTestManager(t, Config{Size: time.Minute, AllowedLateness: 30 * time.Second})
+
+	processFor := func(tenantID string, eventTime time.Time, value int64) {
+		packet := &domain.DataPacket{ID: uuid.New(), TenantID: tenantID, SourceID: "sensor-1", Timestamp: eventTime}
+		m.OnProcessed(context.Background(), packet, &domain.ProcessedData{PacketID: packet.ID, MaxValue: value})
+	}
+
+	processFor("acme", base.Add(10*time.Second), 5)
+	// Часы второго арендатора ушли вперёд: его водяной знак не закрывает окна первого
+	processFor("globex", base.Add(10*time.Minute), 1)
+	assert.Empty(t, sink.late)
+	processFor("acme", base.Add(20*time.Second), 9)
+	assert.Empty(t, sink.late)
+	assert.Empty(t, sink.results)
+
+	acme := StreamKey{TenantID: "acme", SourceID: "sensor-1"}
+	assert.Equal(t, base.Add(20*time.Second), m.Watermark(acme))
+	assert.Equal(t, base.Add(10*time.Minute), m.Watermark(StreamKey{TenantID: "globex", SourceID: "sensor-1"}))
+
+	processFor("acme", base.Add(70*time.Second), 0)
+	require.Len(t, sink.results, 1)
+	assert.Equal(t, "acme", sink.results[0].TenantID)
+	assert.Equal(t, "sensor-1", sink.results[0].SourceID)
+	assert.Equal(t, int64(9), sink.results[0].MaxValue)
+	assert.Equal(t, int64(2), sink.results[0].Count)
+}
+
+func TestManager_RestoreLegacyCheckpoint(t *testing.T) {
+	cfg := Config{Size: time.Minute}
+	logger, _ := zap.NewDevelopment()
+	store := &memoryStore{states: map[string][]byte{
+		"test": []byte(`{"max_event_time":"2025-09-01T12:00:10Z","watermark":"2025-09-01T12:00:10Z",` +
+			`"windows":[{"start":"2025-09-01T12:00:00Z","end":"2025-09-01T12:01:00Z","max_value":8,"count":1}]}`),
+	}}
+	sink := &memorySink{}
+	m, err := NewManager("test", cfg, sink, store, logger)
+	require.NoError(t, err)
+	require.NoError(t, m.Restore(context.Background()))
+	assert.Equal(t, base.Add(10*time.Second), m.Watermark(defaultStream))
+
+	process(m, base.Add(61*time.Second), 2)
+	require.Len(t, sink.results, 1)
+	assert.Equal(t, int64(8), sink.results[0].MaxValue)
+}
+
+func TestNewManager_InvalidConfig(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	_, err := NewManager("test", Config{}, &memorySink{}, &memoryStore{}, logger)
+	assert.Error(t, err)
+
+	_, err = NewManager("test", Config{Size: time.Minute, Slide: 2 * time.Minute}, &memorySink{}, &memoryStore{}, logger)
+	assert.Error(t, err)
+}
@@ -0,0 +1,48 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS processed_packets_rollup_1m(
+    bucket_start TIMESTAMPTZ NOT NULL PRIMARY KEY,
+    max_value INTEGER NOT NULL,
+    min_value INTEGER NOT NULL,
+    count BIGINT NOT NULL,
+    sum BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS processed_packets_rollup_1h(
+    bucket_start TIMESTAMPTZ NOT NULL PRIMARY KEY,
+    max_value INTEGER NOT NULL,
+    min_value INTEGER NOT NULL,
+    count BIGINT NOT NULL,
+    sum BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS processed_packets_rollup_1d(
+    bucket_start TIMESTAMPTZ NOT NULL PRIMARY KEY,
+    max_value INTEGER NOT NULL,
+    min_value INTEGER NOT NULL,
+    count BIGINT NOT NULL,
+    sum BIGINT NOT NULL
+);
+
+-- Заполняем роллапы по уже обработанным данным
+INSERT INTO processed_packets_rollup_1m (bucket_start, max_value, min_value, count, sum)
+SELECT date_trunc('minute', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', MAX(max_value), MIN(max_value), COUNT(*), SUM(max_value)
+FROM processed_packets
+GROUP BY 1
+ON CONFLICT (bucket_start) DO NOTHING;
+
+INSERT INTO processed_packets_rollup_1h (bucket_start, max_value, min_value, count, sum)
+SELECT date_trunc('hour', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', MAX(max_value), MIN(max_value), COUNT(*), SUM(max_value)
+FROM processed_packets
+GROUP BY 1
+ON CONFLICT (bucket_start) DO NOTHING;
+
+INSERT INTO processed_packets_rollup_1d (bucket_start, max_value, min_value, count, sum)
+SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', MAX(max_value), MIN(max_value), COUNT(*), SUM(max_value)
+FROM processed_packets
+GROUP BY 1
+ON CONFLICT (bucket_start) DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS processed_packets_rollup_1d;
+DROP TABLE IF EXISTS processed_packets_rollup_1h;
+DROP TABLE IF EXISTS processed_packets_rollup_1m;
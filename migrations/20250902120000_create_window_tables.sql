@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS window_results(
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    max_value INTEGER NOT NULL,
+    count BIGINT NOT NULL,
+    late BOOLEAN NOT NULL DEFAULT FALSE,
+    emitted_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (window_start, window_end)
+);
+
+CREATE TABLE IF NOT EXISTS late_packets(
+    packet_id UUID NOT NULL,
+    packet_created_at TIMESTAMPTZ NOT NULL,
+    max_value INTEGER NOT NULL,
+    watermark TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_late_packets_received_at ON late_packets (received_at);
+
+CREATE TABLE IF NOT EXISTS window_checkpoints(
+    name TEXT NOT NULL PRIMARY KEY,
+    state JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS window_checkpoints;
+DROP TABLE IF EXISTS late_packets;
+DROP TABLE IF EXISTS window_results;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE processed_packets
+    ADD COLUMN IF NOT EXISTS value_kind TEXT NOT NULL DEFAULT 'int',
+    ADD COLUMN IF NOT EXISTS max_value_float DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS max_value_decimal NUMERIC;
+
+-- +goose Down
+ALTER TABLE processed_packets
+    DROP COLUMN IF EXISTS max_value_decimal,
+    DROP COLUMN IF EXISTS max_value_float,
+    DROP COLUMN IF EXISTS value_kind;
@@ -0,0 +1,38 @@
+-- +goose Up
+ALTER TABLE processed_packets ALTER COLUMN max_value TYPE BIGINT;
+
+ALTER TABLE processed_packets_rollup_1m
+    ALTER COLUMN max_value TYPE BIGINT,
+    ALTER COLUMN min_value TYPE BIGINT;
+
+ALTER TABLE processed_packets_rollup_1h
+    ALTER COLUMN max_value TYPE BIGINT,
+    ALTER COLUMN min_value TYPE BIGINT;
+
+ALTER TABLE processed_packets_rollup_1d
+    ALTER COLUMN max_value TYPE BIGINT,
+    ALTER COLUMN min_value TYPE BIGINT;
+
+ALTER TABLE window_results ALTER COLUMN max_value TYPE BIGINT;
+
+ALTER TABLE late_packets ALTER COLUMN max_value TYPE BIGINT;
+
+-- +goose Down
+-- Значения вне диапазона INTEGER приведут к ошибке отката, это ожидаемо
+ALTER TABLE late_packets ALTER COLUMN max_value TYPE INTEGER;
+
+ALTER TABLE window_results ALTER COLUMN max_value TYPE INTEGER;
+
+ALTER TABLE processed_packets_rollup_1d
+    ALTER COLUMN max_value TYPE INTEGER,
+    ALTER COLUMN min_value TYPE INTEGER;
+
+ALTER TABLE processed_packets_rollup_1h
+    ALTER COLUMN max_value TYPE INTEGER,
+    ALTER COLUMN min_value TYPE INTEGER;
+
+ALTER TABLE processed_packets_rollup_1m
+    ALTER COLUMN max_value TYPE INTEGER,
+    ALTER COLUMN min_value TYPE INTEGER;
+
+ALTER TABLE processed_packets ALTER COLUMN max_value TYPE INTEGER;
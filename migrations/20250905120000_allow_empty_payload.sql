@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE processed_packets
+    ALTER COLUMN max_value DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS empty_payload BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+DELETE FROM processed_packets WHERE max_value IS NULL;
+
+ALTER TABLE processed_packets
+    DROP COLUMN IF EXISTS empty_payload,
+    ALTER COLUMN max_value SET NOT NULL;
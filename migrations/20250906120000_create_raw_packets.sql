@@ -0,0 +1,15 @@
+-- +goose Up
+-- Партиции по суткам создаёт и удаляет сервис (internal/archive) согласно RAW_ARCHIVE_RETENTION_DAYS
+CREATE TABLE IF NOT EXISTS raw_packets(
+    packet_id UUID NOT NULL,
+    packet_created_at TIMESTAMPTZ NOT NULL,
+    archived_at TIMESTAMPTZ NOT NULL,
+    payload_kind TEXT NOT NULL,
+    payload BYTEA NOT NULL, -- gzip-сжатый JSON пейлоада
+    PRIMARY KEY (packet_id, archived_at)
+) PARTITION BY RANGE (archived_at);
+
+CREATE INDEX IF NOT EXISTS idx_raw_packets_packet_created_at ON raw_packets (packet_created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS raw_packets CASCADE;
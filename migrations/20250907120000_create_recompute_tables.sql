@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS packet_results(
+    packet_id UUID NOT NULL,
+    function TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    value NUMERIC NOT NULL,
+    computed_at TIMESTAMPTZ NOT NULL,
+    job_id UUID NOT NULL,
+    PRIMARY KEY (packet_id, function, version)
+);
+
+CREATE TABLE IF NOT EXISTS recompute_jobs(
+    id UUID NOT NULL PRIMARY KEY,
+    status TEXT NOT NULL,
+    state JSONB NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_raw_packets_archived_at_packet_id ON raw_packets (archived_at, packet_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_raw_packets_archived_at_packet_id;
+DROP TABLE IF EXISTS recompute_jobs;
+DROP TABLE IF EXISTS packet_results;
@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS alert_rules(
+    id UUID NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL,
+    condition TEXT NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    for_packets INTEGER NOT NULL DEFAULT 1,
+    window_seconds INTEGER NOT NULL DEFAULT 0,
+    webhooks TEXT[] NOT NULL DEFAULT '{}',
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS alert_events(
+    id UUID NOT NULL PRIMARY KEY,
+    incident_id UUID NOT NULL,
+    rule_id UUID NOT NULL,
+    rule_name TEXT NOT NULL,
+    status TEXT NOT NULL,
+    condition TEXT NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    packet_id UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_events_rule_id_created_at ON alert_events (rule_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS alert_events;
+DROP TABLE IF EXISTS alert_rules;
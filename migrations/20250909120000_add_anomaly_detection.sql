@@ -0,0 +1,31 @@
+-- +goose Up
+ALTER TABLE processed_packets
+    ADD COLUMN IF NOT EXISTS anomaly_score DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS anomalous BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_processed_packets_anomalous ON processed_packets (created_at) WHERE anomalous;
+
+CREATE TABLE IF NOT EXISTS anomaly_params(
+    source_id TEXT NOT NULL PRIMARY KEY,
+    method TEXT NOT NULL,
+    alpha DOUBLE PRECISION NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    warm_up INTEGER NOT NULL,
+    window_size INTEGER NOT NULL,
+    notify BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS anomaly_states(
+    source_id TEXT NOT NULL PRIMARY KEY,
+    state JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS anomaly_states;
+DROP TABLE IF EXISTS anomaly_params;
+DROP INDEX IF EXISTS idx_processed_packets_anomalous;
+
+ALTER TABLE processed_packets
+    DROP COLUMN IF EXISTS anomalous,
+    DROP COLUMN IF EXISTS anomaly_score;
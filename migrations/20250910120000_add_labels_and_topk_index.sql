@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE processed_packets
+    ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_processed_packets_labels ON processed_packets USING GIN (labels);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_processed_packets_labels;
+
+ALTER TABLE processed_packets
+    DROP COLUMN IF EXISTS labels;
@@ -0,0 +1,50 @@
+-- +goose Up
+ALTER TABLE processed_packets_rollup_1m ADD COLUMN IF NOT EXISTS sketch JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE processed_packets_rollup_1h ADD COLUMN IF NOT EXISTS sketch JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE processed_packets_rollup_1d ADD COLUMN IF NOT EXISTS sketch JSONB NOT NULL DEFAULT '{}';
+
+-- Заполняем скетчи по уже обработанным данным. Ключи бакетов совпадают с sketch.Key
+-- при относительной точности 0.01: gamma = 1.01 / 0.99.
+CREATE TEMPORARY TABLE sketch_keys AS
+SELECT created_at,
+    CASE
+        WHEN abs(v) < 1e-9 THEN 'z'
+        WHEN v > 0 THEN 'p' || ceil(ln(v) / ln(1.01 / 0.99))::BIGINT
+        ELSE 'n' || ceil(ln(-v) / ln(1.01 / 0.99))::BIGINT
+    END AS key
+FROM (
+    SELECT created_at, COALESCE(max_value_decimal, max_value_float::NUMERIC, max_value::NUMERIC) AS v
+    FROM processed_packets
+    WHERE NOT empty_payload
+) AS processed;
+
+UPDATE processed_packets_rollup_1m r SET sketch = s.sketch
+FROM (
+    SELECT bucket, jsonb_object_agg(key, cnt) AS sketch
+    FROM (SELECT date_trunc('minute', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket, key, COUNT(*) AS cnt FROM sketch_keys GROUP BY 1, 2) AS counts
+    GROUP BY bucket
+) AS s
+WHERE r.bucket_start = s.bucket;
+
+UPDATE processed_packets_rollup_1h r SET sketch = s.sketch
+FROM (
+    SELECT bucket, jsonb_object_agg(key, cnt) AS sketch
+    FROM (SELECT date_trunc('hour', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket, key, COUNT(*) AS cnt FROM sketch_keys GROUP BY 1, 2) AS counts
+    GROUP BY bucket
+) AS s
+WHERE r.bucket_start = s.bucket;
+
+UPDATE processed_packets_rollup_1d r SET sketch = s.sketch
+FROM (
+    SELECT bucket, jsonb_object_agg(key, cnt) AS sketch
+    FROM (SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket, key, COUNT(*) AS cnt FROM sketch_keys GROUP BY 1, 2) AS counts
+    GROUP BY bucket
+) AS s
+WHERE r.bucket_start = s.bucket;
+
+DROP TABLE sketch_keys;
+
+-- +goose Down
+ALTER TABLE processed_packets_rollup_1d DROP COLUMN IF EXISTS sketch;
+ALTER TABLE processed_packets_rollup_1h DROP COLUMN IF EXISTS sketch;
+ALTER TABLE processed_packets_rollup_1m DROP COLUMN IF EXISTS sketch;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE processed_packets ADD COLUMN IF NOT EXISTS derived JSONB NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS derived_metrics(
+    source_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    expression TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (source_id, name)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS derived_metrics;
+
+ALTER TABLE processed_packets DROP COLUMN IF EXISTS derived;
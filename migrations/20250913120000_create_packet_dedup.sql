@@ -0,0 +1,20 @@
+-- +goose Up
+-- Первичный ключ processed_packets включает created_at (время обработки), поэтому
+-- не отсекает повторную отправку пакета. Идентификаторы хранятся отдельно с TTL.
+CREATE TABLE IF NOT EXISTS packet_dedup(
+    packet_id UUID NOT NULL PRIMARY KEY,
+    first_seen_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_packet_dedup_first_seen_at ON packet_dedup (first_seen_at);
+
+-- Уже обработанные за последние сутки пакеты (TTL по умолчанию)
+INSERT INTO packet_dedup (packet_id, first_seen_at)
+SELECT packet_id, MIN(created_at)
+FROM processed_packets
+WHERE created_at > NOW() - INTERVAL '1 day'
+GROUP BY packet_id
+ON CONFLICT (packet_id) DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS packet_dedup;
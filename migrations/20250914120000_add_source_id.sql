@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE processed_packets
+    ADD COLUMN IF NOT EXISTS source_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_processed_packets_source_created ON processed_packets (source_id, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_processed_packets_source_created;
+
+ALTER TABLE processed_packets
+    DROP COLUMN IF EXISTS source_id;
@@ -0,0 +1,74 @@
+-- +goose Up
+-- Данные, записанные до появления арендаторов, относятся к арендатору по умолчанию
+ALTER TABLE processed_packets
+    ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE raw_packets
+    ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE alert_rules
+    ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE alert_events
+    ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_processed_packets_tenant_created ON processed_packets (tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_raw_packets_tenant_packet ON raw_packets (tenant_id, packet_id);
+
+-- Роллапы и фильтр повторов ведутся отдельно для каждого арендатора
+ALTER TABLE processed_packets_rollup_1m
+    ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE processed_packets_rollup_1m DROP CONSTRAINT IF EXISTS processed_packets_rollup_1m_pkey;
+ALTER TABLE processed_packets_rollup_1m ADD PRIMARY KEY (tenant_id, bucket_start);
+
+ALTER TABLE processed_packets_rollup_1h
+    ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE processed_packets_rollup_1h DROP CONSTRAINT IF EXISTS processed_packets_rollup_1h_pkey;
+ALTER TABLE processed_packets_rollup_1h ADD PRIMARY KEY (tenant_id, bucket_start);
+
+ALTER TABLE processed_packets_rollup_1d
+    ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE processed_packets_rollup_1d DROP CONSTRAINT IF EXISTS processed_packets_rollup_1d_pkey;
+ALTER TABLE processed_packets_rollup_1d ADD PRIMARY KEY (tenant_id, bucket_start);
+
+ALTER TABLE packet_dedup
+    ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE packet_dedup DROP CONSTRAINT IF EXISTS packet_dedup_pkey;
+ALTER TABLE packet_dedup ADD PRIMARY KEY (tenant_id, packet_id);
+
+-- +goose Down
+-- Данные других арендаторов не помещаются в прежние ключи и удаляются
+DELETE FROM packet_dedup WHERE tenant_id <> 'default';
+ALTER TABLE packet_dedup DROP CONSTRAINT IF EXISTS packet_dedup_pkey;
+ALTER TABLE packet_dedup DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE packet_dedup ADD PRIMARY KEY (packet_id);
+
+DELETE FROM processed_packets_rollup_1d WHERE tenant_id <> 'default';
+ALTER TABLE processed_packets_rollup_1d DROP CONSTRAINT IF EXISTS processed_packets_rollup_1d_pkey;
+ALTER TABLE processed_packets_rollup_1d DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE processed_packets_rollup_1d ADD PRIMARY KEY (bucket_start);
+
+DELETE FROM processed_packets_rollup_1h WHERE tenant_id <> 'default';
+ALTER TABLE processed_packets_rollup_1h DROP CONSTRAINT IF EXISTS processed_packets_rollup_1h_pkey;
+ALTER TABLE processed_packets_rollup_1h DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE processed_packets_rollup_1h ADD PRIMARY KEY (bucket_start);
+
+DELETE FROM processed_packets_rollup_1m WHERE tenant_id <> 'default';
+ALTER TABLE processed_packets_rollup_1m DROP CONSTRAINT IF EXISTS processed_packets_rollup_1m_pkey;
+ALTER TABLE processed_packets_rollup_1m DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE processed_packets_rollup_1m ADD PRIMARY KEY (bucket_start);
+
+DROP INDEX IF EXISTS idx_raw_packets_tenant_packet;
+DROP INDEX IF EXISTS idx_processed_packets_tenant_created;
+
+ALTER TABLE alert_events
+    DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE alert_rules
+    DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE raw_packets
+    DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE processed_packets
+    DROP COLUMN IF EXISTS tenant_id;
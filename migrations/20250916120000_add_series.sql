@@ -0,0 +1,44 @@
+-- +goose Up
+-- Результаты и роллапы ведутся отдельно для каждой серии пакета.
+-- Пакеты без серий хранятся под безымянной серией ''.
+ALTER TABLE processed_packets
+    ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '';
+ALTER TABLE processed_packets DROP CONSTRAINT IF EXISTS processed_packets_pkey;
+ALTER TABLE processed_packets ADD PRIMARY KEY (packet_id, series, created_at);
+
+ALTER TABLE processed_packets_rollup_1m
+    ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '';
+ALTER TABLE processed_packets_rollup_1m DROP CONSTRAINT IF EXISTS processed_packets_rollup_1m_pkey;
+ALTER TABLE processed_packets_rollup_1m ADD PRIMARY KEY (tenant_id, series, bucket_start);
+
+ALTER TABLE processed_packets_rollup_1h
+    ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '';
+ALTER TABLE processed_packets_rollup_1h DROP CONSTRAINT IF EXISTS processed_packets_rollup_1h_pkey;
+ALTER TABLE processed_packets_rollup_1h ADD PRIMARY KEY (tenant_id, series, bucket_start);
+
+ALTER TABLE processed_packets_rollup_1d
+    ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '';
+ALTER TABLE processed_packets_rollup_1d DROP CONSTRAINT IF EXISTS processed_packets_rollup_1d_pkey;
+ALTER TABLE processed_packets_rollup_1d ADD PRIMARY KEY (tenant_id, series, bucket_start);
+
+-- +goose Down
+-- Именованные серии не помещаются в прежние ключи и удаляются
+DELETE FROM processed_packets_rollup_1d WHERE series <> '';
+ALTER TABLE processed_packets_rollup_1d DROP CONSTRAINT IF EXISTS processed_packets_rollup_1d_pkey;
+ALTER TABLE processed_packets_rollup_1d DROP COLUMN IF EXISTS series;
+ALTER TABLE processed_packets_rollup_1d ADD PRIMARY KEY (tenant_id, bucket_start);
+
+DELETE FROM processed_packets_rollup_1h WHERE series <> '';
+ALTER TABLE processed_packets_rollup_1h DROP CONSTRAINT IF EXISTS processed_packets_rollup_1h_pkey;
+ALTER TABLE processed_packets_rollup_1h DROP COLUMN IF EXISTS series;
+ALTER TABLE processed_packets_rollup_1h ADD PRIMARY KEY (tenant_id, bucket_start);
+
+DELETE FROM processed_packets_rollup_1m WHERE series <> '';
+ALTER TABLE processed_packets_rollup_1m DROP CONSTRAINT IF EXISTS processed_packets_rollup_1m_pkey;
+ALTER TABLE processed_packets_rollup_1m DROP COLUMN IF EXISTS series;
+ALTER TABLE processed_packets_rollup_1m ADD PRIMARY KEY (tenant_id, bucket_start);
+
+DELETE FROM processed_packets WHERE series <> '';
+ALTER TABLE processed_packets DROP CONSTRAINT IF EXISTS processed_packets_pkey;
+ALTER TABLE processed_packets DROP COLUMN IF EXISTS series;
+ALTER TABLE processed_packets ADD PRIMARY KEY (packet_id, created_at);
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS packet_schemas(
+    source_id TEXT NOT NULL,
+    version INT NOT NULL,
+    definition JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (source_id, version)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS packet_schemas;
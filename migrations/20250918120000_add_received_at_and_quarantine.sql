@@ -0,0 +1,26 @@
+-- +goose Up
+-- Время приёма сервером хранится отдельно от времени устройства (packet_created_at).
+-- У строк, записанных раньше, received_at остаётся NULL и читается как created_at.
+ALTER TABLE processed_packets
+    ADD COLUMN IF NOT EXISTS received_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS clamped_from TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS quarantined_packets(
+    tenant_id TEXT NOT NULL,
+    packet_id UUID NOT NULL,
+    source_id TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    packet_created_at TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL,
+    packet JSONB NOT NULL,
+    PRIMARY KEY (tenant_id, packet_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_quarantined_packets_received ON quarantined_packets (tenant_id, received_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS quarantined_packets;
+
+ALTER TABLE processed_packets
+    DROP COLUMN IF EXISTS clamped_from,
+    DROP COLUMN IF EXISTS received_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Ключи проверки подписей пакетов: общий секрет HMAC или открытый ключ Ed25519
+CREATE TABLE IF NOT EXISTS signing_keys(
+    source_id TEXT NOT NULL,
+    key_id TEXT NOT NULL,
+    algorithm TEXT NOT NULL,
+    key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ,
+    PRIMARY KEY (source_id, key_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS signing_keys;
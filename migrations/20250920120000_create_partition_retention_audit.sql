@@ -0,0 +1,19 @@
+-- +goose Up
+-- Журнал удаления партиций processed_packets по сроку хранения, включая пробные прогоны
+CREATE TABLE IF NOT EXISTS partition_retention_audit(
+    id BIGSERIAL PRIMARY KEY,
+    partition_name TEXT NOT NULL,
+    range_from TIMESTAMPTZ NOT NULL,
+    range_to TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL,
+    dry_run BOOLEAN NOT NULL,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    export_path TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_partition_retention_audit_created_at ON partition_retention_audit (created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS partition_retention_audit;
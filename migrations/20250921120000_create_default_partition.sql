@@ -0,0 +1,9 @@
+-- +goose Up
+-- Строки, для времени обработки которых нет месячной партиции, попадают сюда вместо ошибки вставки;
+-- сервис переносит их в месячные партиции при обслуживании
+CREATE TABLE IF NOT EXISTS processed_packets_default PARTITION OF processed_packets DEFAULT;
+
+CREATE INDEX IF NOT EXISTS idx_processed_packets_default_packet_created_at ON processed_packets_default (packet_created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS processed_packets_default;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Индексы для запросов по времени устройства (time_axis=event): в отличие от времени обработки,
+-- интервал по packet_created_at не отсекает партиции, поэтому в каждой партиции нужен индекс с арендатором
+CREATE INDEX IF NOT EXISTS idx_processed_packets_tenant_packet_created ON processed_packets (tenant_id, packet_created_at);
+CREATE INDEX IF NOT EXISTS idx_processed_packets_source_packet_created ON processed_packets (source_id, packet_created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_processed_packets_source_packet_created;
+DROP INDEX IF EXISTS idx_processed_packets_tenant_packet_created;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Постраничная выборка результатов за период идёт в порядке (время, packet_id, series) на выбранной оси;
+-- индексы с полным ключом курсора заменяют индексы (tenant_id, created_at) и (tenant_id, packet_created_at)
+CREATE INDEX IF NOT EXISTS idx_processed_packets_tenant_created_page ON processed_packets (tenant_id, created_at, packet_id, series);
+CREATE INDEX IF NOT EXISTS idx_processed_packets_tenant_packet_created_page ON processed_packets (tenant_id, packet_created_at, packet_id, series);
+
+DROP INDEX IF EXISTS idx_processed_packets_tenant_created;
+DROP INDEX IF EXISTS idx_processed_packets_tenant_packet_created;
+
+-- +goose Down
+CREATE INDEX IF NOT EXISTS idx_processed_packets_tenant_packet_created ON processed_packets (tenant_id, packet_created_at);
+CREATE INDEX IF NOT EXISTS idx_processed_packets_tenant_created ON processed_packets (tenant_id, created_at);
+
+DROP INDEX IF EXISTS idx_processed_packets_tenant_packet_created_page;
+DROP INDEX IF EXISTS idx_processed_packets_tenant_created_page;
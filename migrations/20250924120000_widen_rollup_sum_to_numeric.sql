@@ -0,0 +1,12 @@
+-- +goose Up
+-- Сумма максимумов около границы int64 не помещается в BIGINT: переполнение прерывало
+-- транзакцию сохранения пакета вместе с его результатом
+ALTER TABLE processed_packets_rollup_1m ALTER COLUMN sum TYPE NUMERIC;
+ALTER TABLE processed_packets_rollup_1h ALTER COLUMN sum TYPE NUMERIC;
+ALTER TABLE processed_packets_rollup_1d ALTER COLUMN sum TYPE NUMERIC;
+
+-- +goose Down
+-- Суммы вне диапазона BIGINT приведут к ошибке отката, это ожидаемо
+ALTER TABLE processed_packets_rollup_1d ALTER COLUMN sum TYPE BIGINT;
+ALTER TABLE processed_packets_rollup_1h ALTER COLUMN sum TYPE BIGINT;
+ALTER TABLE processed_packets_rollup_1m ALTER COLUMN sum TYPE BIGINT;
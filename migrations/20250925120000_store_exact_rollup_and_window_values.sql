@@ -0,0 +1,16 @@
+-- +goose Up
+-- Дробные и десятичные максимумы хранились округлёнными до int64, а значения вне его
+-- диапазона отклонялись: max/min роллапов и максимумы окон храним точно
+ALTER TABLE processed_packets_rollup_1m ALTER COLUMN max_value TYPE NUMERIC, ALTER COLUMN min_value TYPE NUMERIC;
+ALTER TABLE processed_packets_rollup_1h ALTER COLUMN max_value TYPE NUMERIC, ALTER COLUMN min_value TYPE NUMERIC;
+ALTER TABLE processed_packets_rollup_1d ALTER COLUMN max_value TYPE NUMERIC, ALTER COLUMN min_value TYPE NUMERIC;
+ALTER TABLE window_results ALTER COLUMN max_value TYPE NUMERIC;
+ALTER TABLE late_packets ALTER COLUMN max_value TYPE NUMERIC;
+
+-- +goose Down
+-- Значения вне диапазона BIGINT приведут к ошибке отката, это ожидаемо
+ALTER TABLE late_packets ALTER COLUMN max_value TYPE BIGINT USING round(max_value);
+ALTER TABLE window_results ALTER COLUMN max_value TYPE BIGINT USING round(max_value);
+ALTER TABLE processed_packets_rollup_1d ALTER COLUMN max_value TYPE BIGINT USING round(max_value), ALTER COLUMN min_value TYPE BIGINT USING round(min_value);
+ALTER TABLE processed_packets_rollup_1h ALTER COLUMN max_value TYPE BIGINT USING round(max_value), ALTER COLUMN min_value TYPE BIGINT USING round(min_value);
+ALTER TABLE processed_packets_rollup_1m ALTER COLUMN max_value TYPE BIGINT USING round(max_value), ALTER COLUMN min_value TYPE BIGINT USING round(min_value);
@@ -0,0 +1,41 @@
+-- +goose Up
+-- Параметры детектора, производные метрики, схемы и ключи подписи задавались по source_id
+-- и действовали для одноимённых источников всех арендаторов. Существующие настройки
+-- остаются за арендатором по умолчанию.
+ALTER TABLE anomaly_params ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE anomaly_params DROP CONSTRAINT IF EXISTS anomaly_params_pkey;
+ALTER TABLE anomaly_params ADD PRIMARY KEY (tenant_id, source_id);
+
+ALTER TABLE derived_metrics ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE derived_metrics DROP CONSTRAINT IF EXISTS derived_metrics_pkey;
+ALTER TABLE derived_metrics ADD PRIMARY KEY (tenant_id, source_id, name);
+
+ALTER TABLE packet_schemas ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE packet_schemas DROP CONSTRAINT IF EXISTS packet_schemas_pkey;
+ALTER TABLE packet_schemas ADD PRIMARY KEY (tenant_id, source_id, version);
+
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE signing_keys DROP CONSTRAINT IF EXISTS signing_keys_pkey;
+ALTER TABLE signing_keys ADD PRIMARY KEY (tenant_id, source_id, key_id);
+
+-- +goose Down
+-- Настройки других арендаторов удаляются: без tenant_id они стали бы общими
+DELETE FROM signing_keys WHERE tenant_id <> 'default';
+ALTER TABLE signing_keys DROP CONSTRAINT IF EXISTS signing_keys_pkey;
+ALTER TABLE signing_keys DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE signing_keys ADD PRIMARY KEY (source_id, key_id);
+
+DELETE FROM packet_schemas WHERE tenant_id <> 'default';
+ALTER TABLE packet_schemas DROP CONSTRAINT IF EXISTS packet_schemas_pkey;
+ALTER TABLE packet_schemas DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE packet_schemas ADD PRIMARY KEY (source_id, version);
+
+DELETE FROM derived_metrics WHERE tenant_id <> 'default';
+ALTER TABLE derived_metrics DROP CONSTRAINT IF EXISTS derived_metrics_pkey;
+ALTER TABLE derived_metrics DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE derived_metrics ADD PRIMARY KEY (source_id, name);
+
+DELETE FROM anomaly_params WHERE tenant_id <> 'default';
+ALTER TABLE anomaly_params DROP CONSTRAINT IF EXISTS anomaly_params_pkey;
+ALTER TABLE anomaly_params DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE anomaly_params ADD PRIMARY KEY (source_id);
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Пересчёт выполняется для каждой серии пакета; прежние результаты относятся к безымянной серии.
+ALTER TABLE packet_results ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '';
+ALTER TABLE packet_results DROP CONSTRAINT IF EXISTS packet_results_pkey;
+ALTER TABLE packet_results ADD PRIMARY KEY (packet_id, series, function, version);
+
+-- +goose Down
+DELETE FROM packet_results WHERE series <> '';
+ALTER TABLE packet_results DROP CONSTRAINT IF EXISTS packet_results_pkey;
+ALTER TABLE packet_results ADD PRIMARY KEY (packet_id, function, version);
+ALTER TABLE packet_results DROP COLUMN IF EXISTS series;
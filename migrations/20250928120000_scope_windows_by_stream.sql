@@ -0,0 +1,25 @@
+-- +goose Up
+-- Окна событийного времени и водяной знак ведутся по серии источника арендатора.
+-- Прежние результаты относятся к безымянной серии источника по умолчанию арендатора по умолчанию.
+ALTER TABLE window_results ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE window_results ADD COLUMN IF NOT EXISTS source_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE window_results ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '';
+ALTER TABLE window_results DROP CONSTRAINT IF EXISTS window_results_pkey;
+ALTER TABLE window_results ADD PRIMARY KEY (tenant_id, source_id, series, window_start, window_end);
+
+ALTER TABLE late_packets ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE late_packets ADD COLUMN IF NOT EXISTS source_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE late_packets ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE late_packets DROP COLUMN IF EXISTS series;
+ALTER TABLE late_packets DROP COLUMN IF EXISTS source_id;
+ALTER TABLE late_packets DROP COLUMN IF EXISTS tenant_id;
+
+-- Без ключа потока результаты разных потоков за одно окно совпали бы, остаются только прежние
+DELETE FROM window_results WHERE tenant_id <> 'default' OR source_id <> '' OR series <> '';
+ALTER TABLE window_results DROP CONSTRAINT IF EXISTS window_results_pkey;
+ALTER TABLE window_results ADD PRIMARY KEY (window_start, window_end);
+ALTER TABLE window_results DROP COLUMN IF EXISTS series;
+ALTER TABLE window_results DROP COLUMN IF EXISTS source_id;
+ALTER TABLE window_results DROP COLUMN IF EXISTS tenant_id;
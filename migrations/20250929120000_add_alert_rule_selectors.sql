@@ -0,0 +1,21 @@
+-- +goose Up
+-- Правило отбирает источник и серии и вычисляется по каждой серии источника отдельно.
+-- Существующие правила отбирают все источники и серии.
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS source_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS series TEXT[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE alert_events ADD COLUMN IF NOT EXISTS source_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE alert_events ADD COLUMN IF NOT EXISTS series TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_alert_events_rule_id_created_at;
+CREATE INDEX IF NOT EXISTS idx_alert_events_rule_stream_created_at ON alert_events (rule_id, source_id, series, created_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_alert_events_rule_stream_created_at;
+CREATE INDEX IF NOT EXISTS idx_alert_events_rule_id_created_at ON alert_events (rule_id, created_at DESC);
+
+ALTER TABLE alert_events DROP COLUMN IF EXISTS series;
+ALTER TABLE alert_events DROP COLUMN IF EXISTS source_id;
+
+ALTER TABLE alert_rules DROP COLUMN IF EXISTS series;
+ALTER TABLE alert_rules DROP COLUMN IF EXISTS source_id;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- packet_id уникален только в пределах арендатора, результаты пересчёта хранятся по арендатору.
+-- Прежние результаты относятся к арендатору пакета, если его packet_id не встречается у других арендаторов.
+ALTER TABLE packet_results ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+
+UPDATE packet_results r SET tenant_id = p.tenant_id
+FROM (
+    SELECT packet_id, MIN(tenant_id) AS tenant_id
+    FROM raw_packets
+    GROUP BY packet_id
+    HAVING COUNT(DISTINCT tenant_id) = 1
+) p
+WHERE p.packet_id = r.packet_id;
+
+ALTER TABLE packet_results DROP CONSTRAINT IF EXISTS packet_results_pkey;
+ALTER TABLE packet_results ADD PRIMARY KEY (tenant_id, packet_id, series, function, version);
+
+-- +goose Down
+-- Результаты других арендаторов удаляются: без tenant_id они совпали бы с результатами арендатора по умолчанию
+DELETE FROM packet_results WHERE tenant_id <> 'default';
+ALTER TABLE packet_results DROP CONSTRAINT IF EXISTS packet_results_pkey;
+ALTER TABLE packet_results ADD PRIMARY KEY (packet_id, series, function, version);
+ALTER TABLE packet_results DROP COLUMN IF EXISTS tenant_id;
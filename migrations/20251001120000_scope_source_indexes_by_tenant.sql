@@ -0,0 +1,13 @@
+-- +goose Up
+-- Запросы с фильтром source всегда ограничены арендатором, а source_id уникален только в его пределах,
+-- поэтому индексы по источнику начинаются с tenant_id
+DROP INDEX IF EXISTS idx_processed_packets_source_created;
+DROP INDEX IF EXISTS idx_processed_packets_source_packet_created;
+CREATE INDEX IF NOT EXISTS idx_processed_packets_tenant_source_created ON processed_packets (tenant_id, source_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_processed_packets_tenant_source_packet_created ON processed_packets (tenant_id, source_id, packet_created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_processed_packets_tenant_source_packet_created;
+DROP INDEX IF EXISTS idx_processed_packets_tenant_source_created;
+CREATE INDEX IF NOT EXISTS idx_processed_packets_source_packet_created ON processed_packets (source_id, packet_created_at);
+CREATE INDEX IF NOT EXISTS idx_processed_packets_source_created ON processed_packets (source_id, created_at);
@@ -17,10 +17,10 @@ func IsValidUUID(s string) error {
 }
 
 // GenerateRandomPayload генерит рандомные инты
-func GenerateRandomPayload(size int) []int {
-	payload := make([]int, size)
+func GenerateRandomPayload(size int) []int64 {
+	payload := make([]int64, size)
 	for i := 0; i < size; i++ {
-		payload[i] = rand.Intn(100)
+		payload[i] = rand.Int63n(100)
 	}
 	return payload
 }